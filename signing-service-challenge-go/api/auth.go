@@ -0,0 +1,104 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/auth"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/logging"
+)
+
+type apiKeyKey struct{}
+
+// KeyFromContext returns the API key a request was authenticated with, if API keys are required.
+func KeyFromContext(ctx context.Context) (*auth.Key, bool) {
+	key, ok := ctx.Value(apiKeyKey{}).(*auth.Key)
+	return key, ok
+}
+
+// authorize requires an API key with the given scope for a handler, see authorizeMethods.
+func (s *Server) authorize(scope auth.Scope, handler http.HandlerFunc) http.Handler {
+	return s.authorizeMethods(scope, scope, handler)
+}
+
+// authorizeMethods requires an API key for a handler, with the read scope for GET and HEAD requests
+// and the write scope for all others. If the route has an id path value, the key must also allow
+// the device with this ID. Without an auth service, all requests are let through. Authorized requests
+// are subject to the rate limit of their client.
+func (s *Server) authorizeMethods(read auth.Scope, write auth.Scope, handlerFunc http.HandlerFunc) http.Handler {
+	handler := s.limitClient(handlerFunc)
+	if s.authService == nil {
+		return handler
+	}
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		token := request.Header.Get("X-API-Key")
+		if bearer, ok := strings.CutPrefix(request.Header.Get("Authorization"), "Bearer "); ok {
+			token = strings.TrimSpace(bearer)
+		}
+		if token == "" {
+			writeUnauthorized(response, "API key required")
+			return
+		}
+		key, err := s.authService.Authenticate(token)
+		if err != nil {
+			if errors.Is(err, auth.ErrInvalidKey) {
+				writeUnauthorized(response, err.Error())
+			} else {
+				WriteInternalError(response, request, err)
+			}
+			return
+		}
+		logging.Add(request.Context(), slog.String("api_key_id", key.ID), slog.String("organization_id", key.OrganizationID))
+		scope := write
+		if request.Method == http.MethodGet || request.Method == http.MethodHead {
+			scope = read
+		}
+		if !key.HasScope(scope) {
+			WriteErrorResponse(response, http.StatusForbidden, []string{
+				fmt.Sprintf("API key lacks scope %s", scope),
+			})
+			return
+		}
+		if id := request.PathValue("id"); id != "" && !key.AllowsDevice(id) {
+			writeDeviceForbidden(response, id)
+			return
+		}
+		// A client certificate must not let its holder act for another organization with a leaked API key.
+		if identity, ok := IdentityFromContext(request.Context()); ok && s.organizationService != nil && !identity.allowsOrganization(key.OrganizationID) {
+			WriteErrorResponse(response, http.StatusForbidden, []string{
+				fmt.Sprintf("Client certificate %s is not issued for organization %s", identity.Name, key.OrganizationID),
+			})
+			return
+		}
+		scoped, err := s.withOrganization(request.WithContext(context.WithValue(request.Context(), apiKeyKey{}, key)), key.OrganizationID)
+		if err != nil {
+			WriteInternalError(response, request, err)
+			return
+		}
+		handler.ServeHTTP(response, scoped)
+	})
+}
+
+// allowsDevice reports whether the API key of a request may access the device with the given ID,
+// for devices that are not addressed by the path.
+func allowsDevice(request *http.Request, id string) bool {
+	key, ok := KeyFromContext(request.Context())
+	return !ok || key.AllowsDevice(id)
+}
+
+func writeUnauthorized(response http.ResponseWriter, message string) {
+	response.Header().Set("WWW-Authenticate", `Bearer realm="signing-service"`)
+	WriteErrorResponse(response, http.StatusUnauthorized, []string{
+		message,
+	})
+}
+
+func writeDeviceForbidden(response http.ResponseWriter, id string) {
+	WriteErrorResponse(response, http.StatusForbidden, []string{
+		fmt.Sprintf("API key is not allowed to access device %s", id),
+	})
+}
@@ -0,0 +1,148 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/auth"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+)
+
+func TestServer_Authentication(t *testing.T) {
+	ts := serveTenants(t)
+	_, token := ts.key(t, types.DefaultOrganizationID, []auth.Scope{auth.ScopeDevicesRead})
+
+	response, content := call(t, ts.server, http.MethodGet, "/api/v0/devices", "", nil)
+	expectStatus(t, response, content, http.StatusUnauthorized)
+	if response.Header.Get("WWW-Authenticate") == "" {
+		t.Fatal("expected a WWW-Authenticate header")
+	}
+	response, content = call(t, ts.server, http.MethodGet, "/api/v0/devices", token+"x", nil)
+	expectStatus(t, response, content, http.StatusUnauthorized)
+	response, content = call(t, ts.server, http.MethodGet, "/api/v0/devices", token, nil)
+	expectStatus(t, response, content, http.StatusOK)
+
+	// the key may also be sent in the X-API-Key header
+	request, err := http.NewRequest(http.MethodGet, ts.server.URL+"/api/v0/devices", nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	request.Header.Set("X-API-Key", token)
+	if response, err = ts.server.Client().Do(request); err != nil {
+		t.Fatalf("failed to send request: %v", err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, response.StatusCode)
+	}
+
+	// probes need no key
+	response, content = call(t, ts.server, http.MethodGet, "/api/v0/health/live", "", nil)
+	expectStatus(t, response, content, http.StatusOK)
+}
+
+func TestServer_Scopes(t *testing.T) {
+	ts := serveTenants(t)
+	_, creator := ts.key(t, types.DefaultOrganizationID, []auth.Scope{auth.ScopeDevicesCreate})
+	_, reader := ts.key(t, types.DefaultOrganizationID, []auth.Scope{auth.ScopeDevicesRead})
+	_, signer := ts.key(t, types.DefaultOrganizationID, []auth.Scope{auth.ScopeSign})
+	id := ts.device(t, creator)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   any
+		status int
+	}{
+		{"Create Without Scope", http.MethodPost, "/api/v0/create-signature-device", reader, CreateSignatureDeviceRequest{Algorithm: "ECC"}, http.StatusForbidden},
+		{"Read", http.MethodGet, "/api/v0/devices", reader, nil, http.StatusOK},
+		{"Read Without Scope", http.MethodGet, "/api/v0/devices", signer, nil, http.StatusForbidden},
+		{"Sign", http.MethodPost, "/api/v0/sign-transaction", signer, SignTransactionRequest{DeviceID: id, DataToBeSigned: "data"}, http.StatusCreated},
+		{"Sign Without Scope", http.MethodPost, "/api/v0/sign-transaction", reader, SignTransactionRequest{DeviceID: id, DataToBeSigned: "data"}, http.StatusForbidden},
+		{"Read Signatures", http.MethodGet, "/api/v0/device-signs/" + id, reader, nil, http.StatusOK},
+		{"Attach Certificate Without Scope", http.MethodPut, "/api/v0/devices/" + id + "/certificate", reader, AttachCertificateRequest{}, http.StatusForbidden},
+		{"Manage Keys Without Scope", http.MethodGet, "/api/v0/admin/keys", creator, nil, http.StatusForbidden},
+		{"Export Without Scope", http.MethodGet, "/api/v0/export", reader, nil, http.StatusForbidden},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response, content := call(t, ts.server, test.method, test.path, test.token, test.body)
+			expectStatus(t, response, content, test.status)
+		})
+	}
+}
+
+func TestServer_DeviceRestriction(t *testing.T) {
+	ts := serveTenants(t)
+	_, creator := ts.key(t, types.DefaultOrganizationID, []auth.Scope{auth.ScopeDevicesCreate})
+	allowed, other := ts.device(t, creator), ts.device(t, creator)
+	_, token := ts.key(t, types.DefaultOrganizationID, []auth.Scope{auth.ScopeSign, auth.ScopeDevicesRead}, allowed)
+
+	response, content := sign(t, ts.server, token, allowed)
+	expectStatus(t, response, content, http.StatusCreated)
+	response, content = sign(t, ts.server, token, other)
+	expectStatus(t, response, content, http.StatusForbidden)
+	response, content = call(t, ts.server, http.MethodGet, "/api/v0/device-signs/"+other, token, nil)
+	expectStatus(t, response, content, http.StatusForbidden)
+
+	// other devices are left out of the list
+	response, content = call(t, ts.server, http.MethodGet, "/api/v0/devices", token, nil)
+	expectStatus(t, response, content, http.StatusOK)
+	var listed []DeviceResponse
+	decode(t, content, &listed)
+	if len(listed) != 1 || listed[0].ID != allowed {
+		t.Fatalf("expected only device %s, got %+v", allowed, listed)
+	}
+}
+
+func TestServer_RevokedKey(t *testing.T) {
+	ts := serveTenants(t)
+	_, admin := ts.key(t, types.DefaultOrganizationID, []auth.Scope{auth.ScopeAdmin})
+	key, token := ts.key(t, types.DefaultOrganizationID, []auth.Scope{auth.ScopeDevicesRead})
+
+	response, content := call(t, ts.server, http.MethodGet, "/api/v0/devices", token, nil)
+	expectStatus(t, response, content, http.StatusOK)
+	response, content = call(t, ts.server, http.MethodDelete, "/api/v0/admin/keys/"+key.ID, admin, nil)
+	expectStatus(t, response, content, http.StatusOK)
+	response, content = call(t, ts.server, http.MethodGet, "/api/v0/devices", token, nil)
+	expectStatus(t, response, content, http.StatusUnauthorized)
+}
+
+func TestServer_ClientCertificate(t *testing.T) {
+	ts := serveTenants(t)
+	ts.organization(t, "store-a")
+	_, token := ts.key(t, "store-a", []auth.Scope{auth.ScopeDevicesRead})
+	handler := ts.s.handler()
+
+	tests := []struct {
+		name          string
+		organizations []string
+		status        int
+	}{
+		{"Organization Of Key", []string{"store-a"}, http.StatusOK},
+		{"Several Organizations", []string{"store-b", "store-a"}, http.StatusOK},
+		{"Other Organization", []string{types.DefaultOrganizationID}, http.StatusForbidden},
+		{"No Organization", nil, http.StatusForbidden},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/api/v0/devices", nil)
+			request.Header.Set("Authorization", "Bearer "+token)
+			// as verified by the TLS server
+			request.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{
+				Subject: pkix.Name{CommonName: "till-1", Organization: test.organizations},
+			}}}}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+			if recorder.Code != test.status {
+				t.Fatalf("expected status %d, got %d: %s", test.status, recorder.Code, recorder.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/backup"
+)
+
+// DefaultMaxBackupSize is the default size limit of backups accepted for restoring.
+const DefaultMaxBackupSize = 1 << 30
+
+// Backup streams a signed archive of all devices, their keys and signatures.
+func (s *Server) Backup(response http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		WriteErrorResponse(response, http.StatusMethodNotAllowed, []string{
+			http.StatusText(http.StatusMethodNotAllowed),
+		})
+		return
+	}
+	filename := fmt.Sprintf("backup-%s.tar.gz", time.Now().UTC().Format("20060102T150405Z"))
+	response.Header().Set("Content-Type", "application/gzip")
+	response.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	// The status is sent with the first bytes of the archive, so a failure can only abort the response.
+	if err := s.backupService.Backup(response); err != nil {
+		slog.ErrorContext(request.Context(), "Backup failed", "error", err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// Restore verifies the archive in the request body and restores its devices and signatures. The database
+// must be empty, unless the query parameter merge is true.
+func (s *Server) Restore(response http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		WriteErrorResponse(response, http.StatusMethodNotAllowed, []string{
+			http.StatusText(http.StatusMethodNotAllowed),
+		})
+		return
+	}
+	merge, err := parseMerge(request.URL.Query().Get("merge"))
+	if err != nil {
+		WriteErrorResponse(response, http.StatusBadRequest, []string{
+			err.Error(),
+		})
+		return
+	}
+	summary, err := s.backupService.Restore(http.MaxBytesReader(response, request.Body, s.maxBackupSize), merge)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.As(err, &tooLarge):
+			WriteErrorResponse(response, http.StatusRequestEntityTooLarge, []string{
+				fmt.Sprintf("Backup exceeds %d bytes", tooLarge.Limit),
+			})
+		case errors.Is(err, backup.ErrInvalidBackup) || errors.Is(err, backup.ErrUnsupportedVersion):
+			WriteErrorResponse(response, http.StatusBadRequest, []string{
+				err.Error(),
+			})
+		case errors.Is(err, backup.ErrCounterRollback) || errors.Is(err, backup.ErrChainMismatch) || errors.Is(err, backup.ErrNotEmpty):
+			WriteErrorResponse(response, http.StatusConflict, []string{
+				err.Error(),
+			})
+		default:
+			WriteInternalError(response, request, err)
+		}
+		return
+	}
+	WriteAPIResponse(response, http.StatusOK, summary)
+}
+
+// parseMerge parses the merge query parameter of a restore, which defaults to false.
+func parseMerge(value string) (bool, error) {
+	if value == "" {
+		return false, nil
+	}
+	merge, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid merge: %q is not a boolean", value)
+	}
+	return merge, nil
+}
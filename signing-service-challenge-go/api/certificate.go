@@ -0,0 +1,190 @@
+package api
+
+import (
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+)
+
+type DeviceCertificateResponse struct {
+	Certificate string `json:"certificate"`
+}
+
+type CertificateChainResponse struct {
+	Certificates []string `json:"certificates"`
+}
+
+type CSRResponse struct {
+	CSR string `json:"csr"`
+}
+
+// DeviceCertificate retrieves (GET) or attaches (PUT) the certificate of a signature device.
+func (s *Server) DeviceCertificate(response http.ResponseWriter, request *http.Request) {
+	switch request.Method {
+	case http.MethodGet:
+		s.getDeviceCertificate(response, request)
+	case http.MethodPut:
+		s.attachDeviceCertificate(response, request)
+	default:
+		WriteErrorResponse(response, http.StatusMethodNotAllowed, []string{
+			http.StatusText(http.StatusMethodNotAllowed),
+		})
+	}
+}
+
+// getDeviceCertificate writes the PEM encoded certificate of a signature device.
+func (s *Server) getDeviceCertificate(response http.ResponseWriter, request *http.Request) {
+	certificate, err := s.devices(request).GetDeviceCertificate(request.Context(), request.PathValue("id"))
+	if err != nil {
+		if errors.Is(err, types.ErrDeviceNotFound) || errors.Is(err, types.ErrCertificateNotFound) {
+			WriteErrorResponse(response, http.StatusNotFound, []string{
+				err.Error(),
+			})
+		} else {
+			WriteInternalError(response, request, err)
+		}
+		return
+	}
+	WriteAPIResponse(response, http.StatusOK, DeviceCertificateResponse{
+		Certificate: encodeCertificate(certificate),
+	})
+}
+
+// attachDeviceCertificate stores a PEM encoded certificate issued for the key of a signature device.
+func (s *Server) attachDeviceCertificate(response http.ResponseWriter, request *http.Request) {
+	body, err := io.ReadAll(request.Body)
+	if err != nil {
+		WriteErrorResponse(response, http.StatusBadRequest, []string{
+			fmt.Sprintf("Failed to read request body: %s", err.Error()),
+		})
+		return
+	}
+	unmarshalled := AttachCertificateRequest{}
+	if err = json.Unmarshal(body, &unmarshalled); err != nil {
+		WriteErrorResponse(response, http.StatusBadRequest, []string{
+			fmt.Sprintf("Incorrect request format: %s", err.Error()),
+		})
+		return
+	}
+	block, _ := pem.Decode([]byte(unmarshalled.Certificate))
+	if block == nil || block.Type != "CERTIFICATE" {
+		WriteErrorResponse(response, http.StatusBadRequest, []string{
+			"Certificate must be PEM encoded",
+		})
+		return
+	}
+	if err = s.devices(request).AttachCertificate(request.Context(), request.PathValue("id"), block.Bytes); err != nil {
+		if errors.Is(err, types.ErrDeviceNotFound) {
+			WriteErrorResponse(response, http.StatusNotFound, []string{
+				err.Error(),
+			})
+		} else if errors.Is(err, types.ErrInvalidCertificate) {
+			WriteErrorResponse(response, http.StatusBadRequest, []string{
+				err.Error(),
+			})
+		} else {
+			WriteInternalError(response, request, err)
+		}
+		return
+	}
+	WriteAPIResponse(response, http.StatusOK, DeviceCertificateResponse{
+		Certificate: encodeCertificate(block.Bytes),
+	})
+}
+
+// DeviceCSR writes a PEM encoded certificate signing request for the key of a signature device.
+func (s *Server) DeviceCSR(response http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		WriteErrorResponse(response, http.StatusMethodNotAllowed, []string{
+			http.StatusText(http.StatusMethodNotAllowed),
+		})
+		return
+	}
+	body, err := io.ReadAll(request.Body)
+	if err != nil {
+		WriteErrorResponse(response, http.StatusBadRequest, []string{
+			fmt.Sprintf("Failed to read request body: %s", err.Error()),
+		})
+		return
+	}
+	unmarshalled := CreateCSRRequest{}
+	// The subject is optional, an empty body requests the default subject.
+	if len(body) > 0 {
+		if err = json.Unmarshal(body, &unmarshalled); err != nil {
+			WriteErrorResponse(response, http.StatusBadRequest, []string{
+				fmt.Sprintf("Incorrect request format: %s", err.Error()),
+			})
+			return
+		}
+	}
+	csr, err := s.devices(request).CreateCertificateRequest(request.Context(), request.PathValue("id"), pkix.Name{
+		CommonName:         unmarshalled.CommonName,
+		SerialNumber:       unmarshalled.SerialNumber,
+		Organization:       optional(unmarshalled.Organization),
+		OrganizationalUnit: optional(unmarshalled.OrganizationalUnit),
+		Country:            optional(unmarshalled.Country),
+		Province:           optional(unmarshalled.Province),
+		Locality:           optional(unmarshalled.Locality),
+		StreetAddress:      optional(unmarshalled.StreetAddress),
+		PostalCode:         optional(unmarshalled.PostalCode),
+	})
+	if err != nil {
+		if errors.Is(err, types.ErrDeviceNotFound) {
+			WriteErrorResponse(response, http.StatusNotFound, []string{
+				err.Error(),
+			})
+		} else {
+			WriteInternalError(response, request, err)
+		}
+		return
+	}
+	WriteAPIResponse(response, http.StatusCreated, CSRResponse{
+		CSR: string(csr),
+	})
+}
+
+// CertificateAuthority writes the PEM encoded certificate chain of the CA issuing device certificates.
+func (s *Server) CertificateAuthority(response http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		WriteErrorResponse(response, http.StatusMethodNotAllowed, []string{
+			http.StatusText(http.StatusMethodNotAllowed),
+		})
+		return
+	}
+	chain, err := s.devices(request).GetCAChain()
+	if err != nil {
+		if errors.Is(err, types.ErrNoCertificateAuthority) {
+			WriteErrorResponse(response, http.StatusNotFound, []string{
+				err.Error(),
+			})
+		} else {
+			WriteInternalError(response, request, err)
+		}
+		return
+	}
+	certificates := make([]string, len(chain))
+	for i, certificate := range chain {
+		certificates[i] = encodeCertificate(certificate)
+	}
+	WriteAPIResponse(response, http.StatusOK, CertificateChainResponse{
+		Certificates: certificates,
+	})
+}
+
+func encodeCertificate(der []byte) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+// optional maps an empty subject attribute to no attribute at all.
+func optional(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return []string{value}
+}
@@ -1,16 +1,57 @@
 package api
 
 import (
+	"crypto/x509"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"fmt"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/logging"
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
 	"io"
+	"log/slog"
 	"net/http"
+	"slices"
+	"time"
 )
 
 // TODO: REST endpoints ...
 
+// DeviceResponse describes a signature device by its public key. The private key never leaves the service.
+type DeviceResponse struct {
+	ID        string                 `json:"id"`
+	Label     string                 `json:"label"`
+	Algorithm types.SigningAlgorithm `json:"algorithm"`
+	Counter   uint32                 `json:"counter"`
+	// PublicKey is the PEM encoded public key of the device.
+	PublicKey string `json:"public_key"`
+	// Certificate is the PEM encoded certificate of the device, if one was issued or attached.
+	Certificate string `json:"certificate,omitempty"`
+}
+
+func newDeviceResponse(device *types.SignatureDevice) (DeviceResponse, error) {
+	signer, err := crypto.NewSigner(device.Algorithm, device.PkPem)
+	if err != nil {
+		return DeviceResponse{}, fmt.Errorf("failed to read the key of device %s: %w", device.ID, err)
+	}
+	publicKey, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		return DeviceResponse{}, fmt.Errorf("failed to encode public key: %w", err)
+	}
+	described := DeviceResponse{
+		ID:        device.ID,
+		Label:     device.Label,
+		Algorithm: device.Algorithm,
+		Counter:   device.Counter,
+		PublicKey: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey})),
+	}
+	if len(device.Certificate) > 0 {
+		described.Certificate = encodeCertificate(device.Certificate)
+	}
+	return described, nil
+}
+
 func (s *Server) CreateSignatureDevice(response http.ResponseWriter, request *http.Request) {
 	if request.Method != http.MethodPost {
 		WriteErrorResponse(response, http.StatusMethodNotAllowed, []string{
@@ -32,7 +73,7 @@ func (s *Server) CreateSignatureDevice(response http.ResponseWriter, request *ht
 		})
 		return
 	}
-	device, err := s.deviceService.Create(types.NewSignatureDevice{
+	device, err := s.devices(request).Create(request.Context(), types.NewSignatureDevice{
 		Algorithm: unmarshalled.Algorithm,
 		Label:     unmarshalled.Label,
 	})
@@ -45,17 +86,32 @@ func (s *Server) CreateSignatureDevice(response http.ResponseWriter, request *ht
 			WriteErrorResponse(response, http.StatusConflict, []string{
 				err.Error(),
 			})
+		} else if errors.Is(err, types.ErrDeviceQuotaExceeded) {
+			WriteErrorResponse(response, http.StatusForbidden, []string{
+				err.Error(),
+			})
 		} else {
-			WriteInternalError(response, request.URL.Path, err)
+			WriteInternalError(response, request, err)
 		}
 		return
 	}
-	WriteAPIResponse(response, http.StatusCreated, device)
+	logging.Add(request.Context(), slog.String("device_id", device.ID), slog.String("algorithm", string(device.Algorithm)))
+	created, err := newDeviceResponse(device)
+	if err != nil {
+		WriteInternalError(response, request, err)
+		return
+	}
+	WriteAPIResponse(response, http.StatusCreated, created)
 }
 
 type SignTransactionResponse struct {
-	Signature  []byte `json:"signature"`
-	SignedData []byte `json:"signed_data"`
+	Signature      []byte    `json:"signature"`
+	SignedData     []byte    `json:"signed_data"`
+	Timestamp      time.Time `json:"timestamp"`
+	TimestampToken []byte    `json:"timestamp_token,omitempty"`
+	Format         string    `json:"format"`
+	JWS            string    `json:"jws,omitempty"`
+	COSE           []byte    `json:"cose,omitempty"`
 }
 
 func (s *Server) SignTransaction(response http.ResponseWriter, request *http.Request) {
@@ -79,22 +135,58 @@ func (s *Server) SignTransaction(response http.ResponseWriter, request *http.Req
 		})
 		return
 	}
-	signature, signedData, err := s.deviceService.SignUsingDevice(unmarshalled.DeviceID, []byte(unmarshalled.DataToBeSigned))
+	if !allowsDevice(request, unmarshalled.DeviceID) {
+		writeDeviceForbidden(response, unmarshalled.DeviceID)
+		return
+	}
+	logging.Add(request.Context(), slog.String("device_id", unmarshalled.DeviceID))
+	cancel, ok := s.reserveSignature(response, request, unmarshalled.DeviceID)
+	if !ok {
+		return
+	}
+	signature, err := s.devices(request).SignUsingDevice(request.Context(), unmarshalled.DeviceID, []byte(unmarshalled.DataToBeSigned), types.SignatureFormat(unmarshalled.Format))
 	if err != nil {
+		cancel()
 		if errors.Is(err, types.ErrDeviceNotFound) {
 			WriteErrorResponse(response, http.StatusNotFound, []string{
 				err.Error(),
 			})
 
+		} else if errors.Is(err, types.ErrUnknownSignatureFormat) {
+			WriteErrorResponse(response, http.StatusBadRequest, []string{
+				err.Error(),
+			})
+		} else if errors.Is(err, types.ErrSignatureFormatUnsupportedByKey) {
+			WriteErrorResponse(response, http.StatusUnprocessableEntity, []string{
+				err.Error(),
+			})
+		} else if errors.Is(err, types.ErrSignatureCounterConflict) {
+			WriteErrorResponse(response, http.StatusConflict, []string{
+				err.Error(),
+			})
+		} else if errors.Is(err, types.ErrClockMovedBackwards) || errors.Is(err, types.ErrTimestampUnavailable) {
+			WriteErrorResponse(response, http.StatusServiceUnavailable, []string{
+				err.Error(),
+			})
 		} else {
-			WriteInternalError(response, request.URL.Path, err)
+			WriteInternalError(response, request, err)
 		}
 		return
 	}
-	WriteAPIResponse(response, http.StatusCreated, SignTransactionResponse{
-		Signature:  signature,
-		SignedData: signedData,
-	})
+	logging.Add(request.Context(), slog.Uint64("counter", uint64(signature.Counter)), slog.String("format", string(signature.Format)))
+	signed := SignTransactionResponse{
+		Signature:      signature.Value,
+		SignedData:     signature.SignedData,
+		Timestamp:      signature.Timestamp,
+		TimestampToken: signature.TimestampToken,
+		Format:         string(signature.Format),
+	}
+	if signature.Format == types.FormatJWS || signature.Format == types.FormatJWSDetached {
+		signed.JWS = string(signature.Envelope)
+	} else if signature.Format == types.FormatCOSE {
+		signed.COSE = signature.Envelope
+	}
+	WriteAPIResponse(response, http.StatusCreated, signed)
 }
 
 func (s *Server) Devices(response http.ResponseWriter, request *http.Request) {
@@ -104,8 +196,26 @@ func (s *Server) Devices(response http.ResponseWriter, request *http.Request) {
 		})
 		return
 	}
-	all := s.deviceService.GetAll()
-	WriteAPIResponse(response, http.StatusOK, all)
+	all, err := s.devices(request).GetAll(request.Context())
+	if err != nil {
+		WriteInternalError(response, request, err)
+		return
+	}
+	if key, ok := KeyFromContext(request.Context()); ok && key.Restricted() {
+		all = slices.DeleteFunc(all, func(device *types.SignatureDevice) bool {
+			return !key.AllowsDevice(device.ID)
+		})
+	}
+	listed := make([]DeviceResponse, 0, len(all))
+	for _, device := range all {
+		described, err := newDeviceResponse(device)
+		if err != nil {
+			WriteInternalError(response, request, err)
+			return
+		}
+		listed = append(listed, described)
+	}
+	WriteAPIResponse(response, http.StatusOK, listed)
 }
 
 func (s *Server) DeviceSignatures(response http.ResponseWriter, request *http.Request) {
@@ -115,14 +225,14 @@ func (s *Server) DeviceSignatures(response http.ResponseWriter, request *http.Re
 		})
 		return
 	}
-	signatures, err := s.deviceService.GetDeviceSignatures(request.PathValue("id"))
+	signatures, err := s.devices(request).GetDeviceSignatures(request.Context(), request.PathValue("id"))
 	if err != nil {
 		if errors.Is(err, types.ErrDeviceNotFound) {
 			WriteErrorResponse(response, http.StatusNotFound, []string{
 				err.Error(),
 			})
 		} else {
-			WriteInternalError(response, request.URL.Path, err)
+			WriteInternalError(response, request, err)
 		}
 		return
 	}
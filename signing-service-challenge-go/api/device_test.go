@@ -0,0 +1,48 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+)
+
+func TestServer_DeviceResponse(t *testing.T) {
+	_, server := serve(t, newDeviceService())
+
+	for _, algorithm := range []types.SigningAlgorithm{types.ECC, types.RSA, types.Ed25519} {
+		response, content := call(t, server, http.MethodPost, "/api/v0/create-signature-device", "",
+			CreateSignatureDeviceRequest{Algorithm: string(algorithm), Label: "till"})
+		expectStatus(t, response, content, http.StatusCreated)
+		expectNoPrivateKey(t, content)
+		var created DeviceResponse
+		decode(t, content, &created)
+		if created.ID == "" || created.Algorithm != algorithm || created.Label != "till" {
+			t.Fatalf("expected the created device, got %+v", created)
+		}
+		if _, err := crypto.ParsePublicKey([]byte(created.PublicKey)); err != nil {
+			t.Fatalf("expected a public key, got %v", err)
+		}
+	}
+
+	response, content := call(t, server, http.MethodGet, "/api/v0/devices", "", nil)
+	expectStatus(t, response, content, http.StatusOK)
+	expectNoPrivateKey(t, content)
+	var listed []DeviceResponse
+	decode(t, content, &listed)
+	if len(listed) != 3 {
+		t.Fatalf("expected 3 devices, got %d", len(listed))
+	}
+}
+
+// expectNoPrivateKey checks that a response carries no private key in any encoding.
+func expectNoPrivateKey(t *testing.T, content []byte) {
+	t.Helper()
+	// []byte fields are base64 encoded, "LS0tLS1CRUdJT" is the encoding of a PEM header
+	if bytes.Contains(content, []byte("PkPem")) || bytes.Contains(content, []byte("PRIVATE")) ||
+		bytes.Contains(content, []byte("LS0tLS1CRUdJT")) {
+		t.Fatalf("expected no private key in the response, got %s", content)
+	}
+}
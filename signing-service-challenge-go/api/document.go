@@ -0,0 +1,87 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/logging"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+)
+
+// DefaultMaxDocumentSize is the default size limit of documents accepted for signing.
+const DefaultMaxDocumentSize = 32 << 20
+
+type SignDocumentResponse struct {
+	Signature      []byte    `json:"signature"`
+	SignedData     []byte    `json:"signed_data"`
+	Timestamp      time.Time `json:"timestamp"`
+	TimestampToken []byte    `json:"timestamp_token,omitempty"`
+	// CMS is the DER encoded detached CMS SignedData over the document.
+	CMS []byte `json:"cms"`
+}
+
+// SignDocument signs the request body as document with a signature device.
+func (s *Server) SignDocument(response http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		WriteErrorResponse(response, http.StatusMethodNotAllowed, []string{
+			http.StatusText(http.StatusMethodNotAllowed),
+		})
+		return
+	}
+	document, err := io.ReadAll(http.MaxBytesReader(response, request.Body, s.maxDocumentSize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			WriteErrorResponse(response, http.StatusRequestEntityTooLarge, []string{
+				fmt.Sprintf("Document exceeds %d bytes", tooLarge.Limit),
+			})
+			return
+		}
+		WriteErrorResponse(response, http.StatusBadRequest, []string{
+			fmt.Sprintf("Failed to read request body: %s", err.Error()),
+		})
+		return
+	}
+	if len(document) == 0 {
+		WriteErrorResponse(response, http.StatusBadRequest, []string{
+			"Document must not be empty",
+		})
+		return
+	}
+	cancel, ok := s.reserveSignature(response, request, request.PathValue("id"))
+	if !ok {
+		return
+	}
+	signature, err := s.devices(request).SignDocument(request.Context(), request.PathValue("id"), document)
+	if err != nil {
+		cancel()
+		if errors.Is(err, types.ErrDeviceNotFound) {
+			WriteErrorResponse(response, http.StatusNotFound, []string{
+				err.Error(),
+			})
+		} else if errors.Is(err, types.ErrSignatureCounterConflict) {
+			WriteErrorResponse(response, http.StatusConflict, []string{
+				err.Error(),
+			})
+		} else if errors.Is(err, types.ErrClockMovedBackwards) || errors.Is(err, types.ErrTimestampUnavailable) {
+			WriteErrorResponse(response, http.StatusServiceUnavailable, []string{
+				err.Error(),
+			})
+		} else {
+			WriteInternalError(response, request, err)
+		}
+		return
+	}
+	logging.Add(request.Context(), slog.Uint64("counter", uint64(signature.Counter)))
+	WriteAPIResponse(response, http.StatusCreated, SignDocumentResponse{
+		Signature:      signature.Value,
+		SignedData:     signature.SignedData,
+		Timestamp:      signature.Timestamp,
+		TimestampToken: signature.TimestampToken,
+		CMS:            signature.Envelope,
+	})
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultDrainTimeout is the default time in-flight writes are given to complete on shutdown.
+	DefaultDrainTimeout = 15 * time.Second
+	// DefaultShutdownTimeout is the default time the remaining requests are given to complete after draining.
+	DefaultShutdownTimeout = 15 * time.Second
+	// drainRetryAfter is the Retry-After header of writes rejected while draining, in seconds.
+	drainRetryAfter = "5"
+)
+
+// drainer tracks the in-flight writes, which create devices, sign or restore, so that they complete
+// and are persisted before the server shuts down. Once draining, new writes are rejected.
+type drainer struct {
+	lock     sync.Mutex
+	draining bool
+	inFlight int
+	idle     chan struct{}
+}
+
+func newDrainer() *drainer {
+	return &drainer{idle: make(chan struct{})}
+}
+
+// enter registers a write, unless the drainer is draining.
+func (d *drainer) enter() bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.draining {
+		return false
+	}
+	d.inFlight++
+	return true
+}
+
+// leave deregisters a write registered by enter.
+func (d *drainer) leave() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.inFlight--
+	if d.draining && d.inFlight == 0 {
+		close(d.idle)
+	}
+}
+
+// drain rejects new writes and waits for the in-flight writes to complete, or for ctx to be done.
+func (d *drainer) drain(ctx context.Context) error {
+	d.lock.Lock()
+	if !d.draining {
+		d.draining = true
+		if d.inFlight == 0 {
+			close(d.idle)
+		}
+	}
+	d.lock.Unlock()
+	select {
+	case <-d.idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// isDraining reports whether the drainer rejects new writes.
+func (d *drainer) isDraining() bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.draining
+}
+
+// writes wraps handler to track every request that may change state, that is every request other than
+// GET, HEAD and OPTIONS, and to reject them with 503 Service Unavailable while draining.
+func (d *drainer) writes(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		switch request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			handler.ServeHTTP(response, request)
+			return
+		}
+		if !d.enter() {
+			response.Header().Set("Retry-After", drainRetryAfter)
+			WriteErrorResponse(response, http.StatusServiceUnavailable, []string{
+				"server is shutting down",
+			})
+			return
+		}
+		defer d.leave()
+		handler.ServeHTTP(response, request)
+	})
+}
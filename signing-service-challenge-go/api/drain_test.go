@@ -0,0 +1,74 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+)
+
+// blockingDevices blocks the creation of devices until released, to keep a write in flight.
+type blockingDevices struct {
+	DeviceService
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingDevices) Create(ctx context.Context, device types.NewSignatureDevice) (*types.SignatureDevice, error) {
+	close(b.started)
+	<-b.release
+	return b.DeviceService.Create(ctx, device)
+}
+
+func TestServer_Drain(t *testing.T) {
+	devices := &blockingDevices{DeviceService: newDeviceService(), started: make(chan struct{}), release: make(chan struct{})}
+	s, server := serve(t, devices)
+	create := CreateSignatureDeviceRequest{Algorithm: string(types.ECC), Label: "drain"}
+
+	inFlight := make(chan int)
+	go func() {
+		response, err := server.Client().Post(server.URL+"/api/v0/create-signature-device", "application/json",
+			strings.NewReader(`{"algorithm": "ECC", "label": "in flight"}`))
+		if err != nil {
+			inFlight <- 0
+			return
+		}
+		response.Body.Close()
+		inFlight <- response.StatusCode
+	}()
+	<-devices.started
+	drained := make(chan error)
+	go func() {
+		drained <- s.drainer.drain(context.Background())
+	}()
+	for !s.drainer.isDraining() {
+		runtime.Gosched()
+	}
+
+	// new writes are rejected while the in-flight write completes, reads are still served
+	response, content := call(t, server, http.MethodPost, "/api/v0/create-signature-device", "", create)
+	expectStatus(t, response, content, http.StatusServiceUnavailable)
+	if retryAfter := response.Header.Get("Retry-After"); retryAfter != drainRetryAfter {
+		t.Fatalf("expected Retry-After %s, got %q", drainRetryAfter, retryAfter)
+	}
+	response, content = call(t, server, http.MethodGet, "/api/v0/devices", "", nil)
+	expectStatus(t, response, content, http.StatusOK)
+	response, content = call(t, server, http.MethodGet, "/api/v0/health/ready", "", nil)
+	expectStatus(t, response, content, http.StatusServiceUnavailable)
+	select {
+	case <-drained:
+		t.Fatal("expected draining to wait for the in-flight write")
+	default:
+	}
+
+	close(devices.release)
+	if status := <-inFlight; status != http.StatusCreated {
+		t.Fatalf("expected the in-flight write to complete with %d, got %d", http.StatusCreated, status)
+	}
+	if err := <-drained; err != nil {
+		t.Fatalf("expected draining to complete, got %v", err)
+	}
+}
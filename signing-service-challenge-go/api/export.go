@@ -0,0 +1,99 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/export"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+)
+
+// ExportDevice streams the signature journal of a device as tar archive. The optional query parameters
+// from and to restrict it to a period, see parsePeriod.
+func (s *Server) ExportDevice(response http.ResponseWriter, request *http.Request) {
+	s.export(response, request, []string{request.PathValue("id")})
+}
+
+// ExportAll streams the signature journals of all devices as tar archive. For an API key restricted
+// to a set of devices, it contains the journals of these devices only.
+func (s *Server) ExportAll(response http.ResponseWriter, request *http.Request) {
+	var deviceIDs []string
+	if key, ok := KeyFromContext(request.Context()); ok && key.Restricted() {
+		deviceIDs = key.DeviceIDs
+	}
+	s.export(response, request, deviceIDs)
+}
+
+func (s *Server) export(response http.ResponseWriter, request *http.Request, deviceIDs []string) {
+	if request.Method != http.MethodGet {
+		WriteErrorResponse(response, http.StatusMethodNotAllowed, []string{
+			http.StatusText(http.StatusMethodNotAllowed),
+		})
+		return
+	}
+	from, to, err := parsePeriod(request.URL.Query().Get("from"), request.URL.Query().Get("to"))
+	if err != nil {
+		WriteErrorResponse(response, http.StatusBadRequest, []string{
+			err.Error(),
+		})
+		return
+	}
+	journal, err := s.exports(request).Export(deviceIDs, from, to)
+	if err != nil {
+		if errors.Is(err, types.ErrDeviceNotFound) {
+			WriteErrorResponse(response, http.StatusNotFound, []string{
+				err.Error(),
+			})
+		} else if errors.Is(err, export.ErrInvalidPeriod) {
+			WriteErrorResponse(response, http.StatusBadRequest, []string{
+				err.Error(),
+			})
+		} else {
+			WriteInternalError(response, request, err)
+		}
+		return
+	}
+	filename := fmt.Sprintf("export-%s.tar", time.Now().UTC().Format("20060102T150405Z"))
+	response.Header().Set("Content-Type", "application/x-tar")
+	response.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	// The status is sent with the first bytes of the archive, so a failure can only abort the response.
+	if _, err = journal.WriteTo(response); err != nil {
+		slog.ErrorContext(request.Context(), "Export failed", "error", err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// parsePeriod parses the bounds of an export period, either RFC 3339 timestamps or dates. The period
+// starts at from and ends before to, except that a date as end includes the whole day.
+func parsePeriod(fromValue, toValue string) (time.Time, time.Time, error) {
+	from, _, err := parseBound(fromValue)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid from: %w", err)
+	}
+	to, date, err := parseBound(toValue)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid to: %w", err)
+	}
+	if date {
+		to = to.AddDate(0, 0, 1)
+	}
+	return from, to, nil
+}
+
+// parseBound parses a timestamp or a date in UTC, and reports whether it was a date.
+func parseBound(value string) (time.Time, bool, error) {
+	if value == "" {
+		return time.Time{}, false, nil
+	}
+	if date, err := time.Parse(time.DateOnly, value); err == nil {
+		return date, true, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}, false, errors.New("expected an RFC 3339 timestamp or a date (YYYY-MM-DD)")
+	}
+	return t, false, nil
+}
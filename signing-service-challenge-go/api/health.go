@@ -1,13 +1,22 @@
 package api
 
-import "net/http"
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/health"
+)
 
 type HealthResponse struct {
 	Status  string `json:"status"`
 	Version string `json:"version"`
 }
 
-// Health evaluates the health of the service and writes a standardized response.
+// Health reports the liveness of the service and its version in the response format of the other endpoints.
+// Probes should use Liveness and Readiness instead.
 func (s *Server) Health(response http.ResponseWriter, request *http.Request) {
 	if request.Method != http.MethodGet {
 		WriteErrorResponse(response, http.StatusMethodNotAllowed, []string{
@@ -16,10 +25,66 @@ func (s *Server) Health(response http.ResponseWriter, request *http.Request) {
 		return
 	}
 
+	live := s.health.Live(request.Context())
 	health := HealthResponse{
-		Status:  "pass",
-		Version: "v0",
+		Status:  string(live.Status),
+		Version: live.Version,
 	}
 
 	WriteAPIResponse(response, http.StatusOK, health)
 }
+
+// Liveness reports whether the service is alive, in the format of the health check RFC draft. It does not
+// check the dependencies of the service, which a restart would not fix.
+func (s *Server) Liveness(response http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		WriteErrorResponse(response, http.StatusMethodNotAllowed, []string{
+			http.StatusText(http.StatusMethodNotAllowed),
+		})
+		return
+	}
+	writeHealthResponse(response, s.health.Live(request.Context()))
+}
+
+// Readiness checks the dependencies of the service, in the format of the health check RFC draft. It fails
+// with 503 Service Unavailable if the service cannot serve requests, e.g. because its storage is unreachable
+// or it is shutting down.
+func (s *Server) Readiness(response http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		WriteErrorResponse(response, http.StatusMethodNotAllowed, []string{
+			http.StatusText(http.StatusMethodNotAllowed),
+		})
+		return
+	}
+	writeHealthResponse(response, s.health.Ready(request.Context()))
+}
+
+// writeHealthResponse writes a health check response, which is not wrapped like the other responses.
+func writeHealthResponse(response http.ResponseWriter, report *health.Response) {
+	bytes, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		slog.Error("Failed to encode the health response", "error", err)
+	}
+	response.Header().Set("Content-Type", health.ContentType)
+	response.Header().Set("Cache-Control", "no-store")
+	response.WriteHeader(report.HTTPStatus())
+	response.Write(bytes)
+}
+
+// drainingCheck fails the readiness of a server once it drains, so that no new requests are routed to it.
+type drainingCheck struct {
+	drainer *drainer
+}
+
+func (drainingCheck) Name() string {
+	return "server:draining"
+}
+
+func (c drainingCheck) Check(context.Context) []health.Result {
+	result := health.Result{ComponentType: "component", Status: health.Pass, Time: time.Now()}
+	if c.drainer.isDraining() {
+		result.Status = health.Fail
+		result.Output = "shutting down"
+	}
+	return []health.Result{result}
+}
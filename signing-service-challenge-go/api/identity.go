@@ -0,0 +1,55 @@
+package api
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+	"slices"
+)
+
+// Identity is a caller authenticated by a client certificate.
+type Identity struct {
+	// Name is the common name of the certificate subject, or the whole subject if it has no common name.
+	Name string
+	// Subject is the distinguished name of the certificate subject.
+	Subject string
+	// Organizations are the organization (O) attributes of the certificate subject. If organizations are
+	// isolated, they are the IDs of the organizations the caller may act for.
+	Organizations []string
+	// Certificate is the verified client certificate.
+	Certificate *x509.Certificate
+}
+
+type identityKey struct{}
+
+// allowsOrganization reports whether the certificate of the caller was issued for the organization with the given ID.
+func (i *Identity) allowsOrganization(organizationID string) bool {
+	return slices.Contains(i.Organizations, organizationID)
+}
+
+// IdentityFromContext returns the identity of the caller of a request, if it presented a verified client certificate.
+func IdentityFromContext(ctx context.Context) (*Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(*Identity)
+	return identity, ok
+}
+
+// withClientIdentity adds the identity of the verified client certificate of a request to its context.
+// Unverified certificates, which are only possible without client authentication, carry no identity.
+func withClientIdentity(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		if request.TLS != nil && len(request.TLS.VerifiedChains) > 0 {
+			certificate := request.TLS.VerifiedChains[0][0]
+			identity := &Identity{
+				Name:          certificate.Subject.CommonName,
+				Subject:       certificate.Subject.String(),
+				Organizations: certificate.Subject.Organization,
+				Certificate:   certificate,
+			}
+			if identity.Name == "" {
+				identity.Name = identity.Subject
+			}
+			request = request.WithContext(context.WithValue(request.Context(), identityKey{}, identity))
+		}
+		handler.ServeHTTP(response, request)
+	})
+}
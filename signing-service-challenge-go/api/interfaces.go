@@ -1,19 +1,100 @@
 package api
 
 import (
+	"context"
+	"crypto/x509/pkix"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/auth"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/backup"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/export"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/ratelimit"
+
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
 )
 
 type DeviceService interface {
 	// Get retrieves a device by its ID.
-	Get(id string) (*types.SignatureDevice, error)
+	Get(ctx context.Context, id string) (*types.SignatureDevice, error)
 	// Create adds a new device to the system.
-	Create(device types.NewSignatureDevice) (*types.SignatureDevice, error)
-	// SignUsingDevice generates a signature for the given data using the specified device ID.
-	// It returns the signature and the signed data.
-	SignUsingDevice(deviceID string, data []byte) ([]byte, []byte, error)
+	Create(ctx context.Context, device types.NewSignatureDevice) (*types.SignatureDevice, error)
+	// SignUsingDevice generates a signature in the given format for the data using the specified device ID.
+	// It returns the signature together with the signed data and its timestamp.
+	SignUsingDevice(ctx context.Context, deviceID string, data []byte, format types.SignatureFormat) (*types.Signature, error)
+	// SignDocument signs a document using the specified device ID and returns the signature
+	// with a detached CMS SignedData over the document as envelope.
+	SignDocument(ctx context.Context, deviceID string, document []byte) (*types.Signature, error)
 	// GetAll retrieves all signature devices.
-	GetAll() []*types.SignatureDevice
+	GetAll(ctx context.Context) ([]*types.SignatureDevice, error)
 	// GetDeviceSignatures retrieves all signatures associated with a signature device by its ID.
-	GetDeviceSignatures(deviceID string) ([][]byte, error)
+	GetDeviceSignatures(ctx context.Context, deviceID string) ([]types.Signature, error)
+	// GetDeviceCertificate retrieves the DER encoded certificate of a signature device by its ID.
+	GetDeviceCertificate(ctx context.Context, deviceID string) ([]byte, error)
+	// CreateCertificateRequest creates a PEM encoded certificate signing request for the key of a signature device.
+	CreateCertificateRequest(ctx context.Context, deviceID string, subject pkix.Name) ([]byte, error)
+	// AttachCertificate stores a DER encoded certificate for the key of a signature device.
+	AttachCertificate(ctx context.Context, deviceID string, certificate []byte) error
+	// GetCAChain retrieves the DER encoded certificate chain of the CA issuing device certificates.
+	GetCAChain() ([][]byte, error)
+}
+
+type BackupService interface {
+	// Backup writes a signed archive of all devices, their keys and signatures to w.
+	Backup(w io.Writer) error
+	// Restore verifies the archive read from r and loads it into the database, which must be empty
+	// unless merge is set.
+	Restore(r io.Reader, merge bool) (*backup.Summary, error)
+}
+
+type ExportService interface {
+	// Export takes a point-in-time export of the signatures of the given devices, or of all devices
+	// if no ID is given, with a timestamp in [from, to). A zero time leaves the period open.
+	Export(deviceIDs []string, from, to time.Time) (*export.Export, error)
+}
+
+type AuthService interface {
+	// Authenticate returns the active API key of a token, auth.ErrInvalidKey if there is none.
+	Authenticate(token string) (*auth.Key, error)
+	// Create creates an API key of an organization with the given scopes, restricted to the given
+	// devices if any, and returns it together with its token.
+	Create(organizationID string, name string, scopes []auth.Scope, deviceIDs []string) (*auth.Key, string, error)
+	// Get retrieves an API key by its ID, including revoked keys.
+	Get(id string) (*auth.Key, error)
+	// List retrieves all API keys, including revoked ones.
+	List() ([]*auth.Key, error)
+	// Revoke revokes an API key by its ID and returns it.
+	Revoke(id string) (*auth.Key, error)
+}
+
+type OrganizationService interface {
+	// Get retrieves an organization by its ID.
+	Get(id string) (*types.Organization, error)
+	// GetAll retrieves all organizations.
+	GetAll() ([]*types.Organization, error)
+	// Create creates an organization with the given ID, name and device quota, 0 for unlimited devices.
+	Create(id string, name string, maxDevices int) (*types.Organization, error)
+	// Update changes the name and device quota of an organization.
+	Update(id string, name string, maxDevices int) (*types.Organization, error)
+}
+
+// OrganizationScope returns the services restricted to the devices of an organization.
+type OrganizationScope func(organization *types.Organization) (DeviceService, ExportService)
+
+type RateLimiter interface {
+	// AllowClient takes a request of the client with the given identity from its rate limit.
+	AllowClient(client string) error
+	// ReserveSignature takes a signature of a device from its rate limit and quotas, the returned
+	// function gives it back if no signature is made.
+	ReserveSignature(deviceID string) (func(), error)
+	// Usage retrieves the number of signatures of a device in the current quota periods.
+	Usage(deviceID string) (*ratelimit.Usage, error)
+}
+
+type Metrics interface {
+	// ObserveRequest records a request to the route with the given pattern.
+	ObserveRequest(route string, method string, status int, duration time.Duration)
+	// Handler serves the metrics to a scraper.
+	Handler() http.Handler
 }
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/auth"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+)
+
+// APIKeyResponse describes an API key. The hash of its token is never returned.
+type APIKeyResponse struct {
+	ID             string       `json:"id"`
+	OrganizationID string       `json:"organization_id"`
+	Name           string       `json:"name"`
+	Scopes         []auth.Scope `json:"scopes"`
+	DeviceIDs      []string     `json:"device_ids"`
+	CreatedAt      time.Time    `json:"created_at"`
+	RevokedAt      *time.Time   `json:"revoked_at,omitempty"`
+}
+
+// CreateAPIKeyResponse describes a new API key together with its token, which is only returned once.
+type CreateAPIKeyResponse struct {
+	APIKeyResponse
+	Token string `json:"token"`
+}
+
+func newAPIKeyResponse(key *auth.Key) APIKeyResponse {
+	return APIKeyResponse{
+		ID:             key.ID,
+		OrganizationID: key.OrganizationID,
+		Name:           key.Name,
+		Scopes:         key.Scopes,
+		DeviceIDs:      key.DeviceIDs,
+		CreatedAt:      key.CreatedAt,
+		RevokedAt:      key.RevokedAt,
+	}
+}
+
+// managesKeysOf reports whether the caller of a request may manage the API keys of the given organization,
+// which administrators of the default organization may do for all organizations.
+func managesKeysOf(request *http.Request, organizationID string) bool {
+	organization, ok := OrganizationFromContext(request.Context())
+	return isOperator(request) || (ok && organization.ID == organizationID)
+}
+
+// APIKeys lists (GET) or creates (POST) API keys. Administrators only see and create keys of their
+// own organization, except for administrators of the default organization.
+func (s *Server) APIKeys(response http.ResponseWriter, request *http.Request) {
+	switch request.Method {
+	case http.MethodGet:
+		s.listAPIKeys(response, request)
+	case http.MethodPost:
+		s.createAPIKey(response, request)
+	default:
+		WriteErrorResponse(response, http.StatusMethodNotAllowed, []string{
+			http.StatusText(http.StatusMethodNotAllowed),
+		})
+	}
+}
+
+func (s *Server) listAPIKeys(response http.ResponseWriter, request *http.Request) {
+	keys, err := s.authService.List()
+	if err != nil {
+		WriteInternalError(response, request, err)
+		return
+	}
+	listed := make([]APIKeyResponse, 0, len(keys))
+	for _, key := range keys {
+		if managesKeysOf(request, key.OrganizationID) {
+			listed = append(listed, newAPIKeyResponse(key))
+		}
+	}
+	WriteAPIResponse(response, http.StatusOK, listed)
+}
+
+func (s *Server) createAPIKey(response http.ResponseWriter, request *http.Request) {
+	body, err := io.ReadAll(request.Body)
+	if err != nil {
+		WriteErrorResponse(response, http.StatusBadRequest, []string{
+			fmt.Sprintf("Failed to read request body: %s", err.Error()),
+		})
+		return
+	}
+	unmarshalled := CreateAPIKeyRequest{}
+	if err = json.Unmarshal(body, &unmarshalled); err != nil {
+		WriteErrorResponse(response, http.StatusBadRequest, []string{
+			fmt.Sprintf("Incorrect request format: %s", err.Error()),
+		})
+		return
+	}
+	organizationID := unmarshalled.OrganizationID
+	if organization, ok := OrganizationFromContext(request.Context()); ok && organizationID == "" {
+		organizationID = organization.ID
+	}
+	if organizationID != "" && !managesKeysOf(request, organizationID) {
+		WriteErrorResponse(response, http.StatusForbidden, []string{
+			fmt.Sprintf("Not allowed to create API keys of organization %s", organizationID),
+		})
+		return
+	}
+	if organizationID != "" && s.organizationService != nil {
+		if _, err = s.organizationService.Get(organizationID); err != nil {
+			if errors.Is(err, types.ErrOrganizationNotFound) {
+				WriteErrorResponse(response, http.StatusBadRequest, []string{
+					err.Error(),
+				})
+			} else {
+				WriteInternalError(response, request, err)
+			}
+			return
+		}
+	}
+	key, token, err := s.authService.Create(organizationID, unmarshalled.Name, unmarshalled.Scopes, unmarshalled.DeviceIDs)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidScope) {
+			WriteErrorResponse(response, http.StatusBadRequest, []string{
+				err.Error(),
+			})
+		} else {
+			WriteInternalError(response, request, err)
+		}
+		return
+	}
+	WriteAPIResponse(response, http.StatusCreated, CreateAPIKeyResponse{
+		APIKeyResponse: newAPIKeyResponse(key),
+		Token:          token,
+	})
+}
+
+// RevokeAPIKey revokes (DELETE) an API key, which is rejected from then on. Keys of organizations
+// the caller does not manage are reported as not found.
+func (s *Server) RevokeAPIKey(response http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodDelete {
+		WriteErrorResponse(response, http.StatusMethodNotAllowed, []string{
+			http.StatusText(http.StatusMethodNotAllowed),
+		})
+		return
+	}
+	key, err := s.authService.Get(request.PathValue("keyID"))
+	if err == nil && !managesKeysOf(request, key.OrganizationID) {
+		err = auth.ErrKeyNotFound
+	}
+	if err == nil {
+		key, err = s.authService.Revoke(key.ID)
+	}
+	if err != nil {
+		if errors.Is(err, auth.ErrKeyNotFound) {
+			WriteErrorResponse(response, http.StatusNotFound, []string{
+				err.Error(),
+			})
+		} else {
+			WriteInternalError(response, request, err)
+		}
+		return
+	}
+	WriteAPIResponse(response, http.StatusOK, newAPIKeyResponse(key))
+}
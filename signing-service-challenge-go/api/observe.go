@@ -0,0 +1,85 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/logging"
+)
+
+// unmatchedRoute is the route of requests that match no pattern, or are rejected before routing,
+// which keeps arbitrary paths out of the metrics.
+const unmatchedRoute = "unmatched"
+
+// quietRoutes are polled by infrastructure, their requests are only logged at debug level.
+var quietRoutes = map[string]bool{
+	"/api/v0/health":       true,
+	"/api/v0/health/live":  true,
+	"/api/v0/health/ready": true,
+	"/metrics":             true,
+}
+
+// statusRecorder records the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(data []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(data)
+}
+
+// Unwrap gives http.ResponseController access to the underlying writer, e.g. for flushing.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// observeRequests traces every request and logs it with the attributes its handlers added to its context,
+// and reports its route, method, status code and latency to the metrics. The route is the pattern set on
+// the request by the ServeMux that handler dispatches to.
+func (s *Server) observeRequests(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		start := time.Now()
+		request, span := startSpan(request)
+		recorder := &statusRecorder{ResponseWriter: response}
+		handler.ServeHTTP(recorder, request)
+		duration := time.Since(start)
+		route := request.Pattern
+		if route == "" {
+			route = unmatchedRoute
+		}
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		endSpan(span, request.Method, route, recorder.status)
+		if s.metrics != nil {
+			s.metrics.ObserveRequest(route, request.Method, recorder.status, duration)
+		}
+
+		if id := request.PathValue("id"); id != "" {
+			logging.Add(request.Context(), slog.String("device_id", id))
+		}
+		level := slog.LevelInfo
+		if quietRoutes[route] {
+			level = slog.LevelDebug
+		}
+		slog.Log(request.Context(), level, "Request",
+			"method", request.Method,
+			"route", route,
+			"path", request.URL.Path,
+			"status", recorder.status,
+			"duration", duration,
+		)
+	})
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+)
+
+// tenant is the organization of a request together with the services restricted to its devices.
+type tenant struct {
+	organization *types.Organization
+	devices      DeviceService
+	exports      ExportService
+}
+
+type tenantKey struct{}
+
+// OrganizationFromContext returns the organization of the API key of a request, if organizations are isolated.
+func OrganizationFromContext(ctx context.Context) (*types.Organization, bool) {
+	t, ok := ctx.Value(tenantKey{}).(*tenant)
+	if !ok {
+		return nil, false
+	}
+	return t.organization, true
+}
+
+// withOrganization adds the organization with the given ID and its services to the context of a request.
+func (s *Server) withOrganization(request *http.Request, organizationID string) (*http.Request, error) {
+	if s.organizationService == nil {
+		return request, nil
+	}
+	organization, err := s.organizationService.Get(organizationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get organization %s: %w", organizationID, err)
+	}
+	devices, exports := s.organizationScope(organization)
+	t := &tenant{organization: organization, devices: devices, exports: exports}
+	return request.WithContext(context.WithValue(request.Context(), tenantKey{}, t)), nil
+}
+
+// devices returns the device service for a request, restricted to its organization if organizations are isolated.
+func (s *Server) devices(request *http.Request) DeviceService {
+	if t, ok := request.Context().Value(tenantKey{}).(*tenant); ok {
+		return t.devices
+	}
+	return s.deviceService
+}
+
+// exports returns the export service for a request, restricted to its organization if organizations are isolated.
+func (s *Server) exports(request *http.Request) ExportService {
+	if t, ok := request.Context().Value(tenantKey{}).(*tenant); ok {
+		return t.exports
+	}
+	return s.exportService
+}
+
+// isOperator reports whether the request acts for the default organization, which operates the service.
+// Without isolated organizations, every request does.
+func isOperator(request *http.Request) bool {
+	organization, ok := OrganizationFromContext(request.Context())
+	return !ok || organization.ID == types.DefaultOrganizationID
+}
+
+// operatorOnly restricts a handler to requests of the default organization, as it affects all organizations.
+func operatorOnly(handler http.HandlerFunc) http.HandlerFunc {
+	return func(response http.ResponseWriter, request *http.Request) {
+		if !isOperator(request) {
+			WriteErrorResponse(response, http.StatusForbidden, []string{
+				"Only the default organization may access this endpoint",
+			})
+			return
+		}
+		handler(response, request)
+	}
+}
+
+// Organizations lists (GET) or creates (POST) organizations.
+func (s *Server) Organizations(response http.ResponseWriter, request *http.Request) {
+	switch request.Method {
+	case http.MethodGet:
+		organizations, err := s.organizationService.GetAll()
+		if err != nil {
+			WriteInternalError(response, request, err)
+			return
+		}
+		WriteAPIResponse(response, http.StatusOK, organizations)
+	case http.MethodPost:
+		unmarshalled := CreateOrganizationRequest{}
+		if !readJSON(response, request, &unmarshalled) {
+			return
+		}
+		organization, err := s.organizationService.Create(unmarshalled.ID, unmarshalled.Name, unmarshalled.MaxDevices)
+		if err != nil {
+			writeOrganizationError(response, request, err)
+			return
+		}
+		WriteAPIResponse(response, http.StatusCreated, organization)
+	default:
+		WriteErrorResponse(response, http.StatusMethodNotAllowed, []string{
+			http.StatusText(http.StatusMethodNotAllowed),
+		})
+	}
+}
+
+// UpdateOrganization changes (PUT) the name and device quota of an organization.
+func (s *Server) UpdateOrganization(response http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPut {
+		WriteErrorResponse(response, http.StatusMethodNotAllowed, []string{
+			http.StatusText(http.StatusMethodNotAllowed),
+		})
+		return
+	}
+	unmarshalled := UpdateOrganizationRequest{}
+	if !readJSON(response, request, &unmarshalled) {
+		return
+	}
+	organization, err := s.organizationService.Update(request.PathValue("organizationID"), unmarshalled.Name, unmarshalled.MaxDevices)
+	if err != nil {
+		writeOrganizationError(response, request, err)
+		return
+	}
+	WriteAPIResponse(response, http.StatusOK, organization)
+}
+
+// readJSON decodes the JSON request body into v, and writes the error response if it cannot.
+func readJSON(response http.ResponseWriter, request *http.Request, v any) bool {
+	body, err := io.ReadAll(request.Body)
+	if err != nil {
+		WriteErrorResponse(response, http.StatusBadRequest, []string{
+			fmt.Sprintf("Failed to read request body: %s", err.Error()),
+		})
+		return false
+	}
+	if err = json.Unmarshal(body, v); err != nil {
+		WriteErrorResponse(response, http.StatusBadRequest, []string{
+			fmt.Sprintf("Incorrect request format: %s", err.Error()),
+		})
+		return false
+	}
+	return true
+}
+
+func writeOrganizationError(response http.ResponseWriter, request *http.Request, err error) {
+	if errors.Is(err, types.ErrInvalidOrganization) {
+		WriteErrorResponse(response, http.StatusBadRequest, []string{
+			err.Error(),
+		})
+	} else if errors.Is(err, types.ErrOrganizationExists) {
+		WriteErrorResponse(response, http.StatusConflict, []string{
+			err.Error(),
+		})
+	} else if errors.Is(err, types.ErrOrganizationNotFound) {
+		WriteErrorResponse(response, http.StatusNotFound, []string{
+			err.Error(),
+		})
+	} else {
+		WriteInternalError(response, request, err)
+	}
+}
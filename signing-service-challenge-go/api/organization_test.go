@@ -0,0 +1,54 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/auth"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/ratelimit"
+)
+
+func TestServer_OrganizationIsolation(t *testing.T) {
+	ts := serveTenants(t, WithRateLimiter(ratelimit.New(ratelimit.NewMemoryBackend())))
+	ts.organization(t, "store-a")
+	ts.organization(t, "store-b")
+	_, a := ts.key(t, "store-a", auth.Scopes)
+	_, b := ts.key(t, "store-b", auth.Scopes)
+	id := ts.device(t, a)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   any
+	}{
+		{"Sign", http.MethodPost, "/api/v0/sign-transaction", SignTransactionRequest{DeviceID: id, DataToBeSigned: "data"}},
+		{"Sign Document", http.MethodPost, "/api/v0/devices/" + id + "/sign-document", "document"},
+		{"Signatures", http.MethodGet, "/api/v0/device-signs/" + id, nil},
+		{"Export", http.MethodGet, "/api/v0/devices/" + id + "/export", nil},
+		{"Certificate", http.MethodGet, "/api/v0/devices/" + id + "/certificate", nil},
+		{"CSR", http.MethodPost, "/api/v0/devices/" + id + "/csr", nil},
+		{"Quota", http.MethodGet, "/api/v0/devices/" + id + "/quota", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// the device does not exist for another organization, rather than being forbidden
+			response, content := call(t, ts.server, test.method, test.path, b, test.body)
+			expectStatus(t, response, content, http.StatusNotFound)
+		})
+	}
+
+	response, content := call(t, ts.server, http.MethodGet, "/api/v0/devices", b, nil)
+	expectStatus(t, response, content, http.StatusOK)
+	var listed []DeviceResponse
+	decode(t, content, &listed)
+	if len(listed) != 0 {
+		t.Fatalf("expected no devices of another organization, got %+v", listed)
+	}
+
+	// the organization of the device still uses it
+	response, content = sign(t, ts.server, a, id)
+	expectStatus(t, response, content, http.StatusCreated)
+	response, content = call(t, ts.server, http.MethodGet, "/api/v0/device-signs/"+id, a, nil)
+	expectStatus(t, response, content, http.StatusOK)
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/ratelimit"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+)
+
+// DeviceQuotaResponse is the number of signatures of a device in the current quota periods.
+type DeviceQuotaResponse struct {
+	Daily   QuotaPeriodResponse `json:"daily"`
+	Monthly QuotaPeriodResponse `json:"monthly"`
+}
+
+// QuotaPeriodResponse is the number of signatures of a device in a quota period.
+type QuotaPeriodResponse struct {
+	Used int64 `json:"used"`
+	// Limit is the quota of the period, omitted if it is unlimited.
+	Limit     int64     `json:"limit,omitempty"`
+	Remaining *int64    `json:"remaining,omitempty"`
+	ResetsAt  time.Time `json:"resets_at"`
+}
+
+func newQuotaPeriodResponse(usage ratelimit.PeriodUsage) QuotaPeriodResponse {
+	period := QuotaPeriodResponse{Used: usage.Used, Limit: usage.Limit, ResetsAt: usage.ResetsAt}
+	if usage.Limit > 0 {
+		remaining := max(0, usage.Limit-usage.Used)
+		period.Remaining = &remaining
+	}
+	return period
+}
+
+// clientOf identifies the caller of a request for its rate limit: by its API key, else its client
+// certificate, else its IP address.
+func clientOf(request *http.Request) string {
+	if key, ok := KeyFromContext(request.Context()); ok {
+		return "key:" + key.ID
+	}
+	if identity, ok := IdentityFromContext(request.Context()); ok {
+		return "certificate:" + identity.Subject
+	}
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		host = request.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// limitClient applies the rate limit of the caller to a handler, rejecting requests above it
+// with 429 Too Many Requests. Without a rate limiter, all requests are let through.
+func (s *Server) limitClient(handler http.Handler) http.Handler {
+	if s.rateLimiter == nil {
+		return handler
+	}
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		if err := s.rateLimiter.AllowClient(clientOf(request)); err != nil {
+			writeLimitError(response, request, err)
+			return
+		}
+		handler.ServeHTTP(response, request)
+	})
+}
+
+// reserveSignature takes a signature of a device from its rate limit and quotas. The device is looked up
+// first, so that callers cannot use up the limits of devices they cannot see. If it is not allowed, the
+// error response is written and ok is false. Otherwise cancel must be called if no signature is made.
+func (s *Server) reserveSignature(response http.ResponseWriter, request *http.Request, deviceID string) (cancel func(), ok bool) {
+	if s.rateLimiter == nil {
+		return func() {}, true
+	}
+	if _, err := s.devices(request).Get(request.Context(), deviceID); err != nil {
+		if errors.Is(err, types.ErrDeviceNotFound) {
+			WriteErrorResponse(response, http.StatusNotFound, []string{
+				err.Error(),
+			})
+		} else {
+			WriteInternalError(response, request, err)
+		}
+		return nil, false
+	}
+	cancel, err := s.rateLimiter.ReserveSignature(deviceID)
+	if err != nil {
+		writeLimitError(response, request, err)
+		return nil, false
+	}
+	return cancel, true
+}
+
+// writeLimitError writes 429 Too Many Requests with a Retry-After header for an exceeded limit,
+// and an internal error for any other error.
+func writeLimitError(response http.ResponseWriter, request *http.Request, err error) {
+	var exceeded *ratelimit.ExceededError
+	if !errors.As(err, &exceeded) {
+		WriteInternalError(response, request, err)
+		return
+	}
+	response.Header().Set("Retry-After", strconv.FormatInt(exceeded.RetryAfterSeconds(), 10))
+	WriteErrorResponse(response, http.StatusTooManyRequests, []string{
+		err.Error(),
+	})
+}
+
+// DeviceQuota returns the number of signatures of a device in the current day and month, and its quotas.
+func (s *Server) DeviceQuota(response http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		WriteErrorResponse(response, http.StatusMethodNotAllowed, []string{
+			http.StatusText(http.StatusMethodNotAllowed),
+		})
+		return
+	}
+	device, err := s.devices(request).Get(request.Context(), request.PathValue("id"))
+	if err != nil {
+		if errors.Is(err, types.ErrDeviceNotFound) {
+			WriteErrorResponse(response, http.StatusNotFound, []string{
+				err.Error(),
+			})
+		} else {
+			WriteInternalError(response, request, err)
+		}
+		return
+	}
+	usage, err := s.rateLimiter.Usage(device.ID)
+	if err != nil {
+		WriteInternalError(response, request, err)
+		return
+	}
+	WriteAPIResponse(response, http.StatusOK, DeviceQuotaResponse{
+		Daily:   newQuotaPeriodResponse(usage.Daily),
+		Monthly: newQuotaPeriodResponse(usage.Monthly),
+	})
+}
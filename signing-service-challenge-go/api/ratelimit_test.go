@@ -0,0 +1,97 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/auth"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/ratelimit"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+)
+
+func TestServer_ReserveSignature(t *testing.T) {
+	// a device may sign once, the limits are only taken from by signatures the caller may make
+	ts := serveTenants(t, WithRateLimiter(ratelimit.New(ratelimit.NewMemoryBackend(),
+		ratelimit.WithDeviceLimit(ratelimit.Limit{Rate: 0.001}), ratelimit.WithSigningQuota(ratelimit.Quota{Daily: 1}))))
+	ts.organization(t, "store-a")
+	ts.organization(t, "store-b")
+	_, a := ts.key(t, "store-a", auth.Scopes)
+	_, b := ts.key(t, "store-b", auth.Scopes)
+	id := ts.device(t, a)
+
+	for range 3 {
+		response, content := sign(t, ts.server, b, id)
+		expectStatus(t, response, content, http.StatusNotFound)
+		response, content = call(t, ts.server, http.MethodPost, "/api/v0/devices/"+id+"/sign-document", b, "document")
+		expectStatus(t, response, content, http.StatusNotFound)
+	}
+	// failed signatures are given back
+	response, content := call(t, ts.server, http.MethodPost, "/api/v0/sign-transaction", a,
+		SignTransactionRequest{DeviceID: id, DataToBeSigned: "data", Format: "unknown"})
+	expectStatus(t, response, content, http.StatusBadRequest)
+
+	response, content = sign(t, ts.server, a, id)
+	expectStatus(t, response, content, http.StatusCreated)
+	response, content = sign(t, ts.server, a, id)
+	expectStatus(t, response, content, http.StatusTooManyRequests)
+
+	// the exhausted limits of a device do not reveal it to other organizations
+	response, content = sign(t, ts.server, b, id)
+	expectStatus(t, response, content, http.StatusNotFound)
+}
+
+func TestServer_TooManyRequests(t *testing.T) {
+	now := func() time.Time { return time.Date(2025, 6, 30, 23, 59, 0, 0, time.UTC) }
+	tests := []struct {
+		name       string
+		opts       []ratelimit.Option
+		allowed    int
+		retryAfter string
+	}{
+		{"Client Rate", []ratelimit.Option{ratelimit.WithClientLimit(ratelimit.Limit{Rate: 0.5})}, 1, "2"},
+		{"Device Rate", []ratelimit.Option{ratelimit.WithDeviceLimit(ratelimit.Limit{Rate: 0.1, Burst: 2})}, 2, "10"},
+		{"Daily Quota", []ratelimit.Option{ratelimit.WithSigningQuota(ratelimit.Quota{Daily: 3})}, 3, "60"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ts := serveTenants(t, WithRateLimiter(ratelimit.New(ratelimit.NewMemoryBackend(),
+				append(test.opts, ratelimit.WithClock(now))...)))
+			_, admin := ts.key(t, types.DefaultOrganizationID, auth.Scopes)
+			id := ts.device(t, admin)
+			_, token := ts.key(t, types.DefaultOrganizationID, auth.Scopes)
+
+			for range test.allowed {
+				response, content := sign(t, ts.server, token, id)
+				expectStatus(t, response, content, http.StatusCreated)
+			}
+			response, content := sign(t, ts.server, token, id)
+			expectStatus(t, response, content, http.StatusTooManyRequests)
+			if retryAfter := response.Header.Get("Retry-After"); retryAfter != test.retryAfter {
+				t.Fatalf("expected Retry-After %s, got %q", test.retryAfter, retryAfter)
+			}
+		})
+	}
+}
+
+func TestServer_ClientLimitOverride(t *testing.T) {
+	clients := map[string]ratelimit.Limit{}
+	ts := serveTenants(t, WithRateLimiter(ratelimit.New(ratelimit.NewMemoryBackend(),
+		ratelimit.WithClientLimit(ratelimit.Limit{Rate: 0.001}), ratelimit.WithClientLimits(clients))))
+	_, limited := ts.key(t, types.DefaultOrganizationID, []auth.Scope{auth.ScopeDevicesRead})
+	key, bulk := ts.key(t, types.DefaultOrganizationID, []auth.Scope{auth.ScopeDevicesRead})
+	// the ID of a key is only known once it is created, the limiter reads the overrides on every request
+	clients["key:"+key.ID] = ratelimit.Limit{Rate: 0.001, Burst: 3}
+
+	for _, test := range []struct {
+		token   string
+		allowed int
+	}{{limited, 1}, {bulk, 3}} {
+		for range test.allowed {
+			response, content := call(t, ts.server, http.MethodGet, "/api/v0/devices", test.token, nil)
+			expectStatus(t, response, content, http.StatusOK)
+		}
+		response, content := call(t, ts.server, http.MethodGet, "/api/v0/devices", test.token, nil)
+		expectStatus(t, response, content, http.StatusTooManyRequests)
+	}
+}
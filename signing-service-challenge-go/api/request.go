@@ -1,5 +1,7 @@
 package api
 
+import "github.com/fiskaly/coding-challenges/signing-service-challenge/auth"
+
 type CreateSignatureDeviceRequest struct {
 	Algorithm string `json:"algorithm,omitempty"`
 	Label     string `json:"label"`
@@ -8,4 +10,46 @@ type CreateSignatureDeviceRequest struct {
 type SignTransactionRequest struct {
 	DeviceID       string `json:"deviceId,omitempty"`
 	DataToBeSigned string `json:"data_to_be_signed,omitempty"`
+	// Format is one of "raw" (default), "jws", "jws-detached" or "cose".
+	Format string `json:"format,omitempty"`
+}
+
+type CreateCSRRequest struct {
+	CommonName         string `json:"common_name,omitempty"`
+	SerialNumber       string `json:"serial_number,omitempty"`
+	Organization       string `json:"organization,omitempty"`
+	OrganizationalUnit string `json:"organizational_unit,omitempty"`
+	Country            string `json:"country,omitempty"`
+	Province           string `json:"province,omitempty"`
+	Locality           string `json:"locality,omitempty"`
+	StreetAddress      string `json:"street_address,omitempty"`
+	PostalCode         string `json:"postal_code,omitempty"`
+}
+
+type AttachCertificateRequest struct {
+	Certificate string `json:"certificate"`
+}
+
+type CreateAPIKeyRequest struct {
+	// OrganizationID is the organization of the key, defaults to the organization of the caller.
+	// Only administrators of the default organization create keys for other organizations.
+	OrganizationID string `json:"organization_id,omitempty"`
+	Name           string `json:"name"`
+	// Scopes are any of "devices:create", "devices:read", "sign", "audit" and "admin".
+	Scopes []auth.Scope `json:"scopes"`
+	// DeviceIDs optionally restricts the key to the given devices.
+	DeviceIDs []string `json:"device_ids,omitempty"`
+}
+
+type CreateOrganizationRequest struct {
+	// ID consists of lower case letters, digits and dashes, e.g. "store-0042".
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// MaxDevices limits the number of devices of the organization, 0 means unlimited.
+	MaxDevices int `json:"max_devices"`
+}
+
+type UpdateOrganizationRequest struct {
+	Name       string `json:"name"`
+	MaxDevices int    `json:"max_devices"`
 }
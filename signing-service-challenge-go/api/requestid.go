@@ -0,0 +1,42 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"regexp"
+
+	"github.com/google/uuid"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/logging"
+)
+
+// RequestIDHeader carries the ID of a request, which correlates it with the log records it caused.
+const RequestIDHeader = "X-Request-ID"
+
+// validRequestID matches the request IDs accepted from clients, which end up in the logs unchanged.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:+=/-]{1,128}$`)
+
+type requestIDKey struct{}
+
+// RequestIDFromContext returns the ID of a request.
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDKey{}).(string)
+	return id, ok
+}
+
+// withRequestID assigns every request an ID, taken from its X-Request-ID header if it is valid and generated
+// otherwise, and returns it in the X-Request-ID header of the response. The ID is added to every record
+// logged with the context of the request.
+func withRequestID(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		id := request.Header.Get(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = uuid.NewString()
+		}
+		response.Header().Set(RequestIDHeader, id)
+		ctx := context.WithValue(request.Context(), requestIDKey{}, id)
+		ctx = logging.NewContext(ctx, slog.String("request_id", id))
+		handler.ServeHTTP(response, request.WithContext(ctx))
+	})
+}
@@ -1,9 +1,16 @@
 package api
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
-	"log"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/auth"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/health"
 )
 
 // Response is the generic API response container.
@@ -20,36 +27,222 @@ type ErrorResponse struct {
 type Server struct {
 	listenAddress string
 	deviceService DeviceService
+	backupService BackupService
+	exportService ExportService
+	authService   AuthService
+	// organizationService and organizationScope isolate the organizations of API keys from each other.
+	organizationService OrganizationService
+	organizationScope   OrganizationScope
+	rateLimiter         RateLimiter
+	metrics             Metrics
+	// healthChecks are the checks of the readiness probe, besides whether the server drains.
+	healthChecks []health.Checker
+	health       *health.Service
+	// maxDocumentSize limits the size of documents accepted for signing.
+	maxDocumentSize int64
+	// maxBackupSize limits the size of backups accepted for restoring.
+	maxBackupSize   int64
+	drainTimeout    time.Duration
+	shutdownTimeout time.Duration
+	drainer         *drainer
+	tlsConfig       *tls.Config
+}
+
+// Option configures optional features of the Server.
+type Option func(*Server)
+
+// WithBackupService enables the backup and restore endpoints.
+func WithBackupService(backupService BackupService) Option {
+	return func(s *Server) {
+		s.backupService = backupService
+	}
+}
+
+// WithExportService enables the export endpoints.
+func WithExportService(exportService ExportService) Option {
+	return func(s *Server) {
+		s.exportService = exportService
+	}
+}
+
+// WithAuthService requires API keys for all endpoints except the health check, enforces their scopes
+// and device restrictions, and enables the endpoints managing API keys.
+func WithAuthService(authService AuthService) Option {
+	return func(s *Server) {
+		s.authService = authService
+	}
+}
+
+// WithOrganizations isolates organizations: every request only accesses the devices of the organization
+// of its API key, through the services returned by scope, and cross-organization access is reported as
+// not found. It also enables the endpoints managing organizations. It requires WithAuthService.
+func WithOrganizations(organizationService OrganizationService, scope OrganizationScope) Option {
+	return func(s *Server) {
+		s.organizationService = organizationService
+		s.organizationScope = scope
+	}
+}
+
+// WithRateLimiter limits the rate of requests of every client and the signatures of every device,
+// enforces the signature quotas of devices and enables the endpoint reporting their usage.
+func WithRateLimiter(rateLimiter RateLimiter) Option {
+	return func(s *Server) {
+		s.rateLimiter = rateLimiter
+	}
+}
+
+// WithMetrics records every request in metrics and serves them on /metrics, which like the health
+// check requires no API key.
+func WithMetrics(metrics Metrics) Option {
+	return func(s *Server) {
+		s.metrics = metrics
+	}
+}
+
+// WithMaxDocumentSize limits the size of documents accepted for signing to n bytes.
+func WithMaxDocumentSize(n int64) Option {
+	return func(s *Server) {
+		s.maxDocumentSize = n
+	}
+}
+
+// WithMaxBackupSize limits the size of backups accepted for restoring to n bytes.
+func WithMaxBackupSize(n int64) Option {
+	return func(s *Server) {
+		s.maxBackupSize = n
+	}
+}
+
+// WithShutdownTimeouts sets the time in-flight writes are given to complete on shutdown, while new writes
+// are rejected, and the time all remaining requests are given afterwards.
+func WithShutdownTimeouts(drain time.Duration, shutdown time.Duration) Option {
+	return func(s *Server) {
+		s.drainTimeout = drain
+		s.shutdownTimeout = shutdown
+	}
+}
+
+// WithHealthChecks adds checks of the dependencies of the service to the readiness probe.
+func WithHealthChecks(checks ...health.Checker) Option {
+	return func(s *Server) {
+		s.healthChecks = append(s.healthChecks, checks...)
+	}
+}
+
+// WithTLS serves HTTPS with the given configuration. If it verifies client certificates, the identity
+// of the caller is available to handlers through IdentityFromContext. With isolated organizations, a client
+// certificate must name the organization of the API key of a request in its subject, e.g. O=default.
+func WithTLS(config *tls.Config) Option {
+	return func(s *Server) {
+		s.tlsConfig = config
+	}
 }
 
 // NewServer is a factory to instantiate a new Server.
-func NewServer(listenAddress string, deviceService DeviceService) *Server {
-	return &Server{
-		listenAddress: listenAddress,
-		deviceService: deviceService,
+func NewServer(listenAddress string, deviceService DeviceService, opts ...Option) *Server {
+	s := &Server{
+		listenAddress:   listenAddress,
+		deviceService:   deviceService,
+		maxDocumentSize: DefaultMaxDocumentSize,
+		maxBackupSize:   DefaultMaxBackupSize,
+		drainTimeout:    DefaultDrainTimeout,
+		shutdownTimeout: DefaultShutdownTimeout,
+		drainer:         newDrainer(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.health = health.New(append(s.healthChecks, drainingCheck{drainer: s.drainer}))
+	return s
+}
+
+// Run serves the HTTP routes until ctx is done. It then drains the server: new writes are rejected
+// with 503 Service Unavailable while in-flight writes complete, after which the server stops accepting
+// connections and waits for the remaining requests. Run returns nil once the server has shut down cleanly.
+func (s *Server) Run(ctx context.Context) error {
+	server := &http.Server{
+		Addr:      s.listenAddress,
+		Handler:   s.handler(),
+		TLSConfig: s.tlsConfig,
+	}
+	errs := make(chan error, 1)
+	go func() {
+		if s.tlsConfig != nil {
+			errs <- server.ListenAndServeTLS("", "")
+		} else {
+			errs <- server.ListenAndServe()
+		}
+	}()
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("Shutting down, draining in-flight requests")
+	drainCtx, cancel := context.WithTimeout(context.Background(), s.drainTimeout)
+	defer cancel()
+	if err := s.drainer.drain(drainCtx); err != nil {
+		slog.Warn("In-flight requests did not complete in time", "drain_timeout", s.drainTimeout)
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("failed to shut down the server: %w", err)
 	}
+	return nil
 }
 
-// Run registers all HandlerFuncs for the existing HTTP routes and starts the Server.
-func (s *Server) Run() error {
+// handler registers all HandlerFuncs for the existing HTTP routes and wraps them into the middleware
+// every request passes through.
+func (s *Server) handler() http.Handler {
 	mux := http.NewServeMux()
 
 	mux.Handle("/api/v0/health", http.HandlerFunc(s.Health))
-	mux.Handle("/api/v0/create-signature-device", http.HandlerFunc(s.CreateSignatureDevice))
-	mux.Handle("/api/v0/sign-transaction", http.HandlerFunc(s.SignTransaction))
-	mux.Handle("/api/v0/devices", http.HandlerFunc(s.Devices))
-	mux.Handle("/api/v0/device-signs/{id}", http.HandlerFunc(s.DeviceSignatures))
+	mux.Handle("/api/v0/health/live", http.HandlerFunc(s.Liveness))
+	mux.Handle("/api/v0/health/ready", http.HandlerFunc(s.Readiness))
+	if s.metrics != nil {
+		mux.Handle("/metrics", s.metrics.Handler())
+	}
+	mux.Handle("/api/v0/create-signature-device", s.authorize(auth.ScopeDevicesCreate, s.CreateSignatureDevice))
+	mux.Handle("/api/v0/sign-transaction", s.authorize(auth.ScopeSign, s.SignTransaction))
+	mux.Handle("/api/v0/devices", s.authorize(auth.ScopeDevicesRead, s.Devices))
+	mux.Handle("/api/v0/device-signs/{id}", s.authorize(auth.ScopeDevicesRead, s.DeviceSignatures))
+	mux.Handle("/api/v0/devices/{id}/certificate", s.authorizeMethods(auth.ScopeDevicesRead, auth.ScopeDevicesCreate, s.DeviceCertificate))
+	mux.Handle("/api/v0/devices/{id}/csr", s.authorize(auth.ScopeDevicesCreate, s.DeviceCSR))
+	mux.Handle("/api/v0/devices/{id}/sign-document", s.authorize(auth.ScopeSign, s.SignDocument))
+	mux.Handle("/api/v0/ca", s.authorize(auth.ScopeDevicesRead, s.CertificateAuthority))
+	if s.backupService != nil {
+		mux.Handle("/api/v0/backup", s.authorize(auth.ScopeAdmin, operatorOnly(s.Backup)))
+		mux.Handle("/api/v0/restore", s.authorize(auth.ScopeAdmin, operatorOnly(s.Restore)))
+	}
+	if s.exportService != nil {
+		mux.Handle("/api/v0/devices/{id}/export", s.authorize(auth.ScopeAudit, s.ExportDevice))
+		mux.Handle("/api/v0/export", s.authorize(auth.ScopeAudit, s.ExportAll))
+	}
+	if s.rateLimiter != nil {
+		mux.Handle("/api/v0/devices/{id}/quota", s.authorize(auth.ScopeDevicesRead, s.DeviceQuota))
+	}
+	if s.authService != nil {
+		mux.Handle("/api/v0/admin/keys", s.authorize(auth.ScopeAdmin, s.APIKeys))
+		mux.Handle("/api/v0/admin/keys/{keyID}", s.authorize(auth.ScopeAdmin, s.RevokeAPIKey))
+	}
+	if s.authService != nil && s.organizationService != nil {
+		mux.Handle("/api/v0/admin/organizations", s.authorize(auth.ScopeAdmin, operatorOnly(s.Organizations)))
+		mux.Handle("/api/v0/admin/organizations/{organizationID}", s.authorize(auth.ScopeAdmin, operatorOnly(s.UpdateOrganization)))
+	}
 
 	// TODO: register further HandlerFuncs here ...
 
-	return http.ListenAndServe(s.listenAddress, mux)
+	return withClientIdentity(withRequestID(s.observeRequests(s.drainer.writes(mux))))
 }
 
-// WriteInternalError writes a default internal error message as an HTTP response.
-func WriteInternalError(w http.ResponseWriter, url string, err error) {
+// WriteInternalError writes a default internal error message as an HTTP response and logs the error
+// with the context of the request.
+func WriteInternalError(w http.ResponseWriter, request *http.Request, err error) {
 	w.WriteHeader(http.StatusInternalServerError)
 	w.Write([]byte(http.StatusText(http.StatusInternalServerError)))
-	log.Printf("Internal error: \nPath: %s\nError msg: %v\n", url, err)
+	slog.ErrorContext(request.Context(), "Internal error", "path", request.URL.Path, "error", err)
 }
 
 // WriteErrorResponse takes an HTTP status code and a slice of errors
@@ -63,7 +256,7 @@ func WriteErrorResponse(w http.ResponseWriter, code int, errors []string) {
 
 	bytes, err := json.Marshal(errorResponse)
 	if err != nil {
-		WriteInternalError(w, "", err)
+		slog.Error("Failed to encode the error response", "error", err)
 	}
 
 	w.Write(bytes)
@@ -80,7 +273,7 @@ func WriteAPIResponse(w http.ResponseWriter, code int, data interface{}) {
 
 	bytes, err := json.MarshalIndent(response, "", "  ")
 	if err != nil {
-		WriteInternalError(w, "", err)
+		slog.Error("Failed to encode the response", "error", err)
 	}
 
 	w.Write(bytes)
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/auth"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/export"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+)
+
+// newDeviceService creates a DeviceService on an empty in-memory database.
+func newDeviceService() *domain.DeviceService {
+	return domain.NewDeviceService(persistence.NewInMemoryDatabase())
+}
+
+// serve creates a Server with the given options and serves its routes until the test ends.
+func serve(t *testing.T, deviceService DeviceService, opts ...Option) (*Server, *httptest.Server) {
+	t.Helper()
+	s := NewServer("", deviceService, opts...)
+	server := httptest.NewServer(s.handler())
+	t.Cleanup(server.Close)
+	return s, server
+}
+
+// tenantServer is a Server with API keys and isolated organizations, set up like the service does.
+type tenantServer struct {
+	s             *Server
+	server        *httptest.Server
+	auth          *auth.Service
+	organizations *domain.OrganizationService
+}
+
+// serveTenants serves a Server with API keys and isolated organizations on an in-memory database.
+func serveTenants(t *testing.T, opts ...Option) *tenantServer {
+	t.Helper()
+	db := persistence.NewInMemoryDatabase()
+	deviceService := domain.NewDeviceService(db)
+	ts := &tenantServer{auth: auth.NewService(db), organizations: domain.NewOrganizationService(db)}
+	opts = append([]Option{
+		WithAuthService(ts.auth),
+		WithExportService(export.NewService(db)),
+		WithOrganizations(ts.organizations, func(organization *types.Organization) (DeviceService, ExportService) {
+			return deviceService.ForOrganization(organization), export.NewService(domain.OrganizationDatabase(db, organization.ID))
+		}),
+	}, opts...)
+	ts.s, ts.server = serve(t, deviceService, opts...)
+	return ts
+}
+
+// organization creates an organization with the given ID.
+func (ts *tenantServer) organization(t *testing.T, id string) {
+	t.Helper()
+	if _, err := ts.organizations.Create(id, id, 0); err != nil {
+		t.Fatalf("failed to create organization: %v", err)
+	}
+}
+
+// key creates an API key of an organization and returns its token.
+func (ts *tenantServer) key(t *testing.T, organizationID string, scopes []auth.Scope, deviceIDs ...string) (*auth.Key, string) {
+	t.Helper()
+	key, token, err := ts.auth.Create(organizationID, "test", scopes, deviceIDs)
+	if err != nil {
+		t.Fatalf("failed to create API key: %v", err)
+	}
+	return key, token
+}
+
+// device creates a device with the API key of the given token and returns its ID.
+func (ts *tenantServer) device(t *testing.T, token string) string {
+	t.Helper()
+	response, content := call(t, ts.server, http.MethodPost, "/api/v0/create-signature-device", token,
+		CreateSignatureDeviceRequest{Algorithm: string(types.ECC), Label: "test"})
+	expectStatus(t, response, content, http.StatusCreated)
+	var device DeviceResponse
+	decode(t, content, &device)
+	return device.ID
+}
+
+// sign signs with a device using the API key of the given token.
+func sign(t *testing.T, server *httptest.Server, token string, deviceID string) (*http.Response, []byte) {
+	t.Helper()
+	return call(t, server, http.MethodPost, "/api/v0/sign-transaction", token,
+		SignTransactionRequest{DeviceID: deviceID, DataToBeSigned: "data"})
+}
+
+// call sends a request with the given API key, if any, and the JSON encoded body, if any,
+// and returns the response together with its body.
+func call(t *testing.T, server *httptest.Server, method string, path string, token string, body any) (*http.Response, []byte) {
+	t.Helper()
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("failed to encode request: %v", err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	request, err := http.NewRequest(method, server.URL+path, reader)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	response, err := server.Client().Do(request)
+	if err != nil {
+		t.Fatalf("failed to send request: %v", err)
+	}
+	defer response.Body.Close()
+	content, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatalf("failed to read response: %v", err)
+	}
+	return response, content
+}
+
+// expectStatus checks the status code of a response.
+func expectStatus(t *testing.T, response *http.Response, content []byte, status int) {
+	t.Helper()
+	if response.StatusCode != status {
+		t.Fatalf("expected status %d for %s %s, got %d: %s", status, response.Request.Method, response.Request.URL.Path,
+			response.StatusCode, content)
+	}
+}
+
+// decode decodes the data of a response into v.
+func decode(t *testing.T, content []byte, v any) {
+	t.Helper()
+	if err := json.Unmarshal(content, &Response{Data: v}); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+}
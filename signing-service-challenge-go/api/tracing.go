@@ -0,0 +1,47 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/logging"
+)
+
+// startSpan starts the server span of a request, as child of the trace given in its W3C traceparent header,
+// and returns the request with the span in its context. The trace ID is added to the logs of the request.
+func startSpan(request *http.Request) (*http.Request, trace.Span) {
+	ctx := otel.GetTextMapPropagator().Extract(request.Context(), propagation.HeaderCarrier(request.Header))
+	ctx, span := otel.Tracer("github.com/fiskaly/coding-challenges/signing-service-challenge/api").Start(ctx, request.Method,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("http.request.method", request.Method),
+			attribute.String("url.path", request.URL.Path),
+		),
+	)
+	if id, ok := RequestIDFromContext(ctx); ok {
+		span.SetAttributes(attribute.StringSlice("http.request.header.x-request-id", []string{id}))
+	}
+	if spanContext := span.SpanContext(); spanContext.IsValid() {
+		logging.Add(ctx, slog.String("trace_id", spanContext.TraceID().String()))
+	}
+	return request.WithContext(ctx), span
+}
+
+// endSpan ends the server span of a request to the given route, which names the span, with the given status.
+func endSpan(span trace.Span, method string, route string, status int) {
+	span.SetName(method + " " + route)
+	span.SetAttributes(
+		attribute.String("http.route", route),
+		attribute.Int("http.response.status_code", status),
+	)
+	if status >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(status))
+	}
+	span.End()
+}
@@ -0,0 +1,163 @@
+// Package audit verifies the signature chains of devices.
+package audit
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/cose"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/jose"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+)
+
+var (
+	// ErrBrokenChain indicates a signature that does not continue the chain of its device.
+	ErrBrokenChain = errors.New("signature chain is broken")
+	// ErrInvalidSignature indicates a signature that does not verify with the key of its device.
+	ErrInvalidSignature = errors.New("invalid signature")
+)
+
+// Verifier checks a signature in the format produced by the device signers, crypto.Signer implements it.
+type Verifier interface {
+	Verify(data []byte, signature []byte) error
+}
+
+// Chain verifies the signature chain of a device one signature at a time, in the order of their counters.
+type Chain struct {
+	deviceID string
+	verifier Verifier
+	next     uint32
+	last     []byte
+	signedAt time.Time
+	// unlinked is set until the first signature of a chain started in the middle is verified,
+	// as its predecessor is not known.
+	unlinked bool
+}
+
+// NewChain starts the verification of the chain of the device with the given ID.
+func NewChain(deviceID string, verifier Verifier) *Chain {
+	return &Chain{
+		deviceID: deviceID,
+		verifier: verifier,
+	}
+}
+
+// NewChainAt starts the verification in the middle of the chain of a device, at the signature with
+// the given counter, e.g. for the signatures of a period. The reference of that first signature
+// to its predecessor cannot be checked.
+func NewChainAt(deviceID string, verifier Verifier, counter uint32) *Chain {
+	return &Chain{
+		deviceID: deviceID,
+		verifier: verifier,
+		next:     counter,
+		unlinked: counter > 0,
+	}
+}
+
+// Verify checks that the signature is the next one of the chain, that its secured data refers to the previous
+// signature and that it verifies with the key of the device. The chain moves on to the signature regardless,
+// so a defect is reported once rather than for every following signature.
+func (c *Chain) Verify(signature types.Signature) error {
+	err := c.verify(signature)
+	c.unlinked = false
+	c.next = signature.Counter + 1
+	c.last = signature.Value
+	if signature.Timestamp.After(c.signedAt) {
+		c.signedAt = signature.Timestamp
+	}
+	return err
+}
+
+func (c *Chain) verify(signature types.Signature) error {
+	if signature.Counter != c.next {
+		return fmt.Errorf("%w: expected signature %d, got %d", ErrBrokenChain, c.next, signature.Counter)
+	}
+	if signature.Timestamp.Before(c.signedAt) {
+		return fmt.Errorf("%w: signature %d at %s precedes the previous one", ErrBrokenChain,
+			signature.Counter, signature.Timestamp.Format(time.RFC3339Nano))
+	}
+	// <counter>_[<timestamp>_]<data>_<previous signature or device ID, base64 encoded>
+	previous := c.last
+	if signature.Counter == 0 {
+		previous = []byte(c.deviceID)
+	}
+	prefix := []byte(strconv.FormatUint(uint64(signature.Counter), 10) + "_")
+	suffix := []byte("_" + base64.StdEncoding.EncodeToString(previous))
+	linked := bytes.HasSuffix(signature.SignedData, suffix) && len(signature.SignedData) >= len(prefix)+len(suffix)
+	if c.unlinked {
+		// only the structure can be checked
+		linked = bytes.Contains(bytes.TrimPrefix(signature.SignedData, prefix), []byte("_"))
+	}
+	if !bytes.HasPrefix(signature.SignedData, prefix) || !linked {
+		return fmt.Errorf("%w: secured data of signature %d does not refer to the previous signature", ErrBrokenChain, signature.Counter)
+	}
+	if err := c.verifySignature(signature); err != nil {
+		return fmt.Errorf("%w: signature %d: %v", ErrInvalidSignature, signature.Counter, err)
+	}
+	return nil
+}
+
+// verifySignature checks the value, or the envelope carrying it, against the secured data.
+func (c *Chain) verifySignature(signature types.Signature) error {
+	envelope := &recordingVerifier{verifier: c.verifier}
+	var payload []byte
+	var err error
+	switch signature.Format {
+	case "", types.FormatRaw, types.FormatCMS:
+		// the CMS envelope signs the document, while the value is computed over the secured data
+		return c.verifier.Verify(signature.SignedData, signature.Value)
+	case types.FormatJWS:
+		_, payload, err = jose.Verify(signature.Envelope, nil, envelope)
+	case types.FormatJWSDetached:
+		_, payload, err = jose.Verify(signature.Envelope, signature.SignedData, envelope)
+	case types.FormatCOSE:
+		_, payload, err = cose.Verify(signature.Envelope, nil, envelope)
+	default:
+		return fmt.Errorf("%w: %s", types.ErrUnknownSignatureFormat, signature.Format)
+	}
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(payload, signature.SignedData) {
+		return errors.New("envelope does not carry the secured data")
+	}
+	// the value is chained into the next signature, so it must be the signature of the envelope as well
+	return c.verifier.Verify(envelope.signingInput, signature.Value)
+}
+
+// recordingVerifier remembers the signing input of the envelope it verifies.
+type recordingVerifier struct {
+	verifier     Verifier
+	signingInput []byte
+}
+
+func (v *recordingVerifier) Verify(data []byte, signature []byte) error {
+	v.signingInput = data
+	return v.verifier.Verify(data, signature)
+}
+
+// Counter returns the counter the next signature must have, which is the number of signatures verified
+// if the chain is intact.
+func (c *Chain) Counter() uint32 {
+	return c.next
+}
+
+// Last returns the value of the last signature verified, nil if there is none.
+func (c *Chain) Last() []byte {
+	return c.last
+}
+
+// Close checks that the device refers to the last signature of the verified chain.
+func (c *Chain) Close(device *types.SignatureDevice) error {
+	if device.Counter != c.next {
+		return fmt.Errorf("%w: device counter is %d, but the chain ends at %d", ErrBrokenChain, device.Counter, c.next)
+	}
+	if !bytes.Equal(device.LastSignature, c.last) {
+		return fmt.Errorf("%w: device does not refer to the last signature of the chain", ErrBrokenChain)
+	}
+	return nil
+}
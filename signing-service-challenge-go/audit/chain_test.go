@@ -0,0 +1,217 @@
+package audit_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/audit"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+)
+
+// signChain creates a device and signs data once in each format.
+func signChain(t *testing.T, algorithm types.SigningAlgorithm) (*types.SignatureDevice, []types.Signature) {
+	t.Helper()
+	db := persistence.NewInMemoryDatabase()
+	service := domain.NewDeviceService(db)
+	device, err := service.Create(context.Background(), types.NewSignatureDevice{Algorithm: string(algorithm), Label: "audit"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	formats := []types.SignatureFormat{types.FormatRaw, types.FormatJWS, types.FormatJWSDetached, types.FormatCOSE}
+	for _, format := range formats {
+		if _, err = service.SignUsingDevice(context.Background(), device.ID, []byte("data"), format); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	if _, err = service.SignDocument(context.Background(), device.ID, []byte("document")); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if device, err = service.Get(context.Background(), device.ID); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	signatures, err := service.GetDeviceSignatures(context.Background(), device.ID)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	return device, signatures
+}
+
+func verifyChain(t *testing.T, device *types.SignatureDevice, signatures []types.Signature) error {
+	t.Helper()
+	signer, err := crypto.NewSigner(device.Algorithm, device.PkPem)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	chain := audit.NewChain(device.ID, signer)
+	var first error
+	for _, signature := range signatures {
+		if err = chain.Verify(signature); err != nil && first == nil {
+			first = err
+		}
+	}
+	if first != nil {
+		return first
+	}
+	return chain.Close(device)
+}
+
+func TestChain_Intact(t *testing.T) {
+	for _, algorithm := range []types.SigningAlgorithm{types.ECC, types.RSA, types.RSAPSS, types.Ed25519} {
+		t.Run(string(algorithm), func(t *testing.T) {
+			device, signatures := signChain(t, algorithm)
+			if err := verifyChain(t, device, signatures); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestChain_Tampered(t *testing.T) {
+	device, signatures := signChain(t, types.ECC)
+	_, otherKey, err := crypto.GenerateNewPair(types.ECC)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		tamper func(device *types.SignatureDevice, signatures []types.Signature) []types.Signature
+		err    error
+	}{
+		{
+			name: "Missing Signature",
+			tamper: func(_ *types.SignatureDevice, signatures []types.Signature) []types.Signature {
+				return append(signatures[:1], signatures[2:]...)
+			},
+			err: audit.ErrBrokenChain,
+		},
+		{
+			name: "Reordered Signatures",
+			tamper: func(_ *types.SignatureDevice, signatures []types.Signature) []types.Signature {
+				signatures[1], signatures[2] = signatures[2], signatures[1]
+				return signatures
+			},
+			err: audit.ErrBrokenChain,
+		},
+		{
+			name: "Timestamp Goes Back",
+			tamper: func(_ *types.SignatureDevice, signatures []types.Signature) []types.Signature {
+				signatures[3].Timestamp = signatures[2].Timestamp.Add(-time.Hour)
+				return signatures
+			},
+			err: audit.ErrBrokenChain,
+		},
+		{
+			name: "Secured Data Of Another Chain",
+			tamper: func(_ *types.SignatureDevice, signatures []types.Signature) []types.Signature {
+				signatures[0].SignedData = []byte("0_data_b3RoZXI=")
+				return signatures
+			},
+			err: audit.ErrBrokenChain,
+		},
+		{
+			name: "Modified Secured Data",
+			tamper: func(_ *types.SignatureDevice, signatures []types.Signature) []types.Signature {
+				signatures[0].SignedData = append([]byte("0_other"), signatures[0].SignedData[len("0_data"):]...)
+				return signatures
+			},
+			err: audit.ErrInvalidSignature,
+		},
+		{
+			name: "Modified Value",
+			tamper: func(device *types.SignatureDevice, signatures []types.Signature) []types.Signature {
+				last := &signatures[len(signatures)-1]
+				last.Value = signatures[0].Value
+				device.LastSignature = last.Value
+				return signatures
+			},
+			err: audit.ErrInvalidSignature,
+		},
+		{
+			name: "Value Does Not Match Envelope",
+			tamper: func(_ *types.SignatureDevice, signatures []types.Signature) []types.Signature {
+				// the JWS still verifies, but the chained value is another signature
+				signatures[1].Value = signatures[0].Value
+				return signatures
+			},
+			err: audit.ErrInvalidSignature,
+		},
+		{
+			name: "Unknown Format",
+			tamper: func(_ *types.SignatureDevice, signatures []types.Signature) []types.Signature {
+				signatures[2].Format = "pdf"
+				return signatures
+			},
+			err: audit.ErrInvalidSignature,
+		},
+		{
+			name: "Other Key",
+			tamper: func(device *types.SignatureDevice, signatures []types.Signature) []types.Signature {
+				device.PkPem = otherKey
+				return signatures
+			},
+			err: audit.ErrInvalidSignature,
+		},
+		{
+			name: "Device Ahead Of Chain",
+			tamper: func(device *types.SignatureDevice, signatures []types.Signature) []types.Signature {
+				device.Counter++
+				return signatures
+			},
+			err: audit.ErrBrokenChain,
+		},
+		{
+			name: "Device Refers To Other Signature",
+			tamper: func(device *types.SignatureDevice, signatures []types.Signature) []types.Signature {
+				device.LastSignature = signatures[0].Value
+				return signatures
+			},
+			err: audit.ErrBrokenChain,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tampered := *device
+			chain := test.tamper(&tampered, append([]types.Signature(nil), signatures...))
+			err := verifyChain(t, &tampered, chain)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("expected error %v, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestChainAt(t *testing.T) {
+	device, signatures := signChain(t, types.Ed25519)
+	signer, err := crypto.NewSigner(device.Algorithm, device.PkPem)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	chain := audit.NewChainAt(device.ID, signer, 2)
+	for _, signature := range signatures[2:] {
+		if err = chain.Verify(signature); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	if err = chain.Close(device); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// the signatures following the first one must still be linked
+	chain = audit.NewChainAt(device.ID, signer, 2)
+	if err = chain.Verify(signatures[2]); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	unlinked := signatures[3]
+	unlinked.SignedData = []byte("3_data_b3RoZXI=")
+	if err = chain.Verify(unlinked); !errors.Is(err, audit.ErrBrokenChain) {
+		t.Fatalf("expected error %v, got %v", audit.ErrBrokenChain, err)
+	}
+}
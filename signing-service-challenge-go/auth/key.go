@@ -0,0 +1,84 @@
+// Package auth authenticates API callers by API keys and authorizes them by the scopes of their key.
+package auth
+
+import (
+	"errors"
+	"slices"
+	"time"
+)
+
+// Scope is a permission granted to an API key.
+type Scope string
+
+const (
+	// ScopeDevicesCreate allows creating devices and managing their certificates.
+	ScopeDevicesCreate Scope = "devices:create"
+	// ScopeDevicesRead allows reading devices, their signatures and certificates.
+	ScopeDevicesRead Scope = "devices:read"
+	// ScopeSign allows signing with devices.
+	ScopeSign Scope = "sign"
+	// ScopeAudit allows exporting signature journals.
+	ScopeAudit Scope = "audit"
+	// ScopeAdmin allows managing API keys, backups and restores.
+	ScopeAdmin Scope = "admin"
+)
+
+// Scopes are all scopes, in the order they are documented.
+var Scopes = []Scope{ScopeDevicesCreate, ScopeDevicesRead, ScopeSign, ScopeAudit, ScopeAdmin}
+
+var (
+	// ErrKeyNotFound indicates an API key that does not exist.
+	ErrKeyNotFound = errors.New("API key not found")
+	// ErrKeyAlreadyExists indicates an API key with an ID that is already taken.
+	ErrKeyAlreadyExists = errors.New("API key already exists")
+	// ErrInvalidKey indicates a token that does not belong to an active API key.
+	ErrInvalidKey = errors.New("invalid API key")
+	// ErrInvalidScope indicates an unknown scope or a key without scopes.
+	ErrInvalidScope = errors.New("invalid scope")
+)
+
+// Key is an API key. Only the SHA-256 hash of its token is stored, the token itself is shown once on creation.
+type Key struct {
+	ID string `json:"id"`
+	// OrganizationID is the organization the key acts for, it only accesses devices of this organization.
+	OrganizationID string  `json:"organization_id"`
+	Name           string  `json:"name"`
+	Hash           []byte  `json:"hash"`
+	Scopes         []Scope `json:"scopes"`
+	// DeviceIDs restricts the key to the given devices, an empty list allows all devices.
+	DeviceIDs []string   `json:"device_ids"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// HasScope reports whether the key grants the given scope.
+func (k *Key) HasScope(scope Scope) bool {
+	return slices.Contains(k.Scopes, scope)
+}
+
+// Restricted reports whether the key is restricted to a set of devices.
+func (k *Key) Restricted() bool {
+	return len(k.DeviceIDs) > 0
+}
+
+// AllowsDevice reports whether the key may access the device with the given ID.
+func (k *Key) AllowsDevice(id string) bool {
+	return !k.Restricted() || slices.Contains(k.DeviceIDs, id)
+}
+
+// Revoked reports whether the key has been revoked.
+func (k *Key) Revoked() bool {
+	return k.RevokedAt != nil
+}
+
+// KeyStore persists API keys.
+type KeyStore interface {
+	// CreateAPIKey stores a new key, ErrKeyAlreadyExists if its ID is taken.
+	CreateAPIKey(key *Key) error
+	// GetAPIKey retrieves a key by its ID, ErrKeyNotFound if there is none.
+	GetAPIKey(id string) (*Key, error)
+	// GetAllAPIKeys retrieves all keys, including revoked ones, ordered by creation.
+	GetAllAPIKeys() ([]*Key, error)
+	// RevokeAPIKey marks a key as revoked at the given time, unless it is revoked already.
+	RevokeAPIKey(id string, revokedAt time.Time) error
+}
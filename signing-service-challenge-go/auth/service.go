@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+	"github.com/google/uuid"
+)
+
+const (
+	// tokenPrefix starts every token, which makes leaked tokens easy to find, e.g. by secret scanners.
+	tokenPrefix = "sk_"
+	// secretSize is the number of random bytes of a token.
+	secretSize = 32
+)
+
+// AdminKeyID is the ID of the bootstrap admin key configured by WithAdminKeyHash, which acts for the default organization.
+const AdminKeyID = "admin"
+
+// Option configures optional behaviour of a Service.
+type Option func(*Service)
+
+// WithAdminKeyHash accepts the token with the given SHA-256 hash as admin key with all scopes, so that
+// the first API keys can be created. The token itself never needs to be configured.
+func WithAdminKeyHash(hash []byte) Option {
+	return func(s *Service) {
+		s.adminHash = hash
+	}
+}
+
+// Service creates, authenticates and revokes API keys.
+type Service struct {
+	store     KeyStore
+	adminHash []byte
+}
+
+// NewService creates a Service storing the keys in store.
+func NewService(store KeyStore, opts ...Option) *Service {
+	s := &Service{store: store}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Hash returns the SHA-256 hash of a token, as stored for its key.
+func Hash(token string) []byte {
+	hash := sha256.Sum256([]byte(token))
+	return hash[:]
+}
+
+// Create creates a key of an organization with the given scopes, restricted to the given devices if any,
+// and returns it together with its token. The token cannot be recovered later.
+func (s *Service) Create(organizationID string, name string, scopes []Scope, deviceIDs []string) (*Key, string, error) {
+	if len(scopes) == 0 {
+		return nil, "", fmt.Errorf("%w: at least one scope is required", ErrInvalidScope)
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(Scopes, scope) {
+			return nil, "", fmt.Errorf("%w: %s", ErrInvalidScope, scope)
+		}
+	}
+	secret := make([]byte, secretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	id := uuid.NewString()
+	token := tokenPrefix + id + "." + base64.RawURLEncoding.EncodeToString(secret)
+	if organizationID == "" {
+		organizationID = types.DefaultOrganizationID
+	}
+	if deviceIDs == nil {
+		deviceIDs = []string{}
+	}
+	key := &Key{
+		ID:             id,
+		OrganizationID: organizationID,
+		Name:           name,
+		Hash:           Hash(token),
+		Scopes:         slices.Compact(slices.Sorted(slices.Values(scopes))),
+		DeviceIDs:      deviceIDs,
+		CreatedAt:      time.Now().UTC(),
+	}
+	if err := s.store.CreateAPIKey(key); err != nil {
+		return nil, "", err
+	}
+	return key, token, nil
+}
+
+// Authenticate returns the active key of a token, ErrInvalidKey if there is none.
+func (s *Service) Authenticate(token string) (*Key, error) {
+	hash := Hash(token)
+	if s.adminHash != nil && subtle.ConstantTimeCompare(hash, s.adminHash) == 1 {
+		return &Key{
+			ID:             AdminKeyID,
+			OrganizationID: types.DefaultOrganizationID,
+			Name:           "bootstrap admin key",
+			Scopes:         Scopes,
+			DeviceIDs:      []string{},
+		}, nil
+	}
+	id, _, ok := strings.Cut(strings.TrimPrefix(token, tokenPrefix), ".")
+	if !ok || !strings.HasPrefix(token, tokenPrefix) {
+		return nil, ErrInvalidKey
+	}
+	key, err := s.store.GetAPIKey(id)
+	if errors.Is(err, ErrKeyNotFound) {
+		return nil, ErrInvalidKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare(hash, key.Hash) != 1 || key.Revoked() {
+		return nil, ErrInvalidKey
+	}
+	return key, nil
+}
+
+// Get returns the key with the given ID, including revoked keys.
+func (s *Service) Get(id string) (*Key, error) {
+	return s.store.GetAPIKey(id)
+}
+
+// List returns all keys, including revoked ones.
+func (s *Service) List() ([]*Key, error) {
+	return s.store.GetAllAPIKeys()
+}
+
+// Revoke revokes the key with the given ID, which is rejected from then on, and returns it.
+func (s *Service) Revoke(id string) (*Key, error) {
+	if err := s.store.RevokeAPIKey(id, time.Now().UTC()); err != nil {
+		return nil, err
+	}
+	return s.store.GetAPIKey(id)
+}
@@ -0,0 +1,121 @@
+package auth_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/auth"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+)
+
+func TestService_CreateAndAuthenticate(t *testing.T) {
+	db := persistence.NewInMemoryDatabase()
+	service := auth.NewService(db)
+	key, token, err := service.Create("store-42", "store 42", []auth.Scope{auth.ScopeSign, auth.ScopeDevicesRead, auth.ScopeSign}, []string{"device-a"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !strings.HasPrefix(token, "sk_"+key.ID+".") {
+		t.Fatalf("expected a token with the key ID, got %s", token)
+	}
+	stored, err := db.GetAPIKey(key.ID)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if strings.Contains(string(stored.Hash), token) || len(stored.Hash) != 32 {
+		t.Fatalf("expected only the hash of the token to be stored, got %x", stored.Hash)
+	}
+	if stored.OrganizationID != "store-42" {
+		t.Fatalf("expected the key to belong to store-42, got %s", stored.OrganizationID)
+	}
+	if len(key.Scopes) != 2 {
+		t.Fatalf("expected duplicate scopes to be removed, got %v", key.Scopes)
+	}
+
+	authenticated, err := service.Authenticate(token)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if authenticated.ID != key.ID || !authenticated.HasScope(auth.ScopeSign) || authenticated.HasScope(auth.ScopeAdmin) {
+		t.Fatalf("unexpected key %+v", authenticated)
+	}
+	if !authenticated.AllowsDevice("device-a") || authenticated.AllowsDevice("device-b") {
+		t.Fatalf("expected the key to be restricted to device-a, got %v", authenticated.DeviceIDs)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"Empty", ""},
+		{"Wrong Secret", token[:len(token)-2] + "xx"},
+		{"Unknown Key", "sk_unknown." + strings.SplitN(token, ".", 2)[1]},
+		{"Missing Prefix", strings.TrimPrefix(token, "sk_")},
+		{"Malformed", "sk_" + key.ID},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := service.Authenticate(test.token); !errors.Is(err, auth.ErrInvalidKey) {
+				t.Fatalf("expected error %v, got %v", auth.ErrInvalidKey, err)
+			}
+		})
+	}
+}
+
+func TestService_Revoke(t *testing.T) {
+	service := auth.NewService(persistence.NewInMemoryDatabase())
+	key, token, err := service.Create("", "audit", []auth.Scope{auth.ScopeAudit}, nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if key.OrganizationID != types.DefaultOrganizationID {
+		t.Fatalf("expected the key to belong to the default organization, got %s", key.OrganizationID)
+	}
+	revoked, err := service.Revoke(key.ID)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !revoked.Revoked() {
+		t.Fatal("expected the key to be revoked")
+	}
+	if _, err = service.Authenticate(token); !errors.Is(err, auth.ErrInvalidKey) {
+		t.Fatalf("expected error %v, got %v", auth.ErrInvalidKey, err)
+	}
+	if _, err = service.Revoke("unknown"); !errors.Is(err, auth.ErrKeyNotFound) {
+		t.Fatalf("expected error %v, got %v", auth.ErrKeyNotFound, err)
+	}
+	keys, err := service.List()
+	if err != nil || len(keys) != 1 {
+		t.Fatalf("expected the revoked key to be listed, got %v, %v", keys, err)
+	}
+}
+
+func TestService_InvalidScope(t *testing.T) {
+	service := auth.NewService(persistence.NewInMemoryDatabase())
+	for _, scopes := range [][]auth.Scope{nil, {"devices:delete"}} {
+		if _, _, err := service.Create("", "invalid", scopes, nil); !errors.Is(err, auth.ErrInvalidScope) {
+			t.Fatalf("expected error %v, got %v", auth.ErrInvalidScope, err)
+		}
+	}
+}
+
+func TestService_AdminKey(t *testing.T) {
+	service := auth.NewService(persistence.NewInMemoryDatabase(), auth.WithAdminKeyHash(auth.Hash("bootstrap")))
+	key, err := service.Authenticate("bootstrap")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	for _, scope := range auth.Scopes {
+		if !key.HasScope(scope) {
+			t.Fatalf("expected the admin key to have scope %s", scope)
+		}
+	}
+	if key.Restricted() {
+		t.Fatalf("expected the admin key to allow all devices, got %v", key.DeviceIDs)
+	}
+	if _, err = service.Authenticate("bootstrap2"); !errors.Is(err, auth.ErrInvalidKey) {
+		t.Fatalf("expected error %v, got %v", auth.ErrInvalidKey, err)
+	}
+}
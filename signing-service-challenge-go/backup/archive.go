@@ -0,0 +1,375 @@
+// Package backup writes and restores signed archives of all devices and their signature chains.
+//
+// An archive is a gzip compressed tar file with the entries
+//
+//	devices/<id>.json        the device, its private key encrypted with the backup key
+//	signatures/<id>.ndjson   the signature chain of the device, one signature per line
+//	manifest.json            version, SHA-256 checksum of every entry and counter of every device
+//	manifest.sig             signature of manifest.json with the backup key
+package backup
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/audit"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+)
+
+const (
+	// Version is the version of the archive format written by Write.
+	Version = 1
+
+	manifestFile  = "manifest.json"
+	signatureFile = "manifest.sig"
+	// pageSize is the number of signatures read from the database at once.
+	pageSize = 1000
+)
+
+var (
+	// ErrInvalidBackup indicates an archive that is malformed, tampered with or signed with another key.
+	ErrInvalidBackup = errors.New("invalid backup")
+	// ErrUnsupportedVersion indicates an archive written in an unknown format version.
+	ErrUnsupportedVersion = errors.New("unsupported backup version")
+)
+
+// Archive is the verified content of a backup.
+type Archive struct {
+	CreatedAt time.Time
+	Devices   []DeviceHistory
+}
+
+// DeviceHistory is a device, with its decrypted private key, and its complete signature chain.
+type DeviceHistory struct {
+	Device     *types.SignatureDevice
+	Signatures []types.Signature
+}
+
+type manifest struct {
+	Version   int              `json:"version"`
+	CreatedAt time.Time        `json:"created_at"`
+	KeyID     string           `json:"key_id"`
+	Files     []manifestEntry  `json:"files"`
+	Devices   []manifestDevice `json:"devices"`
+}
+
+type manifestEntry struct {
+	Name   string `json:"name"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+type manifestDevice struct {
+	ID      string `json:"id"`
+	Counter uint32 `json:"counter"`
+}
+
+type deviceRecord struct {
+	ID            string                 `json:"id"`
+	Algorithm     types.SigningAlgorithm `json:"algorithm"`
+	Label         string                 `json:"label"`
+	Counter       uint32                 `json:"counter"`
+	Certificate   []byte                 `json:"certificate,omitempty"`
+	WrappedKey    []byte                 `json:"wrapped_key"`
+	LastSignature []byte                 `json:"last_signature,omitempty"`
+	LastSignedAt  time.Time              `json:"last_signed_at"`
+	Organization  string                 `json:"organization_id,omitempty"`
+}
+
+func deviceFile(id string) string {
+	return "devices/" + id + ".json"
+}
+
+func signaturesFile(id string) string {
+	return "signatures/" + id + ".ndjson"
+}
+
+// Write streams a backup of all devices of db to w. Every device is backed up as of the moment its entry
+// is written: the signatures up to the counter read with the device, later signatures are not included.
+func Write(w io.Writer, db domain.Database, keys *Keys) error {
+	gz := gzip.NewWriter(w)
+	archive := tar.NewWriter(gz)
+	now := time.Now().UTC()
+	m := manifest{
+		Version:   Version,
+		CreatedAt: now,
+		KeyID:     keys.keyID,
+		Files:     []manifestEntry{},
+		Devices:   []manifestDevice{},
+	}
+	add := func(name string, content []byte) error {
+		digest := sha256.Sum256(content)
+		m.Files = append(m.Files, manifestEntry{Name: name, SHA256: hex.EncodeToString(digest[:]), Size: int64(len(content))})
+		return writeEntry(archive, name, content, now)
+	}
+
+	devices, err := db.GetAllSignatureDevices()
+	if err != nil {
+		return fmt.Errorf("failed to read devices: %w", err)
+	}
+	for _, device := range devices {
+		signatures, err := readSignatures(db, device)
+		if err != nil {
+			return err
+		}
+		wrappedKey, err := keys.wrap(device.ID, device.PkPem)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt key of device %s: %w", device.ID, err)
+		}
+		record, err := json.Marshal(deviceRecord{
+			ID:            device.ID,
+			Algorithm:     device.Algorithm,
+			Label:         device.Label,
+			Counter:       device.Counter,
+			Certificate:   device.Certificate,
+			WrappedKey:    wrappedKey,
+			LastSignature: device.LastSignature,
+			LastSignedAt:  device.LastSignedAt,
+			Organization:  device.OrganizationID,
+		})
+		if err != nil {
+			return err
+		}
+		if err = add(deviceFile(device.ID), record); err != nil {
+			return err
+		}
+		if err = add(signaturesFile(device.ID), signatures); err != nil {
+			return err
+		}
+		m.Devices = append(m.Devices, manifestDevice{ID: device.ID, Counter: device.Counter})
+	}
+
+	encoded, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	signature, err := keys.signer.Sign(encoded)
+	if err != nil {
+		return fmt.Errorf("failed to sign manifest: %w", err)
+	}
+	if err = writeEntry(archive, manifestFile, encoded, now); err != nil {
+		return err
+	}
+	if err = writeEntry(archive, signatureFile, signature, now); err != nil {
+		return err
+	}
+	if err = archive.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// readSignatures encodes the signatures preceding the counter of the device as NDJSON, reading them in pages.
+func readSignatures(db domain.Database, device *types.SignatureDevice) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for from := uint32(0); from < device.Counter; from += pageSize {
+		to := min(uint64(from)+pageSize, uint64(device.Counter)) - 1
+		page, err := db.GetSignatures(device.ID, from, uint32(to))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read signatures of device %s: %w", device.ID, err)
+		}
+		if uint64(len(page)) != to-uint64(from)+1 {
+			return nil, fmt.Errorf("failed to read signatures of device %s: expected %d signatures from %d, got %d",
+				device.ID, to-uint64(from)+1, from, len(page))
+		}
+		for _, signature := range page {
+			if err = encoder.Encode(signature); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func writeEntry(archive *tar.Writer, name string, content []byte, modified time.Time) error {
+	err := archive.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0o600,
+		Size:     int64(len(content)),
+		ModTime:  modified,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	if _, err = archive.Write(content); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+// Read verifies the signature and the checksums of a backup, decrypts the device keys and audits
+// every signature chain. Only a backup that passes all checks is returned.
+func Read(r io.Reader, keys *Keys) (*Archive, error) {
+	files, err := readEntries(r)
+	if err != nil {
+		return nil, err
+	}
+	m, err := verifyManifest(files, keys)
+	if err != nil {
+		return nil, err
+	}
+	archive := &Archive{CreatedAt: m.CreatedAt}
+	for _, entry := range m.Devices {
+		history, err := readDevice(files, entry, keys)
+		if err != nil {
+			return nil, fmt.Errorf("%w: device %s: %w", ErrInvalidBackup, entry.ID, err)
+		}
+		archive.Devices = append(archive.Devices, *history)
+	}
+	return archive, nil
+}
+
+// readEntries reads all regular files of the archive into memory.
+func readEntries(r io.Reader) (map[string][]byte, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidBackup, err)
+	}
+	defer gz.Close()
+	archive := tar.NewReader(gz)
+	files := make(map[string][]byte)
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			return files, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidBackup, err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			return nil, fmt.Errorf("%w: unexpected entry %s", ErrInvalidBackup, header.Name)
+		}
+		if _, exists := files[header.Name]; exists {
+			return nil, fmt.Errorf("%w: duplicate entry %s", ErrInvalidBackup, header.Name)
+		}
+		if files[header.Name], err = io.ReadAll(archive); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidBackup, err)
+		}
+	}
+}
+
+// verifyManifest checks the signature of the manifest and that the archive holds exactly the files it lists.
+func verifyManifest(files map[string][]byte, keys *Keys) (*manifest, error) {
+	encoded, exists := files[manifestFile]
+	if !exists {
+		return nil, fmt.Errorf("%w: missing %s", ErrInvalidBackup, manifestFile)
+	}
+	signature, exists := files[signatureFile]
+	if !exists {
+		return nil, fmt.Errorf("%w: missing %s", ErrInvalidBackup, signatureFile)
+	}
+	var m manifest
+	if err := json.Unmarshal(encoded, &m); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+	}
+	if m.Version != Version {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, m.Version)
+	}
+	if m.KeyID != keys.keyID {
+		return nil, fmt.Errorf("%w: signed with key %s, expected %s", ErrInvalidBackup, m.KeyID, keys.keyID)
+	}
+	if err := keys.signer.Verify(encoded, signature); err != nil {
+		return nil, fmt.Errorf("%w: manifest signature: %v", ErrInvalidBackup, err)
+	}
+
+	listed := make(map[string]bool, len(m.Files))
+	for _, entry := range m.Files {
+		content, exists := files[entry.Name]
+		if !exists {
+			return nil, fmt.Errorf("%w: missing %s", ErrInvalidBackup, entry.Name)
+		}
+		digest := sha256.Sum256(content)
+		if int64(len(content)) != entry.Size || hex.EncodeToString(digest[:]) != entry.SHA256 {
+			return nil, fmt.Errorf("%w: checksum mismatch of %s", ErrInvalidBackup, entry.Name)
+		}
+		listed[entry.Name] = true
+	}
+	for name := range files {
+		if !listed[name] && name != manifestFile && name != signatureFile {
+			return nil, fmt.Errorf("%w: unexpected entry %s", ErrInvalidBackup, name)
+		}
+	}
+	seen := make(map[string]bool, len(m.Devices))
+	for _, device := range m.Devices {
+		if device.ID == "" || strings.ContainsRune(device.ID, '/') || seen[device.ID] {
+			return nil, fmt.Errorf("%w: invalid device ID %q", ErrInvalidBackup, device.ID)
+		}
+		if !listed[deviceFile(device.ID)] || !listed[signaturesFile(device.ID)] {
+			return nil, fmt.Errorf("%w: missing entries of device %s", ErrInvalidBackup, device.ID)
+		}
+		seen[device.ID] = true
+	}
+	if len(m.Files) != 2*len(m.Devices) {
+		return nil, fmt.Errorf("%w: entries do not belong to the listed devices", ErrInvalidBackup)
+	}
+	return &m, nil
+}
+
+// readDevice decodes a device and its signatures and audits the chain.
+func readDevice(files map[string][]byte, entry manifestDevice, keys *Keys) (*DeviceHistory, error) {
+	var record deviceRecord
+	if err := json.Unmarshal(files[deviceFile(entry.ID)], &record); err != nil {
+		return nil, err
+	}
+	if record.ID != entry.ID || record.Counter != entry.Counter {
+		return nil, errors.New("device does not match the manifest")
+	}
+	pkPem, err := keys.unwrap(record.ID, record.WrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt key: %w", err)
+	}
+	device := &types.SignatureDevice{
+		ID:             record.ID,
+		Algorithm:      record.Algorithm,
+		Label:          record.Label,
+		Counter:        record.Counter,
+		PkPem:          pkPem,
+		Certificate:    record.Certificate,
+		LastSignature:  record.LastSignature,
+		LastSignedAt:   record.LastSignedAt,
+		OrganizationID: record.Organization,
+	}
+	signer, err := crypto.NewSigner(device.Algorithm, device.PkPem)
+	if err != nil {
+		return nil, err
+	}
+
+	chain := audit.NewChain(device.ID, signer)
+	signatures := make([]types.Signature, 0, device.Counter)
+	scanner := bufio.NewScanner(bytes.NewReader(files[signaturesFile(entry.ID)]))
+	scanner.Buffer(nil, len(files[signaturesFile(entry.ID)])+1)
+	for scanner.Scan() {
+		var signature types.Signature
+		if err = json.Unmarshal(scanner.Bytes(), &signature); err != nil {
+			return nil, err
+		}
+		if err = chain.Verify(signature); err != nil {
+			return nil, err
+		}
+		signatures = append(signatures, signature)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err = chain.Close(device); err != nil {
+		return nil, err
+	}
+	if len(signatures) > 0 && !signatures[len(signatures)-1].Timestamp.Equal(device.LastSignedAt) {
+		return nil, errors.New("device does not refer to the time of its last signature")
+	}
+	return &DeviceHistory{Device: device, Signatures: signatures}, nil
+}
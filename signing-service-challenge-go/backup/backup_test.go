@@ -0,0 +1,420 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+)
+
+func newKeys(t *testing.T) *Keys {
+	t.Helper()
+	_, privatePem, err := crypto.GenerateNewPair(types.ECC)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	keys, err := NewKeys(privatePem)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	return keys
+}
+
+// newDevice creates a device in db and signs n times with it.
+func newDevice(t *testing.T, service *domain.DeviceService, algorithm types.SigningAlgorithm, n int) string {
+	t.Helper()
+	device, err := service.Create(context.Background(), types.NewSignatureDevice{Algorithm: string(algorithm), Label: "backup"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	sign(t, service, device.ID, n)
+	return device.ID
+}
+
+func sign(t *testing.T, service *domain.DeviceService, id string, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if _, err := service.SignUsingDevice(context.Background(), id, []byte("data"), types.FormatRaw); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+}
+
+func backup(t *testing.T, db domain.Database, keys *Keys) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := Write(&buf, db, keys); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	return buf.Bytes()
+}
+
+func restore(db domain.Database, archive []byte, keys *Keys, merge bool) (*Summary, error) {
+	return NewService(db, keys).Restore(bytes.NewReader(archive), merge)
+}
+
+// expectEqual checks that both databases hold the same devices and chains.
+func expectEqual(t *testing.T, expected, actual domain.Database) {
+	t.Helper()
+	devices, err := expected.GetAllSignatureDevices()
+	if err != nil {
+		t.Fatalf("failed to get devices: %v", err)
+	}
+	if restored, err := actual.GetAllSignatureDevices(); err != nil || len(restored) != len(devices) {
+		t.Fatalf("expected %d devices, got %d, %v", len(devices), len(restored), err)
+	}
+	for _, device := range devices {
+		restored, err := actual.GetSignatureDevice(device.ID)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if restored.Counter != device.Counter || restored.Label != device.Label || !bytes.Equal(restored.PkPem, device.PkPem) ||
+			!bytes.Equal(restored.Certificate, device.Certificate) || !bytes.Equal(restored.LastSignature, device.LastSignature) ||
+			!restored.LastSignedAt.Equal(device.LastSignedAt) || restored.OrganizationID != device.OrganizationID {
+			t.Fatalf("expected device %+v, got %+v", device, restored)
+		}
+		signatures, err := expected.GetSignatures(device.ID, 0, device.Counter)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		restoredSignatures, err := actual.GetSignatures(device.ID, 0, device.Counter)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(restoredSignatures) != len(signatures) {
+			t.Fatalf("expected %d signatures, got %d", len(signatures), len(restoredSignatures))
+		}
+		for i := range signatures {
+			if !bytes.Equal(restoredSignatures[i].Value, signatures[i].Value) || !bytes.Equal(restoredSignatures[i].SignedData, signatures[i].SignedData) {
+				t.Fatalf("expected signature %d to be restored", i)
+			}
+		}
+	}
+}
+
+func TestBackup_RoundTrip(t *testing.T) {
+	keys := newKeys(t)
+	db := persistence.NewInMemoryDatabase()
+	service := domain.NewDeviceService(db)
+	newDevice(t, service, types.ECC, 3)
+	newDevice(t, service, types.RSA, 1)
+	newDevice(t, service, types.ECC, 0)
+	// more than a page of signatures
+	newDevice(t, service, types.Ed25519, pageSize+5)
+	newDevice(t, service.ForOrganization(&types.Organization{ID: "store-a"}), types.ECC, 1)
+	archive := backup(t, db, keys)
+
+	restored := persistence.NewInMemoryDatabase()
+	summary, err := restore(restored, archive, keys, false)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	expected := Summary{Devices: 5, Created: 5, Signatures: pageSize + 10}
+	if *summary != expected {
+		t.Fatalf("expected summary %+v, got %+v", expected, *summary)
+	}
+	expectEqual(t, db, restored)
+
+	// restoring again is refused without merging, and changes nothing with it
+	if _, err = restore(restored, archive, keys, false); !errors.Is(err, ErrNotEmpty) {
+		t.Fatalf("expected error %v, got %v", ErrNotEmpty, err)
+	}
+	summary, err = restore(restored, archive, keys, true)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if expected = (Summary{Devices: 5}); *summary != expected {
+		t.Fatalf("expected summary %+v, got %+v", expected, *summary)
+	}
+	expectEqual(t, db, restored)
+
+	// the restored devices keep signing where the originals stopped
+	restoredService := domain.NewDeviceService(restored)
+	devices, err := db.GetAllSignatureDevices()
+	if err != nil {
+		t.Fatalf("failed to get devices: %v", err)
+	}
+	for _, device := range devices {
+		signature, err := restoredService.SignUsingDevice(context.Background(), device.ID, []byte("data"), types.FormatRaw)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if signature.Counter != device.Counter {
+			t.Fatalf("expected counter %d, got %d", device.Counter, signature.Counter)
+		}
+	}
+}
+
+// rewrite applies edit to the entries of an archive. If resign is set, the manifest is updated
+// to the edited entries and signed again, as if the backup key was used to forge the archive.
+func rewrite(t *testing.T, archive []byte, keys *Keys, resign bool, edit func(files map[string][]byte)) []byte {
+	t.Helper()
+	files, err := readEntries(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	edit(files)
+	if resign {
+		var m manifest
+		if err = json.Unmarshal(files[manifestFile], &m); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		for i, entry := range m.Files {
+			digest := sha256.Sum256(files[entry.Name])
+			m.Files[i].SHA256 = hex.EncodeToString(digest[:])
+			m.Files[i].Size = int64(len(files[entry.Name]))
+		}
+		if files[manifestFile], err = json.Marshal(m); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if files[signatureFile], err = keys.signer.Sign(files[manifestFile]); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	writer := tar.NewWriter(gz)
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		if err = writeEntry(writer, name, files[name], time.Now()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	if err = writer.Close(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err = gz.Close(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestBackup_Invalid(t *testing.T) {
+	keys := newKeys(t)
+	db := persistence.NewInMemoryDatabase()
+	service := domain.NewDeviceService(db)
+	id := newDevice(t, service, types.ECC, 3)
+	archive := backup(t, db, keys)
+
+	tests := []struct {
+		name    string
+		archive func() []byte
+		keys    *Keys
+		err     error
+	}{
+		{
+			name:    "Not An Archive",
+			archive: func() []byte { return []byte("backup") },
+			err:     ErrInvalidBackup,
+		},
+		{
+			name: "Truncated",
+			archive: func() []byte {
+				return archive[:len(archive)/2]
+			},
+			err: ErrInvalidBackup,
+		},
+		{
+			name:    "Other Key",
+			archive: func() []byte { return archive },
+			keys:    newKeys(t),
+			err:     ErrInvalidBackup,
+		},
+		{
+			name: "Modified Entry",
+			archive: func() []byte {
+				return rewrite(t, archive, keys, false, func(files map[string][]byte) {
+					files[deviceFile(id)] = bytes.Replace(files[deviceFile(id)], []byte("backup"), []byte("forged"), 1)
+				})
+			},
+			err: ErrInvalidBackup,
+		},
+		{
+			name: "Modified Manifest",
+			archive: func() []byte {
+				return rewrite(t, archive, keys, false, func(files map[string][]byte) {
+					files[manifestFile] = bytes.Replace(files[manifestFile], []byte(`"counter": 3`), []byte(`"counter": 2`), 1)
+				})
+			},
+			err: ErrInvalidBackup,
+		},
+		{
+			name: "Missing Entry",
+			archive: func() []byte {
+				return rewrite(t, archive, keys, false, func(files map[string][]byte) {
+					delete(files, signaturesFile(id))
+				})
+			},
+			err: ErrInvalidBackup,
+		},
+		{
+			name: "Unexpected Entry",
+			archive: func() []byte {
+				return rewrite(t, archive, keys, false, func(files map[string][]byte) {
+					files["devices/other.json"] = files[deviceFile(id)]
+				})
+			},
+			err: ErrInvalidBackup,
+		},
+		{
+			name: "Missing Signature",
+			archive: func() []byte {
+				return rewrite(t, archive, keys, false, func(files map[string][]byte) {
+					delete(files, signatureFile)
+				})
+			},
+			err: ErrInvalidBackup,
+		},
+		{
+			name: "Unsupported Version",
+			archive: func() []byte {
+				return rewrite(t, archive, keys, false, func(files map[string][]byte) {
+					files[manifestFile] = bytes.Replace(files[manifestFile], []byte(`"version": 1`), []byte(`"version": 2`), 1)
+				})
+			},
+			err: ErrUnsupportedVersion,
+		},
+		{
+			name: "Broken Chain",
+			archive: func() []byte {
+				return rewrite(t, archive, keys, true, func(files map[string][]byte) {
+					lines := bytes.SplitAfter(files[signaturesFile(id)], []byte("\n"))
+					files[signaturesFile(id)] = bytes.Join([][]byte{lines[0], lines[2], lines[1]}, nil)
+				})
+			},
+			err: ErrInvalidBackup,
+		},
+		{
+			name: "Truncated Chain",
+			archive: func() []byte {
+				return rewrite(t, archive, keys, true, func(files map[string][]byte) {
+					lines := bytes.SplitAfter(files[signaturesFile(id)], []byte("\n"))
+					files[signaturesFile(id)] = bytes.Join(lines[:2], nil)
+				})
+			},
+			err: ErrInvalidBackup,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			readKeys := keys
+			if test.keys != nil {
+				readKeys = test.keys
+			}
+			restored := persistence.NewInMemoryDatabase()
+			_, err := restore(restored, test.archive(), readKeys, false)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("expected error %v, got %v", test.err, err)
+			}
+			if devices, err := restored.GetAllSignatureDevices(); err != nil || len(devices) != 0 {
+				t.Fatalf("expected no devices to be restored, got %d, %v", len(devices), err)
+			}
+		})
+	}
+}
+
+func TestRestore_Existing(t *testing.T) {
+	keys := newKeys(t)
+	db := persistence.NewInMemoryDatabase()
+	service := domain.NewDeviceService(db)
+	id := newDevice(t, service, types.ECC, 2)
+	older := backup(t, db, keys)
+	sign(t, service, id, 2)
+	other := newDevice(t, service, types.ECC, 1)
+	newer := backup(t, db, keys)
+
+	t.Run("Resume From Older Backup", func(t *testing.T) {
+		restored := persistence.NewInMemoryDatabase()
+		if _, err := restore(restored, older, keys, false); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		summary, err := restore(restored, newer, keys, true)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		expected := Summary{Devices: 2, Created: 1, Signatures: 3}
+		if *summary != expected {
+			t.Fatalf("expected summary %+v, got %+v", expected, *summary)
+		}
+		expectEqual(t, db, restored)
+	})
+
+	t.Run("Counter Rollback Refused", func(t *testing.T) {
+		// the device signed after the backup was taken, and the other device is not in the backup
+		_, err := restore(db, older, keys, true)
+		if !errors.Is(err, ErrCounterRollback) {
+			t.Fatalf("expected error %v, got %v", ErrCounterRollback, err)
+		}
+		device, err := db.GetSignatureDevice(id)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if device.Counter != 4 {
+			t.Fatalf("expected counter 4, got %d", device.Counter)
+		}
+	})
+
+	t.Run("Chain Mismatch", func(t *testing.T) {
+		// a device with the same ID, which signed other data
+		restored := persistence.NewInMemoryDatabase()
+		if _, err := restore(restored, older, keys, false); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		forked := domain.NewDeviceService(restored)
+		if _, err := forked.SignUsingDevice(context.Background(), id, []byte("other"), types.FormatRaw); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		_, err := restore(restored, newer, keys, true)
+		if !errors.Is(err, ErrChainMismatch) {
+			t.Fatalf("expected error %v, got %v", ErrChainMismatch, err)
+		}
+		if _, err = restored.GetSignatureDevice(other); !errors.Is(err, types.ErrDeviceNotFound) {
+			t.Fatalf("expected error %v, got %v", types.ErrDeviceNotFound, err)
+		}
+	})
+
+	t.Run("Other Key", func(t *testing.T) {
+		restored := persistence.NewInMemoryDatabase()
+		_, privatePem, err := crypto.GenerateNewPair(types.ECC)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if err = restored.CreateSignatureDevice(&types.SignatureDevice{ID: id, Algorithm: types.ECC, PkPem: privatePem}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		_, err = restore(restored, newer, keys, true)
+		if !errors.Is(err, ErrChainMismatch) {
+			t.Fatalf("expected error %v, got %v", ErrChainMismatch, err)
+		}
+	})
+}
+
+func TestNewKeys_Invalid(t *testing.T) {
+	if _, err := NewKeys([]byte("key")); err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+	_, privatePem, err := crypto.GenerateNewPair(types.Ed25519)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err = NewKeys(privatePem); err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+}
@@ -0,0 +1,95 @@
+package backup
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+)
+
+// Keys protect backups: the manifest of an archive is signed, the private keys of the devices are encrypted.
+type Keys struct {
+	signer crypto.Signer
+	keyID  string
+	aead   cipher.AEAD
+}
+
+// NewKeys derives the backup keys from a PEM encoded ECC private key, in the same format as device keys.
+// The key signs the manifest, the AES-256 key encrypting device keys is derived from it.
+func NewKeys(privatePem []byte) (*Keys, error) {
+	if block, _ := pem.Decode(privatePem); block == nil {
+		return nil, errors.New("backup key must be PEM encoded")
+	}
+	signer, err := crypto.NewSigner(types.ECC, privatePem)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse backup key: %w", err)
+	}
+	key, err := crypto.ParsePrivateKey(types.ECC, privatePem)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse backup key: %w", err)
+	}
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("backup key must be an ECDSA key")
+	}
+	der, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode backup key: %w", err)
+	}
+	mac := hmac.New(sha256.New, der)
+	mac.Write([]byte("backup key wrapping"))
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	keyID, err := crypto.SubjectKeyID(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	return &Keys{
+		signer: signer,
+		keyID:  hex.EncodeToString(keyID),
+		aead:   aead,
+	}, nil
+}
+
+// LoadKeyFile reads the backup key from a PEM file.
+func LoadKeyFile(file string) (*Keys, error) {
+	privatePem, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup key: %w", err)
+	}
+	return NewKeys(privatePem)
+}
+
+// wrap encrypts the private key of a device, bound to its ID so it cannot be moved to another device.
+func (k *Keys) wrap(deviceID string, pkPem []byte) ([]byte, error) {
+	nonce := make([]byte, k.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return k.aead.Seal(nonce, nonce, pkPem, []byte(deviceID)), nil
+}
+
+func (k *Keys) unwrap(deviceID string, wrapped []byte) ([]byte, error) {
+	if len(wrapped) < k.aead.NonceSize() {
+		return nil, errors.New("wrapped key is too short")
+	}
+	nonce, ciphertext := wrapped[:k.aead.NonceSize()], wrapped[k.aead.NonceSize():]
+	return k.aead.Open(nil, nonce, ciphertext, []byte(deviceID))
+}
@@ -0,0 +1,146 @@
+package backup
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+)
+
+var (
+	// ErrCounterRollback indicates a backup that would move the counter of an existing device backwards.
+	ErrCounterRollback = errors.New("restore would roll back the signature counter of a device")
+	// ErrChainMismatch indicates an existing device whose key or signature chain differs from the backup.
+	ErrChainMismatch = errors.New("existing device does not match the backup")
+	// ErrNotEmpty indicates a restore into a database that already has devices, without merging.
+	ErrNotEmpty = errors.New("database already has devices")
+)
+
+// Summary reports what a restore added to the database.
+type Summary struct {
+	Devices    int `json:"devices"`
+	Created    int `json:"created"`
+	Signatures int `json:"signatures"`
+}
+
+// Restore loads the archive into db, which must not have any devices unless merge is set. When merging,
+// devices missing from db are created, and the signatures missing from their chains are appended. Existing
+// devices must continue the chain of the backup: if any of them has signed more than the backup holds or
+// diverges from it, nothing is restored, as restoring would reuse counters. An interrupted restore can
+// therefore be repeated with merge.
+func Restore(db domain.Database, archive *Archive, merge bool) (*Summary, error) {
+	if !merge {
+		devices, err := db.GetAllSignatureDevices()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read devices: %w", err)
+		}
+		if len(devices) > 0 {
+			return nil, fmt.Errorf("%w: %d devices, restore into an empty database or merge", ErrNotEmpty, len(devices))
+		}
+	}
+	for _, history := range archive.Devices {
+		existing, err := db.GetSignatureDevice(history.Device.ID)
+		if errors.Is(err, types.ErrDeviceNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read device %s: %w", history.Device.ID, err)
+		}
+		if err = checkExisting(existing, history); err != nil {
+			return nil, err
+		}
+	}
+
+	summary := &Summary{}
+	for _, history := range archive.Devices {
+		created, err := createDevice(db, history.Device)
+		if err != nil {
+			return summary, err
+		}
+		if created {
+			summary.Created++
+		}
+		appended, err := appendSignatures(db, history)
+		summary.Signatures += appended
+		if err != nil {
+			return summary, err
+		}
+		summary.Devices++
+	}
+	return summary, nil
+}
+
+// checkExisting checks that the backup of a device is the existing device or a prefix of its chain.
+func checkExisting(existing *types.SignatureDevice, history DeviceHistory) error {
+	if existing.Counter > uint32(len(history.Signatures)) {
+		return fmt.Errorf("%w: device %s is at %d, the backup at %d", ErrCounterRollback,
+			existing.ID, existing.Counter, len(history.Signatures))
+	}
+	if existing.Algorithm != history.Device.Algorithm || !bytes.Equal(existing.PkPem, history.Device.PkPem) {
+		return fmt.Errorf("%w: device %s has another key", ErrChainMismatch, existing.ID)
+	}
+	if existing.Counter > 0 && !bytes.Equal(existing.LastSignature, history.Signatures[existing.Counter-1].Value) {
+		return fmt.Errorf("%w: signature %d of device %s differs", ErrChainMismatch, existing.Counter-1, existing.ID)
+	}
+	return nil
+}
+
+// createDevice creates the device without signatures, unless it already exists.
+func createDevice(db domain.Database, device *types.SignatureDevice) (bool, error) {
+	err := db.CreateSignatureDevice(&types.SignatureDevice{
+		ID:             device.ID,
+		Algorithm:      device.Algorithm,
+		Label:          device.Label,
+		PkPem:          device.PkPem,
+		Certificate:    device.Certificate,
+		OrganizationID: device.OrganizationID,
+	})
+	if errors.Is(err, types.ErrDeviceAlreadyExists) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to create device %s: %w", device.ID, err)
+	}
+	return true, nil
+}
+
+// appendSignatures appends the signatures the device is missing, in units of work of one page each.
+// Every unit of work checks the device again, in case it signed since the check before the restore.
+func appendSignatures(db domain.Database, history DeviceHistory) (int, error) {
+	appended := 0
+	for {
+		done, n, err := appendPage(db, history)
+		appended += n
+		if err != nil || done {
+			return appended, err
+		}
+	}
+}
+
+func appendPage(db domain.Database, history DeviceHistory) (bool, int, error) {
+	tx, err := db.BeginDeviceTx(history.Device.ID)
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to restore device %s: %w", history.Device.ID, err)
+	}
+	defer tx.Rollback()
+	device := tx.Device()
+	if err = checkExisting(device, history); err != nil {
+		return false, 0, err
+	}
+	missing := history.Signatures[device.Counter:]
+	if len(missing) == 0 {
+		return true, 0, nil
+	}
+	page := missing[:min(len(missing), pageSize)]
+	for _, signature := range page {
+		if err = tx.AppendSignature(signature); err != nil {
+			return false, 0, fmt.Errorf("failed to restore device %s: %w", history.Device.ID, err)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return false, 0, fmt.Errorf("failed to restore device %s: %w", history.Device.ID, err)
+	}
+	return len(page) == len(missing), len(page), nil
+}
@@ -0,0 +1,35 @@
+package backup
+
+import (
+	"io"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+)
+
+// Service backs up and restores a database.
+type Service struct {
+	db   domain.Database
+	keys *Keys
+}
+
+// NewService creates a Service protecting backups with the given keys.
+func NewService(db domain.Database, keys *Keys) *Service {
+	return &Service{
+		db:   db,
+		keys: keys,
+	}
+}
+
+// Backup writes a backup of all devices to w.
+func (s *Service) Backup(w io.Writer) error {
+	return Write(w, s.db, s.keys)
+}
+
+// Restore verifies the backup read from r and restores it, see Restore for merge.
+func (s *Service) Restore(r io.Reader, merge bool) (*Summary, error) {
+	archive, err := Read(r, s.keys)
+	if err != nil {
+		return nil, err
+	}
+	return Restore(s.db, archive, merge)
+}
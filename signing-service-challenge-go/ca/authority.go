@@ -0,0 +1,191 @@
+package ca
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+
+	devicecrypto "github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+)
+
+// DeviceCertificateValidity is the validity period of issued device certificates.
+const DeviceCertificateValidity = 5 * 365 * 24 * time.Hour
+
+// Authority is a local certificate authority that certifies the keys of signature devices.
+type Authority struct {
+	key   crypto.Signer
+	chain []*x509.Certificate
+}
+
+// New creates an Authority from its key and certificate chain. The first certificate
+// of the chain must be the CA certificate of the key, followed by its issuers, if any.
+func New(key crypto.Signer, chain []*x509.Certificate) (*Authority, error) {
+	if len(chain) == 0 {
+		return nil, errors.New("CA certificate is missing")
+	}
+	certificate := chain[0]
+	publicKey, ok := key.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !publicKey.Equal(certificate.PublicKey) {
+		return nil, errors.New("CA certificate does not match the CA key")
+	}
+	if !certificate.IsCA || certificate.KeyUsage&x509.KeyUsageCertSign == 0 {
+		return nil, errors.New("CA certificate is not allowed to issue certificates")
+	}
+	return &Authority{
+		key:   key,
+		chain: chain,
+	}, nil
+}
+
+// LoadFiles creates an Authority from a PEM encoded private key and a PEM encoded certificate chain.
+func LoadFiles(keyFile string, certificateFile string) (*Authority, error) {
+	keyPem, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA key: %w", err)
+	}
+	certificatePem, err := os.ReadFile(certificateFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+	}
+	key, err := parsePrivateKey(keyPem)
+	if err != nil {
+		return nil, err
+	}
+	var chain []*x509.Certificate
+	for block, rest := pem.Decode(certificatePem); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse CA certificate: %w", err)
+		}
+		chain = append(chain, certificate)
+	}
+	return New(key, chain)
+}
+
+// Generate creates an Authority with a fresh key and a self-signed root certificate.
+func Generate(commonName string) (*Authority, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate CA key: %w", err)
+	}
+	serialNumber, err := randomSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+	keyID, err := devicecrypto.SubjectKeyID(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(20, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		SubjectKeyId:          keyID,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CA certificate: %w", err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return New(key, []*x509.Certificate{certificate})
+}
+
+// IssueCertificate certifies the public key of the device and returns the DER encoded certificate.
+// The subject carries the device ID as serial number and the label as common name.
+func (a *Authority) IssueCertificate(device *types.SignatureDevice, publicKey crypto.PublicKey) ([]byte, error) {
+	serialNumber, err := randomSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+	keyID, err := devicecrypto.SubjectKeyID(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	commonName := device.Label
+	if commonName == "" {
+		commonName = device.ID
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject: pkix.Name{
+			CommonName:   commonName,
+			SerialNumber: device.ID,
+		},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.Add(DeviceCertificateValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment,
+		BasicConstraintsValid: true,
+		SubjectKeyId:          keyID,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, a.chain[0], publicKey, a.key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to issue device certificate: %w", err)
+	}
+	return der, nil
+}
+
+// Chain returns the DER encoded certificate chain of the Authority, starting with its own certificate.
+func (a *Authority) Chain() [][]byte {
+	chain := make([][]byte, len(a.chain))
+	for i, certificate := range a.chain {
+		chain[i] = certificate.Raw
+	}
+	return chain
+}
+
+// parsePrivateKey decodes a PEM encoded PKCS #8, SEC 1 or PKCS #1 private key.
+func parsePrivateKey(keyPem []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(keyPem)
+	if block == nil {
+		return nil, errors.New("CA key is not PEM encoded")
+	}
+	var key any
+	var err error
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CA key: %w", err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported CA key type %T", key)
+	}
+	return signer, nil
+}
+
+// randomSerialNumber returns a random positive 128 bit serial number.
+func randomSerialNumber() (*big.Int, error) {
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+	return serialNumber, nil
+}
@@ -0,0 +1,90 @@
+package ca
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+)
+
+func TestAuthority_IssueCertificate(t *testing.T) {
+	authority, err := Generate("Test CA")
+	if err != nil {
+		t.Fatalf("failed to generate CA: %v", err)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate device key: %v", err)
+	}
+	device := &types.SignatureDevice{ID: "device-id", Label: "Store 42"}
+
+	der, err := authority.IssueCertificate(device, key.Public())
+	if err != nil {
+		t.Fatalf("failed to issue certificate: %v", err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+	if certificate.Subject.SerialNumber != device.ID {
+		t.Fatalf("expected subject serial number %q, got %q", device.ID, certificate.Subject.SerialNumber)
+	}
+	if certificate.Subject.CommonName != device.Label {
+		t.Fatalf("expected subject common name %q, got %q", device.Label, certificate.Subject.CommonName)
+	}
+	if !key.PublicKey.Equal(certificate.PublicKey) {
+		t.Fatal("expected certificate to certify the device key")
+	}
+
+	roots := x509.NewCertPool()
+	root, err := x509.ParseCertificate(authority.Chain()[0])
+	if err != nil {
+		t.Fatalf("failed to parse CA certificate: %v", err)
+	}
+	roots.AddCert(root)
+	if _, err = certificate.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}); err != nil {
+		t.Fatalf("expected certificate to chain up to the CA, got %v", err)
+	}
+}
+
+func TestLoadFiles(t *testing.T) {
+	generated, err := Generate("Test CA")
+	if err != nil {
+		t.Fatalf("failed to generate CA: %v", err)
+	}
+	keyDer, err := x509.MarshalPKCS8PrivateKey(generated.key)
+	if err != nil {
+		t.Fatalf("failed to encode CA key: %v", err)
+	}
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "ca.key")
+	certificateFile := filepath.Join(dir, "ca.pem")
+	if err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatalf("failed to write CA key: %v", err)
+	}
+	if err = os.WriteFile(certificateFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: generated.Chain()[0]}), 0600); err != nil {
+		t.Fatalf("failed to write CA certificate: %v", err)
+	}
+
+	loaded, err := LoadFiles(keyFile, certificateFile)
+	if err != nil {
+		t.Fatalf("failed to load CA: %v", err)
+	}
+	if len(loaded.Chain()) != 1 || string(loaded.Chain()[0]) != string(generated.Chain()[0]) {
+		t.Fatal("expected the loaded chain to match the written certificate")
+	}
+
+	other, err := Generate("Other CA")
+	if err != nil {
+		t.Fatalf("failed to generate CA: %v", err)
+	}
+	if _, err = New(generated.key, []*x509.Certificate{other.chain[0]}); err == nil {
+		t.Fatal("expected mismatching key and certificate to be rejected")
+	}
+}
@@ -0,0 +1,118 @@
+// Command verify checks a journal export of the signing service offline. It verifies the checksums of
+// the archive, every signature and the chaining of the secured data, and prints a report.
+//
+// Usage:
+//
+//	verify [-key file]... [-json] export.tar
+//
+// Every -key names a PEM encoded public key or certificate of a device, obtained independently of the
+// export. If keys are given, every device of the export must use one of them. Otherwise the signatures
+// are verified with the keys in the export, which only shows that the export is consistent in itself.
+// The exit status is 0 if the export is valid, 1 if it is not and 2 if it cannot be read.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	keys := Keys{}
+	flags.Func("key", "PEM encoded public key or certificate of a device, may be repeated", func(file string) error {
+		publicPem, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		return keys.Add(publicPem)
+	})
+	asJSON := flags.Bool("json", false, "print the report as JSON")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: verify [-key file]... [-json] export.tar")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	input := stdin
+	if name := flags.Arg(0); name != "-" {
+		file, err := os.Open(name)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+		defer file.Close()
+		input = file
+	}
+	report, err := Verify(input, keys)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	if *asJSON {
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		if err = encoder.Encode(report); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+	} else {
+		writeText(stdout, report, len(keys) > 0)
+	}
+	if !report.Valid {
+		return 1
+	}
+	return 0
+}
+
+// writeText prints the report for humans.
+func writeText(w io.Writer, report *Report, keysProvided bool) {
+	fmt.Fprintf(w, "Export taken at %s: %s\n", report.TakenAt.Format("2006-01-02 15:04:05 MST"), verdict(report.Valid))
+	if !keysProvided {
+		fmt.Fprintln(w, "Warning: no keys provided, the signatures were verified with the keys in the export.")
+	}
+	for _, message := range report.Errors {
+		fmt.Fprintf(w, "  error: %s\n", message)
+	}
+	for _, device := range report.Devices {
+		fmt.Fprintf(w, "\nDevice %s: %s\n", device.ID, verdict(device.Valid))
+		fmt.Fprintf(w, "  algorithm:  %s\n", device.Algorithm)
+		fmt.Fprintf(w, "  key:        %s (%s)\n", device.KeyID, device.KeySource)
+		if device.FirstCounter != nil {
+			fmt.Fprintf(w, "  signatures: %d, counters %d to %d", device.Signatures, *device.FirstCounter, *device.LastCounter)
+		} else {
+			fmt.Fprintf(w, "  signatures: none")
+		}
+		if device.Complete {
+			fmt.Fprintf(w, ", complete up to counter %d\n", device.Counter)
+		} else {
+			fmt.Fprintf(w, " of %d\n", device.Counter)
+		}
+		for _, message := range device.Errors {
+			fmt.Fprintf(w, "  error: %s\n", message)
+		}
+		if device.Omitted > 0 {
+			fmt.Fprintf(w, "  ... and %d more errors\n", device.Omitted)
+		}
+	}
+}
+
+func verdict(valid bool) string {
+	if valid {
+		return "VALID"
+	}
+	return "INVALID"
+}
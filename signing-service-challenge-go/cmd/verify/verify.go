@@ -0,0 +1,412 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	stdcrypto "crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/audit"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/export"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+)
+
+const (
+	// maxRecordSize limits the size of a signature record, envelopes included.
+	maxRecordSize = 16 << 20
+	// maxErrors limits the errors listed per device, further errors are only counted.
+	maxErrors = 100
+)
+
+// Key sources of a device report.
+const (
+	KeyProvided = "provided"
+	KeyArchive  = "archive"
+)
+
+// Report is the result of verifying an export.
+type Report struct {
+	Valid   bool      `json:"valid"`
+	TakenAt time.Time `json:"taken_at"`
+	// Errors concern the archive as a whole, e.g. entries that do not match the manifest.
+	Errors  []string        `json:"errors,omitempty"`
+	Devices []*DeviceReport `json:"devices"`
+}
+
+// DeviceReport is the result of verifying the journal of a device.
+type DeviceReport struct {
+	ID        string                 `json:"id"`
+	Algorithm types.SigningAlgorithm `json:"algorithm"`
+	KeyID     string                 `json:"key_id"`
+	// KeySource tells whether the signatures were verified with a provided key or the key in the archive.
+	KeySource string `json:"key_source"`
+	// Counter is the counter of the device when the export was taken.
+	Counter      uint32  `json:"counter"`
+	Signatures   int     `json:"signatures"`
+	FirstCounter *uint32 `json:"first_counter,omitempty"`
+	LastCounter  *uint32 `json:"last_counter,omitempty"`
+	// Complete is set if the journal holds every signature of the device up to the export.
+	Complete bool     `json:"complete"`
+	Valid    bool     `json:"valid"`
+	Errors   []string `json:"errors,omitempty"`
+	// Omitted is the number of errors beyond the listed ones.
+	Omitted int `json:"omitted_errors,omitempty"`
+}
+
+func (d *DeviceReport) fail(format string, args ...any) {
+	if len(d.Errors) >= maxErrors {
+		d.Omitted++
+		return
+	}
+	d.Errors = append(d.Errors, fmt.Sprintf(format, args...))
+}
+
+// Keys are public keys obtained independently of the archive, by their subject key ID.
+type Keys map[string]stdcrypto.PublicKey
+
+// Add parses a PEM encoded public key or certificate and adds its key.
+func (k Keys) Add(publicPem []byte) error {
+	publicKey, err := crypto.ParsePublicKey(publicPem)
+	if err != nil {
+		return err
+	}
+	keyID, err := crypto.SubjectKeyID(publicKey)
+	if err != nil {
+		return err
+	}
+	k[hex.EncodeToString(keyID)] = publicKey
+	return nil
+}
+
+// journal is the state of the verification of a device.
+type journal struct {
+	report   *DeviceReport
+	verifier crypto.Verifier
+	chain    *audit.Chain
+	// rows and csvRows are digests over the chain fields of the NDJSON and CSV records.
+	rows    hash.Hash
+	csvRows hash.Hash
+	csvRead bool
+}
+
+// verifier checks an export read from r. The signatures are verified with the provided keys,
+// or with the keys in the archive if no keys are provided.
+type verifier struct {
+	keys     Keys
+	report   Report
+	journals map[string]*journal
+	entries  map[string]export.FileEntry
+	manifest *export.Manifest
+}
+
+// Verify verifies the export read from r, plain or gzip compressed. An error is only returned
+// if the archive cannot be read, defects of its content are listed in the report.
+func Verify(r io.Reader, keys Keys) (*Report, error) {
+	v := &verifier{
+		keys:     keys,
+		journals: make(map[string]*journal),
+		entries:  make(map[string]export.FileEntry),
+		report:   Report{Devices: []*DeviceReport{}},
+	}
+	reader := bufio.NewReader(r)
+	if magic, err := reader.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	} else {
+		r = reader
+	}
+
+	archive := tar.NewReader(r)
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err = v.readEntry(header.Name, archive); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", header.Name, err)
+		}
+	}
+	v.finish()
+	return &v.report, nil
+}
+
+// readEntry verifies an entry and records its checksum.
+func (v *verifier) readEntry(name string, r io.Reader) error {
+	if _, exists := v.entries[name]; exists {
+		v.report.Errors = append(v.report.Errors, fmt.Sprintf("duplicate entry %s", name))
+	}
+	digest := sha256.New()
+	counted := &countingReader{r: io.TeeReader(r, digest)}
+	var err error
+	switch {
+	case name == export.ManifestFile:
+		v.manifest = &export.Manifest{}
+		if err = json.NewDecoder(counted).Decode(v.manifest); err != nil {
+			v.report.Errors = append(v.report.Errors, fmt.Sprintf("malformed manifest: %v", err))
+			v.manifest = nil
+		}
+	case strings.HasSuffix(name, "/device.json"):
+		err = v.readDevice(name, counted)
+	case strings.HasSuffix(name, "/signatures.ndjson"):
+		err = v.readNDJSON(name, counted)
+	case strings.HasSuffix(name, "/signatures.csv"):
+		err = v.readCSV(name, counted)
+	}
+	if err != nil {
+		return err
+	}
+	// the rest of the entry only counts towards its checksum
+	if _, err = io.Copy(io.Discard, counted); err != nil {
+		return err
+	}
+	v.entries[name] = export.FileEntry{Name: name, SHA256: hex.EncodeToString(digest.Sum(nil)), Size: counted.n}
+	return nil
+}
+
+// deviceID extracts the device ID of an entry named devices/<id>/<file>, or returns "".
+func deviceID(name string) string {
+	parts := strings.Split(name, "/")
+	if len(parts) != 3 || parts[0] != "devices" {
+		return ""
+	}
+	return parts[1]
+}
+
+func (v *verifier) readDevice(name string, r io.Reader) error {
+	id := deviceID(name)
+	if id == "" {
+		v.report.Errors = append(v.report.Errors, fmt.Sprintf("unexpected entry %s", name))
+		return nil
+	}
+	var record export.DeviceRecord
+	if err := json.NewDecoder(r).Decode(&record); err != nil {
+		v.report.Errors = append(v.report.Errors, fmt.Sprintf("malformed %s: %v", name, err))
+		return nil
+	}
+	report := &DeviceReport{
+		ID:        id,
+		Algorithm: record.Algorithm,
+		KeyID:     record.KeyID,
+		KeySource: KeyArchive,
+		Counter:   record.Counter,
+	}
+	v.report.Devices = append(v.report.Devices, report)
+	j := &journal{report: report, rows: sha256.New(), csvRows: sha256.New()}
+	v.journals[id] = j
+	if record.ID != id {
+		report.fail("device ID %q does not match the entry", record.ID)
+	}
+
+	publicKey, err := crypto.ParsePublicKey([]byte(record.PublicKey))
+	if err != nil {
+		report.fail("malformed public key: %v", err)
+		return nil
+	}
+	keyID, err := crypto.SubjectKeyID(publicKey)
+	if err != nil {
+		report.fail("malformed public key: %v", err)
+		return nil
+	}
+	if hex.EncodeToString(keyID) != record.KeyID {
+		report.fail("key ID %s does not match the public key", record.KeyID)
+	}
+	report.KeyID = hex.EncodeToString(keyID)
+	if len(v.keys) > 0 {
+		provided, exists := v.keys[report.KeyID]
+		if !exists {
+			report.fail("public key %s is none of the provided keys", report.KeyID)
+			return nil
+		}
+		publicKey = provided
+		report.KeySource = KeyProvided
+	}
+	if j.verifier, err = crypto.NewVerifier(record.Algorithm, publicKey); err != nil {
+		report.fail("%v", err)
+	}
+	return nil
+}
+
+func (v *verifier) readNDJSON(name string, r io.Reader) error {
+	j := v.journals[deviceID(name)]
+	if j == nil {
+		v.report.Errors = append(v.report.Errors, fmt.Sprintf("%s precedes the device or belongs to none", name))
+		return nil
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxRecordSize)
+	line := 0
+	for scanner.Scan() {
+		line++
+		var signature types.Signature
+		if err := json.Unmarshal(scanner.Bytes(), &signature); err != nil {
+			j.report.fail("malformed signature on line %d: %v", line, err)
+			continue
+		}
+		v.verifySignature(j, signature)
+	}
+	if err := scanner.Err(); err != nil {
+		j.report.fail("failed to read signatures: %v", err)
+	}
+	return nil
+}
+
+func (v *verifier) verifySignature(j *journal, signature types.Signature) {
+	report := j.report
+	if report.FirstCounter == nil {
+		first := signature.Counter
+		report.FirstCounter = &first
+		if j.verifier != nil {
+			j.chain = audit.NewChainAt(report.ID, j.verifier, first)
+		}
+	}
+	last := signature.Counter
+	report.LastCounter = &last
+	report.Signatures++
+	writeRow(j.rows, csvRow(signature))
+	if j.chain == nil {
+		return
+	}
+	if err := j.chain.Verify(signature); err != nil {
+		report.fail("%v", err)
+	}
+}
+
+func (v *verifier) readCSV(name string, r io.Reader) error {
+	j := v.journals[deviceID(name)]
+	if j == nil {
+		v.report.Errors = append(v.report.Errors, fmt.Sprintf("%s precedes the device or belongs to none", name))
+		return nil
+	}
+	j.csvRead = true
+	rows := csv.NewReader(r)
+	header, err := rows.Read()
+	if err != nil || !slices.Equal(header, export.CSVHeader) {
+		j.report.fail("CSV journal does not start with the header %s", strings.Join(export.CSVHeader, ","))
+		return nil
+	}
+	for {
+		row, err := rows.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			j.report.fail("malformed CSV journal: %v", err)
+			return nil
+		}
+		writeRow(j.csvRows, row)
+	}
+}
+
+// finish checks the entries and devices against the manifest and concludes the report.
+func (v *verifier) finish() {
+	report := &v.report
+	if v.manifest == nil {
+		report.Errors = append(report.Errors, "missing manifest")
+	} else {
+		report.TakenAt = v.manifest.TakenAt
+		if v.manifest.Version != export.Version {
+			report.Errors = append(report.Errors, fmt.Sprintf("unsupported export version %d", v.manifest.Version))
+		}
+		listed := make(map[string]bool)
+		for _, expected := range v.manifest.Files {
+			listed[expected.Name] = true
+			actual, exists := v.entries[expected.Name]
+			if !exists {
+				report.Errors = append(report.Errors, fmt.Sprintf("missing entry %s", expected.Name))
+			} else if actual != expected {
+				report.Errors = append(report.Errors, fmt.Sprintf("checksum of %s does not match the manifest", expected.Name))
+			}
+		}
+		for name := range v.entries {
+			if !listed[name] && name != export.ManifestFile {
+				report.Errors = append(report.Errors, fmt.Sprintf("entry %s is not in the manifest", name))
+			}
+		}
+		for _, device := range v.manifest.Devices {
+			j, exists := v.journals[device.ID]
+			if !exists {
+				report.Errors = append(report.Errors, fmt.Sprintf("missing device %s", device.ID))
+				continue
+			}
+			if device.Counter != j.report.Counter || device.Signatures != j.report.Signatures {
+				j.report.fail("manifest lists counter %d and %d signatures, the journal has counter %d and %d signatures",
+					device.Counter, device.Signatures, j.report.Counter, j.report.Signatures)
+			}
+		}
+		if len(v.manifest.Devices) != len(v.journals) {
+			report.Errors = append(report.Errors, "devices do not match the manifest")
+		}
+	}
+
+	slices.SortFunc(report.Devices, func(a, b *DeviceReport) int { return strings.Compare(a.ID, b.ID) })
+	report.Valid = len(report.Errors) == 0
+	for _, device := range report.Devices {
+		j := v.journals[device.ID]
+		if !j.csvRead {
+			device.fail("missing CSV journal")
+		} else if !bytes.Equal(j.rows.Sum(nil), j.csvRows.Sum(nil)) {
+			device.fail("CSV journal does not match the NDJSON journal")
+		}
+		if device.LastCounter != nil && *device.LastCounter >= device.Counter {
+			device.fail("signature %d is beyond the counter %d of the device", *device.LastCounter, device.Counter)
+		}
+		device.Complete = device.Counter == 0 ||
+			(device.FirstCounter != nil && *device.FirstCounter == 0 && *device.LastCounter == device.Counter-1)
+		device.Valid = len(device.Errors) == 0
+		report.Valid = report.Valid && device.Valid
+	}
+}
+
+// csvRow encodes the chain fields of a signature as in the CSV journal.
+func csvRow(signature types.Signature) []string {
+	return []string{
+		strconv.FormatUint(uint64(signature.Counter), 10),
+		signature.Timestamp.UTC().Format(time.RFC3339Nano),
+		base64.StdEncoding.EncodeToString(signature.SignedData),
+		base64.StdEncoding.EncodeToString(signature.Value),
+	}
+}
+
+// writeRow adds a row to a digest, with lengths so fields cannot run into each other.
+func writeRow(h hash.Hash, row []string) {
+	for _, field := range row {
+		fmt.Fprintf(h, "%d:%s,", len(field), field)
+	}
+	h.Write([]byte("\n"))
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
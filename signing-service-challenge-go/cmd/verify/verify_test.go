@@ -0,0 +1,403 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/export"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+)
+
+var start = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// hourlyClock advances by an hour every time it is read.
+type hourlyClock struct {
+	now time.Time
+}
+
+func (c *hourlyClock) Now() time.Time {
+	now := c.now
+	c.now = c.now.Add(time.Hour)
+	return now
+}
+
+// newExport creates a device of each algorithm, signs in every format and exports the journals.
+// It returns the export and the PEM encoded public keys of the devices.
+func newExport(t *testing.T, from time.Time) ([]byte, [][]byte) {
+	t.Helper()
+	db := persistence.NewInMemoryDatabase()
+	var publicKeys [][]byte
+	for _, algorithm := range []types.SigningAlgorithm{types.ECC, types.RSA, types.RSAPSS, types.Ed25519} {
+		service := domain.NewDeviceService(db, domain.WithClock(&hourlyClock{now: start}))
+		device, err := service.Create(context.Background(), types.NewSignatureDevice{Algorithm: string(algorithm), Label: "verify"})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		for _, format := range []types.SignatureFormat{types.FormatRaw, types.FormatJWS, types.FormatJWSDetached, types.FormatCOSE} {
+			if _, err = service.SignUsingDevice(context.Background(), device.ID, []byte("data"), format); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+		}
+		if _, err = service.SignDocument(context.Background(), device.ID, []byte("document")); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		signer, err := crypto.NewSigner(algorithm, device.PkPem)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		der, err := x509.MarshalPKIXPublicKey(signer.Public())
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		publicKeys = append(publicKeys, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	}
+	journal, err := export.New(db, nil, from, time.Time{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	var buf bytes.Buffer
+	if _, err = journal.WriteTo(&buf); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	return buf.Bytes(), publicKeys
+}
+
+func newKeys(t *testing.T, publicKeys ...[]byte) Keys {
+	t.Helper()
+	keys := Keys{}
+	for _, publicKey := range publicKeys {
+		if err := keys.Add(publicKey); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	return keys
+}
+
+// rewrite applies edit to the entries of an export. If rehash is set, the manifest is updated to the
+// edited entries, so only the content of the entries is wrong.
+func rewrite(t *testing.T, archive []byte, rehash bool, edit func(files map[string][]byte)) []byte {
+	t.Helper()
+	files := make(map[string][]byte)
+	var names []string
+	reader := tar.NewReader(bytes.NewReader(archive))
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if files[header.Name], err = io.ReadAll(reader); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		names = append(names, header.Name)
+	}
+	edit(files)
+	if rehash {
+		var m export.Manifest
+		if err := json.Unmarshal(files[export.ManifestFile], &m); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		for i, entry := range m.Files {
+			digest := sha256.Sum256(files[entry.Name])
+			m.Files[i].SHA256 = hex.EncodeToString(digest[:])
+			m.Files[i].Size = int64(len(files[entry.Name]))
+		}
+		encoded, err := json.Marshal(m)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		files[export.ManifestFile] = encoded
+	}
+	var buf bytes.Buffer
+	writer := tar.NewWriter(&buf)
+	for _, name := range names {
+		content, exists := files[name]
+		if !exists {
+			continue
+		}
+		if err := writer.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0o644, Size: int64(len(content))}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if _, err := writer.Write(content); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	return buf.Bytes()
+}
+
+// ndjsonOf returns the name of the NDJSON journal of the first device in the manifest.
+func ndjsonOf(t *testing.T, files map[string][]byte) string {
+	t.Helper()
+	var m export.Manifest
+	if err := json.Unmarshal(files[export.ManifestFile], &m); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	return export.NDJSONFile(m.Devices[0].ID)
+}
+
+func TestVerify(t *testing.T) {
+	archive, publicKeys := newExport(t, time.Time{})
+	_, otherKey, err := crypto.GenerateNewPair(types.ECC)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	otherSigner, err := crypto.NewSigner(types.ECC, otherKey)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	otherDER, err := x509.MarshalPKIXPublicKey(otherSigner.Public())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	otherPublicKey := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: otherDER})
+
+	tests := []struct {
+		name    string
+		archive func() []byte
+		keys    Keys
+		valid   bool
+		message string
+	}{
+		{
+			name:    "Provided Keys",
+			archive: func() []byte { return archive },
+			keys:    newKeys(t, publicKeys...),
+			valid:   true,
+		},
+		{
+			name:    "Keys From Archive",
+			archive: func() []byte { return archive },
+			keys:    Keys{},
+			valid:   true,
+		},
+		{
+			name: "Gzip Compressed",
+			archive: func() []byte {
+				var buf bytes.Buffer
+				gz := gzip.NewWriter(&buf)
+				gz.Write(archive)
+				gz.Close()
+				return buf.Bytes()
+			},
+			keys:  newKeys(t, publicKeys...),
+			valid: true,
+		},
+		{
+			name:    "Key Missing",
+			archive: func() []byte { return archive },
+			keys:    newKeys(t, append(publicKeys[1:], otherPublicKey)...),
+			message: "none of the provided keys",
+		},
+		{
+			name: "Modified Entry",
+			archive: func() []byte {
+				return rewrite(t, archive, false, func(files map[string][]byte) {
+					name := ndjsonOf(t, files)
+					files[name] = bytes.Replace(files[name], []byte(`"counter":1`), []byte(`"counter":9`), 1)
+				})
+			},
+			keys:    newKeys(t, publicKeys...),
+			message: "does not match the manifest",
+		},
+		{
+			name: "Missing Entry",
+			archive: func() []byte {
+				return rewrite(t, archive, false, func(files map[string][]byte) {
+					delete(files, ndjsonOf(t, files))
+				})
+			},
+			keys:    newKeys(t, publicKeys...),
+			message: "missing entry",
+		},
+		{
+			name: "Missing Manifest",
+			archive: func() []byte {
+				return rewrite(t, archive, false, func(files map[string][]byte) {
+					delete(files, export.ManifestFile)
+				})
+			},
+			keys:    newKeys(t, publicKeys...),
+			message: "missing manifest",
+		},
+		{
+			name: "Removed Signature",
+			archive: func() []byte {
+				return rewrite(t, archive, true, func(files map[string][]byte) {
+					name := ndjsonOf(t, files)
+					lines := bytes.SplitAfter(files[name], []byte("\n"))
+					files[name] = bytes.Join(append(lines[:1], lines[2:]...), nil)
+				})
+			},
+			keys:    newKeys(t, publicKeys...),
+			message: "signature chain is broken",
+		},
+		{
+			name: "Forged Signature",
+			archive: func() []byte {
+				return rewrite(t, archive, true, func(files map[string][]byte) {
+					name := ndjsonOf(t, files)
+					lines := bytes.SplitAfter(files[name], []byte("\n"))
+					var signature types.Signature
+					if err := json.Unmarshal(lines[0], &signature); err != nil {
+						t.Fatalf("expected no error, got %v", err)
+					}
+					signature.SignedData = bytes.Replace(signature.SignedData, []byte("data"), []byte("fake"), 1)
+					encoded, err := json.Marshal(signature)
+					if err != nil {
+						t.Fatalf("expected no error, got %v", err)
+					}
+					lines[0] = append(encoded, '\n')
+					files[name] = bytes.Join(lines, nil)
+				})
+			},
+			keys:    newKeys(t, publicKeys...),
+			message: "invalid signature",
+		},
+		{
+			name: "CSV Differs",
+			archive: func() []byte {
+				return rewrite(t, archive, true, func(files map[string][]byte) {
+					name := strings.Replace(ndjsonOf(t, files), "signatures.ndjson", "signatures.csv", 1)
+					files[name] = bytes.Replace(files[name], []byte("\n1,"), []byte("\n7,"), 1)
+				})
+			},
+			keys:    newKeys(t, publicKeys...),
+			message: "CSV journal does not match",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			report, err := Verify(bytes.NewReader(test.archive()), test.keys)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if report.Valid != test.valid {
+				t.Fatalf("expected valid %t, got report %+v", test.valid, report)
+			}
+			if len(report.Devices) != 4 {
+				t.Fatalf("expected 4 devices, got %d", len(report.Devices))
+			}
+			var text bytes.Buffer
+			writeText(&text, report, len(test.keys) > 0)
+			if !strings.Contains(text.String(), test.message) {
+				t.Fatalf("expected report to contain %q, got\n%s", test.message, text.String())
+			}
+			if test.valid {
+				for _, device := range report.Devices {
+					if !device.Complete || device.Signatures != 5 {
+						t.Fatalf("expected complete journal of 5 signatures, got %+v", device)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestVerify_Period(t *testing.T) {
+	// signatures of another period cannot be linked to their predecessor, but are verified nevertheless
+	archive, publicKeys := newExport(t, start.Add(2*time.Hour))
+	report, err := Verify(bytes.NewReader(archive), newKeys(t, publicKeys...))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !report.Valid {
+		t.Fatalf("expected valid report, got %+v", report)
+	}
+	for _, device := range report.Devices {
+		if device.Complete || device.Signatures != 3 || *device.FirstCounter != 2 {
+			t.Fatalf("expected incomplete journal of signatures 2 to 4, got %+v", device)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	archive, publicKeys := newExport(t, time.Time{})
+	dir := t.TempDir()
+	archiveFile := filepath.Join(dir, "export.tar")
+	if err := os.WriteFile(archiveFile, archive, 0o600); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	var args []string
+	for i, publicKey := range publicKeys {
+		keyFile := filepath.Join(dir, "key"+strconv.Itoa(i)+".pem")
+		if err := os.WriteFile(keyFile, publicKey, 0o600); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		args = append(args, "-key", keyFile)
+	}
+
+	tests := []struct {
+		name   string
+		args   []string
+		stdin  []byte
+		status int
+	}{
+		{
+			name:   "Valid",
+			args:   append(append([]string{}, args...), archiveFile),
+			status: 0,
+		},
+		{
+			name:   "JSON From Stdin",
+			args:   append(append([]string{"-json"}, args...), "-"),
+			stdin:  archive,
+			status: 0,
+		},
+		{
+			name:   "Invalid",
+			args:   []string{"-key", filepath.Join(dir, "key0.pem"), archiveFile},
+			status: 1,
+		},
+		{
+			name:   "Not An Archive",
+			args:   []string{"-"},
+			stdin:  []byte("export"),
+			status: 2,
+		},
+		{
+			name:   "Missing Argument",
+			args:   args,
+			status: 2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			status := run(test.args, bytes.NewReader(test.stdin), &stdout, &stderr)
+			if status != test.status {
+				t.Fatalf("expected status %d, got %d\n%s%s", test.status, status, stdout.String(), stderr.String())
+			}
+			if test.status == 0 && strings.Contains(test.name, "JSON") {
+				var report Report
+				if err := json.Unmarshal(stdout.Bytes(), &report); err != nil || !report.Valid {
+					t.Fatalf("expected valid JSON report, got %s", stdout.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package cms
+
+import (
+	"bytes"
+	"crypto"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+)
+
+var (
+	OIDData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	OIDSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	OIDContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	OIDMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	OIDSigningTime   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+
+	oidSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+
+	oidRSAEncryption   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidSHA256WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidSHA384WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}
+	oidSHA512WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}
+	oidRSASSAPSS       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 10}
+	oidECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidECDSAWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
+	oidECDSAWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}
+	oidEd25519         = asn1.ObjectIdentifier{1, 3, 101, 112}
+
+	// pssParametersSHA256 are the RSASSA-PSS-params for SHA-256, MGF1 with SHA-256 and a salt of
+	// the hash length (RFC 4055), matching what crypto/x509 expects for x509.SHA256WithRSAPSS.
+	pssParametersSHA256 = asn1.RawValue{FullBytes: []byte{
+		0x30, 0x34, 0xa0, 0x0f, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02,
+		0x01, 0x05, 0x00, 0xa1, 0x1c, 0x30, 0x1a, 0x06, 0x09, 0x2a, 0x86, 0x48, 0x86, 0xf7, 0x0d, 0x01,
+		0x01, 0x08, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05,
+		0x00, 0xa2, 0x03, 0x02, 0x01, 0x20,
+	}}
+)
+
+// contentInfo is the outermost CMS structure (RFC 5652, section 3).
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	// Content is the [0] EXPLICIT wrapper around the DER encoded content.
+	Content asn1.RawValue
+}
+
+// signedData is the CMS SignedData content type (RFC 5652, section 5.1).
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapsulatedContentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+type encapsulatedContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     []byte `asn1:"explicit,optional,tag:0"`
+}
+
+type signerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+}
+
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+// digestAlgorithmOID returns the algorithm identifier of the given hash function.
+func digestAlgorithmOID(hash crypto.Hash) (asn1.ObjectIdentifier, bool) {
+	switch hash {
+	case crypto.SHA256:
+		return oidSHA256, true
+	case crypto.SHA384:
+		return oidSHA384, true
+	case crypto.SHA512:
+		return oidSHA512, true
+	default:
+		return nil, false
+	}
+}
+
+// hashFromOID is the inverse of digestAlgorithmOID.
+func hashFromOID(oid asn1.ObjectIdentifier) (crypto.Hash, bool) {
+	switch {
+	case oid.Equal(oidSHA256):
+		return crypto.SHA256, true
+	case oid.Equal(oidSHA384):
+		return crypto.SHA384, true
+	case oid.Equal(oidSHA512):
+		return crypto.SHA512, true
+	default:
+		return 0, false
+	}
+}
+
+var signatureAlgorithms = []struct {
+	algorithm x509.SignatureAlgorithm
+	oid       asn1.ObjectIdentifier
+}{
+	{x509.SHA256WithRSA, oidSHA256WithRSA},
+	{x509.SHA384WithRSA, oidSHA384WithRSA},
+	{x509.SHA512WithRSA, oidSHA512WithRSA},
+	{x509.ECDSAWithSHA256, oidECDSAWithSHA256},
+	{x509.ECDSAWithSHA384, oidECDSAWithSHA384},
+	{x509.ECDSAWithSHA512, oidECDSAWithSHA512},
+	{x509.PureEd25519, oidEd25519},
+}
+
+// signatureAlgorithmIdentifier returns the algorithm identifier of the given signature algorithm.
+func signatureAlgorithmIdentifier(algorithm x509.SignatureAlgorithm) (pkix.AlgorithmIdentifier, bool) {
+	if algorithm == x509.SHA256WithRSAPSS {
+		return pkix.AlgorithmIdentifier{Algorithm: oidRSASSAPSS, Parameters: pssParametersSHA256}, true
+	}
+	for _, candidate := range signatureAlgorithms {
+		if candidate.algorithm == algorithm {
+			return pkix.AlgorithmIdentifier{Algorithm: candidate.oid}, true
+		}
+	}
+	return pkix.AlgorithmIdentifier{}, false
+}
+
+// signatureAlgorithmFromIdentifier is the inverse of signatureAlgorithmIdentifier.
+// Some implementations only name the key type for RSA, the digest then determines the algorithm.
+func signatureAlgorithmFromIdentifier(identifier pkix.AlgorithmIdentifier, hash crypto.Hash) (x509.SignatureAlgorithm, bool) {
+	if identifier.Algorithm.Equal(oidRSAEncryption) {
+		switch hash {
+		case crypto.SHA256:
+			return x509.SHA256WithRSA, true
+		case crypto.SHA384:
+			return x509.SHA384WithRSA, true
+		case crypto.SHA512:
+			return x509.SHA512WithRSA, true
+		}
+	}
+	if identifier.Algorithm.Equal(oidRSASSAPSS) {
+		// Only the parameters produced by signatureAlgorithmIdentifier are supported.
+		if hash == crypto.SHA256 && bytes.Equal(identifier.Parameters.FullBytes, pssParametersSHA256.FullBytes) {
+			return x509.SHA256WithRSAPSS, true
+		}
+		return x509.UnknownSignatureAlgorithm, false
+	}
+	for _, candidate := range signatureAlgorithms {
+		if candidate.oid.Equal(identifier.Algorithm) {
+			return candidate.algorithm, true
+		}
+	}
+	return x509.UnknownSignatureAlgorithm, false
+}
@@ -0,0 +1,356 @@
+package cms
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrUnsupportedAlgorithm = errors.New("unsupported algorithm")
+	ErrMalformedSignedData  = errors.New("malformed CMS signed data")
+	ErrSignerNotFound       = errors.New("signer certificate not found")
+	ErrVerificationFailed   = errors.New("CMS signature verification failed")
+)
+
+// Signer produces a signature over data, hashing it with the digest algorithm given in the Options.
+type Signer interface {
+	Sign(data []byte) ([]byte, error)
+}
+
+// NewSigner adapts a crypto.Signer to a Signer that hashes the data with the given hash function.
+func NewSigner(key crypto.Signer, hash crypto.Hash) Signer {
+	return keySigner{key: key, hash: hash}
+}
+
+type keySigner struct {
+	key  crypto.Signer
+	hash crypto.Hash
+}
+
+func (k keySigner) Sign(data []byte) ([]byte, error) {
+	// Ed25519 signs the message itself and not a digest.
+	if _, ok := k.key.Public().(ed25519.PublicKey); ok {
+		return k.key.Sign(rand.Reader, data, crypto.Hash(0))
+	}
+	hasher := k.hash.New()
+	hasher.Write(data)
+	return k.key.Sign(rand.Reader, hasher.Sum(nil), k.hash)
+}
+
+// Attribute is an additional signed attribute. The Value must be encodable by encoding/asn1.
+type Attribute struct {
+	Type  asn1.ObjectIdentifier
+	Value interface{}
+}
+
+// Options control how a SignedData structure is assembled.
+type Options struct {
+	// ContentType of the signed content, defaults to OIDData.
+	ContentType asn1.ObjectIdentifier
+	// Detached omits the content from the resulting structure.
+	Detached bool
+	// Hash is the digest algorithm used for the content and the signed attributes.
+	Hash crypto.Hash
+	// SignatureAlgorithm the Signer produces.
+	SignatureAlgorithm x509.SignatureAlgorithm
+	// Certificate of the signer. It identifies the signer and is embedded into the structure.
+	Certificate *x509.Certificate
+	// ExcludeCertificates only uses the Certificate to identify the signer without embedding any certificates.
+	ExcludeCertificates bool
+	// SubjectKeyID identifies the signer if no Certificate is available.
+	SubjectKeyID []byte
+	// Certificates are additional certificates to embed, e.g. the issuing chain.
+	Certificates []*x509.Certificate
+	// SigningTime is added as signed attribute unless it is zero.
+	SigningTime time.Time
+	// Attributes are added to the signed attributes.
+	Attributes []Attribute
+}
+
+// Sign creates a DER encoded CMS SignedData structure (RFC 5652) with a single signer over content.
+func Sign(content []byte, signer Signer, opts Options) ([]byte, error) {
+	unsigned, err := Prepare(content, opts)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := signer.Sign(unsigned.SigningInput())
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign attributes: %w", err)
+	}
+	return unsigned.Seal(signature)
+}
+
+// Unsigned is a SignedData structure awaiting the signature over its signed attributes.
+// It allows the signature to be produced outside of this package, e.g. by a signature device.
+type Unsigned struct {
+	signedAttrs []byte
+	sd          signedData
+}
+
+// Prepare assembles a SignedData structure with a single signer over content, except for the signature.
+func Prepare(content []byte, opts Options) (*Unsigned, error) {
+	contentType := opts.ContentType
+	if contentType == nil {
+		contentType = OIDData
+	}
+	digestOID, ok := digestAlgorithmOID(opts.Hash)
+	if !ok {
+		return nil, fmt.Errorf("%w: digest %s", ErrUnsupportedAlgorithm, opts.Hash)
+	}
+	signatureAlgorithm, ok := signatureAlgorithmIdentifier(opts.SignatureAlgorithm)
+	if !ok {
+		return nil, fmt.Errorf("%w: signature %s", ErrUnsupportedAlgorithm, opts.SignatureAlgorithm)
+	}
+
+	hasher := opts.Hash.New()
+	hasher.Write(content)
+	attributes := []Attribute{
+		{Type: OIDContentType, Value: contentType},
+		{Type: OIDMessageDigest, Value: hasher.Sum(nil)},
+	}
+	if !opts.SigningTime.IsZero() {
+		attributes = append(attributes, Attribute{Type: OIDSigningTime, Value: opts.SigningTime.UTC()})
+	}
+	attributes = append(attributes, opts.Attributes...)
+	signedAttrs, err := marshalAttributes(attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	info := signerInfo{
+		DigestAlgorithm: pkix.AlgorithmIdentifier{Algorithm: digestOID},
+		// The attributes are signed as SET OF but embedded with an IMPLICIT [0] tag.
+		SignedAttrs:        asn1.RawValue{FullBytes: append([]byte{0xA0}, signedAttrs[1:]...)},
+		SignatureAlgorithm: signatureAlgorithm,
+	}
+	switch {
+	case opts.Certificate != nil:
+		sid, err := asn1.Marshal(issuerAndSerialNumber{
+			Issuer:       asn1.RawValue{FullBytes: opts.Certificate.RawIssuer},
+			SerialNumber: opts.Certificate.SerialNumber,
+		})
+		if err != nil {
+			return nil, err
+		}
+		info.Version = 1
+		info.SID = asn1.RawValue{FullBytes: sid}
+	case len(opts.SubjectKeyID) > 0:
+		info.Version = 3
+		info.SID = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, Bytes: opts.SubjectKeyID}
+	default:
+		return nil, errors.New("either a certificate or a subject key identifier is required")
+	}
+
+	sd := signedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{{Algorithm: digestOID}},
+		EncapContentInfo: encapsulatedContentInfo{EContentType: contentType},
+		SignerInfos:      []signerInfo{info},
+	}
+	if !contentType.Equal(OIDData) || info.Version == 3 {
+		sd.Version = 3
+	}
+	if !opts.Detached {
+		sd.EncapContentInfo.EContent = content
+	}
+	var certificates []byte
+	if !opts.ExcludeCertificates {
+		if opts.Certificate != nil {
+			certificates = append(certificates, opts.Certificate.Raw...)
+		}
+		for _, certificate := range opts.Certificates {
+			certificates = append(certificates, certificate.Raw...)
+		}
+	}
+	if len(certificates) > 0 {
+		sd.Certificates = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: certificates}
+	}
+	return &Unsigned{signedAttrs: signedAttrs, sd: sd}, nil
+}
+
+// SigningInput returns the DER encoded signed attributes, which is what the signer signs.
+func (u *Unsigned) SigningInput() []byte {
+	return u.signedAttrs
+}
+
+// Seal returns the DER encoded ContentInfo with the given signature over the signing input.
+func (u *Unsigned) Seal(signature []byte) ([]byte, error) {
+	sd := u.sd
+	sd.SignerInfos = []signerInfo{u.sd.SignerInfos[0]}
+	sd.SignerInfos[0].Signature = signature
+	encoded, err := asn1.Marshal(sd)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(contentInfo{
+		ContentType: OIDSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: encoded},
+	})
+}
+
+// marshalAttributes encodes the attributes as DER SET OF, which is the form that gets signed.
+func marshalAttributes(attributes []Attribute) ([]byte, error) {
+	encoded := make([]attribute, len(attributes))
+	for i, attr := range attributes {
+		value, err := asn1.Marshal(attr.Value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode attribute %s: %w", attr.Type, err)
+		}
+		encoded[i] = attribute{Type: attr.Type, Values: []asn1.RawValue{{FullBytes: value}}}
+	}
+	return asn1.MarshalWithParams(encoded, "set")
+}
+
+// SignedData is a parsed CMS SignedData structure with a single signer.
+type SignedData struct {
+	// ContentType of the encapsulated content.
+	ContentType asn1.ObjectIdentifier
+	// Content is the encapsulated content, nil for detached signatures.
+	Content []byte
+	// Certificates embedded into the structure.
+	Certificates []*x509.Certificate
+
+	signer     signerInfo
+	attributes []attribute
+}
+
+// Parse decodes a DER encoded CMS SignedData structure.
+func Parse(der []byte) (*SignedData, error) {
+	var ci contentInfo
+	if rest, err := asn1.Unmarshal(der, &ci); err != nil || len(rest) > 0 {
+		return nil, fmt.Errorf("%w: invalid content info", ErrMalformedSignedData)
+	}
+	if !ci.ContentType.Equal(OIDSignedData) || ci.Content.Class != asn1.ClassContextSpecific || ci.Content.Tag != 0 {
+		return nil, fmt.Errorf("%w: unexpected content type %s", ErrMalformedSignedData, ci.ContentType)
+	}
+	var sd signedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedSignedData, err)
+	}
+	if len(sd.SignerInfos) != 1 {
+		return nil, fmt.Errorf("%w: expected exactly one signer, got %d", ErrMalformedSignedData, len(sd.SignerInfos))
+	}
+	parsed := &SignedData{
+		ContentType: sd.EncapContentInfo.EContentType,
+		Content:     sd.EncapContentInfo.EContent,
+		signer:      sd.SignerInfos[0],
+	}
+	if len(sd.Certificates.Bytes) > 0 {
+		certificates, err := x509.ParseCertificates(sd.Certificates.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrMalformedSignedData, err)
+		}
+		parsed.Certificates = certificates
+	}
+	if len(parsed.signer.SignedAttrs.Bytes) == 0 {
+		return nil, fmt.Errorf("%w: missing signed attributes", ErrMalformedSignedData)
+	}
+	// Go decodes SET OF like SEQUENCE OF, wrap the content accordingly.
+	rawAttributes := append([]byte{0x30}, parsed.signer.SignedAttrs.FullBytes[1:]...)
+	if _, err := asn1.Unmarshal(rawAttributes, &parsed.attributes); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedSignedData, err)
+	}
+	return parsed, nil
+}
+
+// Attribute decodes the value of the signed attribute with the given type into out.
+// It returns false if the attribute is not present.
+func (s *SignedData) Attribute(attributeType asn1.ObjectIdentifier, out interface{}) (bool, error) {
+	for _, attr := range s.attributes {
+		if !attr.Type.Equal(attributeType) {
+			continue
+		}
+		if len(attr.Values) != 1 {
+			return true, fmt.Errorf("%w: attribute %s must have exactly one value", ErrMalformedSignedData, attributeType)
+		}
+		_, err := asn1.Unmarshal(attr.Values[0].FullBytes, out)
+		return true, err
+	}
+	return false, nil
+}
+
+// SigningTime returns the signing time attribute, or the zero time if it is absent.
+func (s *SignedData) SigningTime() (time.Time, error) {
+	var signingTime time.Time
+	if _, err := s.Attribute(OIDSigningTime, &signingTime); err != nil {
+		return time.Time{}, err
+	}
+	return signingTime, nil
+}
+
+// Signer returns the embedded certificate of the signer.
+func (s *SignedData) Signer() (*x509.Certificate, error) {
+	if s.signer.SID.Class == asn1.ClassContextSpecific && s.signer.SID.Tag == 0 {
+		for _, certificate := range s.Certificates {
+			if bytes.Equal(certificate.SubjectKeyId, s.signer.SID.Bytes) {
+				return certificate, nil
+			}
+		}
+		return nil, ErrSignerNotFound
+	}
+	var sid issuerAndSerialNumber
+	if _, err := asn1.Unmarshal(s.signer.SID.FullBytes, &sid); err != nil {
+		return nil, fmt.Errorf("%w: invalid signer identifier", ErrMalformedSignedData)
+	}
+	for _, certificate := range s.Certificates {
+		if bytes.Equal(certificate.RawIssuer, sid.Issuer.FullBytes) && certificate.SerialNumber.Cmp(sid.SerialNumber) == 0 {
+			return certificate, nil
+		}
+	}
+	return nil, ErrSignerNotFound
+}
+
+// Verify checks the signature with the embedded signer certificate and returns that certificate.
+// The content must be passed for detached signatures and is ignored otherwise.
+func (s *SignedData) Verify(content []byte) (*x509.Certificate, error) {
+	certificate, err := s.Signer()
+	if err != nil {
+		return nil, err
+	}
+	if err = s.verify(content, certificate); err != nil {
+		return nil, err
+	}
+	return certificate, nil
+}
+
+func (s *SignedData) verify(content []byte, certificate *x509.Certificate) error {
+	if s.Content != nil {
+		content = s.Content
+	}
+	hash, ok := hashFromOID(s.signer.DigestAlgorithm.Algorithm)
+	if !ok {
+		return fmt.Errorf("%w: digest %s", ErrUnsupportedAlgorithm, s.signer.DigestAlgorithm.Algorithm)
+	}
+	algorithm, ok := signatureAlgorithmFromIdentifier(s.signer.SignatureAlgorithm, hash)
+	if !ok {
+		return fmt.Errorf("%w: signature %s", ErrUnsupportedAlgorithm, s.signer.SignatureAlgorithm.Algorithm)
+	}
+
+	var contentType asn1.ObjectIdentifier
+	if found, err := s.Attribute(OIDContentType, &contentType); err != nil || !found || !contentType.Equal(s.ContentType) {
+		return fmt.Errorf("%w: content type attribute does not match", ErrVerificationFailed)
+	}
+	var digest []byte
+	if found, err := s.Attribute(OIDMessageDigest, &digest); err != nil || !found {
+		return fmt.Errorf("%w: missing message digest attribute", ErrVerificationFailed)
+	}
+	hasher := hash.New()
+	hasher.Write(content)
+	if !bytes.Equal(digest, hasher.Sum(nil)) {
+		return fmt.Errorf("%w: message digest does not match the content", ErrVerificationFailed)
+	}
+
+	signedAttrs := append([]byte{0x31}, s.signer.SignedAttrs.FullBytes[1:]...)
+	if err := certificate.CheckSignature(algorithm, signedAttrs, s.signer.Signature); err != nil {
+		return fmt.Errorf("%w: %v", ErrVerificationFailed, err)
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package cms
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func newTestCertificate(t *testing.T) (*ecdsa.PrivateKey, *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      pkix.Name{CommonName: "test signer"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		SubjectKeyId: []byte{1, 2, 3, 4},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+	return key, certificate
+}
+
+func TestSignAndVerify(t *testing.T) {
+	key, certificate := newTestCertificate(t)
+	content := []byte("daily report")
+	signingTime := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		opts     Options
+		detached bool
+	}{
+		{
+			name: "Attached",
+			opts: Options{Certificate: certificate},
+		},
+		{
+			name:     "Detached",
+			opts:     Options{Certificate: certificate, Detached: true},
+			detached: true,
+		},
+		{
+			name: "Subject Key Identifier",
+			opts: Options{SubjectKeyID: certificate.SubjectKeyId, Certificates: []*x509.Certificate{certificate}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.opts.Hash = crypto.SHA384
+			test.opts.SignatureAlgorithm = x509.ECDSAWithSHA384
+			test.opts.SigningTime = signingTime
+			der, err := Sign(content, NewSigner(key, crypto.SHA384), test.opts)
+			if err != nil {
+				t.Fatalf("failed to sign: %v", err)
+			}
+			signedData, err := Parse(der)
+			if err != nil {
+				t.Fatalf("failed to parse: %v", err)
+			}
+			if test.detached && signedData.Content != nil {
+				t.Fatal("expected detached signature without content")
+			}
+			var detachedContent []byte
+			if test.detached {
+				detachedContent = content
+			}
+			signer, err := signedData.Verify(detachedContent)
+			if err != nil {
+				t.Fatalf("expected verification to pass, got %v", err)
+			}
+			if !signer.Equal(certificate) {
+				t.Fatal("expected the signer certificate to be returned")
+			}
+			got, err := signedData.SigningTime()
+			if err != nil {
+				t.Fatalf("failed to read signing time: %v", err)
+			}
+			if !got.Equal(signingTime) {
+				t.Fatalf("expected signing time %s, got %s", signingTime, got)
+			}
+		})
+	}
+}
+
+func TestVerify_TamperedContent(t *testing.T) {
+	key, certificate := newTestCertificate(t)
+	der, err := Sign([]byte("daily report"), NewSigner(key, crypto.SHA384), Options{
+		Detached:           true,
+		Hash:               crypto.SHA384,
+		SignatureAlgorithm: x509.ECDSAWithSHA384,
+		Certificate:        certificate,
+	})
+	if err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+	signedData, err := Parse(der)
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	if _, err = signedData.Verify([]byte("another report")); !errors.Is(err, ErrVerificationFailed) {
+		t.Fatalf("expected %q, got %v", ErrVerificationFailed, err)
+	}
+}
+
+func TestPrepare_ExternalSigner(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(7),
+		Subject:      pkix.Name{CommonName: "pss signer"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+
+	content := []byte("daily report")
+	unsigned, err := Prepare(content, Options{
+		Detached:           true,
+		Hash:               crypto.SHA256,
+		SignatureAlgorithm: x509.SHA256WithRSAPSS,
+		Certificate:        certificate,
+	})
+	if err != nil {
+		t.Fatalf("failed to prepare: %v", err)
+	}
+	digest := sha256.Sum256(unsigned.SigningInput())
+	signature, err := rsa.SignPSS(rand.Reader, key, crypto.SHA256, digest[:], &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+	if err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+	sealed, err := unsigned.Seal(signature)
+	if err != nil {
+		t.Fatalf("failed to seal: %v", err)
+	}
+	signedData, err := Parse(sealed)
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	if _, err = signedData.Verify(content); err != nil {
+		t.Fatalf("expected verification to pass, got %v", err)
+	}
+}
@@ -0,0 +1,433 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// env returns a lookupEnv function for the given variables.
+func env(variables map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := variables[name]
+		return value, ok
+	}
+}
+
+func writeFile(t *testing.T, name string, content string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	return file
+}
+
+func TestLoad_Default(t *testing.T) {
+	c, err := Load("test", nil, env(nil), io.Discard)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(c, Default()) {
+		t.Fatalf("expected the default configuration, got %+v", c)
+	}
+	if c.Server.ListenAddress != ":8080" || c.Server.MaxDocumentSize != 32<<20 || c.Keys.ECCCurve != "P-384" {
+		t.Fatalf("unexpected default configuration %+v", c)
+	}
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	yamlFile := writeFile(t, "config.yaml", `
+server:
+  listen_address: "file:1"
+  max_document_size: 1MiB
+  max_backup_size: 4096
+  drain_timeout: 1m
+keys:
+  ecc_curve: P-256
+storage:
+  data_directory: /var/lib/signing
+`)
+	tomlFile := writeFile(t, "config.toml", `
+[server]
+listen_address = "file:1"
+max_document_size = "1MiB"
+max_backup_size = 4096
+drain_timeout = "1m"
+
+[keys]
+ecc_curve = "P-256"
+
+[storage]
+data_directory = "/var/lib/signing"
+`)
+
+	for _, file := range []string{yamlFile, tomlFile} {
+		t.Run(filepath.Ext(file), func(t *testing.T) {
+			tests := []struct {
+				name     string
+				args     []string
+				env      map[string]string
+				expected string
+			}{
+				{
+					name:     "File",
+					args:     []string{"-config", file},
+					expected: "file:1",
+				},
+				{
+					name:     "Env Over File",
+					env:      map[string]string{"SIGNING_CONFIG": file, "SIGNING_SERVER_LISTEN_ADDRESS": "env:2"},
+					expected: "env:2",
+				},
+				{
+					name:     "Flag Over Env",
+					args:     []string{"-config", file, "-server.listen-address", "flag:3"},
+					env:      map[string]string{"SIGNING_SERVER_LISTEN_ADDRESS": "env:2"},
+					expected: "flag:3",
+				},
+			}
+			for _, test := range tests {
+				t.Run(test.name, func(t *testing.T) {
+					c, err := Load("test", test.args, env(test.env), io.Discard)
+					if err != nil {
+						t.Fatalf("expected no error, got %v", err)
+					}
+					if c.Server.ListenAddress != test.expected {
+						t.Fatalf("expected listen address %s, got %s", test.expected, c.Server.ListenAddress)
+					}
+					// settings missing in the file keep their defaults
+					if c.Server.MaxDocumentSize != 1<<20 || c.Server.MaxBackupSize != 4096 || c.Server.DrainTimeout != time.Minute ||
+						c.Server.ShutdownTimeout != Default().Server.ShutdownTimeout || c.Keys.ECCCurve != "P-256" ||
+						c.Keys.RSABits != Default().Keys.RSABits || c.Storage.DataDirectory != "/var/lib/signing" {
+						t.Fatalf("unexpected configuration %+v", c)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		env      map[string]string
+		expected string
+	}{
+		{
+			name:     "Listen Address",
+			args:     []string{"-server.listen-address", "8080"},
+			expected: "invalid server.listen_address",
+		},
+		{
+			name:     "TLS Key",
+			args:     []string{"-tls.certificate-file", "server.crt"},
+			expected: "certificate_file and key_file must be set together",
+		},
+		{
+			name:     "Client Auth",
+			args:     []string{"-tls.certificate-file", "server.crt", "-tls.key-file", "server.key", "-tls.client-auth", "require"},
+			expected: "invalid tls.client_auth: requires",
+		},
+		{
+			name:     "TLS Version",
+			env:      map[string]string{"SIGNING_TLS_MIN_VERSION": "1.0"},
+			expected: "invalid tls.min_version",
+		},
+		{
+			name:     "Cipher Suite",
+			args:     []string{"-tls.cipher-suites", "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,TLS_RSA_WITH_RC4_128_SHA"},
+			expected: "unsupported cipher suite: TLS_RSA_WITH_RC4_128_SHA",
+		},
+		{
+			name:     "Admin Key Hash",
+			env:      map[string]string{"SIGNING_AUTH_ENABLED": "true", "SIGNING_AUTH_ADMIN_KEY_SHA256": "c0ffee"},
+			expected: "invalid auth.admin_key_sha256: must be 32 hex encoded bytes",
+		},
+		{
+			name:     "Negative Quota",
+			args:     []string{"-limits.daily-signatures", "-1"},
+			expected: "invalid limits.daily_signatures: must not be negative",
+		},
+		{
+			name:     "Negative Override",
+			args:     []string{"-config", writeFile(t, "config.yaml", "limits:\n  devices:\n    till-1:\n      rate: -1\n")},
+			expected: "invalid limits.devices.till-1: must not be negative",
+		},
+		{
+			name:     "Rate",
+			env:      map[string]string{"SIGNING_LIMITS_CLIENT_RATE": "NaN"},
+			expected: "invalid SIGNING_LIMITS_CLIENT_RATE",
+		},
+		{
+			name:     "Device Counters",
+			env:      map[string]string{"SIGNING_METRICS_ENABLED": "false", "SIGNING_METRICS_DEVICE_COUNTERS": "true"},
+			expected: "invalid metrics.device_counters: requires metrics.enabled",
+		},
+		{
+			name:     "Log Level",
+			args:     []string{"-logging.level", "verbose"},
+			expected: "invalid logging.level: unknown log level: verbose",
+		},
+		{
+			name:     "Log Format",
+			env:      map[string]string{"SIGNING_LOGGING_FORMAT": "xml"},
+			expected: "invalid logging.format: must be text or json",
+		},
+		{
+			name:     "Trace Exporter",
+			args:     []string{"-tracing.exporter", "jaeger"},
+			expected: "invalid tracing.exporter: must be none, otlp or stdout",
+		},
+		{
+			name:     "Trace Endpoint",
+			env:      map[string]string{"SIGNING_TRACING_ENDPOINT": "collector:4318"},
+			expected: "invalid tracing.endpoint: must be an http(s) URL",
+		},
+		{
+			name:     "Sample Ratio",
+			args:     []string{"-tracing.sample-ratio", "1.5"},
+			expected: "invalid tracing.sample_ratio: must be between 0 and 1, got 1.5",
+		},
+		{
+			name:     "Storage",
+			env:      map[string]string{"SIGNING_STORAGE_DATABASE_URL": "postgres://db", "SIGNING_STORAGE_DATA_DIRECTORY": "/data"},
+			expected: "database_url and data_directory are mutually exclusive",
+		},
+		{
+			name:     "Key Size",
+			args:     []string{"-keys.rsa-bits", "1024"},
+			expected: "invalid keys.rsa_bits",
+		},
+		{
+			name:     "Curve",
+			args:     []string{"-keys.ecc-curve", "P-224"},
+			expected: "invalid keys.ecc_curve",
+		},
+		{
+			name:     "Timestamp Authority",
+			args:     []string{"-signing.timestamp-authority", "tsa.example.com"},
+			expected: "invalid signing.timestamp_authority",
+		},
+		{
+			name:     "Timestamp Authority Key",
+			args:     []string{"-signing.timestamp-key-file", "tsa.key", "-signing.timestamp-certificate-file", "tsa.crt"},
+			expected: "require the \"local\" timestamp_authority",
+		},
+		{
+			name:     "Timestamp Authority Roots",
+			args:     []string{"-signing.timestamp-authority", "https://tsa.example.com"},
+			expected: "invalid signing.timestamp_roots_file: is required",
+		},
+		{
+			name:     "CA",
+			args:     []string{"-ca.key-file", "ca.key"},
+			expected: "key_file and certificate_file must be set together",
+		},
+		{
+			name:     "Size",
+			env:      map[string]string{"SIGNING_SERVER_MAX_DOCUMENT_SIZE": "lots"},
+			expected: "invalid SIGNING_SERVER_MAX_DOCUMENT_SIZE",
+		},
+		{
+			name:     "Duration",
+			args:     []string{"-server.shutdown-timeout", "10"},
+			expected: "invalid -server.shutdown-timeout",
+		},
+		{
+			name:     "Negative Duration",
+			args:     []string{"-server.drain-timeout", "-1s"},
+			expected: "invalid server.drain_timeout",
+		},
+		{
+			name:     "Boolean",
+			env:      map[string]string{"SIGNING_SIGNING_TIMESTAMP_IN_SIGNED_DATA": "maybe"},
+			expected: "invalid SIGNING_SIGNING_TIMESTAMP_IN_SIGNED_DATA",
+		},
+		{
+			name:     "Unknown Flag",
+			args:     []string{"-listen", ":80"},
+			expected: "flag provided but not defined",
+		},
+		{
+			name:     "Unknown Setting",
+			args:     []string{"-config", writeFile(t, "config.yaml", "server:\n  listen: \":80\"\n")},
+			expected: "field listen not found",
+		},
+		{
+			name:     "Unknown TOML Setting",
+			args:     []string{"-config", writeFile(t, "config.toml", "[server]\nlisten = \":80\"\n")},
+			expected: "unknown setting server.listen",
+		},
+		{
+			name:     "Format",
+			args:     []string{"-config", writeFile(t, "config.json", "{}")},
+			expected: ErrUnsupportedFormat.Error(),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Load("test", test.args, env(test.env), io.Discard)
+			if err == nil || !strings.Contains(err.Error(), test.expected) {
+				t.Fatalf("expected error containing %q, got %v", test.expected, err)
+			}
+		})
+	}
+}
+
+func TestLoad_LimitOverrides(t *testing.T) {
+	yamlFile := writeFile(t, "config.yaml", `
+limits:
+  client_rate: 10
+  clients:
+    back-office:
+      rate: 100
+      burst: 500
+  devices:
+    till-1:
+      rate: 0
+`)
+	tomlFile := writeFile(t, "config.toml", `
+[limits]
+client_rate = 10
+
+[limits.clients.back-office]
+rate = 100
+burst = 500
+
+[limits.devices.till-1]
+rate = 0
+`)
+	for _, file := range []string{yamlFile, tomlFile} {
+		t.Run(filepath.Ext(file), func(t *testing.T) {
+			c, err := Load("test", []string{"-config", file}, env(nil), io.Discard)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			expected := Limits{
+				ClientRate: 10,
+				Clients:    map[string]LimitOverride{"back-office": {Rate: 100, Burst: 500}},
+				Devices:    map[string]LimitOverride{"till-1": {}},
+			}
+			if !reflect.DeepEqual(c.Limits, expected) {
+				t.Fatalf("expected limits %+v, got %+v", expected, c.Limits)
+			}
+		})
+	}
+
+	// overrides alone enable rate limiting
+	c := Default()
+	if c.RateLimiting() {
+		t.Fatal("expected no rate limiting by default")
+	}
+	c.Limits.Devices["till-1"] = LimitOverride{Rate: 1}
+	if !c.RateLimiting() {
+		t.Fatal("expected rate limiting with an override")
+	}
+}
+
+func TestLoad_AllErrors(t *testing.T) {
+	_, err := Load("test", []string{"-keys.rsa-bits", "1", "-keys.rsa-pss-bits", "1"}, env(nil), io.Discard)
+	if err == nil || !strings.Contains(err.Error(), "keys.rsa_bits") || !strings.Contains(err.Error(), "keys.rsa_pss_bits") {
+		t.Fatalf("expected errors of both key sizes, got %v", err)
+	}
+}
+
+func TestLoad_Help(t *testing.T) {
+	var output bytes.Buffer
+	if _, err := Load("test", []string{"-h"}, env(nil), &output); !errors.Is(err, flag.ErrHelp) {
+		t.Fatalf("expected error %v, got %v", flag.ErrHelp, err)
+	}
+	if !strings.Contains(output.String(), "SIGNING_BACKUP_KEY_FILE") {
+		t.Fatalf("expected usage to name the environment variables, got %s", output.String())
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	tests := []struct {
+		url      string
+		expected string
+	}{
+		{"postgres://user:secret@db/signing", "postgres://user:xxxxx@db/signing"},
+		{"postgres://user@db/signing?password=secret", "postgres://user@db/signing?password=xxxxx"},
+		{"host=db user=user password=secret dbname=signing", "host=db user=user password=xxxxx dbname=signing"},
+		{"host=db password='a secret'", "host=db password=xxxxx"},
+		{"", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.expected, func(t *testing.T) {
+			c := Default()
+			c.Storage.DatabaseURL = test.url
+			redacted := c.Redacted()
+			if redacted.Storage.DatabaseURL != test.expected {
+				t.Fatalf("expected %s, got %s", test.expected, redacted.Storage.DatabaseURL)
+			}
+			if c.Storage.DatabaseURL != test.url {
+				t.Fatalf("expected the configuration to be unchanged, got %s", c.Storage.DatabaseURL)
+			}
+		})
+	}
+}
+
+func TestWriteYAML(t *testing.T) {
+	c := Default()
+	var output bytes.Buffer
+	if err := c.WriteYAML(&output); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !strings.Contains(output.String(), "max_document_size: 32MiB") {
+		t.Fatalf("expected sizes with units, got %s", output.String())
+	}
+	// the output is a valid configuration file
+	file := writeFile(t, "config.yml", output.String())
+	loaded, err := Load("test", []string{"-config", file}, env(nil), io.Discard)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(loaded, c) {
+		t.Fatalf("expected %+v, got %+v", c, loaded)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected Size
+		err      bool
+	}{
+		{value: "1024", expected: 1024},
+		{value: "512B", expected: 512},
+		{value: "8KiB", expected: 8 << 10},
+		{value: "32 MiB", expected: 32 << 20},
+		{value: "1GiB", expected: 1 << 30},
+		{value: "1TiB", err: true},
+		{value: "-1", err: true},
+		{value: "99999999999GiB", err: true},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			size, err := ParseSize(test.value)
+			if test.err {
+				if err == nil {
+					t.Fatalf("expected error, got %d", size)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if size != test.expected {
+				t.Fatalf("expected %d, got %d", test.expected, size)
+			}
+		})
+	}
+}
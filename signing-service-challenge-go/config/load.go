@@ -0,0 +1,300 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix is the prefix of the environment variables of all settings.
+const EnvPrefix = "SIGNING_"
+
+// ErrUnsupportedFormat indicates a configuration file that is neither YAML nor TOML.
+var ErrUnsupportedFormat = errors.New("unsupported configuration file format")
+
+// setting is a configurable value, with its name in the configuration file.
+type setting struct {
+	name  string
+	usage string
+	value flag.Value
+}
+
+// flagName is the command line flag of the setting, e.g. server.listen-address.
+func (s setting) flagName() string {
+	return strings.ReplaceAll(s.name, "_", "-")
+}
+
+// envName is the environment variable of the setting, e.g. SIGNING_SERVER_LISTEN_ADDRESS.
+func (s setting) envName() string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(s.name, ".", "_"))
+}
+
+// settings lists the settings of c, which are set through the returned values.
+func (c *Config) settings() []setting {
+	return []setting{
+		{"server.listen_address", "host:port the API listens on", (*stringValue)(&c.Server.ListenAddress)},
+		{"server.max_document_size", "size limit of documents accepted for signing, e.g. 32MiB", &c.Server.MaxDocumentSize},
+		{"server.max_backup_size", "size limit of backups accepted for restoring, e.g. 1GiB", &c.Server.MaxBackupSize},
+		{"server.drain_timeout", "time in-flight writes are given to complete on shutdown, e.g. 15s", (*durationValue)(&c.Server.DrainTimeout)},
+		{"server.shutdown_timeout", "time the remaining requests are given to complete after draining", (*durationValue)(&c.Server.ShutdownTimeout)},
+		{"tls.certificate_file", "PEM file with the certificate chain of the server, enables HTTPS", (*stringValue)(&c.TLS.CertificateFile)},
+		{"tls.key_file", "PEM file with the private key of the server", (*stringValue)(&c.TLS.KeyFile)},
+		{"tls.client_ca_file", "PEM file with the CA certificates issuing client certificates", (*stringValue)(&c.TLS.ClientCAFile)},
+		{"tls.client_auth", "client certificate authentication, none, optional or require", (*stringValue)(&c.TLS.ClientAuth)},
+		{"tls.min_version", "minimum TLS version, 1.2 or 1.3", (*stringValue)(&c.TLS.MinVersion)},
+		{"tls.cipher_suites", "comma separated TLS 1.2 cipher suites", (*stringsValue)(&c.TLS.CipherSuites)},
+		{"tls.reload_interval", "minimum time between two checks of the TLS files for changes", (*durationValue)(&c.TLS.ReloadInterval)},
+		{"auth.enabled", "require API keys for all endpoints except the health check", (*boolValue)(&c.Auth.Enabled)},
+		{"auth.admin_key_sha256", "hex encoded SHA-256 hash of the bootstrap admin token", (*stringValue)(&c.Auth.AdminKeySHA256)},
+		{"limits.client_rate", "requests per second of every API client, 0 for no limit", (*floatValue)(&c.Limits.ClientRate)},
+		{"limits.client_burst", "requests every API client may make at once, 0 for one second of requests", (*intValue)(&c.Limits.ClientBurst)},
+		{"limits.device_rate", "signatures per second of every device, 0 for no limit", (*floatValue)(&c.Limits.DeviceRate)},
+		{"limits.device_burst", "signatures every device may make at once, 0 for one second of signatures", (*intValue)(&c.Limits.DeviceBurst)},
+		{"limits.daily_signatures", "signatures of every device per day (UTC), 0 for no quota", (*int64Value)(&c.Limits.DailySignatures)},
+		{"limits.monthly_signatures", "signatures of every device per month (UTC), 0 for no quota", (*int64Value)(&c.Limits.MonthlySignatures)},
+		{"metrics.enabled", "serve Prometheus metrics on /metrics", (*boolValue)(&c.Metrics.Enabled)},
+		{"metrics.device_counters", "export the signature counter of every device as metric", (*boolValue)(&c.Metrics.DeviceCounters)},
+		{"logging.level", "minimum level of logged records, debug, info, warn or error", (*stringValue)(&c.Logging.Level)},
+		{"logging.format", "format of the logs, text or json", (*stringValue)(&c.Logging.Format)},
+		{"tracing.exporter", "exporter of trace spans, none, otlp or stdout", (*stringValue)(&c.Tracing.Exporter)},
+		{"tracing.endpoint", "URL of the OTLP/HTTP collector receiving trace spans", (*stringValue)(&c.Tracing.Endpoint)},
+		{"tracing.file", "file the stdout exporter appends trace spans to, standard output if empty", (*stringValue)(&c.Tracing.File)},
+		{"tracing.sample_ratio", "fraction of traces recorded, between 0 and 1", (*floatValue)(&c.Tracing.SampleRatio)},
+		{"storage.database_url", "PostgreSQL connection string of the device database", (*stringValue)(&c.Storage.DatabaseURL)},
+		{"storage.data_directory", "directory of the file device database", (*stringValue)(&c.Storage.DataDirectory)},
+		{"storage.key_encryption_key_file", "file with the hex encoded master key encrypting the private keys of devices", (*stringValue)(&c.Storage.KeyEncryptionKeyFile)},
+		{"keys.rsa_bits", "size of RSA device keys", (*intValue)(&c.Keys.RSABits)},
+		{"keys.rsa_pss_bits", "size of RSA-PSS device keys", (*intValue)(&c.Keys.RSAPSSBits)},
+		{"keys.ecc_curve", "curve of ECC device keys, P-256, P-384 or P-521", (*stringValue)(&c.Keys.ECCCurve)},
+		{"signing.timestamp_authority", "URL of an RFC 3161 time stamping authority, or \"local\"", (*stringValue)(&c.Signing.TimestampAuthority)},
+		{"signing.timestamp_key_file", "PEM file with the key of the \"local\" time stamping authority", (*stringValue)(&c.Signing.TimestampKeyFile)},
+		{"signing.timestamp_certificate_file", "PEM file with the certificate of the \"local\" time stamping authority", (*stringValue)(&c.Signing.TimestampCertificateFile)},
+		{"signing.timestamp_roots_file", "PEM file with the root certificates of a remote time stamping authority", (*stringValue)(&c.Signing.TimestampRootsFile)},
+		{"signing.timestamp_timeout", "time the time stamping authority is given to issue a token, e.g. 2s", (*durationValue)(&c.Signing.TimestampTimeout)},
+		{"signing.timestamp_in_signed_data", "include the signature timestamp in the secured data", (*boolValue)(&c.Signing.TimestampInSignedData)},
+		{"ca.key_file", "PEM file with the key of the CA certifying device keys", (*stringValue)(&c.CA.KeyFile)},
+		{"ca.certificate_file", "PEM file with the certificate chain of the CA", (*stringValue)(&c.CA.CertificateFile)},
+		{"backup.key_file", "PEM file with the ECC key signing and encrypting backups", (*stringValue)(&c.Backup.KeyFile)},
+	}
+}
+
+// Load loads and validates the configuration from the command line arguments, the environment looked up
+// by lookupEnv and the configuration file named by either. Usage and flag errors are written to output.
+func Load(name string, args []string, lookupEnv func(string) (string, bool), output io.Writer) (*Config, error) {
+	c := Default()
+	settings := c.settings()
+
+	// flags are recorded first, as they name the configuration file, and applied last
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(output)
+	file := flags.String("config", "", "YAML or TOML configuration file (env "+EnvPrefix+"CONFIG)")
+	values := make(map[string]string)
+	for _, s := range settings {
+		flags.Var(&recorder{setting: s, values: values, def: s.value.String()}, s.flagName(), s.usage+" (env "+s.envName()+")")
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if flags.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument: %s", flags.Arg(0))
+	}
+
+	if *file == "" {
+		*file, _ = lookupEnv(EnvPrefix + "CONFIG")
+	}
+	if *file != "" {
+		if err := c.loadFile(*file); err != nil {
+			return nil, err
+		}
+	}
+	for _, s := range settings {
+		if value, ok := lookupEnv(s.envName()); ok {
+			if err := s.value.Set(value); err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", s.envName(), err)
+			}
+		}
+	}
+	for _, s := range settings {
+		if value, ok := values[s.name]; ok {
+			if err := s.value.Set(value); err != nil {
+				return nil, fmt.Errorf("invalid -%s: %w", s.flagName(), err)
+			}
+		}
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// loadFile overrides the settings in the given file, which must not contain unknown settings.
+func (c *Config) loadFile(file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("failed to read configuration file: %w", err)
+	}
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err = decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("invalid configuration file %s: %w", file, err)
+		}
+	case ".toml":
+		metadata, err := toml.Decode(string(data), c)
+		if err != nil {
+			return fmt.Errorf("invalid configuration file %s: %w", file, err)
+		}
+		if undecoded := metadata.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("invalid configuration file %s: unknown setting %s", file, undecoded[0])
+		}
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedFormat, file)
+	}
+	return nil
+}
+
+// WriteYAML writes the configuration as YAML, in the format of a configuration file.
+func (c *Config) WriteYAML(w io.Writer) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(c); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// recorder records the value of a flag by the name of its setting.
+type recorder struct {
+	setting setting
+	values  map[string]string
+	def     string
+}
+
+func (r *recorder) String() string {
+	return r.def
+}
+
+func (r *recorder) Set(value string) error {
+	r.values[r.setting.name] = value
+	return nil
+}
+
+func (r *recorder) IsBoolFlag() bool {
+	_, ok := r.setting.value.(*boolValue)
+	return ok
+}
+
+type stringValue string
+
+func (s *stringValue) String() string {
+	return string(*s)
+}
+
+func (s *stringValue) Set(value string) error {
+	*s = stringValue(value)
+	return nil
+}
+
+type intValue int
+
+func (i *intValue) String() string {
+	return strconv.Itoa(int(*i))
+}
+
+func (i *intValue) Set(value string) error {
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("invalid number: %s", value)
+	}
+	*i = intValue(parsed)
+	return nil
+}
+
+type int64Value int64
+
+func (i *int64Value) String() string {
+	return strconv.FormatInt(int64(*i), 10)
+}
+
+func (i *int64Value) Set(value string) error {
+	parsed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid number: %s", value)
+	}
+	*i = int64Value(parsed)
+	return nil
+}
+
+type floatValue float64
+
+func (f *floatValue) String() string {
+	return strconv.FormatFloat(float64(*f), 'g', -1, 64)
+}
+
+func (f *floatValue) Set(value string) error {
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(parsed) || math.IsInf(parsed, 0) {
+		return fmt.Errorf("invalid number: %s", value)
+	}
+	*f = floatValue(parsed)
+	return nil
+}
+
+type boolValue bool
+
+func (b *boolValue) String() string {
+	return strconv.FormatBool(bool(*b))
+}
+
+func (b *boolValue) Set(value string) error {
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("invalid boolean: %s", value)
+	}
+	*b = boolValue(parsed)
+	return nil
+}
+
+type durationValue time.Duration
+
+func (d *durationValue) String() string {
+	return time.Duration(*d).String()
+}
+
+func (d *durationValue) Set(value string) error {
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("invalid duration: %s", value)
+	}
+	*d = durationValue(parsed)
+	return nil
+}
+
+// stringsValue is a comma separated list.
+type stringsValue []string
+
+func (s *stringsValue) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsValue) Set(value string) error {
+	*s = stringsValue{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*s = append(*s, item)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Size is a number of bytes, written as plain number or with a binary unit, e.g. 32MiB.
+type Size int64
+
+// sizeUnits are the units of a Size, largest first.
+var sizeUnits = []struct {
+	suffix string
+	bytes  int64
+}{
+	{"GiB", 1 << 30},
+	{"MiB", 1 << 20},
+	{"KiB", 1 << 10},
+	{"B", 1},
+}
+
+// ParseSize parses a number of bytes with an optional unit, B, KiB, MiB or GiB.
+func ParseSize(value string) (Size, error) {
+	number, multiplier := strings.TrimSpace(value), int64(1)
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(number, unit.suffix) {
+			number, multiplier = strings.TrimSpace(strings.TrimSuffix(number, unit.suffix)), unit.bytes
+			break
+		}
+	}
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || n < 0 || n > (1<<63-1)/multiplier {
+		return 0, fmt.Errorf("invalid size: %s", value)
+	}
+	return Size(n * multiplier), nil
+}
+
+// String formats the size with the largest unit that divides it.
+func (s Size) String() string {
+	for _, unit := range sizeUnits {
+		if s != 0 && int64(s)%unit.bytes == 0 {
+			return strconv.FormatInt(int64(s)/unit.bytes, 10) + unit.suffix
+		}
+	}
+	return strconv.FormatInt(int64(s), 10)
+}
+
+func (s *Size) Set(value string) error {
+	parsed, err := ParseSize(value)
+	if err != nil {
+		return err
+	}
+	*s = parsed
+	return nil
+}
+
+func (s Size) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *Size) UnmarshalText(text []byte) error {
+	return s.Set(string(text))
+}
@@ -0,0 +1,215 @@
+package cose
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// CBOR major types (RFC 8949, section 3.1).
+const (
+	majorUnsigned = 0
+	majorNegative = 1
+	majorBytes    = 2
+	majorText     = 3
+	majorArray    = 4
+	majorMap      = 5
+	majorTag      = 6
+)
+
+// maxDepth bounds the nesting of decoded items.
+const maxDepth = 16
+
+var errMalformedCBOR = errors.New("malformed CBOR")
+
+// tag is a decoded tagged CBOR item.
+type tag struct {
+	number  uint64
+	content any
+}
+
+// encoder writes the deterministic encoding (RFC 8949, section 4.2.1) of the few CBOR items COSE needs.
+// Map keys have to be written in their canonical order by the caller.
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) head(major byte, argument uint64) {
+	switch {
+	case argument < 24:
+		e.buf = append(e.buf, major<<5|byte(argument))
+	case argument <= math.MaxUint8:
+		e.buf = append(e.buf, major<<5|24, byte(argument))
+	case argument <= math.MaxUint16:
+		e.buf = binary.BigEndian.AppendUint16(append(e.buf, major<<5|25), uint16(argument))
+	case argument <= math.MaxUint32:
+		e.buf = binary.BigEndian.AppendUint32(append(e.buf, major<<5|26), uint32(argument))
+	default:
+		e.buf = binary.BigEndian.AppendUint64(append(e.buf, major<<5|27), argument)
+	}
+}
+
+func (e *encoder) int(value int64) {
+	if value < 0 {
+		e.head(majorNegative, uint64(-1-value))
+		return
+	}
+	e.head(majorUnsigned, uint64(value))
+}
+
+func (e *encoder) bytes(value []byte) {
+	e.head(majorBytes, uint64(len(value)))
+	e.buf = append(e.buf, value...)
+}
+
+func (e *encoder) text(value string) {
+	e.head(majorText, uint64(len(value)))
+	e.buf = append(e.buf, value...)
+}
+
+func (e *encoder) array(length int) {
+	e.head(majorArray, uint64(length))
+}
+
+func (e *encoder) mapHeader(length int) {
+	e.head(majorMap, uint64(length))
+}
+
+func (e *encoder) tag(number uint64) {
+	e.head(majorTag, number)
+}
+
+// decode parses a single CBOR item that has to span all of data. Integers are returned as int64,
+// byte and text strings as []byte and string, arrays as []any, maps as map[any]any and tags as tag.
+// Floating point numbers, simple values other than booleans and null, and indefinite lengths are rejected.
+func decode(data []byte) (any, error) {
+	d := decoder{data: data}
+	item, err := d.item(0)
+	if err != nil {
+		return nil, err
+	}
+	if d.offset != len(d.data) {
+		return nil, fmt.Errorf("%w: trailing data", errMalformedCBOR)
+	}
+	return item, nil
+}
+
+type decoder struct {
+	data   []byte
+	offset int
+}
+
+func (d *decoder) head() (byte, uint64, error) {
+	if d.offset >= len(d.data) {
+		return 0, 0, fmt.Errorf("%w: unexpected end of data", errMalformedCBOR)
+	}
+	initial := d.data[d.offset]
+	d.offset++
+	major, info := initial>>5, initial&0x1f
+	var size int
+	switch {
+	case info < 24:
+		return major, uint64(info), nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	default:
+		return 0, 0, fmt.Errorf("%w: unsupported additional information %d", errMalformedCBOR, info)
+	}
+	if len(d.data)-d.offset < size {
+		return 0, 0, fmt.Errorf("%w: unexpected end of data", errMalformedCBOR)
+	}
+	var argument uint64
+	for _, b := range d.data[d.offset : d.offset+size] {
+		argument = argument<<8 | uint64(b)
+	}
+	d.offset += size
+	return major, argument, nil
+}
+
+func (d *decoder) item(depth int) (any, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("%w: nesting too deep", errMalformedCBOR)
+	}
+	major, argument, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	switch major {
+	case majorUnsigned, majorNegative:
+		if argument > math.MaxInt64 {
+			return nil, fmt.Errorf("%w: integer out of range", errMalformedCBOR)
+		}
+		if major == majorNegative {
+			return -1 - int64(argument), nil
+		}
+		return int64(argument), nil
+	case majorBytes, majorText:
+		if argument > uint64(len(d.data)-d.offset) {
+			return nil, fmt.Errorf("%w: unexpected end of data", errMalformedCBOR)
+		}
+		value := d.data[d.offset : d.offset+int(argument)]
+		d.offset += int(argument)
+		if major == majorText {
+			return string(value), nil
+		}
+		return value, nil
+	case majorArray:
+		// every item takes at least one byte, which bounds the allocation by the input size
+		if argument > uint64(len(d.data)-d.offset) {
+			return nil, fmt.Errorf("%w: unexpected end of data", errMalformedCBOR)
+		}
+		items := make([]any, argument)
+		for i := range items {
+			if items[i], err = d.item(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	case majorMap:
+		if argument > uint64(len(d.data)-d.offset)/2 {
+			return nil, fmt.Errorf("%w: unexpected end of data", errMalformedCBOR)
+		}
+		items := make(map[any]any, argument)
+		for range argument {
+			key, err := d.item(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, fmt.Errorf("%w: unsupported map key %T", errMalformedCBOR, key)
+			}
+			if _, ok := items[key]; ok {
+				return nil, fmt.Errorf("%w: duplicate map key %v", errMalformedCBOR, key)
+			}
+			if items[key], err = d.item(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	case majorTag:
+		content, err := d.item(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return tag{number: argument, content: content}, nil
+	default:
+		switch argument {
+		case 20:
+			return false, nil
+		case 21:
+			return true, nil
+		case 22:
+			return nil, nil
+		}
+		return nil, fmt.Errorf("%w: unsupported simple value %d", errMalformedCBOR, argument)
+	}
+}
@@ -0,0 +1,237 @@
+package cose
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+)
+
+// COSE algorithms (RFC 9053, RFC 8812) of the supported device algorithms.
+const (
+	ES384 int64 = -35
+	EdDSA int64 = -8
+	PS256 int64 = -37
+	RS256 int64 = -257
+)
+
+// Header labels (RFC 9052, section 3.1). Counter is a text label, as the signature counter
+// has no registered label.
+const (
+	labelAlgorithm = 1
+	labelKeyID     = 4
+	labelCounter   = "counter"
+)
+
+// tagSign1 is the CBOR tag of a COSE_Sign1 structure (RFC 9052, section 4.2).
+const tagSign1 = 18
+
+// es384Size is the byte size of the P-384 curve order.
+const es384Size = 48
+
+var (
+	ErrUnsupportedAlgorithm = errors.New("unsupported COSE algorithm")
+	ErrMalformedSign1       = errors.New("malformed COSE_Sign1")
+)
+
+// AlgorithmFor returns the COSE algorithm matching the signatures of the given device algorithm.
+func AlgorithmFor(algorithm types.SigningAlgorithm) (int64, error) {
+	switch algorithm {
+	case types.RSA:
+		return RS256, nil
+	case types.ECC:
+		return ES384, nil
+	case types.RSAPSS:
+		return PS256, nil
+	case types.Ed25519:
+		return EdDSA, nil
+	default:
+		return 0, fmt.Errorf("%w: no COSE algorithm for %s", ErrUnsupportedAlgorithm, algorithm)
+	}
+}
+
+// Header is the protected header of signatures produced by a signature device.
+type Header struct {
+	Algorithm int64
+	// KeyID is the device ID.
+	KeyID   string
+	Counter uint32
+}
+
+// Sign1 is a tagged COSE_Sign1 structure (RFC 9052, section 4.2) awaiting its signature.
+type Sign1 struct {
+	header    Header
+	protected []byte
+	payload   []byte
+	detached  bool
+}
+
+// New prepares a COSE_Sign1 over the payload with the header in the protected bucket.
+// A detached Sign1 carries nil instead of the payload, which has to be supplied for verification.
+func New(header Header, payload []byte, detached bool) (*Sign1, error) {
+	var protected encoder
+	protected.mapHeader(3)
+	protected.int(labelAlgorithm)
+	protected.int(header.Algorithm)
+	protected.int(labelKeyID)
+	protected.bytes([]byte(header.KeyID))
+	protected.text(labelCounter)
+	protected.int(int64(header.Counter))
+	return &Sign1{
+		header:    header,
+		protected: protected.buf,
+		payload:   payload,
+		detached:  detached,
+	}, nil
+}
+
+// SigningInput returns the encoded Sig_structure (RFC 9052, section 4.4) that has to be signed.
+func (s *Sign1) SigningInput() []byte {
+	return sigStructure(s.protected, s.payload)
+}
+
+// Seal returns the tagged COSE_Sign1 carrying the signature over the signing input.
+// The signature is expected in the format of the device signers and converted if necessary.
+func (s *Sign1) Seal(signature []byte) ([]byte, error) {
+	signature, err := encodeSignature(s.header.Algorithm, signature)
+	if err != nil {
+		return nil, err
+	}
+	var e encoder
+	e.tag(tagSign1)
+	e.array(4)
+	e.bytes(s.protected)
+	e.mapHeader(0)
+	if s.detached {
+		e.buf = append(e.buf, 0xf6) // null
+	} else {
+		e.bytes(s.payload)
+	}
+	e.bytes(signature)
+	return e.buf, nil
+}
+
+// Verifier checks a signature in the format produced by the device signers.
+type Verifier interface {
+	Verify(data []byte, signature []byte) error
+}
+
+// Verify checks a COSE_Sign1 with the verifier and returns its protected header and payload.
+// The payload must be passed for detached signatures and is ignored otherwise.
+// Untagged structures are accepted as well.
+func Verify(encoded []byte, detachedPayload []byte, verifier Verifier) (*Header, []byte, error) {
+	item, err := decode(encoded)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrMalformedSign1, err)
+	}
+	if tagged, ok := item.(tag); ok {
+		if tagged.number != tagSign1 {
+			return nil, nil, fmt.Errorf("%w: unexpected tag %d", ErrMalformedSign1, tagged.number)
+		}
+		item = tagged.content
+	}
+	structure, ok := item.([]any)
+	if !ok || len(structure) != 4 {
+		return nil, nil, fmt.Errorf("%w: expected an array of four items", ErrMalformedSign1)
+	}
+	protected, ok := structure[0].([]byte)
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: protected header is not a byte string", ErrMalformedSign1)
+	}
+	if _, ok = structure[1].(map[any]any); !ok {
+		return nil, nil, fmt.Errorf("%w: unprotected header is not a map", ErrMalformedSign1)
+	}
+	payload := detachedPayload
+	switch value := structure[2].(type) {
+	case []byte:
+		payload = value
+	case nil:
+	default:
+		return nil, nil, fmt.Errorf("%w: payload is neither a byte string nor null", ErrMalformedSign1)
+	}
+	signature, ok := structure[3].([]byte)
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: signature is not a byte string", ErrMalformedSign1)
+	}
+
+	header, err := decodeProtected(protected)
+	if err != nil {
+		return nil, nil, err
+	}
+	if signature, err = decodeSignature(header.Algorithm, signature); err != nil {
+		return nil, nil, err
+	}
+	if err = verifier.Verify(sigStructure(protected, payload), signature); err != nil {
+		return nil, nil, err
+	}
+	return header, payload, nil
+}
+
+// sigStructure encodes the Sig_structure for a COSE_Sign1 without external data.
+func sigStructure(protected []byte, payload []byte) []byte {
+	var e encoder
+	e.array(4)
+	e.text("Signature1")
+	e.bytes(protected)
+	e.bytes(nil)
+	e.bytes(payload)
+	return e.buf
+}
+
+// decodeProtected parses the protected header and requires the algorithm, key ID and counter.
+func decodeProtected(protected []byte) (*Header, error) {
+	item, err := decode(protected)
+	if err != nil {
+		return nil, fmt.Errorf("%w: protected header: %v", ErrMalformedSign1, err)
+	}
+	values, ok := item.(map[any]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: protected header is not a map", ErrMalformedSign1)
+	}
+	algorithm, ok := values[int64(labelAlgorithm)].(int64)
+	if !ok {
+		return nil, fmt.Errorf("%w: missing algorithm", ErrMalformedSign1)
+	}
+	keyID, ok := values[int64(labelKeyID)].([]byte)
+	if !ok {
+		return nil, fmt.Errorf("%w: missing key ID", ErrMalformedSign1)
+	}
+	counter, ok := values[labelCounter].(int64)
+	if !ok || counter < 0 || counter > math.MaxUint32 {
+		return nil, fmt.Errorf("%w: missing or invalid counter", ErrMalformedSign1)
+	}
+	return &Header{
+		Algorithm: algorithm,
+		KeyID:     string(keyID),
+		Counter:   uint32(counter),
+	}, nil
+}
+
+// encodeSignature converts a device signature into its COSE representation.
+func encodeSignature(algorithm int64, signature []byte) ([]byte, error) {
+	switch algorithm {
+	case ES384:
+		return crypto.ECDSASignatureToRaw(signature, es384Size)
+	case RS256, PS256, EdDSA:
+		return signature, nil
+	default:
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedAlgorithm, algorithm)
+	}
+}
+
+// decodeSignature converts a COSE signature into the representation the device signers verify.
+func decodeSignature(algorithm int64, signature []byte) ([]byte, error) {
+	switch algorithm {
+	case ES384:
+		if len(signature) != 2*es384Size {
+			return nil, fmt.Errorf("%w: invalid ES384 signature length", ErrMalformedSign1)
+		}
+		return crypto.ECDSASignatureFromRaw(signature)
+	case RS256, PS256, EdDSA:
+		return signature, nil
+	default:
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedAlgorithm, algorithm)
+	}
+}
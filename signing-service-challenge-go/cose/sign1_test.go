@@ -0,0 +1,118 @@
+package cose
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+)
+
+func TestSign1(t *testing.T) {
+	payload := []byte("0_test data_dmFsaWQtaWQ=")
+	for _, algorithm := range []types.SigningAlgorithm{types.RSA, types.ECC, types.RSAPSS, types.Ed25519} {
+		for _, detached := range []bool{false, true} {
+			name := string(algorithm)
+			if detached {
+				name += " detached"
+			}
+			t.Run(name, func(t *testing.T) {
+				_, privatePem, err := crypto.GenerateNewPair(algorithm)
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				signer, err := crypto.NewSigner(algorithm, privatePem)
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				alg, err := AlgorithmFor(algorithm)
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				sign1, err := New(Header{Algorithm: alg, KeyID: "device", Counter: 300}, payload, detached)
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				signature, err := signer.Sign(sign1.SigningInput())
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				encoded, err := sign1.Seal(signature)
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				// tag 18 followed by an array of four items
+				if !bytes.HasPrefix(encoded, []byte{0xd2, 0x84}) {
+					t.Fatalf("expected tagged COSE_Sign1, got %x", encoded[:2])
+				}
+
+				var detachedPayload []byte
+				if detached {
+					detachedPayload = payload
+				}
+				header, verified, err := Verify(encoded, detachedPayload, signer)
+				if err != nil {
+					t.Fatalf("expected valid COSE_Sign1, got %v", err)
+				}
+				if header.Algorithm != alg || header.KeyID != "device" || header.Counter != 300 {
+					t.Fatalf("unexpected header %+v", header)
+				}
+				if !bytes.Equal(verified, payload) {
+					t.Fatalf("expected payload %q, got %q", payload, verified)
+				}
+				if detached {
+					if _, _, err = Verify(encoded, []byte("tampered"), signer); err == nil {
+						t.Fatal("expected tampered payload to fail verification")
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestSign1_ProtectedHeader(t *testing.T) {
+	sign1, err := New(Header{Algorithm: ES384, KeyID: "id", Counter: 1}, []byte("data"), false)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	// {1: -35, 4: h'6964', "counter": 1}
+	want := "a3" + "01" + "3822" + "04" + "426964" + "67636f756e746572" + "01"
+	if got := hex.EncodeToString(sign1.protected); got != want {
+		t.Fatalf("expected protected header %s, got %s", want, got)
+	}
+}
+
+func TestVerify_Malformed(t *testing.T) {
+	tests := []struct {
+		name    string
+		encoded string
+	}{
+		{name: "Empty", encoded: ""},
+		{name: "Wrong Tag", encoded: "d1840040f640"},
+		{name: "Not An Array", encoded: "d24100"},
+		{name: "Three Items", encoded: "d283404040"},
+		{name: "Truncated", encoded: "d28443a10126a0"},
+		{name: "Trailing Data", encoded: "d28440a0f64000"},
+		{name: "Missing Header Values", encoded: "d28443a10126a0f640"},
+		{name: "Indefinite Length", encoded: "d29f40a0f640ff"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			encoded, err := hex.DecodeString(test.encoded)
+			if err != nil {
+				t.Fatalf("invalid test data: %v", err)
+			}
+			if _, _, err = Verify(encoded, nil, nil); !errors.Is(err, ErrMalformedSign1) {
+				t.Fatalf("expected %v, got %v", ErrMalformedSign1, err)
+			}
+		})
+	}
+}
+
+func TestAlgorithmFor_Unknown(t *testing.T) {
+	if _, err := AlgorithmFor("Unknown"); !errors.Is(err, ErrUnsupportedAlgorithm) {
+		t.Fatalf("expected %v, got %v", ErrUnsupportedAlgorithm, err)
+	}
+}
@@ -3,7 +3,10 @@ package crypto
 import (
 	"crypto/ecdsa"
 	"crypto/x509"
+	"encoding/asn1"
 	"encoding/pem"
+	"errors"
+	"math/big"
 )
 
 // ECCKeyPair is a DTO that holds ECC private and public keys.
@@ -51,3 +54,35 @@ func unmarshalECC(privateKeyBytes []byte) (*ECCKeyPair, error) {
 		Public:  &privateKey.PublicKey,
 	}, nil
 }
+
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+// ECDSASignatureToRaw converts an ASN.1 encoded ECDSA signature into the fixed size R || S encoding
+// used by JOSE and COSE. The size is the byte length of the curve order, e.g. 48 for P-384.
+func ECDSASignatureToRaw(signature []byte, size int) ([]byte, error) {
+	var parsed ecdsaSignature
+	if rest, err := asn1.Unmarshal(signature, &parsed); err != nil || len(rest) > 0 {
+		return nil, errors.New("malformed ECDSA signature")
+	}
+	if parsed.R.Sign() <= 0 || parsed.S.Sign() <= 0 || parsed.R.BitLen() > size*8 || parsed.S.BitLen() > size*8 {
+		return nil, errors.New("ECDSA signature does not fit the curve size")
+	}
+	raw := make([]byte, 2*size)
+	parsed.R.FillBytes(raw[:size])
+	parsed.S.FillBytes(raw[size:])
+	return raw, nil
+}
+
+// ECDSASignatureFromRaw converts a fixed size R || S encoded ECDSA signature into its ASN.1 encoding.
+func ECDSASignatureFromRaw(raw []byte) ([]byte, error) {
+	if len(raw) == 0 || len(raw)%2 != 0 {
+		return nil, errors.New("malformed raw ECDSA signature")
+	}
+	size := len(raw) / 2
+	return asn1.Marshal(ecdsaSignature{
+		R: new(big.Int).SetBytes(raw[:size]),
+		S: new(big.Int).SetBytes(raw[size:]),
+	})
+}
@@ -0,0 +1,61 @@
+package crypto
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+)
+
+// Ed25519KeyPair is a DTO that holds Ed25519 private and public keys.
+type Ed25519KeyPair struct {
+	Public  ed25519.PublicKey
+	Private ed25519.PrivateKey
+}
+
+// marshalEd25519 takes an Ed25519KeyPair and encodes it to be written on disk.
+// It returns the public and the private key as a byte slice.
+func marshalEd25519(keyPair Ed25519KeyPair) ([]byte, []byte, error) {
+	privateKeyBytes, err := x509.MarshalPKCS8PrivateKey(keyPair.Private)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	publicKeyBytes, err := x509.MarshalPKIXPublicKey(keyPair.Public)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	encodedPrivate := pem.EncodeToMemory(&pem.Block{
+		Type:  "PRIVATE_KEY",
+		Bytes: privateKeyBytes,
+	})
+
+	encodedPublic := pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC_KEY",
+		Bytes: publicKeyBytes,
+	})
+
+	return encodedPublic, encodedPrivate, nil
+}
+
+// unmarshalEd25519 assembles an Ed25519KeyPair from an encoded private key.
+func unmarshalEd25519(privateKeyBytes []byte) (*Ed25519KeyPair, error) {
+	block, _ := pem.Decode(privateKeyBytes)
+	if block == nil {
+		return nil, errors.New("private key is not PEM encoded")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not an Ed25519 key")
+	}
+
+	return &Ed25519KeyPair{
+		Private: privateKey,
+		Public:  privateKey.Public().(ed25519.PublicKey),
+	}, nil
+}
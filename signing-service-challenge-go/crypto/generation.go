@@ -2,15 +2,47 @@ package crypto
 
 import (
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
+	"fmt"
 )
 
-// generateRSA generates a new RSAKeyPair.
-func generateRSA() (*RSAKeyPair, error) {
-	// Security has been ignored for the sake of simplicity.
-	key, err := rsa.GenerateKey(rand.Reader, 512)
+// KeyParameters are the sizes of newly generated device keys.
+type KeyParameters struct {
+	// RSABits is the size of RSA keys for PKCS #1 v1.5 signatures.
+	RSABits int
+	// RSAPSSBits is the size of RSA keys for RSASSA-PSS signatures.
+	RSAPSSBits int
+	// ECCCurve is the curve of ECDSA keys.
+	ECCCurve elliptic.Curve
+}
+
+// DefaultKeyParameters returns the parameters used by GenerateNewPair.
+func DefaultKeyParameters() KeyParameters {
+	return KeyParameters{
+		// RS256 of JWS and COSE requires keys of at least 2048 bits (RFC 7518 section 3.3).
+		RSABits: 2048,
+		// PSS with SHA-256 and a salt of the hash size does not fit into much smaller keys.
+		RSAPSSBits: 2048,
+		ECCCurve:   elliptic.P384(),
+	}
+}
+
+// ParseCurve returns the NIST curve with the given name, e.g. P-256.
+func ParseCurve(name string) (elliptic.Curve, error) {
+	for _, curve := range []elliptic.Curve{elliptic.P256(), elliptic.P384(), elliptic.P521()} {
+		if curve.Params().Name == name {
+			return curve, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported curve: %s", name)
+}
+
+// generateRSA generates a new RSAKeyPair of the given size.
+func generateRSA(bits int) (*RSAKeyPair, error) {
+	key, err := rsa.GenerateKey(rand.Reader, bits)
 	if err != nil {
 		return nil, err
 	}
@@ -21,10 +53,9 @@ func generateRSA() (*RSAKeyPair, error) {
 	}, nil
 }
 
-// generateECC generates a new ECCKeyPair.
-func generateECC() (*ECCKeyPair, error) {
-	// Security has been ignored for the sake of simplicity.
-	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+// generateECC generates a new ECCKeyPair on the given curve.
+func generateECC(curve elliptic.Curve) (*ECCKeyPair, error) {
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
 	if err != nil {
 		return nil, err
 	}
@@ -34,3 +65,16 @@ func generateECC() (*ECCKeyPair, error) {
 		Private: key,
 	}, nil
 }
+
+// generateEd25519 generates a new Ed25519KeyPair.
+func generateEd25519() (*Ed25519KeyPair, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Ed25519KeyPair{
+		Public:  public,
+		Private: private,
+	}, nil
+}
@@ -0,0 +1,27 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+)
+
+// SubjectKeyID derives the key identifier from the SHA-1 hash of the public key (RFC 5280, section 4.2.1.2).
+func SubjectKeyID(publicKey crypto.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode public key: %w", err)
+	}
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err = asn1.Unmarshal(der, &spki); err != nil {
+		return nil, fmt.Errorf("failed to decode public key: %w", err)
+	}
+	hash := sha1.Sum(spki.PublicKey.Bytes)
+	return hash[:], nil
+}
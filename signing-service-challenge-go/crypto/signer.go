@@ -2,7 +2,7 @@ package crypto
 
 import (
 	"crypto"
-	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
@@ -18,6 +18,8 @@ var VerificationFailedError = errors.New("signature verification failed")
 type Signer interface {
 	Sign(dataToBeSigned []byte) ([]byte, error)
 	Verify(data []byte, signature []byte) error
+	// Public returns the public key of the signer.
+	Public() crypto.PublicKey
 }
 
 // NewSigner creates a new Signer based on the provided SignatureDevice.
@@ -35,6 +37,45 @@ func NewSigner(algorithm types.SigningAlgorithm, pkPem []byte) (Signer, error) {
 			return nil, fmt.Errorf("failed to create ECC key pair from PEM: %w", err)
 		}
 		return &ECCSigner{pair: pair}, nil
+	case types.RSAPSS:
+		pair, err := unmarshalRSA(pkPem)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create RSA key pair from PEM: %w", err)
+		}
+		return &RSAPSSSigner{pair: pair}, nil
+	case types.Ed25519:
+		pair, err := unmarshalEd25519(pkPem)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Ed25519 key pair from PEM: %w", err)
+		}
+		return &Ed25519Signer{pair: pair}, nil
+	default:
+		return nil, fmt.Errorf("unsupported algorithm: %s", algorithm)
+	}
+}
+
+// ParsePrivateKey decodes the PEM encoded private key of a device into a crypto.Signer,
+// e.g. to create certificate requests with the standard library.
+func ParsePrivateKey(algorithm types.SigningAlgorithm, pkPem []byte) (crypto.Signer, error) {
+	switch algorithm {
+	case types.RSA, types.RSAPSS:
+		pair, err := unmarshalRSA(pkPem)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create RSA key pair from PEM: %w", err)
+		}
+		return pair.Private, nil
+	case types.ECC:
+		pair, err := unmarshalECC(pkPem)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create ECC key pair from PEM: %w", err)
+		}
+		return pair.Private, nil
+	case types.Ed25519:
+		pair, err := unmarshalEd25519(pkPem)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Ed25519 key pair from PEM: %w", err)
+		}
+		return pair.Private, nil
 	default:
 		return nil, fmt.Errorf("unsupported algorithm: %s", algorithm)
 	}
@@ -43,19 +84,36 @@ func NewSigner(algorithm types.SigningAlgorithm, pkPem []byte) (Signer, error) {
 // GenerateNewPair generates a new key pair based on the specified signing algorithm
 // and returns the public and private keys in PEM format.
 func GenerateNewPair(algorithm types.SigningAlgorithm) ([]byte, []byte, error) {
+	return GenerateNewPairWith(algorithm, DefaultKeyParameters())
+}
+
+// GenerateNewPairWith is like GenerateNewPair, but generates keys of the given sizes.
+func GenerateNewPairWith(algorithm types.SigningAlgorithm, params KeyParameters) ([]byte, []byte, error) {
 	switch algorithm {
 	case types.RSA:
-		pair, err := generateRSA()
+		pair, err := generateRSA(params.RSABits)
 		if err != nil {
 			return nil, nil, fmt.Errorf("failed to generate RSA private key: %w", err)
 		}
 		return marshalRSA(*pair)
 	case types.ECC:
-		pair, err := generateECC()
+		pair, err := generateECC(params.ECCCurve)
 		if err != nil {
 			return nil, nil, fmt.Errorf("failed to generate ECC private key: %w", err)
 		}
 		return marshalECC(*pair)
+	case types.RSAPSS:
+		pair, err := generateRSA(params.RSAPSSBits)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to generate RSA private key: %w", err)
+		}
+		return marshalRSA(*pair)
+	case types.Ed25519:
+		pair, err := generateEd25519()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to generate Ed25519 private key: %w", err)
+		}
+		return marshalEd25519(*pair)
 	default:
 		return nil, nil, fmt.Errorf("unsupported algorithm: %s", algorithm)
 	}
@@ -71,13 +129,31 @@ func (r RSASigner) Sign(dataToBeSigned []byte) ([]byte, error) {
 }
 
 func (r RSASigner) Verify(data []byte, signature []byte) error {
-	hashed := sha256.Sum256(data)
-	err := rsa.VerifyPKCS1v15(r.pair.Public, crypto.SHA256, hashed[:], signature)
-	if err != nil {
-		fmt.Printf("failed to verify signature: %v\n", err)
-		return VerificationFailedError
-	}
-	return nil
+	return rsaVerifier{public: r.pair.Public}.Verify(data, signature)
+}
+
+func (r RSASigner) Public() crypto.PublicKey {
+	return r.pair.Public
+}
+
+type RSAPSSSigner struct {
+	pair *RSAKeyPair
+}
+
+// pssOptions uses a salt of the hash size, as required by the JOSE PS256 algorithm.
+var pssOptions = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}
+
+func (r RSAPSSSigner) Sign(dataToBeSigned []byte) ([]byte, error) {
+	hashed := sha256.Sum256(dataToBeSigned)
+	return rsa.SignPSS(rand.Reader, r.pair.Private, crypto.SHA256, hashed[:], pssOptions)
+}
+
+func (r RSAPSSSigner) Verify(data []byte, signature []byte) error {
+	return rsaPSSVerifier{public: r.pair.Public}.Verify(data, signature)
+}
+
+func (r RSAPSSSigner) Public() crypto.PublicKey {
+	return r.pair.Public
 }
 
 type ECCSigner struct {
@@ -90,9 +166,26 @@ func (r ECCSigner) Sign(dataToBeSigned []byte) ([]byte, error) {
 }
 
 func (r ECCSigner) Verify(data []byte, signature []byte) error {
-	hashed := sha512.Sum384(data)
-	if !ecdsa.VerifyASN1(r.pair.Public, hashed[:], signature) {
-		return VerificationFailedError
-	}
-	return nil
+	return eccVerifier{public: r.pair.Public}.Verify(data, signature)
+}
+
+func (r ECCSigner) Public() crypto.PublicKey {
+	return r.pair.Public
+}
+
+type Ed25519Signer struct {
+	pair *Ed25519KeyPair
+}
+
+func (r Ed25519Signer) Sign(dataToBeSigned []byte) ([]byte, error) {
+	// Ed25519 hashes internally, the message is signed as is.
+	return ed25519.Sign(r.pair.Private, dataToBeSigned), nil
+}
+
+func (r Ed25519Signer) Verify(data []byte, signature []byte) error {
+	return ed25519Verifier{public: r.pair.Public}.Verify(data, signature)
+}
+
+func (r Ed25519Signer) Public() crypto.PublicKey {
+	return r.pair.Public
 }
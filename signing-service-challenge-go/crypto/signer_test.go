@@ -44,10 +44,30 @@ func Test_Factories(t *testing.T) {
 			t.Fatalf("expected ECCSigner type, got different %T", signer)
 		}
 	})
+	t.Run("RSA-PSS Signer", func(t *testing.T) {
+		_, pkPem, err := GenerateNewPair(types.RSAPSS)
+		if err != nil {
+			t.Fatalf("failed to create RSA-PSS signer: %v", err)
+		}
+		signer, err := NewSigner(types.RSAPSS, pkPem)
+		if _, ok := signer.(*RSAPSSSigner); !ok {
+			t.Fatalf("expected RSAPSSSigner type, got different %T", signer)
+		}
+	})
+	t.Run("Ed25519 Signer", func(t *testing.T) {
+		_, pkPem, err := GenerateNewPair(types.Ed25519)
+		if err != nil {
+			t.Fatalf("failed to create Ed25519 signer: %v", err)
+		}
+		signer, err := NewSigner(types.Ed25519, pkPem)
+		if _, ok := signer.(*Ed25519Signer); !ok {
+			t.Fatalf("expected Ed25519Signer type, got different %T", signer)
+		}
+	})
 }
 
 func TestRSASigner_Sign(t *testing.T) {
-	pair, err := generateRSA()
+	pair, err := generateRSA(DefaultKeyParameters().RSABits)
 	if err != nil {
 		t.Fatalf("failed to create generate RSA pair: %v", err)
 	}
@@ -69,7 +89,7 @@ func TestRSASigner_Sign(t *testing.T) {
 }
 
 func TestECCSigner_Sign(t *testing.T) {
-	pair, err := generateECC()
+	pair, err := generateECC(DefaultKeyParameters().ECCCurve)
 	if err != nil {
 		t.Fatalf("failed to create generate RSA pair: %v", err)
 	}
@@ -104,6 +124,16 @@ func TestSigner_Verify(t *testing.T) {
 			alg:    types.ECC,
 			passes: true,
 		},
+		{
+			name:   "RSA-PSS Success",
+			alg:    types.RSAPSS,
+			passes: true,
+		},
+		{
+			name:   "Ed25519 Success",
+			alg:    types.Ed25519,
+			passes: true,
+		},
 		{
 			name:   "RSA Fail",
 			alg:    types.RSA,
@@ -114,6 +144,16 @@ func TestSigner_Verify(t *testing.T) {
 			alg:    types.ECC,
 			passes: false,
 		},
+		{
+			name:   "RSA-PSS Fail",
+			alg:    types.RSAPSS,
+			passes: false,
+		},
+		{
+			name:   "Ed25519 Fail",
+			alg:    types.Ed25519,
+			passes: false,
+		},
 	}
 
 	for _, test := range tests {
@@ -142,3 +182,72 @@ func TestSigner_Verify(t *testing.T) {
 		})
 	}
 }
+
+func TestECDSASignatureRawConversion(t *testing.T) {
+	pair, err := generateECC(DefaultKeyParameters().ECCCurve)
+	if err != nil {
+		t.Fatalf("failed to generate ECC pair: %v", err)
+	}
+	signer := ECCSigner{pair: pair}
+	signature, err := signer.Sign([]byte("data"))
+	if err != nil {
+		t.Fatalf("failed to sign data: %v", err)
+	}
+	raw, err := ECDSASignatureToRaw(signature, 48)
+	if err != nil {
+		t.Fatalf("failed to convert signature: %v", err)
+	}
+	if len(raw) != 96 {
+		t.Fatalf("expected raw signature of 96 bytes, got %d", len(raw))
+	}
+	converted, err := ECDSASignatureFromRaw(raw)
+	if err != nil {
+		t.Fatalf("failed to convert signature back: %v", err)
+	}
+	if err = signer.Verify([]byte("data"), converted); err != nil {
+		t.Errorf("expected converted signature to verify, got %v", err)
+	}
+}
+
+func TestGenerateNewPairWith(t *testing.T) {
+	curve, err := ParseCurve("P-256")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	params := KeyParameters{RSABits: 1024, RSAPSSBits: 3072, ECCCurve: curve}
+
+	tests := []struct {
+		alg  types.SigningAlgorithm
+		size int
+	}{
+		{types.RSA, 1024},
+		{types.RSAPSS, 3072},
+		{types.ECC, 256},
+	}
+	for _, test := range tests {
+		t.Run(string(test.alg), func(t *testing.T) {
+			_, pkPem, err := GenerateNewPairWith(test.alg, params)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			signer, err := NewSigner(test.alg, pkPem)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			var size int
+			switch public := signer.Public().(type) {
+			case *rsa.PublicKey:
+				size = public.N.BitLen()
+			case *ecdsa.PublicKey:
+				size = public.Curve.Params().BitSize
+			}
+			if size != test.size {
+				t.Fatalf("expected key of %d bits, got %d", test.size, size)
+			}
+		})
+	}
+
+	if _, err = ParseCurve("P-224"); err == nil {
+		t.Fatal("expected error for unsupported curve")
+	}
+}
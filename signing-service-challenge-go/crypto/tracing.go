@@ -0,0 +1,53 @@
+package crypto
+
+import (
+	"context"
+	"crypto"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/tracing"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+)
+
+// tracer returns the tracer of the package, looked up on every use as the provider is only set up on startup.
+func tracer() trace.Tracer {
+	return otel.Tracer("github.com/fiskaly/coding-challenges/signing-service-challenge/crypto")
+}
+
+// GenerateNewPairContext is like GenerateNewPairWith, but traces the key generation as part of ctx.
+func GenerateNewPairContext(ctx context.Context, algorithm types.SigningAlgorithm, params KeyParameters) (_ []byte, _ []byte, err error) {
+	_, span := tracer().Start(ctx, "crypto.GenerateKey", trace.WithAttributes(attribute.String("signing.algorithm", string(algorithm))))
+	defer func() { tracing.End(span, err) }()
+	return GenerateNewPairWith(algorithm, params)
+}
+
+// tracedSigner traces the signatures and verifications of a Signer.
+type tracedSigner struct {
+	ctx       context.Context
+	algorithm types.SigningAlgorithm
+	signer    Signer
+}
+
+// TraceSigner returns signer tracing its signatures and verifications as part of ctx.
+func TraceSigner(ctx context.Context, algorithm types.SigningAlgorithm, signer Signer) Signer {
+	return &tracedSigner{ctx: ctx, algorithm: algorithm, signer: signer}
+}
+
+func (t *tracedSigner) Sign(dataToBeSigned []byte) (_ []byte, err error) {
+	_, span := tracer().Start(t.ctx, "Signer.Sign", trace.WithAttributes(attribute.String("signing.algorithm", string(t.algorithm))))
+	defer func() { tracing.End(span, err) }()
+	return t.signer.Sign(dataToBeSigned)
+}
+
+func (t *tracedSigner) Verify(data []byte, signature []byte) (err error) {
+	_, span := tracer().Start(t.ctx, "Signer.Verify", trace.WithAttributes(attribute.String("signing.algorithm", string(t.algorithm))))
+	defer func() { tracing.End(span, err) }()
+	return t.signer.Verify(data, signature)
+}
+
+func (t *tracedSigner) Public() crypto.PublicKey {
+	return t.signer.Public()
+}
@@ -0,0 +1,120 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+)
+
+// Verifier verifies signatures of a device with its public key alone, e.g. outside of the service.
+type Verifier interface {
+	Verify(data []byte, signature []byte) error
+}
+
+// NewVerifier creates a Verifier for signatures of the given algorithm with the public key.
+func NewVerifier(algorithm types.SigningAlgorithm, publicKey crypto.PublicKey) (Verifier, error) {
+	switch algorithm {
+	case types.RSA, types.RSAPSS:
+		key, ok := publicKey.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("expected an RSA public key, got %T", publicKey)
+		}
+		if algorithm == types.RSAPSS {
+			return rsaPSSVerifier{public: key}, nil
+		}
+		return rsaVerifier{public: key}, nil
+	case types.ECC:
+		key, ok := publicKey.(*ecdsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("expected an ECDSA public key, got %T", publicKey)
+		}
+		return eccVerifier{public: key}, nil
+	case types.Ed25519:
+		key, ok := publicKey.(ed25519.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("expected an Ed25519 public key, got %T", publicKey)
+		}
+		return ed25519Verifier{public: key}, nil
+	default:
+		return nil, fmt.Errorf("unsupported algorithm: %s", algorithm)
+	}
+}
+
+// ParsePublicKey decodes a PEM encoded public key, including the encodings of GenerateNewPair,
+// or the public key of a PEM encoded certificate.
+func ParsePublicKey(publicPem []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(publicPem)
+	if block == nil {
+		return nil, errors.New("public key is not PEM encoded")
+	}
+	switch block.Type {
+	case "PUBLIC KEY", "PUBLIC_KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY", "RSA_PUBLIC_KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return certificate.PublicKey, nil
+	default:
+		return nil, fmt.Errorf("unexpected PEM block %q", block.Type)
+	}
+}
+
+type rsaVerifier struct {
+	public *rsa.PublicKey
+}
+
+func (v rsaVerifier) Verify(data []byte, signature []byte) error {
+	hashed := sha256.Sum256(data)
+	if err := rsa.VerifyPKCS1v15(v.public, crypto.SHA256, hashed[:], signature); err != nil {
+		return VerificationFailedError
+	}
+	return nil
+}
+
+type rsaPSSVerifier struct {
+	public *rsa.PublicKey
+}
+
+func (v rsaPSSVerifier) Verify(data []byte, signature []byte) error {
+	hashed := sha256.Sum256(data)
+	if err := rsa.VerifyPSS(v.public, crypto.SHA256, hashed[:], signature, pssOptions); err != nil {
+		return VerificationFailedError
+	}
+	return nil
+}
+
+type eccVerifier struct {
+	public *ecdsa.PublicKey
+}
+
+func (v eccVerifier) Verify(data []byte, signature []byte) error {
+	hashed := sha512.Sum384(data)
+	if !ecdsa.VerifyASN1(v.public, hashed[:], signature) {
+		return VerificationFailedError
+	}
+	return nil
+}
+
+type ed25519Verifier struct {
+	public ed25519.PublicKey
+}
+
+func (v ed25519Verifier) Verify(data []byte, signature []byte) error {
+	if !ed25519.Verify(v.public, data, signature) {
+		return VerificationFailedError
+	}
+	return nil
+}
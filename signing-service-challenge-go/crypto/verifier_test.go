@@ -0,0 +1,60 @@
+package crypto
+
+import (
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+)
+
+func TestVerifier_Verify(t *testing.T) {
+	for _, alg := range []types.SigningAlgorithm{types.RSA, types.RSAPSS, types.ECC, types.Ed25519} {
+		t.Run(string(alg), func(t *testing.T) {
+			publicPem, pkPem, err := GenerateNewPair(alg)
+			if err != nil {
+				t.Fatalf("failed to create key pair: %v", err)
+			}
+			signer, err := NewSigner(alg, pkPem)
+			if err != nil {
+				t.Fatalf("failed to create signer: %v", err)
+			}
+			signature, err := signer.Sign([]byte("data"))
+			if err != nil {
+				t.Fatalf("failed to sign data: %v", err)
+			}
+			publicKey, err := ParsePublicKey(publicPem)
+			if err != nil {
+				t.Fatalf("failed to parse public key: %v", err)
+			}
+			verifier, err := NewVerifier(alg, publicKey)
+			if err != nil {
+				t.Fatalf("failed to create verifier: %v", err)
+			}
+			if err = verifier.Verify([]byte("data"), signature); err != nil {
+				t.Errorf("expected verification to pass, but got error: %v", err)
+			}
+			if err = verifier.Verify([]byte("other"), signature); err == nil {
+				t.Error("expected verification to fail, but it passed")
+			}
+		})
+	}
+}
+
+func TestVerifier_Factory(t *testing.T) {
+	publicPem, _, err := GenerateNewPair(types.ECC)
+	if err != nil {
+		t.Fatalf("failed to create key pair: %v", err)
+	}
+	publicKey, err := ParsePublicKey(publicPem)
+	if err != nil {
+		t.Fatalf("failed to parse public key: %v", err)
+	}
+	if _, err = NewVerifier(types.RSA, publicKey); err == nil {
+		t.Error("expected error for a key of another algorithm, got nil")
+	}
+	if _, err = NewVerifier("unsupported", publicKey); err == nil {
+		t.Error("expected error for unsupported algorithm, got nil")
+	}
+	if _, err = ParsePublicKey([]byte("key")); err == nil {
+		t.Error("expected error for a key that is not PEM encoded, got nil")
+	}
+}
@@ -0,0 +1,15 @@
+package domain
+
+import (
+	stdcrypto "crypto"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+)
+
+// CertificateIssuer certifies the keys of signature devices.
+type CertificateIssuer interface {
+	// IssueCertificate certifies the public key of the device and returns the DER encoded certificate.
+	IssueCertificate(device *types.SignatureDevice, publicKey stdcrypto.PublicKey) ([]byte, error)
+	// Chain returns the DER encoded certificate chain of the issuer, starting with its own certificate.
+	Chain() [][]byte
+}
@@ -0,0 +1,18 @@
+package domain
+
+import "time"
+
+// Clock is the source of time for the domain. It is injectable so tests can control the time.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+}
+
+// SystemClock is a Clock backed by the system wall clock.
+type SystemClock struct{}
+
+// Now returns the current wall clock time in UTC.
+func (SystemClock) Now() time.Time {
+	// UTC strips the monotonic reading, the timestamp is persisted and compared as wall time.
+	return time.Now().UTC()
+}
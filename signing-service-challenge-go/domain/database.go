@@ -8,14 +8,50 @@ import (
 
 // Database interface defines the methods required for device persistence.
 type Database interface {
+	SignatureRepository
 	// GetSignatureDevice retrieves a device by its ID.
 	GetSignatureDevice(id string) (*types.SignatureDevice, error)
 	// GetAllSignatureDevices retrieves all signature devices.
-	GetAllSignatureDevices() []*types.SignatureDevice
-	// GetDeviceSignatures retrieves all signatures associated with a signature device by its ID.
-	GetDeviceSignatures(id string) ([][]byte, error)
+	GetAllSignatureDevices() ([]*types.SignatureDevice, error)
+	// GetOrganizationSignatureDevices retrieves the signature devices of the organization with the given ID.
+	GetOrganizationSignatureDevices(organizationID string) ([]*types.SignatureDevice, error)
 	// CreateSignatureDevice adds a new signature device to the database.
 	CreateSignatureDevice(device *types.SignatureDevice) error
-	// UpdateSignatureDevice updates an existing signature device in the database.
+	// CreateOrganizationSignatureDevice adds a new signature device to the database unless its organization
+	// already has maxDevices devices, which fails with types.ErrDeviceQuotaExceeded. 0 means unlimited.
+	// Counting and adding are atomic, so that concurrent creations cannot exceed the quota together.
+	CreateOrganizationSignatureDevice(device *types.SignatureDevice, maxDevices int) error
+	// UpdateSignatureDevice updates the attributes of an existing signature device in the database.
+	// Its signature chain, i.e. the counter and the last signature, only advances through a DeviceTx and is left untouched.
 	UpdateSignatureDevice(updatedDevice *types.SignatureDevice) error
+	// BeginDeviceTx starts a unit of work on the device with the given ID, which is locked until
+	// the unit of work is committed or rolled back.
+	BeginDeviceTx(id string) (DeviceTx, error)
+}
+
+// SignatureRepository provides access to the signature chains of the devices. Signatures are
+// appended with DeviceTx.AppendSignature only, together with the counter of their device.
+type SignatureRepository interface {
+	// GetSignature retrieves the signature of a device by its counter.
+	GetSignature(deviceID string, counter uint32) (*types.Signature, error)
+	// GetSignatures retrieves the signatures of a device with a counter from from to to, both inclusive,
+	// ordered by their counter.
+	GetSignatures(deviceID string, from, to uint32) ([]types.Signature, error)
+	// GetLastSignature retrieves the latest signature of a device.
+	GetLastSignature(deviceID string) (*types.Signature, error)
+}
+
+// DeviceTx is a unit of work appending signatures to the chain of a single device. Concurrent units of work
+// on the same device wait for each other, and nothing becomes visible to readers before Commit returns.
+// Rollback must be called if the unit of work is not committed, it does nothing after Commit.
+type DeviceTx interface {
+	// Device returns a copy of the locked device, including the signatures appended so far.
+	Device() *types.SignatureDevice
+	// AppendSignature appends the signature to the chain of the device and advances its counter.
+	// The counter of the signature must be the current counter of the device.
+	AppendSignature(signature types.Signature) error
+	// Commit durably stores the appended signatures and ends the unit of work.
+	Commit() error
+	// Rollback discards the appended signatures and ends the unit of work.
+	Rollback() error
 }
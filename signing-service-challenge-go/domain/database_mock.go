@@ -40,6 +40,21 @@ func (m *MockDatabase) EXPECT() *MockDatabaseMockRecorder {
 	return m.recorder
 }
 
+// BeginDeviceTx mocks base method.
+func (m *MockDatabase) BeginDeviceTx(id string) (DeviceTx, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BeginDeviceTx", id)
+	ret0, _ := ret[0].(DeviceTx)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// BeginDeviceTx indicates an expected call of BeginDeviceTx.
+func (mr *MockDatabaseMockRecorder) BeginDeviceTx(id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BeginDeviceTx", reflect.TypeOf((*MockDatabase)(nil).BeginDeviceTx), id)
+}
+
 // CreateSignatureDevice mocks base method.
 func (m *MockDatabase) CreateSignatureDevice(device *types.SignatureDevice) error {
 	m.ctrl.T.Helper()
@@ -54,12 +69,27 @@ func (mr *MockDatabaseMockRecorder) CreateSignatureDevice(device any) *gomock.Ca
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateSignatureDevice", reflect.TypeOf((*MockDatabase)(nil).CreateSignatureDevice), device)
 }
 
+// CreateOrganizationSignatureDevice mocks base method.
+func (m *MockDatabase) CreateOrganizationSignatureDevice(device *types.SignatureDevice, maxDevices int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateOrganizationSignatureDevice", device, maxDevices)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateOrganizationSignatureDevice indicates an expected call of CreateOrganizationSignatureDevice.
+func (mr *MockDatabaseMockRecorder) CreateOrganizationSignatureDevice(device, maxDevices any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateOrganizationSignatureDevice", reflect.TypeOf((*MockDatabase)(nil).CreateOrganizationSignatureDevice), device, maxDevices)
+}
+
 // GetAllSignatureDevices mocks base method.
-func (m *MockDatabase) GetAllSignatureDevices() []*types.SignatureDevice {
+func (m *MockDatabase) GetAllSignatureDevices() ([]*types.SignatureDevice, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "GetAllSignatureDevices")
 	ret0, _ := ret[0].([]*types.SignatureDevice)
-	return ret0
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // GetAllSignatureDevices indicates an expected call of GetAllSignatureDevices.
@@ -68,19 +98,49 @@ func (mr *MockDatabaseMockRecorder) GetAllSignatureDevices() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllSignatureDevices", reflect.TypeOf((*MockDatabase)(nil).GetAllSignatureDevices))
 }
 
-// GetDeviceSignatures mocks base method.
-func (m *MockDatabase) GetDeviceSignatures(id string) ([][]byte, error) {
+// GetLastSignature mocks base method.
+func (m *MockDatabase) GetLastSignature(deviceID string) (*types.Signature, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLastSignature", deviceID)
+	ret0, _ := ret[0].(*types.Signature)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetLastSignature indicates an expected call of GetLastSignature.
+func (mr *MockDatabaseMockRecorder) GetLastSignature(deviceID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLastSignature", reflect.TypeOf((*MockDatabase)(nil).GetLastSignature), deviceID)
+}
+
+// GetOrganizationSignatureDevices mocks base method.
+func (m *MockDatabase) GetOrganizationSignatureDevices(organizationID string) ([]*types.SignatureDevice, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetDeviceSignatures", id)
-	ret0, _ := ret[0].([][]byte)
+	ret := m.ctrl.Call(m, "GetOrganizationSignatureDevices", organizationID)
+	ret0, _ := ret[0].([]*types.SignatureDevice)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// GetDeviceSignatures indicates an expected call of GetDeviceSignatures.
-func (mr *MockDatabaseMockRecorder) GetDeviceSignatures(id any) *gomock.Call {
+// GetOrganizationSignatureDevices indicates an expected call of GetOrganizationSignatureDevices.
+func (mr *MockDatabaseMockRecorder) GetOrganizationSignatureDevices(organizationID any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDeviceSignatures", reflect.TypeOf((*MockDatabase)(nil).GetDeviceSignatures), id)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrganizationSignatureDevices", reflect.TypeOf((*MockDatabase)(nil).GetOrganizationSignatureDevices), organizationID)
+}
+
+// GetSignature mocks base method.
+func (m *MockDatabase) GetSignature(deviceID string, counter uint32) (*types.Signature, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSignature", deviceID, counter)
+	ret0, _ := ret[0].(*types.Signature)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSignature indicates an expected call of GetSignature.
+func (mr *MockDatabaseMockRecorder) GetSignature(deviceID, counter any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSignature", reflect.TypeOf((*MockDatabase)(nil).GetSignature), deviceID, counter)
 }
 
 // GetSignatureDevice mocks base method.
@@ -98,6 +158,21 @@ func (mr *MockDatabaseMockRecorder) GetSignatureDevice(id any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSignatureDevice", reflect.TypeOf((*MockDatabase)(nil).GetSignatureDevice), id)
 }
 
+// GetSignatures mocks base method.
+func (m *MockDatabase) GetSignatures(deviceID string, from, to uint32) ([]types.Signature, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSignatures", deviceID, from, to)
+	ret0, _ := ret[0].([]types.Signature)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSignatures indicates an expected call of GetSignatures.
+func (mr *MockDatabaseMockRecorder) GetSignatures(deviceID, from, to any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSignatures", reflect.TypeOf((*MockDatabase)(nil).GetSignatures), deviceID, from, to)
+}
+
 // UpdateSignatureDevice mocks base method.
 func (m *MockDatabase) UpdateSignatureDevice(updatedDevice *types.SignatureDevice) error {
 	m.ctrl.T.Helper()
@@ -111,3 +186,152 @@ func (mr *MockDatabaseMockRecorder) UpdateSignatureDevice(updatedDevice any) *go
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateSignatureDevice", reflect.TypeOf((*MockDatabase)(nil).UpdateSignatureDevice), updatedDevice)
 }
+
+// MockSignatureRepository is a mock of SignatureRepository interface.
+type MockSignatureRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockSignatureRepositoryMockRecorder
+	isgomock struct{}
+}
+
+// MockSignatureRepositoryMockRecorder is the mock recorder for MockSignatureRepository.
+type MockSignatureRepositoryMockRecorder struct {
+	mock *MockSignatureRepository
+}
+
+// NewMockSignatureRepository creates a new mock instance.
+func NewMockSignatureRepository(ctrl *gomock.Controller) *MockSignatureRepository {
+	mock := &MockSignatureRepository{ctrl: ctrl}
+	mock.recorder = &MockSignatureRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockSignatureRepository) EXPECT() *MockSignatureRepositoryMockRecorder {
+	return m.recorder
+}
+
+// GetLastSignature mocks base method.
+func (m *MockSignatureRepository) GetLastSignature(deviceID string) (*types.Signature, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLastSignature", deviceID)
+	ret0, _ := ret[0].(*types.Signature)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetLastSignature indicates an expected call of GetLastSignature.
+func (mr *MockSignatureRepositoryMockRecorder) GetLastSignature(deviceID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLastSignature", reflect.TypeOf((*MockSignatureRepository)(nil).GetLastSignature), deviceID)
+}
+
+// GetSignature mocks base method.
+func (m *MockSignatureRepository) GetSignature(deviceID string, counter uint32) (*types.Signature, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSignature", deviceID, counter)
+	ret0, _ := ret[0].(*types.Signature)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSignature indicates an expected call of GetSignature.
+func (mr *MockSignatureRepositoryMockRecorder) GetSignature(deviceID, counter any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSignature", reflect.TypeOf((*MockSignatureRepository)(nil).GetSignature), deviceID, counter)
+}
+
+// GetSignatures mocks base method.
+func (m *MockSignatureRepository) GetSignatures(deviceID string, from, to uint32) ([]types.Signature, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSignatures", deviceID, from, to)
+	ret0, _ := ret[0].([]types.Signature)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSignatures indicates an expected call of GetSignatures.
+func (mr *MockSignatureRepositoryMockRecorder) GetSignatures(deviceID, from, to any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSignatures", reflect.TypeOf((*MockSignatureRepository)(nil).GetSignatures), deviceID, from, to)
+}
+
+// MockDeviceTx is a mock of DeviceTx interface.
+type MockDeviceTx struct {
+	ctrl     *gomock.Controller
+	recorder *MockDeviceTxMockRecorder
+	isgomock struct{}
+}
+
+// MockDeviceTxMockRecorder is the mock recorder for MockDeviceTx.
+type MockDeviceTxMockRecorder struct {
+	mock *MockDeviceTx
+}
+
+// NewMockDeviceTx creates a new mock instance.
+func NewMockDeviceTx(ctrl *gomock.Controller) *MockDeviceTx {
+	mock := &MockDeviceTx{ctrl: ctrl}
+	mock.recorder = &MockDeviceTxMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockDeviceTx) EXPECT() *MockDeviceTxMockRecorder {
+	return m.recorder
+}
+
+// AppendSignature mocks base method.
+func (m *MockDeviceTx) AppendSignature(signature types.Signature) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AppendSignature", signature)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AppendSignature indicates an expected call of AppendSignature.
+func (mr *MockDeviceTxMockRecorder) AppendSignature(signature any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AppendSignature", reflect.TypeOf((*MockDeviceTx)(nil).AppendSignature), signature)
+}
+
+// Commit mocks base method.
+func (m *MockDeviceTx) Commit() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Commit")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Commit indicates an expected call of Commit.
+func (mr *MockDeviceTxMockRecorder) Commit() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Commit", reflect.TypeOf((*MockDeviceTx)(nil).Commit))
+}
+
+// Device mocks base method.
+func (m *MockDeviceTx) Device() *types.SignatureDevice {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Device")
+	ret0, _ := ret[0].(*types.SignatureDevice)
+	return ret0
+}
+
+// Device indicates an expected call of Device.
+func (mr *MockDeviceTxMockRecorder) Device() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Device", reflect.TypeOf((*MockDeviceTx)(nil).Device))
+}
+
+// Rollback mocks base method.
+func (m *MockDeviceTx) Rollback() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Rollback")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Rollback indicates an expected call of Rollback.
+func (mr *MockDeviceTxMockRecorder) Rollback() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Rollback", reflect.TypeOf((*MockDeviceTx)(nil).Rollback))
+}
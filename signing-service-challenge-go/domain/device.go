@@ -1,35 +1,144 @@
 package domain
 
 import (
+	"context"
+	stdcrypto "crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/base64"
+	"encoding/pem"
+	"errors"
 	"fmt"
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/tracing"
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+	"math"
 	"strconv"
 	"strings"
+	"time"
 )
 
+// Option configures optional behaviour of a DeviceService.
+type Option func(*DeviceService)
+
+// WithClock sets the Clock used to timestamp signatures. Defaults to SystemClock.
+func WithClock(clock Clock) Option {
+	return func(d *DeviceService) {
+		d.clock = clock
+	}
+}
+
+// WithTimestampInSignedData includes the signature timestamp in the secured data,
+// resulting in the format <signature_counter>_<timestamp>_<data_to_be_signed>_<last_signature_base64_encoded>.
+func WithTimestampInSignedData() Option {
+	return func(d *DeviceService) {
+		d.timestampSignedData = true
+	}
+}
+
+// WithTimestamper obtains a timestamp token over every signature from the given Time Stamping Authority.
+func WithTimestamper(timestamper Timestamper) Option {
+	return func(d *DeviceService) {
+		d.timestamper = timestamper
+	}
+}
+
+// WithTimestampTimeout limits the time the Time Stamping Authority is given to issue a token.
+// Defaults to DefaultTimestampTimeout.
+func WithTimestampTimeout(timeout time.Duration) Option {
+	return func(d *DeviceService) {
+		d.timestampTimeout = timeout
+	}
+}
+
+// WithCertificateIssuer certifies the key of every new device with the given issuer.
+func WithCertificateIssuer(issuer CertificateIssuer) Option {
+	return func(d *DeviceService) {
+		d.issuer = issuer
+	}
+}
+
+// WithKeyParameters generates device keys of the given sizes. Defaults to crypto.DefaultKeyParameters.
+func WithKeyParameters(params crypto.KeyParameters) Option {
+	return func(d *DeviceService) {
+		d.keyParams = params
+	}
+}
+
+// WithObserver reports the duration of key generations and signatures to observer.
+func WithObserver(observer Observer) Option {
+	return func(d *DeviceService) {
+		d.observer = observer
+	}
+}
+
 // NewDeviceService creates a new DeviceService instance with the provided database.
-func NewDeviceService(db Database) *DeviceService {
-	return &DeviceService{
-		db:      db,
-		builder: strings.Builder{},
+func NewDeviceService(db Database, opts ...Option) *DeviceService {
+	service := &DeviceService{
+		db:               db,
+		clock:            SystemClock{},
+		keyParams:        crypto.DefaultKeyParameters(),
+		observer:         noObserver{},
+		timestampTimeout: DefaultTimestampTimeout,
+	}
+	for _, opt := range opts {
+		opt(service)
 	}
+	return service
 }
 
 type DeviceService struct {
-	db      Database
-	builder strings.Builder
+	// db is not restricted to the organization of the service, see database.
+	db                  Database
+	clock               Clock
+	timestampSignedData bool
+	timestamper         Timestamper
+	timestampTimeout    time.Duration
+	issuer              CertificateIssuer
+	keyParams           crypto.KeyParameters
+	observer            Observer
+	// organization is the organization the service is restricted to, nil if it is not restricted.
+	organization *types.Organization
+}
+
+// ForOrganization returns a DeviceService restricted to the devices of the given organization, which
+// enforces its device quota. Devices of other organizations are reported as not found.
+func (d *DeviceService) ForOrganization(organization *types.Organization) *DeviceService {
+	service := *d
+	service.organization = organization
+	return &service
+}
+
+// database returns the database of the service, with its operations attributed to ctx if it supports that,
+// restricted to the devices of the organization of the service.
+func (d *DeviceService) database(ctx context.Context) Database {
+	db := d.db
+	if contextual, ok := db.(ContextDatabase); ok {
+		db = contextual.WithContext(ctx)
+	}
+	if d.organization != nil {
+		db = OrganizationDatabase(db, d.organization.ID)
+	}
+	return db
 }
 
 // Get retrieves a device by its ID from the database.
-func (d *DeviceService) Get(id string) (*types.SignatureDevice, error) {
-	return d.db.GetSignatureDevice(id)
+func (d *DeviceService) Get(ctx context.Context, id string) (_ *types.SignatureDevice, err error) {
+	ctx, span := tracer().Start(ctx, "DeviceService.Get", trace.WithAttributes(attribute.String("device.id", id)))
+	defer func() { tracing.End(span, err) }()
+	return d.database(ctx).GetSignatureDevice(id)
 }
 
 // Create adds a new device to the database.
-func (d *DeviceService) Create(device types.NewSignatureDevice) (*types.SignatureDevice, error) {
+func (d *DeviceService) Create(ctx context.Context, device types.NewSignatureDevice) (_ *types.SignatureDevice, err error) {
+	ctx, span := tracer().Start(ctx, "DeviceService.Create", trace.WithAttributes(attribute.String("signing.algorithm", device.Algorithm)))
+	defer func() { tracing.End(span, err) }()
 	if !types.IsAllowedSigningAlgorithm(types.SigningAlgorithm(device.Algorithm)) {
 		return nil, fmt.Errorf("%w: %s", types.ErrUnknownSigningAlgorithm, device.Algorithm)
 	}
@@ -41,71 +150,283 @@ func (d *DeviceService) Create(device types.NewSignatureDevice) (*types.Signatur
 		return nil, fmt.Errorf("failed to generate device id: %v", err)
 	}
 
-	_, privatePem, err := crypto.GenerateNewPair(types.SigningAlgorithm(device.Algorithm))
+	span.SetAttributes(attribute.String("device.id", id.String()))
+
+	start := time.Now()
+	_, privatePem, err := crypto.GenerateNewPairContext(ctx, types.SigningAlgorithm(device.Algorithm), d.keyParams)
+	d.observer.ObserveKeyGeneration(types.SigningAlgorithm(device.Algorithm), time.Since(start), err)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate signer: %v", err)
 	}
 	newDevice := &types.SignatureDevice{
-		ID:                 id.String(),
-		Algorithm:          types.SigningAlgorithm(device.Algorithm),
-		Label:              device.Label,
-		Counter:            0,
-		PkPem:              privatePem,
-		PreviousSignatures: make(map[uint32][]byte),
+		ID:        id.String(),
+		Algorithm: types.SigningAlgorithm(device.Algorithm),
+		Label:     device.Label,
+		Counter:   0,
+		PkPem:     privatePem,
+	}
+	if d.issuer != nil {
+		signer, err := crypto.NewSigner(newDevice.Algorithm, privatePem)
+		if err != nil {
+			return nil, err
+		}
+		newDevice.Certificate, err = d.issuer.IssueCertificate(newDevice, signer.Public())
+		if err != nil {
+			return nil, fmt.Errorf("failed to issue device certificate: %w", err)
+		}
 	}
 
-	if err = d.db.CreateSignatureDevice(newDevice); err != nil {
+	db := d.database(ctx)
+	if d.organization != nil {
+		// The database enforces the quota, which holds across all instances of the service sharing it.
+		err = db.CreateOrganizationSignatureDevice(newDevice, d.organization.MaxDevices)
+		if errors.Is(err, types.ErrDeviceQuotaExceeded) {
+			return nil, fmt.Errorf("%w: at most %d devices", types.ErrDeviceQuotaExceeded, d.organization.MaxDevices)
+		}
+	} else {
+		err = db.CreateSignatureDevice(newDevice)
+	}
+	if err != nil {
 		return nil, fmt.Errorf("failed to save device into the db: %w", err)
 	}
+	slog.Debug("Device created", "device", newDevice)
 
 	return newDevice, nil
 }
 
-func (d *DeviceService) SignUsingDevice(deviceID string, data []byte) ([]byte, []byte, error) {
-	signingDevice, err := d.Get(deviceID)
+// SignUsingDevice signs the given data with the specified device and returns the resulting
+// signature in the requested format, which carries the secured data and the time the signature was produced.
+func (d *DeviceService) SignUsingDevice(ctx context.Context, deviceID string, data []byte, format types.SignatureFormat) (_ *types.Signature, err error) {
+	if format == "" {
+		format = types.FormatRaw
+	}
+	ctx, span := tracer().Start(ctx, "DeviceService.SignUsingDevice", trace.WithAttributes(
+		attribute.String("device.id", deviceID),
+		attribute.String("signature.format", string(format)),
+	))
+	defer func() { tracing.End(span, err) }()
+	return d.sign(ctx, deviceID, data, format, func(device *types.SignatureDevice, signer crypto.Signer, securedData []byte, _ time.Time) (Envelope, error) {
+		return newEnvelope(format, device, signer, securedData)
+	})
+}
+
+// SignDocument signs an arbitrary document with the specified device. The document enters the signature chain
+// by its base64 encoded SHA-256 digest in place of the data to be signed, and the returned signature additionally
+// carries a detached CMS SignedData over the document as envelope.
+func (d *DeviceService) SignDocument(ctx context.Context, deviceID string, document []byte) (_ *types.Signature, err error) {
+	ctx, span := tracer().Start(ctx, "DeviceService.SignDocument", trace.WithAttributes(
+		attribute.String("device.id", deviceID),
+		attribute.String("signature.format", string(types.FormatCMS)),
+	))
+	defer func() { tracing.End(span, err) }()
+	digest := sha256.Sum256(document)
+	data := []byte(base64.StdEncoding.EncodeToString(digest[:]))
+	return d.sign(ctx, deviceID, data, types.FormatCMS, func(device *types.SignatureDevice, signer crypto.Signer, securedData []byte, now time.Time) (Envelope, error) {
+		var chain [][]byte
+		if d.issuer != nil {
+			chain = d.issuer.Chain()
+		}
+		return newCMSEnvelope(device, signer, securedData, document, now, chain)
+	})
+}
+
+// envelopeFunc prepares the envelope of a signature once the device, its signer and the secured data are known.
+type envelopeFunc func(device *types.SignatureDevice, signer crypto.Signer, securedData []byte, now time.Time) (Envelope, error)
+
+// sign appends a new signature over data to the chain of the device. The device stays locked from reading
+// its counter until the signature is committed, so the signature is only returned once it is part of the chain.
+// The signature is traced as part of the span of ctx.
+func (d *DeviceService) sign(ctx context.Context, deviceID string, data []byte, format types.SignatureFormat, prepare envelopeFunc) (_ *types.Signature, err error) {
+	start := time.Now()
+	tx, err := d.database(ctx).BeginDeviceTx(deviceID)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to get device: %w", err)
+		return nil, fmt.Errorf("failed to get device: %w", err)
 	}
+	defer tx.Rollback()
+	signingDevice := tx.Device()
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.String("signing.algorithm", string(signingDevice.Algorithm)),
+		attribute.Int64("signature.counter", int64(signingDevice.Counter)),
+	)
+	defer func() {
+		d.observer.ObserveSigning(signingDevice.Algorithm, format, time.Since(start), err)
+	}()
 
-	// RESET the builder to avoid appending to next call!!!
-	defer d.builder.Reset()
-	d.builder.WriteString(strconv.Itoa(int(signingDevice.Counter)))
-	d.builder.WriteString("_")
-	d.builder.Write(data)
-	d.builder.WriteString("_")
+	now := d.clock.Now()
 	// First sign with this device?
 	var prev []byte
 	if signingDevice.Counter == 0 {
 		prev = []byte(signingDevice.ID)
 	} else {
-		prev = signingDevice.PreviousSignatures[signingDevice.Counter-1]
+		// Signatures must be in chronological order, never sign with a clock that went back in time.
+		if now.Before(signingDevice.LastSignedAt) {
+			return nil, fmt.Errorf("%w: last signature at %s, now %s", types.ErrClockMovedBackwards,
+				signingDevice.LastSignedAt.Format(time.RFC3339Nano), now.Format(time.RFC3339Nano))
+		}
+		prev = signingDevice.LastSignature
 	}
-	d.builder.WriteString(base64.StdEncoding.EncodeToString(prev))
-	toBeSigned := []byte(d.builder.String())
+
+	var builder strings.Builder
+	builder.WriteString(strconv.Itoa(int(signingDevice.Counter)))
+	builder.WriteString("_")
+	if d.timestampSignedData {
+		builder.WriteString(now.Format(time.RFC3339Nano))
+		builder.WriteString("_")
+	}
+	builder.Write(data)
+	builder.WriteString("_")
+	builder.WriteString(base64.StdEncoding.EncodeToString(prev))
+	toBeSigned := []byte(builder.String())
 	signer, err := crypto.NewSigner(signingDevice.Algorithm, signingDevice.PkPem)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
+	}
+	signer = crypto.TraceSigner(ctx, signingDevice.Algorithm, signer)
+	envelope, err := prepare(signingDevice, signer, toBeSigned, now)
+	if err != nil {
+		return nil, err
+	}
+	value, err := signer.Sign(envelope.SigningInput())
+	if err != nil {
+		return nil, err
 	}
-	signature, err := signer.Sign(toBeSigned)
+	sealed, err := envelope.Seal(value)
 	if err != nil {
-		return nil, nil, err
+		return nil, fmt.Errorf("failed to seal %s signature: %w", format, err)
+	}
+
+	signature := types.Signature{
+		Counter:    signingDevice.Counter,
+		Value:      value,
+		SignedData: toBeSigned,
+		Timestamp:  now,
+		Format:     format,
+		Envelope:   sealed,
+	}
+	if d.timestamper != nil {
+		// The token is over the signature, which depends on the counter, so it can only be obtained while the
+		// device is locked. d.timestamp bounds the time this holds the lock and the transaction of the database.
+		// Without the token the signature is incomplete, do not advance the counter.
+		signature.TimestampToken, err = d.timestamp(ctx, value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to obtain timestamp token: %w", err)
+		}
+	}
+	// Append the signature to the chain and increment the counter
+	if err = tx.AppendSignature(signature); err != nil {
+		return nil, err
 	}
+	// A signature that is not durably part of the chain must never reach the client
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit signature: %w", err)
+	}
+	slog.Debug("Signature created", "device_id", signingDevice.ID, "counter", signature.Counter,
+		"algorithm", signingDevice.Algorithm, "format", format)
+
+	return &signature, nil
+}
+
+// timestamp obtains a timestamp token over a signature value from the Time Stamping Authority.
+func (d *DeviceService) timestamp(ctx context.Context, value []byte) (_ []byte, err error) {
+	ctx, span := tracer().Start(ctx, "Timestamper.Timestamp", trace.WithSpanKind(trace.SpanKindClient))
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := context.WithTimeout(ctx, d.timestampTimeout)
+	defer cancel()
+	token, err := d.timestamper.Timestamp(ctx, value)
+	if err != nil && ctx.Err() != nil {
+		return nil, fmt.Errorf("%w: %v", types.ErrTimestampUnavailable, err)
+	}
+	return token, err
+}
+
+func (d *DeviceService) GetAll(ctx context.Context) (_ []*types.SignatureDevice, err error) {
+	ctx, span := tracer().Start(ctx, "DeviceService.GetAll")
+	defer func() { tracing.End(span, err) }()
+	return d.database(ctx).GetAllSignatureDevices()
+}
+
+// GetDeviceSignatures returns the whole signature chain of the device, ordered by counter.
+func (d *DeviceService) GetDeviceSignatures(ctx context.Context, deviceID string) (_ []types.Signature, err error) {
+	ctx, span := tracer().Start(ctx, "DeviceService.GetDeviceSignatures", trace.WithAttributes(attribute.String("device.id", deviceID)))
+	defer func() { tracing.End(span, err) }()
+	return d.database(ctx).GetSignatures(deviceID, 0, math.MaxUint32)
+}
 
-	// Update the device with the new signature and increment the counter
-	signingDevice.PreviousSignatures[signingDevice.Counter] = signature
-	signingDevice.Counter++
-	// Update the device in the database
-	if err = d.db.UpdateSignatureDevice(signingDevice); err != nil {
-		return nil, nil, err
+// GetDeviceCertificate returns the DER encoded certificate of the device.
+func (d *DeviceService) GetDeviceCertificate(ctx context.Context, deviceID string) ([]byte, error) {
+	device, err := d.Get(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if len(device.Certificate) == 0 {
+		return nil, types.ErrCertificateNotFound
 	}
+	return device.Certificate, nil
+}
 
-	return signature, toBeSigned, nil
+// GetCAChain returns the DER encoded certificate chain of the certificate authority issuing device certificates.
+func (d *DeviceService) GetCAChain() ([][]byte, error) {
+	if d.issuer == nil {
+		return nil, types.ErrNoCertificateAuthority
+	}
+	return d.issuer.Chain(), nil
 }
 
-func (d *DeviceService) GetAll() []*types.SignatureDevice {
-	return d.db.GetAllSignatureDevices()
+// CreateCertificateRequest creates a PEM encoded PKCS #10 certificate signing request for the key of the device,
+// signed by that key. The device ID is used as subject serial number and the label as common name unless given.
+func (d *DeviceService) CreateCertificateRequest(ctx context.Context, deviceID string, subject pkix.Name) (_ []byte, err error) {
+	ctx, span := tracer().Start(ctx, "DeviceService.CreateCertificateRequest", trace.WithAttributes(attribute.String("device.id", deviceID)))
+	defer func() { tracing.End(span, err) }()
+	device, err := d.Get(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if subject.CommonName == "" {
+		subject.CommonName = device.Label
+		if subject.CommonName == "" {
+			subject.CommonName = device.ID
+		}
+	}
+	if subject.SerialNumber == "" {
+		subject.SerialNumber = device.ID
+	}
+	key, err := crypto.ParsePrivateKey(device.Algorithm, device.PkPem)
+	if err != nil {
+		return nil, err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{Subject: subject}, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate request: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr}), nil
 }
 
-func (d *DeviceService) GetDeviceSignatures(deviceID string) ([][]byte, error) {
-	return d.db.GetDeviceSignatures(deviceID)
+// AttachCertificate stores a DER encoded certificate issued for the device, e.g. by an external CA,
+// after validating that it certifies the key of the device.
+func (d *DeviceService) AttachCertificate(ctx context.Context, deviceID string, certificate []byte) (err error) {
+	ctx, span := tracer().Start(ctx, "DeviceService.AttachCertificate", trace.WithAttributes(attribute.String("device.id", deviceID)))
+	defer func() { tracing.End(span, err) }()
+	device, err := d.Get(ctx, deviceID)
+	if err != nil {
+		return err
+	}
+	parsed, err := x509.ParseCertificate(certificate)
+	if err != nil {
+		return fmt.Errorf("%w: %v", types.ErrInvalidCertificate, err)
+	}
+	signer, err := crypto.NewSigner(device.Algorithm, device.PkPem)
+	if err != nil {
+		return err
+	}
+	publicKey, ok := signer.Public().(interface {
+		Equal(stdcrypto.PublicKey) bool
+	})
+	if !ok || !publicKey.Equal(parsed.PublicKey) {
+		return fmt.Errorf("%w: certificate does not match the device key", types.ErrInvalidCertificate)
+	}
+	if now := d.clock.Now(); now.After(parsed.NotAfter) {
+		return fmt.Errorf("%w: certificate expired at %s", types.ErrInvalidCertificate, parsed.NotAfter.Format(time.RFC3339))
+	}
+	device.Certificate = certificate
+	return d.database(ctx).UpdateSignatureDevice(device)
 }
@@ -1,14 +1,48 @@
 package domain
 
 import (
+	"context"
+	stdcrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
 	"errors"
+	"fmt"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/ca"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/cms"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/cose"
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/jose"
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 	"go.uber.org/mock/gomock"
+	"math/big"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
+type stubIssuer struct {
+	certificate []byte
+	err         error
+}
+
+func (s stubIssuer) IssueCertificate(*types.SignatureDevice, stdcrypto.PublicKey) ([]byte, error) {
+	return s.certificate, s.err
+}
+
+func (s stubIssuer) Chain() [][]byte {
+	return nil
+}
+
 func Test_DeviceService_CreateNewSignatureDevice(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -18,6 +52,7 @@ func Test_DeviceService_CreateNewSignatureDevice(t *testing.T) {
 		name          string
 		algorithm     string
 		expectedError error
+		opts          []Option
 		setup         func(*MockDatabase)
 	}{
 		{
@@ -43,13 +78,30 @@ func Test_DeviceService_CreateNewSignatureDevice(t *testing.T) {
 				db.EXPECT().CreateSignatureDevice(gomock.Any()).Return(nil)
 			},
 		},
+		{
+			name:      "Certificate Issued",
+			algorithm: "ECC",
+			opts:      []Option{WithCertificateIssuer(stubIssuer{certificate: []byte("certificate")})},
+			setup: func(db *MockDatabase) {
+				db.EXPECT().CreateSignatureDevice(gomock.Any()).Return(nil)
+			},
+		},
+		{
+			name:          "Certificate Issuer Error",
+			algorithm:     "ECC",
+			expectedError: testErr,
+			opts:          []Option{WithCertificateIssuer(stubIssuer{err: testErr})},
+			setup: func(*MockDatabase) {
+				// the device must not be stored without its certificate
+			},
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
 			db := NewMockDatabase(ctrl)
-			deviceService := NewDeviceService(db)
+			deviceService := NewDeviceService(db, test.opts...)
 			test.setup(db)
-			_, err := deviceService.Create(types.NewSignatureDevice{
+			device, err := deviceService.Create(context.Background(), types.NewSignatureDevice{
 				Algorithm: test.algorithm,
 				Label:     "Label",
 			})
@@ -65,6 +117,9 @@ func Test_DeviceService_CreateNewSignatureDevice(t *testing.T) {
 				if err != nil {
 					t.Fatalf("expected no error, got %v", err)
 				}
+				if test.opts != nil && string(device.Certificate) != "certificate" {
+					t.Fatalf("expected the issued certificate to be stored, got %q", device.Certificate)
+				}
 			}
 		})
 	}
@@ -101,7 +156,7 @@ func Test_DeviceService_Get(t *testing.T) {
 			db := NewMockDatabase(ctrl)
 			deviceService := NewDeviceService(db)
 			test.setup(db)
-			device, err := deviceService.Get(test.deviceID)
+			device, err := deviceService.Get(context.Background(), test.deviceID)
 			if test.expectedErrorMsg != "" {
 				if err == nil {
 					t.Fatalf("expected error %q, got nil", test.expectedErrorMsg)
@@ -121,6 +176,31 @@ func Test_DeviceService_Get(t *testing.T) {
 	}
 }
 
+type fixedClock struct {
+	now time.Time
+}
+
+func (c fixedClock) Now() time.Time {
+	return c.now
+}
+
+type stubTimestamper struct {
+	token []byte
+	err   error
+}
+
+func (s stubTimestamper) Timestamp(context.Context, []byte) ([]byte, error) {
+	return s.token, s.err
+}
+
+// hangingTimestamper is a Time Stamping Authority that never responds.
+type hangingTimestamper struct{}
+
+func (hangingTimestamper) Timestamp(ctx context.Context, _ []byte) ([]byte, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
 func Test_DeviceService_SignUsingDevice(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -130,57 +210,545 @@ func Test_DeviceService_SignUsingDevice(t *testing.T) {
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
+	_, smallRSAPem, err := crypto.GenerateNewPairWith(types.RSA, crypto.KeyParameters{RSABits: 1024})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	testErr := errors.New("error")
 
 	tests := []struct {
 		name           string
 		device         types.SignatureDevice
+		opts           []Option
+		format         types.SignatureFormat
 		wantSignedData string
+		wantToken      []byte
+		commitErr      error
+		expectedError  error
 	}{
 		{
 			name: "Zero Counter",
 			device: types.SignatureDevice{
-				ID:                 "valid-id",
-				Algorithm:          types.ECC,
-				PkPem:              privatePem,
-				PreviousSignatures: make(map[uint32][]byte),
-				Counter:            0,
+				ID:        "valid-id",
+				Algorithm: types.ECC,
+				PkPem:     privatePem,
+				Counter:   0,
 			}, wantSignedData: "0_test data_dmFsaWQtaWQ=",
 		},
 		{
 			name: "Non-Zero Counter",
+			device: types.SignatureDevice{
+				ID:            "valid-id",
+				Algorithm:     types.ECC,
+				PkPem:         privatePem,
+				LastSignature: []byte("previous-signature"),
+				LastSignedAt:  now.Add(-time.Minute),
+				Counter:       1,
+			}, wantSignedData: "1_test data_cHJldmlvdXMtc2lnbmF0dXJl",
+		},
+		{
+			name: "Timestamp In Signed Data",
 			device: types.SignatureDevice{
 				ID:        "valid-id",
 				Algorithm: types.ECC,
 				PkPem:     privatePem,
-				PreviousSignatures: map[uint32][]byte{
-					0: []byte("previous-signature"),
-				},
-				Counter: 1,
-			}, wantSignedData: "1_test data_cHJldmlvdXMtc2lnbmF0dXJl",
+				Counter:   0,
+			},
+			opts:           []Option{WithTimestampInSignedData()},
+			wantSignedData: "0_2025-06-01T12:00:00Z_test data_dmFsaWQtaWQ=",
+		},
+		{
+			name: "Clock Moved Backwards",
+			device: types.SignatureDevice{
+				ID:            "valid-id",
+				Algorithm:     types.ECC,
+				PkPem:         privatePem,
+				LastSignature: []byte("previous-signature"),
+				LastSignedAt:  now.Add(time.Second),
+				Counter:       1,
+			},
+			expectedError: types.ErrClockMovedBackwards,
+		},
+		{
+			name: "Timestamp Token",
+			device: types.SignatureDevice{
+				ID:        "valid-id",
+				Algorithm: types.ECC,
+				PkPem:     privatePem,
+				Counter:   0,
+			},
+			opts:           []Option{WithTimestamper(stubTimestamper{token: []byte("token")})},
+			wantSignedData: "0_test data_dmFsaWQtaWQ=",
+			wantToken:      []byte("token"),
+		},
+		{
+			name: "Timestamp Authority Unavailable",
+			device: types.SignatureDevice{
+				ID:        "valid-id",
+				Algorithm: types.ECC,
+				PkPem:     privatePem,
+				Counter:   0,
+			},
+			opts:          []Option{WithTimestamper(stubTimestamper{err: testErr})},
+			expectedError: testErr,
+		},
+		{
+			name: "Timestamp Authority Timeout",
+			device: types.SignatureDevice{
+				ID:        "valid-id",
+				Algorithm: types.ECC,
+				PkPem:     privatePem,
+				Counter:   0,
+			},
+			opts:          []Option{WithTimestamper(hangingTimestamper{}), WithTimestampTimeout(10 * time.Millisecond)},
+			expectedError: types.ErrTimestampUnavailable,
+		},
+		{
+			name: "JWS",
+			device: types.SignatureDevice{
+				ID:        "valid-id",
+				Algorithm: types.ECC,
+				PkPem:     privatePem,
+				Counter:   0,
+			},
+			format:         types.FormatJWS,
+			wantSignedData: "0_test data_dmFsaWQtaWQ=",
+		},
+		{
+			name: "Detached JWS",
+			device: types.SignatureDevice{
+				ID:        "valid-id",
+				Algorithm: types.ECC,
+				PkPem:     privatePem,
+				Counter:   0,
+			},
+			format:         types.FormatJWSDetached,
+			wantSignedData: "0_test data_dmFsaWQtaWQ=",
+		},
+		{
+			name: "COSE",
+			device: types.SignatureDevice{
+				ID:        "valid-id",
+				Algorithm: types.ECC,
+				PkPem:     privatePem,
+				Counter:   0,
+			},
+			format:         types.FormatCOSE,
+			wantSignedData: "0_test data_dmFsaWQtaWQ=",
+		},
+		{
+			name: "Commit Fails",
+			device: types.SignatureDevice{
+				ID:        "valid-id",
+				Algorithm: types.ECC,
+				PkPem:     privatePem,
+				Counter:   0,
+			},
+			commitErr:     testErr,
+			expectedError: testErr,
+		},
+		{
+			name: "Unknown Format",
+			device: types.SignatureDevice{
+				ID:        "valid-id",
+				Algorithm: types.ECC,
+				PkPem:     privatePem,
+				Counter:   0,
+			},
+			format:        "xml",
+			expectedError: types.ErrUnknownSignatureFormat,
+		},
+		{
+			name: "JWS With Small RSA Key",
+			device: types.SignatureDevice{
+				ID:        "valid-id",
+				Algorithm: types.RSA,
+				PkPem:     smallRSAPem,
+				Counter:   0,
+			},
+			format:        types.FormatJWS,
+			expectedError: types.ErrSignatureFormatUnsupportedByKey,
 		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
 			db := NewMockDatabase(ctrl)
-			db.EXPECT().GetSignatureDevice("valid-id").Return(&test.device, nil)
-			db.EXPECT().UpdateSignatureDevice(gomock.Any()).Return(nil)
-			deviceService := NewDeviceService(db)
+			tx := NewMockDeviceTx(ctrl)
+			tx.EXPECT().Device().Return(&test.device)
+			tx.EXPECT().Rollback().Return(nil).AnyTimes()
+			if test.expectedError == nil || test.commitErr != nil {
+				tx.EXPECT().AppendSignature(gomock.Any()).DoAndReturn(func(signature types.Signature) error {
+					if signature.Counter != test.device.Counter {
+						t.Fatalf("expected signature counter %d, got %d", test.device.Counter, signature.Counter)
+					}
+					return nil
+				})
+				tx.EXPECT().Commit().Return(test.commitErr)
+			}
+			db.EXPECT().BeginDeviceTx("valid-id").Return(tx, nil)
+			deviceService := NewDeviceService(db, append(test.opts, WithClock(fixedClock{now: now}))...)
 
-			signature, signedData, err := deviceService.SignUsingDevice("valid-id", []byte("test data"))
+			signature, err := deviceService.SignUsingDevice(context.Background(), "valid-id", []byte("test data"), test.format)
+			if test.expectedError != nil {
+				if !errors.Is(err, test.expectedError) {
+					t.Fatalf("expected error %q, got %v", test.expectedError, err)
+				}
+				return
+			}
 			if err != nil {
 				t.Fatalf("expected no error, got %v", err)
 			}
-			if signature == nil {
+			if signature.Value == nil {
 				t.Fatal("expected non-nil signature and signed data")
 			}
-			if signedData == nil {
+			if signature.SignedData == nil {
 				t.Fatalf("expected non-nil signed data")
 			}
-			if !strings.EqualFold(string(signedData), test.wantSignedData) {
-				t.Fatalf("expected signed data to match, got %s", string(signedData))
+			if !strings.EqualFold(string(signature.SignedData), test.wantSignedData) {
+				t.Fatalf("expected signed data to match, got %s", string(signature.SignedData))
+			}
+			if !signature.Timestamp.Equal(now) {
+				t.Fatalf("expected timestamp %s, got %s", now, signature.Timestamp)
+			}
+			if string(signature.TimestampToken) != string(test.wantToken) {
+				t.Fatalf("expected timestamp token %q, got %q", test.wantToken, signature.TimestampToken)
+			}
+			if test.format == types.FormatJWS || test.format == types.FormatJWSDetached {
+				verifier, err := crypto.NewSigner(types.ECC, privatePem)
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				var detached []byte
+				if test.format == types.FormatJWSDetached {
+					detached = signature.SignedData
+				}
+				header, payload, err := jose.Verify(signature.Envelope, detached, verifier)
+				if err != nil {
+					t.Fatalf("expected valid JWS, got %v", err)
+				}
+				if header.KeyID != "valid-id" || header.Counter != 0 || string(payload) != test.wantSignedData {
+					t.Fatalf("unexpected JWS header %+v and payload %q", header, payload)
+				}
+			} else if test.format == types.FormatCOSE {
+				verifier, err := crypto.NewSigner(types.ECC, privatePem)
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				header, payload, err := cose.Verify(signature.Envelope, nil, verifier)
+				if err != nil {
+					t.Fatalf("expected valid COSE_Sign1, got %v", err)
+				}
+				if header.KeyID != "valid-id" || header.Counter != 0 || string(payload) != test.wantSignedData {
+					t.Fatalf("unexpected COSE header %+v and payload %q", header, payload)
+				}
+			} else if signature.Envelope != nil {
+				t.Fatalf("expected no envelope for raw signatures, got %q", signature.Envelope)
+			}
+		})
+	}
+
+}
+
+func Test_DeviceService_CertificateRequest(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	_, privatePem, err := crypto.GenerateNewPair(types.ECC)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	device := &types.SignatureDevice{ID: "valid-id", Label: "Store 42", Algorithm: types.ECC, PkPem: privatePem}
+	db := NewMockDatabase(ctrl)
+	db.EXPECT().GetSignatureDevice("valid-id").Return(device, nil).Times(2)
+	db.EXPECT().UpdateSignatureDevice(gomock.Any()).Return(nil)
+	deviceService := NewDeviceService(db)
+
+	csrPem, err := deviceService.CreateCertificateRequest(context.Background(), "valid-id", pkix.Name{Organization: []string{"ACME"}})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	block, _ := pem.Decode(csrPem)
+	if block == nil {
+		t.Fatal("expected a PEM encoded certificate request")
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		t.Fatalf("failed to parse certificate request: %v", err)
+	}
+	if err = csr.CheckSignature(); err != nil {
+		t.Fatalf("expected the request to be signed by the device key, got %v", err)
+	}
+	if csr.Subject.CommonName != "Store 42" || csr.Subject.SerialNumber != "valid-id" || csr.Subject.Organization[0] != "ACME" {
+		t.Fatalf("unexpected subject %s", csr.Subject)
+	}
+
+	// certify the request with a throwaway CA and attach the result
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate CA key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      csr.Subject,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certificate, err := x509.CreateCertificate(rand.Reader, template, template, csr.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	if err = deviceService.AttachCertificate(context.Background(), "valid-id", certificate); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if string(device.Certificate) != string(certificate) {
+		t.Fatal("expected the certificate to be attached to the device")
+	}
+}
+
+func Test_DeviceService_AttachCertificate_Mismatch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	_, privatePem, err := crypto.GenerateNewPair(types.ECC)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certificate, err := x509.CreateCertificate(rand.Reader, template, template, otherKey.Public(), otherKey)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+
+	db := NewMockDatabase(ctrl)
+	db.EXPECT().GetSignatureDevice("valid-id").Return(&types.SignatureDevice{ID: "valid-id", Algorithm: types.ECC, PkPem: privatePem}, nil)
+	deviceService := NewDeviceService(db)
+
+	err = deviceService.AttachCertificate(context.Background(), "valid-id", certificate)
+	if !errors.Is(err, types.ErrInvalidCertificate) {
+		t.Fatalf("expected error %q, got %v", types.ErrInvalidCertificate, err)
+	}
+}
+
+func Test_DeviceService_SignDocument(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	authority, err := ca.Generate("Test CA")
+	if err != nil {
+		t.Fatalf("failed to generate CA: %v", err)
+	}
+	document := []byte("%PDF-1.7 daily report")
+	digest := sha256.Sum256(document)
+
+	for _, algorithm := range []types.SigningAlgorithm{types.RSA, types.ECC, types.RSAPSS, types.Ed25519} {
+		t.Run(string(algorithm), func(t *testing.T) {
+			var device *types.SignatureDevice
+			db := NewMockDatabase(ctrl)
+			db.EXPECT().CreateSignatureDevice(gomock.Any()).DoAndReturn(func(created *types.SignatureDevice) error {
+				device = created
+				return nil
+			})
+			tx := NewMockDeviceTx(ctrl)
+			tx.EXPECT().Device().DoAndReturn(func() *types.SignatureDevice {
+				return device
+			})
+			var appended []types.Signature
+			tx.EXPECT().AppendSignature(gomock.Any()).DoAndReturn(func(signature types.Signature) error {
+				appended = append(appended, signature)
+				return nil
+			})
+			tx.EXPECT().Commit().Return(nil)
+			tx.EXPECT().Rollback().Return(nil).AnyTimes()
+			db.EXPECT().BeginDeviceTx(gomock.Any()).Return(tx, nil)
+			deviceService := NewDeviceService(db, WithCertificateIssuer(authority))
+
+			if _, err = deviceService.Create(context.Background(), types.NewSignatureDevice{Algorithm: string(algorithm), Label: "Store 42"}); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			signature, err := deviceService.SignDocument(context.Background(), device.ID, document)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if len(appended) != 1 || appended[0].Counter != 0 {
+				t.Fatalf("expected the signature to be appended to the chain, got %+v", appended)
+			}
+			wantSignedData := "0_" + base64.StdEncoding.EncodeToString(digest[:]) + "_" + base64.StdEncoding.EncodeToString([]byte(device.ID))
+			if string(signature.SignedData) != wantSignedData {
+				t.Fatalf("expected signed data %s, got %s", wantSignedData, signature.SignedData)
+			}
+			if signature.Format != types.FormatCMS {
+				t.Fatalf("expected format %s, got %s", types.FormatCMS, signature.Format)
+			}
+			signer, err := crypto.NewSigner(algorithm, device.PkPem)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if err = signer.Verify(signature.SignedData, signature.Value); err != nil {
+				t.Fatalf("expected the chain signature to verify, got %v", err)
+			}
+
+			signedData, err := cms.Parse(signature.Envelope)
+			if err != nil {
+				t.Fatalf("failed to parse CMS: %v", err)
+			}
+			if signedData.Content != nil {
+				t.Fatal("expected a detached CMS signature")
+			}
+			certificate, err := signedData.Verify(document)
+			if err != nil {
+				t.Fatalf("expected the CMS signature to verify, got %v", err)
+			}
+			if string(certificate.Raw) != string(device.Certificate) {
+				t.Fatal("expected the device certificate to be the signer")
+			}
+			if len(signedData.Certificates) != 2 {
+				t.Fatalf("expected device and CA certificate, got %d certificates", len(signedData.Certificates))
+			}
+			if _, err = signedData.Verify([]byte("another document")); !errors.Is(err, cms.ErrVerificationFailed) {
+				t.Fatalf("expected %q, got %v", cms.ErrVerificationFailed, err)
 			}
 		})
 	}
+}
+
+// recordingObserver records the observed operations with their errors.
+type recordingObserver struct {
+	observed []string
+}
+
+func (o *recordingObserver) ObserveKeyGeneration(algorithm types.SigningAlgorithm, _ time.Duration, err error) {
+	o.observed = append(o.observed, fmt.Sprintf("key %s %v", algorithm, err))
+}
+
+func (o *recordingObserver) ObserveSigning(algorithm types.SigningAlgorithm, format types.SignatureFormat, _ time.Duration, err error) {
+	o.observed = append(o.observed, fmt.Sprintf("sign %s %s %v", algorithm, format, err))
+}
 
+func Test_DeviceService_Observer(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var device *types.SignatureDevice
+	db := NewMockDatabase(ctrl)
+	db.EXPECT().CreateSignatureDevice(gomock.Any()).DoAndReturn(func(created *types.SignatureDevice) error {
+		device = created
+		return nil
+	})
+	tx := NewMockDeviceTx(ctrl)
+	tx.EXPECT().Device().DoAndReturn(func() *types.SignatureDevice {
+		return device
+	}).Times(2)
+	tx.EXPECT().AppendSignature(gomock.Any()).Return(nil).Times(2)
+	gomock.InOrder(
+		tx.EXPECT().Commit().Return(nil),
+		tx.EXPECT().Commit().Return(errors.New("disk full")),
+	)
+	tx.EXPECT().Rollback().Return(nil).AnyTimes()
+	db.EXPECT().BeginDeviceTx(gomock.Any()).Return(tx, nil).Times(2)
+	db.EXPECT().BeginDeviceTx("unknown").Return(nil, types.ErrDeviceNotFound)
+	observer := &recordingObserver{}
+	deviceService := NewDeviceService(db, WithObserver(observer))
+
+	if _, err := deviceService.Create(context.Background(), types.NewSignatureDevice{Algorithm: string(types.ECC)}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := deviceService.SignUsingDevice(context.Background(), device.ID, []byte("data"), types.FormatRaw); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := deviceService.SignDocument(context.Background(), device.ID, []byte("document")); err == nil {
+		t.Fatalf("expected an error")
+	}
+	if _, err := deviceService.SignUsingDevice(context.Background(), "unknown", []byte("data"), types.FormatRaw); !errors.Is(err, types.ErrDeviceNotFound) {
+		t.Fatalf("expected error %v, got %v", types.ErrDeviceNotFound, err)
+	}
+
+	expected := []string{
+		"key ECC <nil>",
+		"sign ECC raw <nil>",
+		"sign ECC cms failed to commit signature: disk full",
+	}
+	if !reflect.DeepEqual(observer.observed, expected) {
+		t.Fatalf("expected %v, got %v", expected, observer.observed)
+	}
+}
+
+func Test_DeviceService_Tracing(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(previous)
+
+	var device *types.SignatureDevice
+	db := NewMockDatabase(ctrl)
+	db.EXPECT().CreateSignatureDevice(gomock.Any()).DoAndReturn(func(created *types.SignatureDevice) error {
+		device = created
+		return nil
+	})
+	tx := NewMockDeviceTx(ctrl)
+	tx.EXPECT().Device().DoAndReturn(func() *types.SignatureDevice {
+		return device
+	})
+	tx.EXPECT().AppendSignature(gomock.Any()).Return(nil)
+	tx.EXPECT().Commit().Return(nil)
+	tx.EXPECT().Rollback().Return(nil)
+	db.EXPECT().BeginDeviceTx(gomock.Any()).Return(tx, nil)
+	db.EXPECT().BeginDeviceTx("unknown").Return(nil, types.ErrDeviceNotFound)
+	deviceService := NewDeviceService(db)
+
+	ctx, request := provider.Tracer("test").Start(context.Background(), "request")
+	if _, err := deviceService.Create(ctx, types.NewSignatureDevice{Algorithm: string(types.ECC)}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := deviceService.SignUsingDevice(ctx, device.ID, []byte("data"), types.FormatRaw); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := deviceService.SignUsingDevice(ctx, "unknown", []byte("data"), types.FormatRaw); !errors.Is(err, types.ErrDeviceNotFound) {
+		t.Fatalf("expected error %v, got %v", types.ErrDeviceNotFound, err)
+	}
+	request.End()
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	var observed []string
+	for _, span := range recorder.Ended() {
+		if _, ok := spans[span.Name()]; !ok {
+			spans[span.Name()] = span
+		}
+		observed = append(observed, fmt.Sprintf("%s %s", span.Name(), span.Status().Code))
+	}
+	expected := []string{
+		"crypto.GenerateKey Unset",
+		"DeviceService.Create Unset",
+		"Signer.Sign Unset",
+		"DeviceService.SignUsingDevice Unset",
+		"DeviceService.SignUsingDevice Error",
+		"request Unset",
+	}
+	if !reflect.DeepEqual(observed, expected) {
+		t.Fatalf("expected %v, got %v", expected, observed)
+	}
+	parents := map[string]string{
+		"crypto.GenerateKey":            "DeviceService.Create",
+		"DeviceService.Create":          "request",
+		"Signer.Sign":                   "DeviceService.SignUsingDevice",
+		"DeviceService.SignUsingDevice": "request",
+	}
+	for child, parent := range parents {
+		if spans[child].Parent().SpanID() != spans[parent].SpanContext().SpanID() {
+			t.Fatalf("expected %s to be a child of %s", child, parent)
+		}
+	}
 }
@@ -0,0 +1,141 @@
+package domain
+
+import (
+	stdcrypto "crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/cms"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/cose"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/jose"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+)
+
+// Envelope wraps the secured data into a standardized signature format.
+type Envelope interface {
+	// SigningInput returns the data the device signs.
+	SigningInput() []byte
+	// Seal assembles the envelope from the device signature over the signing input.
+	Seal(signature []byte) ([]byte, error)
+}
+
+// MinJOSERSABits is the smallest RSA key RFC 7518 and RFC 8230 allow for RS256 and PS256.
+const MinJOSERSABits = 2048
+
+// newEnvelope prepares the envelope of the given format for the next signature of the device.
+func newEnvelope(format types.SignatureFormat, device *types.SignatureDevice, signer crypto.Signer, securedData []byte) (Envelope, error) {
+	switch format {
+	case "", types.FormatRaw:
+		return rawEnvelope{securedData: securedData}, nil
+	}
+	// Devices created with smaller keys can still sign raw, but verifiers reject their JWS and COSE signatures.
+	if key, ok := signer.Public().(*rsa.PublicKey); ok && key.N.BitLen() < MinJOSERSABits {
+		return nil, fmt.Errorf("%w: %s requires RSA keys of at least %d bits, device key has %d",
+			types.ErrSignatureFormatUnsupportedByKey, format, MinJOSERSABits, key.N.BitLen())
+	}
+	switch format {
+	case types.FormatJWS, types.FormatJWSDetached:
+		algorithm, err := jose.AlgorithmFor(device.Algorithm)
+		if err != nil {
+			return nil, err
+		}
+		return jose.New(jose.Header{
+			Algorithm: algorithm,
+			KeyID:     device.ID,
+			Counter:   device.Counter,
+		}, securedData, format == types.FormatJWSDetached)
+	case types.FormatCOSE:
+		algorithm, err := cose.AlgorithmFor(device.Algorithm)
+		if err != nil {
+			return nil, err
+		}
+		return cose.New(cose.Header{
+			Algorithm: algorithm,
+			KeyID:     device.ID,
+			Counter:   device.Counter,
+		}, securedData, false)
+	default:
+		return nil, fmt.Errorf("%w: %s", types.ErrUnknownSignatureFormat, format)
+	}
+}
+
+// rawEnvelope signs the secured data as is and has no representation besides the signature.
+type rawEnvelope struct {
+	securedData []byte
+}
+
+func (r rawEnvelope) SigningInput() []byte {
+	return r.securedData
+}
+
+func (r rawEnvelope) Seal([]byte) ([]byte, error) {
+	return nil, nil
+}
+
+// cmsEnvelope signs the secured data like rawEnvelope and wraps a second signature of the device
+// over the document into a detached CMS SignedData, which is what document consumers verify.
+type cmsEnvelope struct {
+	rawEnvelope
+	document []byte
+	signer   crypto.Signer
+	opts     cms.Options
+}
+
+// newCMSEnvelope prepares the CMS envelope of a document signature. The device certificate is embedded
+// if the device has one, together with the chain of the issuing CA.
+func newCMSEnvelope(device *types.SignatureDevice, signer crypto.Signer, securedData []byte, document []byte, signingTime time.Time, chain [][]byte) (Envelope, error) {
+	opts := cms.Options{
+		Detached:    true,
+		SigningTime: signingTime,
+	}
+	switch device.Algorithm {
+	case types.RSA:
+		opts.Hash, opts.SignatureAlgorithm = stdcrypto.SHA256, x509.SHA256WithRSA
+	case types.ECC:
+		opts.Hash, opts.SignatureAlgorithm = stdcrypto.SHA384, x509.ECDSAWithSHA384
+	case types.RSAPSS:
+		opts.Hash, opts.SignatureAlgorithm = stdcrypto.SHA256, x509.SHA256WithRSAPSS
+	case types.Ed25519:
+		opts.Hash, opts.SignatureAlgorithm = stdcrypto.SHA512, x509.PureEd25519
+	default:
+		return nil, fmt.Errorf("%w: %s", types.ErrUnknownSigningAlgorithm, device.Algorithm)
+	}
+
+	if len(device.Certificate) == 0 {
+		keyID, err := crypto.SubjectKeyID(signer.Public())
+		if err != nil {
+			return nil, err
+		}
+		opts.SubjectKeyID = keyID
+	} else {
+		certificate, err := x509.ParseCertificate(device.Certificate)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", types.ErrInvalidCertificate, err)
+		}
+		opts.Certificate = certificate
+		for i, der := range chain {
+			issuer, err := x509.ParseCertificate(der)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse CA certificate: %w", err)
+			}
+			// The chain is only meaningful if the CA actually issued the (possibly attached) device certificate.
+			if i == 0 && certificate.CheckSignatureFrom(issuer) != nil {
+				break
+			}
+			opts.Certificates = append(opts.Certificates, issuer)
+		}
+	}
+	return cmsEnvelope{
+		rawEnvelope: rawEnvelope{securedData: securedData},
+		document:    document,
+		signer:      signer,
+		opts:        opts,
+	}, nil
+}
+
+func (c cmsEnvelope) Seal([]byte) ([]byte, error) {
+	return cms.Sign(c.document, c.signer, c.opts)
+}
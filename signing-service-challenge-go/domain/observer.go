@@ -0,0 +1,24 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+)
+
+// Observer is notified of the duration and outcome of key generations and signatures, e.g. to export metrics.
+type Observer interface {
+	// ObserveKeyGeneration is called after generating the key of a new device.
+	ObserveKeyGeneration(algorithm types.SigningAlgorithm, duration time.Duration, err error)
+	// ObserveSigning is called after signing with a device, including waiting for the device and
+	// storing the signature. Signatures with devices that do not exist are not observed.
+	ObserveSigning(algorithm types.SigningAlgorithm, format types.SignatureFormat, duration time.Duration, err error)
+}
+
+// noObserver is the Observer of a DeviceService without one.
+type noObserver struct{}
+
+func (noObserver) ObserveKeyGeneration(types.SigningAlgorithm, time.Duration, error) {}
+
+func (noObserver) ObserveSigning(types.SigningAlgorithm, types.SignatureFormat, time.Duration, error) {
+}
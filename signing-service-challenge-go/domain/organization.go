@@ -0,0 +1,191 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+)
+
+// OrganizationStore persists organizations.
+type OrganizationStore interface {
+	// CreateOrganization stores a new organization, types.ErrOrganizationExists if its ID is taken.
+	CreateOrganization(organization *types.Organization) error
+	// GetOrganization retrieves an organization by its ID.
+	GetOrganization(id string) (*types.Organization, error)
+	// GetAllOrganizations retrieves all organizations, ordered by their ID.
+	GetAllOrganizations() ([]*types.Organization, error)
+	// UpdateOrganization updates the name and quota of an existing organization.
+	UpdateOrganization(organization *types.Organization) error
+}
+
+// organizationID matches the IDs of organizations, which appear in URLs and API keys.
+var organizationID = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// OrganizationService manages the organizations sharing the service.
+type OrganizationService struct {
+	store OrganizationStore
+	clock Clock
+}
+
+// OrganizationOption configures an OrganizationService.
+type OrganizationOption func(*OrganizationService)
+
+// WithOrganizationClock sets the Clock used to timestamp the creation of organizations. Defaults to SystemClock.
+func WithOrganizationClock(clock Clock) OrganizationOption {
+	return func(o *OrganizationService) {
+		o.clock = clock
+	}
+}
+
+// NewOrganizationService creates an OrganizationService storing the organizations in store.
+func NewOrganizationService(store OrganizationStore, opts ...OrganizationOption) *OrganizationService {
+	o := &OrganizationService{store: store, clock: SystemClock{}}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// Get retrieves an organization by its ID. The default organization exists without being created.
+func (o *OrganizationService) Get(id string) (*types.Organization, error) {
+	organization, err := o.store.GetOrganization(id)
+	if errors.Is(err, types.ErrOrganizationNotFound) && id == types.DefaultOrganizationID {
+		return &types.Organization{ID: types.DefaultOrganizationID, Name: "Default"}, nil
+	}
+	return organization, err
+}
+
+// GetAll retrieves all created organizations.
+func (o *OrganizationService) GetAll() ([]*types.Organization, error) {
+	return o.store.GetAllOrganizations()
+}
+
+// Create creates an organization with the given ID, which consists of lower case letters, digits and dashes.
+func (o *OrganizationService) Create(id string, name string, maxDevices int) (*types.Organization, error) {
+	if !organizationID.MatchString(id) {
+		return nil, fmt.Errorf("%w: ID must consist of up to 63 lower case letters, digits and dashes", types.ErrInvalidOrganization)
+	}
+	if maxDevices < 0 {
+		return nil, fmt.Errorf("%w: device quota must not be negative", types.ErrInvalidOrganization)
+	}
+	organization := &types.Organization{
+		ID:         id,
+		Name:       name,
+		MaxDevices: maxDevices,
+		CreatedAt:  o.clock.Now(),
+	}
+	if err := o.store.CreateOrganization(organization); err != nil {
+		return nil, err
+	}
+	return organization, nil
+}
+
+// Update changes the name and device quota of an organization. Lowering the quota below the number of
+// devices of the organization only prevents new devices. The default organization is created on its first update.
+func (o *OrganizationService) Update(id string, name string, maxDevices int) (*types.Organization, error) {
+	if maxDevices < 0 {
+		return nil, fmt.Errorf("%w: device quota must not be negative", types.ErrInvalidOrganization)
+	}
+	organization, err := o.store.GetOrganization(id)
+	if errors.Is(err, types.ErrOrganizationNotFound) && id == types.DefaultOrganizationID {
+		return o.Create(id, name, maxDevices)
+	}
+	if err != nil {
+		return nil, err
+	}
+	organization.Name = name
+	organization.MaxDevices = maxDevices
+	if err = o.store.UpdateOrganization(organization); err != nil {
+		return nil, err
+	}
+	return organization, nil
+}
+
+// organizationDatabase restricts a Database to the devices of one organization. Devices of other
+// organizations do not exist for it, so that their IDs cannot even be probed.
+type organizationDatabase struct {
+	db             Database
+	organizationID string
+}
+
+// OrganizationDatabase returns a view of db restricted to the devices of the given organization.
+// Devices created through it belong to the organization.
+func OrganizationDatabase(db Database, organizationID string) Database {
+	return &organizationDatabase{db: db, organizationID: organizationID}
+}
+
+func (o *organizationDatabase) GetSignatureDevice(id string) (*types.SignatureDevice, error) {
+	device, err := o.db.GetSignatureDevice(id)
+	if err != nil {
+		return nil, err
+	}
+	if device.Organization() != o.organizationID {
+		return nil, types.ErrDeviceNotFound
+	}
+	return device, nil
+}
+
+func (o *organizationDatabase) GetAllSignatureDevices() ([]*types.SignatureDevice, error) {
+	return o.db.GetOrganizationSignatureDevices(o.organizationID)
+}
+
+func (o *organizationDatabase) GetOrganizationSignatureDevices(organizationID string) ([]*types.SignatureDevice, error) {
+	if organizationID != o.organizationID {
+		return []*types.SignatureDevice{}, nil
+	}
+	return o.db.GetOrganizationSignatureDevices(organizationID)
+}
+
+func (o *organizationDatabase) CreateSignatureDevice(device *types.SignatureDevice) error {
+	device.OrganizationID = o.organizationID
+	return o.db.CreateSignatureDevice(device)
+}
+
+func (o *organizationDatabase) CreateOrganizationSignatureDevice(device *types.SignatureDevice, maxDevices int) error {
+	device.OrganizationID = o.organizationID
+	return o.db.CreateOrganizationSignatureDevice(device, maxDevices)
+}
+
+// UpdateSignatureDevice updates a device of the organization, it cannot move devices between organizations.
+func (o *organizationDatabase) UpdateSignatureDevice(updatedDevice *types.SignatureDevice) error {
+	if _, err := o.GetSignatureDevice(updatedDevice.ID); err != nil {
+		return err
+	}
+	updatedDevice.OrganizationID = o.organizationID
+	return o.db.UpdateSignatureDevice(updatedDevice)
+}
+
+func (o *organizationDatabase) BeginDeviceTx(id string) (DeviceTx, error) {
+	tx, err := o.db.BeginDeviceTx(id)
+	if err != nil {
+		return nil, err
+	}
+	if tx.Device().Organization() != o.organizationID {
+		tx.Rollback()
+		return nil, types.ErrDeviceNotFound
+	}
+	return tx, nil
+}
+
+func (o *organizationDatabase) GetSignature(deviceID string, counter uint32) (*types.Signature, error) {
+	if _, err := o.GetSignatureDevice(deviceID); err != nil {
+		return nil, err
+	}
+	return o.db.GetSignature(deviceID, counter)
+}
+
+func (o *organizationDatabase) GetSignatures(deviceID string, from, to uint32) ([]types.Signature, error) {
+	if _, err := o.GetSignatureDevice(deviceID); err != nil {
+		return nil, err
+	}
+	return o.db.GetSignatures(deviceID, from, to)
+}
+
+func (o *organizationDatabase) GetLastSignature(deviceID string) (*types.Signature, error) {
+	if _, err := o.GetSignatureDevice(deviceID); err != nil {
+		return nil, err
+	}
+	return o.db.GetLastSignature(deviceID)
+}
@@ -0,0 +1,154 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+	"go.uber.org/mock/gomock"
+)
+
+func Test_OrganizationDatabase(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	own := &types.SignatureDevice{ID: "own", OrganizationID: "store-a"}
+	other := &types.SignatureDevice{ID: "other", OrganizationID: "store-b"}
+	legacy := &types.SignatureDevice{ID: "legacy"}
+	devices := map[string]*types.SignatureDevice{"own": own, "other": other, "legacy": legacy}
+
+	db := NewMockDatabase(ctrl)
+	db.EXPECT().GetSignatureDevice(gomock.Any()).DoAndReturn(func(id string) (*types.SignatureDevice, error) {
+		return devices[id], nil
+	}).AnyTimes()
+	db.EXPECT().GetOrganizationSignatureDevices(gomock.Any()).DoAndReturn(func(organizationID string) ([]*types.SignatureDevice, error) {
+		var result []*types.SignatureDevice
+		for _, device := range []*types.SignatureDevice{own, other, legacy} {
+			if device.Organization() == organizationID {
+				result = append(result, device)
+			}
+		}
+		return result, nil
+	}).AnyTimes()
+
+	tests := []struct {
+		name         string
+		organization string
+		visible      string
+		hidden       []string
+	}{
+		{"Organization", "store-a", "own", []string{"other", "legacy"}},
+		{"Default Organization", types.DefaultOrganizationID, "legacy", []string{"own", "other"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			scoped := OrganizationDatabase(db, test.organization)
+			if device, err := scoped.GetSignatureDevice(test.visible); err != nil || device.ID != test.visible {
+				t.Fatalf("expected device %s, got %v, %v", test.visible, device, err)
+			}
+			for _, id := range test.hidden {
+				if _, err := scoped.GetSignatureDevice(id); !errors.Is(err, types.ErrDeviceNotFound) {
+					t.Fatalf("expected error %v for device %s, got %v", types.ErrDeviceNotFound, id, err)
+				}
+				if _, err := scoped.GetLastSignature(id); !errors.Is(err, types.ErrDeviceNotFound) {
+					t.Fatalf("expected error %v for signatures of device %s, got %v", types.ErrDeviceNotFound, id, err)
+				}
+				if err := scoped.UpdateSignatureDevice(&types.SignatureDevice{ID: id}); !errors.Is(err, types.ErrDeviceNotFound) {
+					t.Fatalf("expected error %v updating device %s, got %v", types.ErrDeviceNotFound, id, err)
+				}
+			}
+			all, err := scoped.GetAllSignatureDevices()
+			if err != nil || len(all) != 1 || all[0].ID != test.visible {
+				t.Fatalf("expected only device %s, got %v, %v", test.visible, all, err)
+			}
+			if foreign, err := scoped.GetOrganizationSignatureDevices("store-b"); err != nil || len(foreign) != 0 {
+				t.Fatalf("expected no devices of another organization, got %v, %v", foreign, err)
+			}
+		})
+	}
+
+	t.Run("Foreign Device Tx", func(t *testing.T) {
+		tx := NewMockDeviceTx(ctrl)
+		tx.EXPECT().Device().Return(other)
+		tx.EXPECT().Rollback().Return(nil)
+		db.EXPECT().BeginDeviceTx("other").Return(tx, nil)
+		if _, err := OrganizationDatabase(db, "store-a").BeginDeviceTx("other"); !errors.Is(err, types.ErrDeviceNotFound) {
+			t.Fatalf("expected error %v, got %v", types.ErrDeviceNotFound, err)
+		}
+	})
+}
+
+func Test_DeviceService_ForOrganization(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	db := NewMockDatabase(ctrl)
+	var created *types.SignatureDevice
+	db.EXPECT().CreateOrganizationSignatureDevice(gomock.Any(), 2).DoAndReturn(func(device *types.SignatureDevice, _ int) error {
+		created = device
+		return nil
+	})
+	db.EXPECT().CreateOrganizationSignatureDevice(gomock.Any(), 1).Return(types.ErrDeviceQuotaExceeded)
+
+	service := NewDeviceService(db)
+	device, err := service.ForOrganization(&types.Organization{ID: "store-a", MaxDevices: 2}).Create(context.Background(), types.NewSignatureDevice{Algorithm: "ECC"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if device.OrganizationID != "store-a" || created.OrganizationID != "store-a" {
+		t.Fatalf("expected the device to belong to store-a, got %q", device.OrganizationID)
+	}
+
+	_, err = service.ForOrganization(&types.Organization{ID: "store-a", MaxDevices: 1}).Create(context.Background(), types.NewSignatureDevice{Algorithm: "ECC"})
+	if !errors.Is(err, types.ErrDeviceQuotaExceeded) {
+		t.Fatalf("expected error %v, got %v", types.ErrDeviceQuotaExceeded, err)
+	}
+}
+
+// organizationStore keeps created organizations in memory.
+type organizationStore map[string]*types.Organization
+
+func (s organizationStore) CreateOrganization(organization *types.Organization) error {
+	if _, exists := s[organization.ID]; exists {
+		return types.ErrOrganizationExists
+	}
+	s[organization.ID] = organization
+	return nil
+}
+
+func (s organizationStore) GetOrganization(id string) (*types.Organization, error) {
+	if organization, exists := s[id]; exists {
+		return organization, nil
+	}
+	return nil, types.ErrOrganizationNotFound
+}
+
+func (s organizationStore) GetAllOrganizations() ([]*types.Organization, error) {
+	return nil, nil
+}
+
+func (s organizationStore) UpdateOrganization(organization *types.Organization) error {
+	s[organization.ID] = organization
+	return nil
+}
+
+func Test_OrganizationService_Create(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	service := NewOrganizationService(organizationStore{}, WithOrganizationClock(fixedClock{now: now}))
+
+	organization, err := service.Create("store-a", "Store A", 2)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !organization.CreatedAt.Equal(now) {
+		t.Fatalf("expected creation at %v, got %v", now, organization.CreatedAt)
+	}
+	if _, err = service.Create("Store A", "Store A", 0); !errors.Is(err, types.ErrInvalidOrganization) {
+		t.Fatalf("expected error %v, got %v", types.ErrInvalidOrganization, err)
+	}
+	if _, err = service.Create("store-a", "Store A", 0); !errors.Is(err, types.ErrOrganizationExists) {
+		t.Fatalf("expected error %v, got %v", types.ErrOrganizationExists, err)
+	}
+}
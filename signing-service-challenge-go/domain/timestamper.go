@@ -0,0 +1,16 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultTimestampTimeout is the default time a Time Stamping Authority is given to issue a token.
+// The device is locked meanwhile, so it is much shorter than what is reasonable for other HTTP calls.
+const DefaultTimestampTimeout = 2 * time.Second
+
+// Timestamper obtains RFC 3161 timestamp tokens from a Time Stamping Authority.
+type Timestamper interface {
+	// Timestamp returns a DER encoded timestamp token over data. It gives up once ctx is done.
+	Timestamp(ctx context.Context, data []byte) ([]byte, error)
+}
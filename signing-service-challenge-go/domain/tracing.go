@@ -0,0 +1,21 @@
+package domain
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer returns the tracer of the package, looked up on every use as the provider is only set up on startup.
+func tracer() trace.Tracer {
+	return otel.Tracer("github.com/fiskaly/coding-challenges/signing-service-challenge/domain")
+}
+
+// ContextDatabase is a Database whose operations can be attributed to a context, e.g. to trace them as
+// part of the request they serve.
+type ContextDatabase interface {
+	Database
+	// WithContext returns the Database attributing its operations to ctx.
+	WithContext(ctx context.Context) Database
+}
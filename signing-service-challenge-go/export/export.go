@@ -0,0 +1,324 @@
+// Package export writes the signature journals of devices as tar archives for auditors.
+//
+// An export holds, for every device,
+//
+//	devices/<id>/device.json        device metadata with public key and certificate
+//	devices/<id>/signatures.ndjson  the signatures in the period, one JSON record per line
+//	devices/<id>/signatures.csv     the same signatures as CSV
+//
+// followed by manifest.json with the SHA-256 checksum of every entry.
+package export
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+)
+
+const (
+	// pageSize is the number of signatures read from the database at once.
+	pageSize = 1000
+)
+
+var (
+	// ErrInvalidPeriod indicates a period that ends before it starts.
+	ErrInvalidPeriod = errors.New("start of the period must be before its end")
+	// ErrJournalChanged indicates signatures that changed while they were exported.
+	ErrJournalChanged = errors.New("signature journal changed during the export")
+)
+
+// Export is a point-in-time view of the signature journals of a set of devices. Signatures created
+// after the export was taken are not part of it, even though the journals are only read while writing.
+type Export struct {
+	db      domain.Database
+	takenAt time.Time
+	from    time.Time
+	to      time.Time
+	devices []*types.SignatureDevice
+}
+
+// New takes an export of the signatures of the given devices, or of all devices if no ID is given,
+// with a timestamp in [from, to). A zero from or to leaves the period open at that end.
+func New(db domain.Database, deviceIDs []string, from, to time.Time) (*Export, error) {
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		return nil, ErrInvalidPeriod
+	}
+	e := &Export{
+		db:      db,
+		takenAt: time.Now().UTC(),
+		from:    from,
+		to:      to,
+	}
+	if len(deviceIDs) == 0 {
+		devices, err := db.GetAllSignatureDevices()
+		if err != nil {
+			return nil, err
+		}
+		e.devices = devices
+		sort.Slice(e.devices, func(i, j int) bool { return e.devices[i].ID < e.devices[j].ID })
+		return e, nil
+	}
+	for _, id := range deviceIDs {
+		device, err := db.GetSignatureDevice(id)
+		if err != nil {
+			return nil, err
+		}
+		e.devices = append(e.devices, device)
+	}
+	return e, nil
+}
+
+// WriteTo streams the export as tar archive to w. Every signature file is encoded twice, once to learn
+// its size for the tar header and once to write it, so only a page of signatures is held in memory.
+func (e *Export) WriteTo(w io.Writer) (int64, error) {
+	counter := &countingWriter{w: w}
+	archive := tar.NewWriter(counter)
+	m := Manifest{
+		Version: Version,
+		TakenAt: e.takenAt,
+		Files:   []FileEntry{},
+		Devices: []DeviceEntry{},
+	}
+	if !e.from.IsZero() {
+		m.From = &e.from
+	}
+	if !e.to.IsZero() {
+		m.To = &e.to
+	}
+	for _, device := range e.devices {
+		entry, err := e.writeDevice(archive, device, &m)
+		if err != nil {
+			return counter.n, fmt.Errorf("failed to export device %s: %w", device.ID, err)
+		}
+		m.Devices = append(m.Devices, *entry)
+	}
+	encoded, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return counter.n, err
+	}
+	if _, err = e.writeEntry(archive, ManifestFile, int64(len(encoded)), func(w io.Writer) error {
+		_, err := w.Write(encoded)
+		return err
+	}); err != nil {
+		return counter.n, err
+	}
+	err = archive.Close()
+	return counter.n, err
+}
+
+func (e *Export) writeDevice(archive *tar.Writer, device *types.SignatureDevice, m *Manifest) (*DeviceEntry, error) {
+	metadata, err := deviceMetadata(device)
+	if err != nil {
+		return nil, err
+	}
+	add := func(name string, size int64, write func(w io.Writer) error) error {
+		digest, err := e.writeEntry(archive, name, size, write)
+		if err != nil {
+			return err
+		}
+		m.Files = append(m.Files, FileEntry{Name: name, SHA256: digest, Size: size})
+		return nil
+	}
+	if err = add(DeviceFile(device.ID), int64(len(metadata)), func(w io.Writer) error {
+		_, err := w.Write(metadata)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	first, err := e.firstSignature(device)
+	if err != nil {
+		return nil, err
+	}
+	// first pass: sizes and checksums of both encodings
+	var ndjsonSize, csvSize countingWriter
+	ndjsonHash, csvHash := sha256.New(), sha256.New()
+	ndjson := newNDJSONWriter(io.MultiWriter(&ndjsonSize, ndjsonHash))
+	csv := newCSVWriter(io.MultiWriter(&csvSize, csvHash))
+	count := 0
+	err = e.scan(device, first, func(signature types.Signature) error {
+		count++
+		if err := ndjson.Write(signature); err != nil {
+			return err
+		}
+		return csv.Write(signature)
+	})
+	if err == nil {
+		err = ndjson.Flush()
+	}
+	if err == nil {
+		err = csv.Flush()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// second pass: the entries, which must match the first pass
+	files := []struct {
+		name      string
+		size      int64
+		digest    []byte
+		newWriter func(w io.Writer) recordWriter
+	}{
+		{NDJSONFile(device.ID), ndjsonSize.n, ndjsonHash.Sum(nil), newNDJSONWriter},
+		{CSVFile(device.ID), csvSize.n, csvHash.Sum(nil), newCSVWriter},
+	}
+	for _, file := range files {
+		expected := hex.EncodeToString(file.digest)
+		if err = add(file.name, file.size, func(w io.Writer) error {
+			records := file.newWriter(w)
+			if err := e.scan(device, first, records.Write); err != nil {
+				return err
+			}
+			return records.Flush()
+		}); err != nil {
+			return nil, err
+		}
+		if m.Files[len(m.Files)-1].SHA256 != expected {
+			return nil, fmt.Errorf("%w: %s", ErrJournalChanged, file.name)
+		}
+	}
+	return &DeviceEntry{ID: device.ID, Counter: device.Counter, Signatures: count}, nil
+}
+
+// writeEntry writes an entry of the given size and returns its hex encoded SHA-256 checksum.
+func (e *Export) writeEntry(archive *tar.Writer, name string, size int64, write func(w io.Writer) error) (string, error) {
+	err := archive.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0o644,
+		Size:     size,
+		ModTime:  e.takenAt,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	hash := sha256.New()
+	if err = write(io.MultiWriter(archive, hash)); err != nil {
+		if errors.Is(err, tar.ErrWriteTooLong) {
+			err = fmt.Errorf("%w: %v", ErrJournalChanged, err)
+		}
+		return "", fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// firstSignature finds the counter of the first signature in the period by a binary search,
+// as the timestamps of a chain never decrease.
+func (e *Export) firstSignature(device *types.SignatureDevice) (uint32, error) {
+	if e.from.IsZero() {
+		return 0, nil
+	}
+	low, high := uint32(0), device.Counter
+	for low < high {
+		middle := low + (high-low)/2
+		signature, err := e.db.GetSignature(device.ID, middle)
+		if err != nil {
+			return 0, err
+		}
+		if signature.Timestamp.Before(e.from) {
+			low = middle + 1
+		} else {
+			high = middle
+		}
+	}
+	return low, nil
+}
+
+// scan passes the signatures in the period to fn in the order of their counters, starting at first
+// and stopping at the counter the device had when the export was taken.
+func (e *Export) scan(device *types.SignatureDevice, first uint32, fn func(types.Signature) error) error {
+	for from := uint64(first); from < uint64(device.Counter); from += pageSize {
+		to := min(from+pageSize, uint64(device.Counter)) - 1
+		page, err := e.db.GetSignatures(device.ID, uint32(from), uint32(to))
+		if err != nil {
+			return err
+		}
+		if uint64(len(page)) != to-from+1 {
+			return fmt.Errorf("%w: expected %d signatures from %d, got %d", ErrJournalChanged, to-from+1, from, len(page))
+		}
+		for _, signature := range page {
+			if !e.to.IsZero() && !signature.Timestamp.Before(e.to) {
+				return nil
+			}
+			if signature.Timestamp.Before(e.from) {
+				continue
+			}
+			if err = fn(signature); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// deviceMetadata encodes the device with its public key and certificate, but without its private key.
+func deviceMetadata(device *types.SignatureDevice) ([]byte, error) {
+	signer, err := crypto.NewSigner(device.Algorithm, device.PkPem)
+	if err != nil {
+		return nil, err
+	}
+	publicKey, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode public key: %w", err)
+	}
+	keyID, err := crypto.SubjectKeyID(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	record := DeviceRecord{
+		ID:        device.ID,
+		Algorithm: device.Algorithm,
+		Label:     device.Label,
+		Counter:   device.Counter,
+		KeyID:     hex.EncodeToString(keyID),
+		PublicKey: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey})),
+	}
+	if len(device.Certificate) > 0 {
+		record.Certificate = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: device.Certificate}))
+	}
+	return json.MarshalIndent(record, "", "  ")
+}
+
+// countingWriter counts the bytes written to w, or discards them if w is nil.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.w == nil {
+		c.n += int64(len(p))
+		return len(p), nil
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Service takes exports of a database.
+type Service struct {
+	db domain.Database
+}
+
+// NewService creates a Service exporting the signatures of db.
+func NewService(db domain.Database) *Service {
+	return &Service{db: db}
+}
+
+// Export takes an export of the given devices, or of all devices if no ID is given, see New.
+func (s *Service) Export(deviceIDs []string, from, to time.Time) (*Export, error) {
+	return New(s.db, deviceIDs, from, to)
+}
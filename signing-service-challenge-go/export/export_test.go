@@ -0,0 +1,225 @@
+package export
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+)
+
+var start = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// hourlyClock advances by an hour every time it is read.
+type hourlyClock struct {
+	now time.Time
+}
+
+func (c *hourlyClock) Now() time.Time {
+	now := c.now
+	c.now = c.now.Add(time.Hour)
+	return now
+}
+
+// newDatabase creates devices that signed n times each, an hour apart starting at start.
+func newDatabase(t *testing.T, n int, devices int) (domain.Database, *domain.DeviceService, []string) {
+	t.Helper()
+	db := persistence.NewInMemoryDatabase()
+	var ids []string
+	for i := 0; i < devices; i++ {
+		service := domain.NewDeviceService(db, domain.WithClock(&hourlyClock{now: start}))
+		device, err := service.Create(context.Background(), types.NewSignatureDevice{Algorithm: string(types.Ed25519), Label: "export"})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		for j := 0; j < n; j++ {
+			if _, err = service.SignUsingDevice(context.Background(), device.ID, []byte("data"), types.FormatRaw); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+		}
+		ids = append(ids, device.ID)
+	}
+	return db, domain.NewDeviceService(db), ids
+}
+
+// readExport reads the entries of an export and checks them against the manifest.
+func readExport(t *testing.T, e *Export) (*Manifest, map[string][]byte) {
+	t.Helper()
+	var buf bytes.Buffer
+	written, err := e.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if written != int64(buf.Len()) {
+		t.Fatalf("expected %d bytes written, got %d", buf.Len(), written)
+	}
+	files := make(map[string][]byte)
+	var names []string
+	reader := tar.NewReader(&buf)
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if files[header.Name], err = io.ReadAll(reader); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		names = append(names, header.Name)
+	}
+	if names[len(names)-1] != ManifestFile {
+		t.Fatalf("expected %s to be the last entry, got %s", ManifestFile, names[len(names)-1])
+	}
+	var m Manifest
+	if err = json.Unmarshal(files[ManifestFile], &m); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(m.Files) != len(files)-1 {
+		t.Fatalf("expected %d files in the manifest, got %d", len(files)-1, len(m.Files))
+	}
+	for _, entry := range m.Files {
+		digest := sha256.Sum256(files[entry.Name])
+		if hex.EncodeToString(digest[:]) != entry.SHA256 || int64(len(files[entry.Name])) != entry.Size {
+			t.Fatalf("expected checksum of %s to match the manifest", entry.Name)
+		}
+	}
+	return &m, files
+}
+
+func counters(t *testing.T, files map[string][]byte, id string) []uint32 {
+	t.Helper()
+	var fromJSON []uint32
+	scanner := bufio.NewScanner(bytes.NewReader(files[NDJSONFile(id)]))
+	for scanner.Scan() {
+		var signature types.Signature
+		if err := json.Unmarshal(scanner.Bytes(), &signature); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		fromJSON = append(fromJSON, signature.Counter)
+	}
+	rows, err := csv.NewReader(bytes.NewReader(files[CSVFile(id)])).ReadAll()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(rows) != len(fromJSON)+1 {
+		t.Fatalf("expected %d CSV rows, got %d", len(fromJSON)+1, len(rows))
+	}
+	for i, counter := range fromJSON {
+		if rows[i+1][0] != strconv.FormatUint(uint64(counter), 10) {
+			t.Fatalf("expected CSV row %d to have counter %d, got %s", i+1, counter, rows[i+1][0])
+		}
+	}
+	return fromJSON
+}
+
+func TestExport_Period(t *testing.T) {
+	db, _, ids := newDatabase(t, 6, 1)
+	id := ids[0]
+
+	tests := []struct {
+		name     string
+		from, to time.Time
+		expected []uint32
+	}{
+		{
+			name:     "Everything",
+			expected: []uint32{0, 1, 2, 3, 4, 5},
+		},
+		{
+			name:     "From",
+			from:     start.Add(2 * time.Hour),
+			expected: []uint32{2, 3, 4, 5},
+		},
+		{
+			name:     "To",
+			to:       start.Add(2 * time.Hour),
+			expected: []uint32{0, 1},
+		},
+		{
+			name:     "Between",
+			from:     start.Add(90 * time.Minute),
+			to:       start.Add(4 * time.Hour),
+			expected: []uint32{2, 3},
+		},
+		{
+			name: "After Last",
+			from: start.Add(24 * time.Hour),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e, err := New(db, []string{id}, test.from, test.to)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			m, files := readExport(t, e)
+			actual := counters(t, files, id)
+			if len(actual) != len(test.expected) {
+				t.Fatalf("expected counters %v, got %v", test.expected, actual)
+			}
+			for i := range actual {
+				if actual[i] != test.expected[i] {
+					t.Fatalf("expected counters %v, got %v", test.expected, actual)
+				}
+			}
+			if len(m.Devices) != 1 || m.Devices[0].Signatures != len(test.expected) || m.Devices[0].Counter != 6 {
+				t.Fatalf("expected manifest of 1 device with %d signatures, got %+v", len(test.expected), m.Devices)
+			}
+			var device DeviceRecord
+			if err = json.Unmarshal(files[DeviceFile(id)], &device); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if device.ID != id || device.PublicKey == "" || bytes.Contains(files[DeviceFile(id)], []byte("PRIVATE")) {
+				t.Fatalf("expected the device with its public key only, got %+v", device)
+			}
+		})
+	}
+}
+
+func TestExport_PointInTime(t *testing.T) {
+	db, service, ids := newDatabase(t, 3, 2)
+	e, err := New(db, nil, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	// signatures after the export was taken are not part of it
+	for _, id := range ids {
+		if _, err = service.SignUsingDevice(context.Background(), id, []byte("later"), types.FormatRaw); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	m, files := readExport(t, e)
+	if len(m.Devices) != 2 {
+		t.Fatalf("expected 2 devices, got %d", len(m.Devices))
+	}
+	for _, id := range ids {
+		if actual := counters(t, files, id); len(actual) != 3 {
+			t.Fatalf("expected 3 signatures of device %s, got %v", id, actual)
+		}
+	}
+}
+
+func TestExport_Invalid(t *testing.T) {
+	db, _, ids := newDatabase(t, 1, 1)
+	if _, err := New(db, []string{"unknown"}, time.Time{}, time.Time{}); !errors.Is(err, types.ErrDeviceNotFound) {
+		t.Fatalf("expected error %v, got %v", types.ErrDeviceNotFound, err)
+	}
+	if _, err := New(db, ids, start.Add(time.Hour), start); !errors.Is(err, ErrInvalidPeriod) {
+		t.Fatalf("expected error %v, got %v", ErrInvalidPeriod, err)
+	}
+}
@@ -0,0 +1,69 @@
+package export
+
+import (
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+)
+
+const (
+	// Version is the version of the export format.
+	Version = 1
+	// ManifestFile is the name of the last entry of an export.
+	ManifestFile = "manifest.json"
+)
+
+// CSVHeader names the columns of the CSV journals, binary values are base64 encoded.
+var CSVHeader = []string{"counter", "timestamp", "signed_data", "signature"}
+
+// DeviceFile is the name of the entry with the metadata of a device.
+func DeviceFile(id string) string {
+	return "devices/" + id + "/device.json"
+}
+
+// NDJSONFile is the name of the entry with the signatures of a device as NDJSON.
+func NDJSONFile(id string) string {
+	return "devices/" + id + "/signatures.ndjson"
+}
+
+// CSVFile is the name of the entry with the signatures of a device as CSV.
+func CSVFile(id string) string {
+	return "devices/" + id + "/signatures.csv"
+}
+
+// Manifest lists the entries of an export with their checksums, and the exported devices.
+type Manifest struct {
+	Version int           `json:"version"`
+	TakenAt time.Time     `json:"taken_at"`
+	From    *time.Time    `json:"from,omitempty"`
+	To      *time.Time    `json:"to,omitempty"`
+	Files   []FileEntry   `json:"files"`
+	Devices []DeviceEntry `json:"devices"`
+}
+
+// FileEntry is the checksum and size of an entry.
+type FileEntry struct {
+	Name   string `json:"name"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+// DeviceEntry describes the journal of a device in an export.
+type DeviceEntry struct {
+	ID string `json:"id"`
+	// Counter is the counter of the device when the export was taken.
+	Counter uint32 `json:"counter"`
+	// Signatures is the number of signatures in the period.
+	Signatures int `json:"signatures"`
+}
+
+// DeviceRecord is the metadata of a device, with its public key instead of its private key.
+type DeviceRecord struct {
+	ID          string                 `json:"id"`
+	Algorithm   types.SigningAlgorithm `json:"algorithm"`
+	Label       string                 `json:"label"`
+	Counter     uint32                 `json:"counter"`
+	KeyID       string                 `json:"key_id"`
+	PublicKey   string                 `json:"public_key"`
+	Certificate string                 `json:"certificate,omitempty"`
+}
@@ -0,0 +1,72 @@
+package export
+
+import (
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+)
+
+// recordWriter encodes signatures one record at a time.
+type recordWriter interface {
+	Write(signature types.Signature) error
+	Flush() error
+}
+
+// ndjsonWriter writes every signature as JSON object on a line of its own, with all its fields.
+type ndjsonWriter struct {
+	encoder *json.Encoder
+}
+
+func newNDJSONWriter(w io.Writer) recordWriter {
+	return ndjsonWriter{encoder: json.NewEncoder(w)}
+}
+
+func (n ndjsonWriter) Write(signature types.Signature) error {
+	return n.encoder.Encode(signature)
+}
+
+func (n ndjsonWriter) Flush() error {
+	return nil
+}
+
+// csvWriter writes a row with the chain fields of every signature, after a header row.
+type csvWriter struct {
+	writer *csv.Writer
+	header bool
+}
+
+func newCSVWriter(w io.Writer) recordWriter {
+	return &csvWriter{writer: csv.NewWriter(w)}
+}
+
+func (c *csvWriter) Write(signature types.Signature) error {
+	if !c.header {
+		if err := c.writer.Write(CSVHeader); err != nil {
+			return err
+		}
+		c.header = true
+	}
+	return c.writer.Write([]string{
+		strconv.FormatUint(uint64(signature.Counter), 10),
+		signature.Timestamp.UTC().Format(time.RFC3339Nano),
+		base64.StdEncoding.EncodeToString(signature.SignedData),
+		base64.StdEncoding.EncodeToString(signature.Value),
+	})
+}
+
+// Flush writes buffered rows, and the header if no signature was written.
+func (c *csvWriter) Flush() error {
+	if !c.header {
+		if err := c.writer.Write(CSVHeader); err != nil {
+			return err
+		}
+		c.header = true
+	}
+	c.writer.Flush()
+	return c.writer.Error()
+}
@@ -0,0 +1,191 @@
+package health
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+)
+
+const (
+	// maxClockSkew is the largest step of the wall clock against the monotonic clock that is not reported.
+	maxClockSkew = time.Minute
+	// minEntropy is the number of bits in the entropy pool of the kernel below which entropy is reported low.
+	minEntropy = 128
+	// entropyFile reports the bits in the entropy pool of the Linux kernel.
+	entropyFile = "/proc/sys/kernel/random/entropy_avail"
+)
+
+// Pinger is implemented by databases that can check whether they are reachable.
+type Pinger interface {
+	// Ping checks that the database is reachable and usable.
+	Ping(ctx context.Context) error
+}
+
+type storageCheck struct {
+	pinger Pinger
+}
+
+// Storage checks that the storage backend is reachable.
+func Storage(pinger Pinger) Checker {
+	return storageCheck{pinger: pinger}
+}
+
+func (storageCheck) Name() string {
+	return "storage:responseTime"
+}
+
+func (c storageCheck) Check(ctx context.Context) []Result {
+	start := time.Now()
+	err := c.pinger.Ping(ctx)
+	result := Result{
+		ComponentType: "datastore",
+		ObservedValue: float64(time.Since(start).Microseconds()) / 1000,
+		ObservedUnit:  "ms",
+		Status:        Pass,
+		Time:          time.Now(),
+	}
+	if err != nil {
+		slog.WarnContext(ctx, "Storage is unreachable", "error", err)
+		result.Status = Fail
+		result.Output = "storage is unreachable"
+	}
+	return []Result{result}
+}
+
+// canaryData is signed by the canary keys.
+var canaryData = []byte("signing service canary")
+
+type keyProviderCheck struct {
+	signers map[types.SigningAlgorithm]crypto.Signer
+}
+
+// KeyProvider checks that devices can sign, by signing with a canary key of every algorithm and verifying
+// the signature. The canary keys are generated with the given parameters, as device keys are.
+func KeyProvider(params crypto.KeyParameters) (Checker, error) {
+	c := keyProviderCheck{signers: map[types.SigningAlgorithm]crypto.Signer{}}
+	for _, algorithm := range types.SigningAlgorithms() {
+		_, privatePem, err := crypto.GenerateNewPairWith(algorithm, params)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate %s canary key: %w", algorithm, err)
+		}
+		c.signers[algorithm], err = crypto.NewSigner(algorithm, privatePem)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (keyProviderCheck) Name() string {
+	return "keyProvider:responseTime"
+}
+
+func (c keyProviderCheck) Check(ctx context.Context) []Result {
+	var results []Result
+	for _, algorithm := range types.SigningAlgorithms() {
+		signer := crypto.TraceSigner(ctx, algorithm, c.signers[algorithm])
+		start := time.Now()
+		signature, err := signer.Sign(canaryData)
+		if err == nil {
+			err = signer.Verify(canaryData, signature)
+		}
+		result := Result{
+			ComponentID:   string(algorithm),
+			ComponentType: "component",
+			ObservedValue: float64(time.Since(start).Microseconds()) / 1000,
+			ObservedUnit:  "ms",
+			Status:        Pass,
+			Time:          time.Now(),
+		}
+		if err != nil {
+			slog.WarnContext(ctx, "Canary signature failed", "algorithm", algorithm, "error", err)
+			result.Status = Fail
+			result.Output = "canary signature failed"
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+type entropyCheck struct {
+	file string
+}
+
+// Entropy checks that random numbers, which keys and signatures require, can be read. On Linux, the bits in
+// the entropy pool of the kernel are reported as well, with a warning if there are few.
+func Entropy() Checker {
+	return entropyCheck{file: entropyFile}
+}
+
+func (entropyCheck) Name() string {
+	return "entropy:available"
+}
+
+func (c entropyCheck) Check(context.Context) []Result {
+	result := Result{
+		ComponentType: "system",
+		Status:        Pass,
+	}
+	if _, err := rand.Read(make([]byte, 32)); err != nil {
+		result.Status = Fail
+		result.Output = "random numbers are unavailable"
+	} else if data, err := os.ReadFile(c.file); err == nil {
+		if bits, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil {
+			result.ObservedValue = bits
+			result.ObservedUnit = "bits"
+			if bits < minEntropy {
+				result.Status = Warn
+				result.Output = "entropy is low"
+			}
+		}
+	}
+	result.Time = time.Now()
+	return []Result{result}
+}
+
+type clockCheck struct {
+	started   time.Time
+	notBefore time.Time
+}
+
+// Clock checks that the wall clock is sane: it must not be before notBefore, e.g. the time the binary was
+// built, and it is reported if it stepped by more than a minute against the monotonic clock since the check
+// was created. Signatures are timestamped with the wall clock, after a step back devices refuse to sign
+// until it catches up with their last signature.
+func Clock(notBefore time.Time) Checker {
+	return clockCheck{started: time.Now(), notBefore: notBefore}
+}
+
+func (clockCheck) Name() string {
+	return "clock:skew"
+}
+
+func (c clockCheck) Check(context.Context) []Result {
+	now := time.Now()
+	// Round(0) strips the monotonic clock reading, so that the difference is that of the wall clock.
+	skew := now.Round(0).Sub(c.started.Round(0)) - now.Sub(c.started)
+	result := Result{
+		ComponentType: "system",
+		ObservedValue: skew.Seconds(),
+		ObservedUnit:  "s",
+		Status:        Pass,
+		Time:          now,
+	}
+	switch {
+	case now.Before(c.notBefore):
+		result.Status = Fail
+		result.Output = "clock is before " + c.notBefore.UTC().Format(time.RFC3339)
+	case skew > maxClockSkew || skew < -maxClockSkew:
+		result.Status = Warn
+		result.Output = "clock stepped by " + skew.Round(time.Second).String()
+	}
+	return []Result{result}
+}
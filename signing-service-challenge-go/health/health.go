@@ -0,0 +1,210 @@
+// Package health checks the health of the signing service and its dependencies, reported in the format
+// of the health check response RFC draft (draft-inadarei-api-health-check).
+package health
+
+import (
+	"context"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// ContentType is the media type of health check responses.
+const ContentType = "application/health+json"
+
+// DefaultTimeout is the default time the checks of a readiness probe are given to complete.
+const DefaultTimeout = 5 * time.Second
+
+// Status is the status of the service or of one of its components.
+type Status string
+
+const (
+	// Pass is healthy.
+	Pass Status = "pass"
+	// Warn is healthy, with some concerns.
+	Warn Status = "warn"
+	// Fail is unhealthy.
+	Fail Status = "fail"
+)
+
+// worse returns the worse of two statuses.
+func worse(a, b Status) Status {
+	if a == Fail || b == Fail {
+		return Fail
+	}
+	if a == Warn || b == Warn {
+		return Warn
+	}
+	return Pass
+}
+
+// Result is the result of checking one component, e.g. one instance of a dependency.
+type Result struct {
+	ComponentID   string    `json:"componentId,omitempty"`
+	ComponentType string    `json:"componentType,omitempty"`
+	ObservedValue any       `json:"observedValue,omitempty"`
+	ObservedUnit  string    `json:"observedUnit,omitempty"`
+	Status        Status    `json:"status"`
+	Time          time.Time `json:"time"`
+	// Output describes a failure or warning. It is served to unauthenticated callers and must not
+	// contain internal details, such as connection strings.
+	Output string `json:"output,omitempty"`
+}
+
+// Response is the health of the service.
+type Response struct {
+	Status      Status `json:"status"`
+	Version     string `json:"version,omitempty"`
+	ReleaseID   string `json:"releaseId,omitempty"`
+	Description string `json:"description,omitempty"`
+	// Checks maps the names of the checks, component and measurement separated by a colon, to their results.
+	Checks map[string][]Result `json:"checks,omitempty"`
+}
+
+// HTTPStatus returns the HTTP status code of the response, 503 Service Unavailable if the service failed.
+func (r *Response) HTTPStatus() int {
+	if r.Status == Fail {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusOK
+}
+
+// Checker checks a dependency of the service.
+type Checker interface {
+	// Name is the name of the check, the component and the measurement separated by a colon, e.g. storage:responseTime.
+	Name() string
+	// Check checks the instances of the dependency. It must return once ctx is done.
+	Check(ctx context.Context) []Result
+}
+
+// Option configures a Service.
+type Option func(*Service)
+
+// WithTimeout sets the time the checks of a readiness probe are given to complete. Defaults to DefaultTimeout.
+func WithTimeout(timeout time.Duration) Option {
+	return func(s *Service) {
+		s.timeout = timeout
+	}
+}
+
+// Service reports the liveness and readiness of the signing service.
+type Service struct {
+	version   string
+	releaseID string
+	started   time.Time
+	timeout   time.Duration
+	checkers  []Checker
+}
+
+// New creates a Service checking readiness with the given checkers.
+func New(checkers []Checker, opts ...Option) *Service {
+	build := ReadBuild()
+	s := &Service{
+		version:   build.Version,
+		releaseID: build.Revision,
+		started:   time.Now(),
+		timeout:   DefaultTimeout,
+		checkers:  checkers,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Live reports whether the service is alive, without checking its dependencies. Liveness only fails if the
+// process has to be restarted, which no dependency can cause.
+func (s *Service) Live(context.Context) *Response {
+	now := time.Now()
+	return &Response{
+		Status:      Pass,
+		Version:     s.version,
+		ReleaseID:   s.releaseID,
+		Description: "liveness of the signing service",
+		Checks: map[string][]Result{
+			"uptime": {{
+				ComponentType: "system",
+				ObservedValue: now.Sub(s.started).Seconds(),
+				ObservedUnit:  "s",
+				Status:        Pass,
+				Time:          now,
+			}},
+		},
+	}
+}
+
+// Ready checks the dependencies of the service concurrently, it is ready to serve requests unless a check
+// fails. Checks that do not complete in time fail.
+func (s *Service) Ready(ctx context.Context) *Response {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	results := make([][]Result, len(s.checkers))
+	var wg sync.WaitGroup
+	for i, checker := range s.checkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			done := make(chan []Result, 1)
+			go func() { done <- checker.Check(ctx) }()
+			select {
+			case results[i] = <-done:
+			case <-ctx.Done():
+				results[i] = []Result{{Status: Fail, Time: time.Now(), Output: "check timed out"}}
+			}
+		}()
+	}
+	wg.Wait()
+
+	response := &Response{
+		Status:      Pass,
+		Version:     s.version,
+		ReleaseID:   s.releaseID,
+		Description: "readiness of the signing service",
+		Checks:      map[string][]Result{},
+	}
+	for i, checker := range s.checkers {
+		for _, result := range results[i] {
+			response.Status = worse(response.Status, result.Status)
+		}
+		response.Checks[checker.Name()] = append(response.Checks[checker.Name()], results[i]...)
+	}
+	return response
+}
+
+// Build describes the build of the running binary.
+type Build struct {
+	// Version is the version of the main module, "devel" if it was not built from a tagged version.
+	Version string
+	// Revision is the VCS revision the binary was built from, suffixed with -dirty if it had local modifications.
+	Revision string
+	// Time is the commit time of the revision, zero if unknown.
+	Time time.Time
+}
+
+// ReadBuild reads the build information embedded in the running binary.
+func ReadBuild() Build {
+	build := Build{Version: "devel"}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return build
+	}
+	if info.Main.Version != "" && info.Main.Version != "(devel)" {
+		build.Version = info.Main.Version
+	}
+	modified := false
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			build.Revision = setting.Value
+		case "vcs.time":
+			build.Time, _ = time.Parse(time.RFC3339, setting.Value)
+		case "vcs.modified":
+			modified = setting.Value == "true"
+		}
+	}
+	if build.Revision != "" && modified {
+		build.Revision += "-dirty"
+	}
+	return build
+}
@@ -0,0 +1,174 @@
+package health_test
+
+import (
+	"context"
+	"crypto/elliptic"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/health"
+)
+
+// staticCheck returns results of the given statuses, after waiting for delay or ctx.
+type staticCheck struct {
+	name     string
+	statuses []health.Status
+	delay    time.Duration
+}
+
+func (c staticCheck) Name() string {
+	return c.name
+}
+
+func (c staticCheck) Check(ctx context.Context) []health.Result {
+	select {
+	case <-time.After(c.delay):
+	case <-ctx.Done():
+	}
+	var results []health.Result
+	for _, status := range c.statuses {
+		results = append(results, health.Result{Status: status, Time: time.Now()})
+	}
+	return results
+}
+
+// pinger fails with err.
+type pinger struct {
+	err error
+}
+
+func (p pinger) Ping(context.Context) error {
+	return p.err
+}
+
+func TestService_Ready(t *testing.T) {
+	tests := []struct {
+		name     string
+		checks   []health.Checker
+		expected health.Status
+		code     int
+	}{
+		{
+			name:     "No Checks",
+			expected: health.Pass,
+			code:     http.StatusOK,
+		},
+		{
+			name: "Warn",
+			checks: []health.Checker{
+				staticCheck{name: "a:b", statuses: []health.Status{health.Pass}},
+				staticCheck{name: "c:d", statuses: []health.Status{health.Pass, health.Warn}},
+			},
+			expected: health.Warn,
+			code:     http.StatusOK,
+		},
+		{
+			name: "Fail",
+			checks: []health.Checker{
+				staticCheck{name: "a:b", statuses: []health.Status{health.Warn}},
+				staticCheck{name: "c:d", statuses: []health.Status{health.Fail, health.Pass}},
+			},
+			expected: health.Fail,
+			code:     http.StatusServiceUnavailable,
+		},
+		{
+			name: "Timeout",
+			checks: []health.Checker{
+				staticCheck{name: "a:b", statuses: []health.Status{health.Pass}, delay: time.Hour},
+			},
+			expected: health.Fail,
+			code:     http.StatusServiceUnavailable,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			service := health.New(test.checks, health.WithTimeout(50*time.Millisecond))
+			response := service.Ready(context.Background())
+			if response.Status != test.expected {
+				t.Fatalf("expected status %s, got %s", test.expected, response.Status)
+			}
+			if code := response.HTTPStatus(); code != test.code {
+				t.Fatalf("expected HTTP status %d, got %d", test.code, code)
+			}
+			if response.Version == "" {
+				t.Fatalf("expected a version")
+			}
+			for _, check := range test.checks {
+				if len(response.Checks[check.Name()]) == 0 {
+					t.Fatalf("expected results of %s, got %v", check.Name(), response.Checks)
+				}
+			}
+		})
+	}
+}
+
+func TestService_Live(t *testing.T) {
+	// liveness does not depend on the checks of the dependencies
+	service := health.New([]health.Checker{staticCheck{name: "a:b", statuses: []health.Status{health.Fail}}})
+	response := service.Live(context.Background())
+	if response.Status != health.Pass || response.HTTPStatus() != http.StatusOK {
+		t.Fatalf("expected the service to be alive, got %v", response)
+	}
+	if len(response.Checks["uptime"]) != 1 {
+		t.Fatalf("expected the uptime, got %v", response.Checks)
+	}
+}
+
+func TestChecks(t *testing.T) {
+	keyProvider, err := health.KeyProvider(crypto.KeyParameters{RSABits: 512, RSAPSSBits: 1024, ECCCurve: elliptic.P256()})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	tests := []struct {
+		name     string
+		check    health.Checker
+		results  int
+		expected health.Status
+		output   string
+	}{
+		{name: "Storage", check: health.Storage(pinger{}), results: 1, expected: health.Pass},
+		{
+			name:     "Unreachable Storage",
+			check:    health.Storage(pinger{err: errors.New("dial tcp 10.0.0.1:5432: connection refused")}),
+			results:  1,
+			expected: health.Fail,
+			output:   "storage is unreachable",
+		},
+		{name: "Key Provider", check: keyProvider, results: 4, expected: health.Pass},
+		{name: "Clock", check: health.Clock(time.Now().Add(-time.Hour)), results: 1, expected: health.Pass},
+		{
+			name:     "Clock Before Build",
+			check:    health.Clock(time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)),
+			results:  1,
+			expected: health.Fail,
+			output:   "clock is before 2100-01-01T00:00:00Z",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			results := test.check.Check(context.Background())
+			if len(results) != test.results {
+				t.Fatalf("expected %d results, got %v", test.results, results)
+			}
+			for _, result := range results {
+				if result.Status != test.expected || result.Output != test.output {
+					t.Fatalf("expected status %s with output %q, got %s with %q", test.expected, test.output, result.Status, result.Output)
+				}
+				if result.Time.IsZero() {
+					t.Fatalf("expected the time of the result")
+				}
+			}
+		})
+	}
+}
+
+func TestEntropy(t *testing.T) {
+	// a small entropy pool of the host only warns
+	results := health.Entropy().Check(context.Background())
+	if len(results) != 1 || results[0].Status == health.Fail {
+		t.Fatalf("expected random numbers to be available, got %v", results)
+	}
+}
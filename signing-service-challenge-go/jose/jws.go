@@ -0,0 +1,192 @@
+package jose
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+)
+
+// JWS algorithms (RFC 7518, RFC 8037) of the supported device algorithms.
+const (
+	RS256 = "RS256"
+	ES384 = "ES384"
+	PS256 = "PS256"
+	EdDSA = "EdDSA"
+)
+
+// es384Size is the byte size of the P-384 curve order.
+const es384Size = 48
+
+var (
+	ErrUnsupportedAlgorithm = errors.New("unsupported JWS algorithm")
+	ErrMalformedJWS         = errors.New("malformed JWS")
+)
+
+// AlgorithmFor returns the JWS algorithm matching the signatures of the given device algorithm.
+func AlgorithmFor(algorithm types.SigningAlgorithm) (string, error) {
+	switch algorithm {
+	case types.RSA:
+		return RS256, nil
+	case types.ECC:
+		return ES384, nil
+	case types.RSAPSS:
+		return PS256, nil
+	case types.Ed25519:
+		return EdDSA, nil
+	default:
+		return "", fmt.Errorf("%w: no JWS algorithm for %s", ErrUnsupportedAlgorithm, algorithm)
+	}
+}
+
+// Header is the protected JOSE header of signatures produced by a signature device.
+type Header struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+	Counter   uint32 `json:"counter"`
+	// B64 is false for the unencoded payload option of RFC 7797.
+	B64      *bool    `json:"b64,omitempty"`
+	Critical []string `json:"crit,omitempty"`
+}
+
+// JWS is a JSON Web Signature (RFC 7515) awaiting its signature.
+type JWS struct {
+	header   Header
+	encoded  []byte
+	payload  []byte
+	detached bool
+}
+
+// New prepares a JWS over payload. A detached JWS uses the unencoded payload option of RFC 7797
+// and omits the payload from its serialization, the receiver already holds it.
+func New(header Header, payload []byte, detached bool) (*JWS, error) {
+	if detached {
+		b64 := false
+		header.B64 = &b64
+		header.Critical = []string{"b64"}
+	}
+	encoded, err := json.Marshal(header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode JWS header: %w", err)
+	}
+	return &JWS{
+		header:   header,
+		encoded:  []byte(base64.RawURLEncoding.EncodeToString(encoded)),
+		payload:  payload,
+		detached: detached,
+	}, nil
+}
+
+// SigningInput returns the data that has to be signed (RFC 7515, section 5.1).
+func (j *JWS) SigningInput() []byte {
+	return signingInput(j.encoded, j.payload, j.detached)
+}
+
+// Seal returns the compact serialization of the JWS with the given device signature over the signing input.
+func (j *JWS) Seal(signature []byte) ([]byte, error) {
+	signature, err := encodeSignature(j.header.Algorithm, signature)
+	if err != nil {
+		return nil, err
+	}
+	var serialized bytes.Buffer
+	serialized.Write(j.encoded)
+	serialized.WriteByte('.')
+	if !j.detached {
+		serialized.WriteString(base64.RawURLEncoding.EncodeToString(j.payload))
+	}
+	serialized.WriteByte('.')
+	serialized.WriteString(base64.RawURLEncoding.EncodeToString(signature))
+	return serialized.Bytes(), nil
+}
+
+// Verifier checks a signature in the format produced by the device signers.
+type Verifier interface {
+	Verify(data []byte, signature []byte) error
+}
+
+// Verify checks a compact serialized JWS with the verifier and returns its header and payload.
+// The payload must be passed for detached signatures and is ignored otherwise.
+func Verify(serialized []byte, detachedPayload []byte, verifier Verifier) (*Header, []byte, error) {
+	parts := bytes.Split(serialized, []byte{'.'})
+	if len(parts) != 3 {
+		return nil, nil, fmt.Errorf("%w: expected three parts, got %d", ErrMalformedJWS, len(parts))
+	}
+	rawHeader, err := base64.RawURLEncoding.DecodeString(string(parts[0]))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: header is not base64url encoded", ErrMalformedJWS)
+	}
+	var header Header
+	if err = json.Unmarshal(rawHeader, &header); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrMalformedJWS, err)
+	}
+	for _, critical := range header.Critical {
+		if critical != "b64" {
+			return nil, nil, fmt.Errorf("%w: unsupported critical header %q", ErrMalformedJWS, critical)
+		}
+	}
+	detached := header.B64 != nil && !*header.B64
+	if detached != slices.Contains(header.Critical, "b64") {
+		return nil, nil, fmt.Errorf("%w: b64 header must be marked critical", ErrMalformedJWS)
+	}
+
+	payload := detachedPayload
+	if len(parts[1]) > 0 {
+		if detached {
+			payload = parts[1]
+		} else if payload, err = base64.RawURLEncoding.DecodeString(string(parts[1])); err != nil {
+			return nil, nil, fmt.Errorf("%w: payload is not base64url encoded", ErrMalformedJWS)
+		}
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(string(parts[2]))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: signature is not base64url encoded", ErrMalformedJWS)
+	}
+	if signature, err = decodeSignature(header.Algorithm, signature); err != nil {
+		return nil, nil, err
+	}
+	if err = verifier.Verify(signingInput(parts[0], payload, detached), signature); err != nil {
+		return nil, nil, err
+	}
+	return &header, payload, nil
+}
+
+func signingInput(encodedHeader []byte, payload []byte, detached bool) []byte {
+	input := slices.Clone(encodedHeader)
+	input = append(input, '.')
+	if detached {
+		return append(input, payload...)
+	}
+	return append(input, base64.RawURLEncoding.EncodeToString(payload)...)
+}
+
+// encodeSignature converts a device signature into its JWS representation.
+func encodeSignature(algorithm string, signature []byte) ([]byte, error) {
+	switch algorithm {
+	case ES384:
+		return crypto.ECDSASignatureToRaw(signature, es384Size)
+	case RS256, PS256, EdDSA:
+		return signature, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, algorithm)
+	}
+}
+
+// decodeSignature converts a JWS signature into the representation the device signers verify.
+func decodeSignature(algorithm string, signature []byte) ([]byte, error) {
+	switch algorithm {
+	case ES384:
+		if len(signature) != 2*es384Size {
+			return nil, fmt.Errorf("%w: invalid ES384 signature length", ErrMalformedJWS)
+		}
+		return crypto.ECDSASignatureFromRaw(signature)
+	case RS256, PS256, EdDSA:
+		return signature, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, algorithm)
+	}
+}
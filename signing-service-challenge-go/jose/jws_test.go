@@ -0,0 +1,77 @@
+package jose
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+)
+
+func TestJWS(t *testing.T) {
+	payload := []byte("0_test data_dmFsaWQtaWQ=")
+	for _, algorithm := range []types.SigningAlgorithm{types.RSA, types.ECC, types.RSAPSS, types.Ed25519} {
+		for _, detached := range []bool{false, true} {
+			name := string(algorithm)
+			if detached {
+				name += " detached"
+			}
+			t.Run(name, func(t *testing.T) {
+				_, privatePem, err := crypto.GenerateNewPair(algorithm)
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				signer, err := crypto.NewSigner(algorithm, privatePem)
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				alg, err := AlgorithmFor(algorithm)
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				jws, err := New(Header{Algorithm: alg, KeyID: "device", Counter: 7}, payload, detached)
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				signature, err := signer.Sign(jws.SigningInput())
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				serialized, err := jws.Seal(signature)
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				if parts := bytes.Split(serialized, []byte{'.'}); len(parts) != 3 || (len(parts[1]) == 0) != detached {
+					t.Fatalf("unexpected serialization %s", serialized)
+				}
+
+				var detachedPayload []byte
+				if detached {
+					detachedPayload = payload
+				}
+				header, verified, err := Verify(serialized, detachedPayload, signer)
+				if err != nil {
+					t.Fatalf("expected valid JWS, got %v", err)
+				}
+				if header.Algorithm != alg || header.KeyID != "device" || header.Counter != 7 {
+					t.Fatalf("unexpected header %+v", header)
+				}
+				if !bytes.Equal(verified, payload) {
+					t.Fatalf("expected payload %q, got %q", payload, verified)
+				}
+				if detached {
+					if _, _, err = Verify(serialized, []byte("tampered"), signer); err == nil {
+						t.Fatal("expected tampered payload to fail verification")
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestAlgorithmFor_Unknown(t *testing.T) {
+	if _, err := AlgorithmFor("Unknown"); !errors.Is(err, ErrUnsupportedAlgorithm) {
+		t.Fatalf("expected %v, got %v", ErrUnsupportedAlgorithm, err)
+	}
+}
@@ -0,0 +1,94 @@
+// Package logging sets up structured logging with log/slog. Every record passes a redaction layer, which
+// keeps private keys and the data being signed out of the logs, and carries the attributes added to its context.
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+const (
+	// FormatText writes records as key=value pairs.
+	FormatText = "text"
+	// FormatJSON writes records as JSON objects, one per line.
+	FormatJSON = "json"
+)
+
+// ErrUnknownFormat indicates a log format that is neither text nor json.
+var ErrUnknownFormat = errors.New("unknown log format")
+
+// New creates a logger writing records in the given format to w, starting at the given level.
+func New(w io.Writer, format string, level slog.Level) (*slog.Logger, error) {
+	options := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case FormatText:
+		handler = slog.NewTextHandler(w, options)
+	case FormatJSON:
+		handler = slog.NewJSONHandler(w, options)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownFormat, format)
+	}
+	return slog.New(contextHandler{redactHandler{handler}}), nil
+}
+
+// ParseLevel parses a log level, debug, info, warn or error.
+func ParseLevel(level string) (slog.Level, error) {
+	var parsed slog.Level
+	if err := parsed.UnmarshalText([]byte(level)); err != nil {
+		return 0, fmt.Errorf("unknown log level: %s", level)
+	}
+	return parsed, nil
+}
+
+// attributes are the attributes of a context, which the code handling a request adds to as it learns
+// more about it, e.g. the device it signs with.
+type attributes struct {
+	lock  sync.Mutex
+	attrs []slog.Attr
+}
+
+type attributesKey struct{}
+
+// NewContext returns a context carrying the given attributes, which are added to every record logged with it.
+// Attributes added with Add to the returned context or its children are shared by all of them.
+func NewContext(ctx context.Context, attrs ...slog.Attr) context.Context {
+	return context.WithValue(ctx, attributesKey{}, &attributes{attrs: attrs})
+}
+
+// Add adds attributes to the records logged with a context returned by NewContext or its children.
+// It does nothing for other contexts.
+func Add(ctx context.Context, attrs ...slog.Attr) {
+	if a, ok := ctx.Value(attributesKey{}).(*attributes); ok {
+		a.lock.Lock()
+		defer a.lock.Unlock()
+		a.attrs = append(a.attrs, attrs...)
+	}
+}
+
+// contextHandler adds the attributes of the context to every record.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if a, ok := ctx.Value(attributesKey{}).(*attributes); ok {
+		a.lock.Lock()
+		record.AddAttrs(a.attrs...)
+		a.lock.Unlock()
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,129 @@
+package logging_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/logging"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+)
+
+// newLogger returns a JSON logger at debug level and the buffer it writes to.
+func newLogger(t *testing.T) (*slog.Logger, *bytes.Buffer) {
+	t.Helper()
+	var buffer bytes.Buffer
+	logger, err := logging.New(&buffer, logging.FormatJSON, slog.LevelDebug)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	return logger, &buffer
+}
+
+// decode decodes the single record in the buffer.
+func decode(t *testing.T, buffer *bytes.Buffer) map[string]any {
+	t.Helper()
+	record := map[string]any{}
+	if err := json.Unmarshal(buffer.Bytes(), &record); err != nil {
+		t.Fatalf("expected a JSON record, got %s", buffer)
+	}
+	return record
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		format string
+		err    error
+	}{
+		{format: "text"},
+		{format: "JSON"},
+		{format: "xml", err: logging.ErrUnknownFormat},
+	}
+	for _, test := range tests {
+		t.Run(test.format, func(t *testing.T) {
+			if _, err := logging.New(&bytes.Buffer{}, test.format, slog.LevelInfo); !errors.Is(err, test.err) {
+				t.Fatalf("expected error %v, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestContext(t *testing.T) {
+	logger, buffer := newLogger(t)
+	ctx := logging.NewContext(context.Background(), slog.String("request_id", "abc"))
+	// attributes added later, e.g. by a handler, reach records logged with the parent context
+	logging.Add(context.WithValue(ctx, struct{}{}, nil), slog.String("device_id", "d1"), slog.Int("counter", 7))
+	logging.Add(context.Background(), slog.String("ignored", "x"))
+
+	logger.InfoContext(ctx, "Request")
+	record := decode(t, buffer)
+	if record["request_id"] != "abc" || record["device_id"] != "d1" || record["counter"] != float64(7) {
+		t.Fatalf("expected the attributes of the context, got %v", record)
+	}
+}
+
+func TestRedaction(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	privatePEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	device := &types.SignatureDevice{ID: "d1", Algorithm: types.ECC, Counter: 2, PkPem: privatePEM}
+
+	tests := []struct {
+		name string
+		attr slog.Attr
+		// expected is the logged value as JSON, with sorted keys
+		expected string
+	}{
+		{name: "Data To Be Signed", attr: slog.String("data_to_be_signed", "receipt 42"), expected: `"[REDACTED]"`},
+		{name: "Key Name", attr: slog.Any("PkPem", []byte("anything")), expected: `"[REDACTED]"`},
+		{name: "Header", attr: slog.String("X-API-Key", "sk_1.secret"), expected: `"[REDACTED]"`},
+		{name: "Private Key", attr: slog.Any("key", key), expected: `"[REDACTED]"`},
+		{name: "PEM Bytes", attr: slog.Any("value", privatePEM), expected: `"[REDACTED]"`},
+		{name: "PEM In Error", attr: slog.Any("error", fmt.Errorf("invalid key %s", privatePEM)), expected: `"invalid key [REDACTED]\n"`},
+		{name: "Struct", attr: slog.Any("request", struct{ DeviceID, Data string }{"d1", "receipt 42"}), expected: `"[REDACTED]"`},
+		{name: "Device", attr: slog.Any("device", device), expected: `{"algorithm":"ECC","counter":2,"id":"d1","organization_id":"default"}`},
+		{name: "Group", attr: slog.Group("request", slog.String("device_id", "d1"), slog.String("data", "receipt 42")), expected: `{"data":"[REDACTED]","device_id":"d1"}`},
+		{name: "Harmless", attr: slog.String("device_id", "d1"), expected: `"d1"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger, buffer := newLogger(t)
+			logger.Info("Signing", test.attr)
+			if strings.Contains(buffer.String(), "PRIVATE KEY") || strings.Contains(buffer.String(), "receipt") {
+				t.Fatalf("expected sensitive values to be redacted, got %s", buffer)
+			}
+			logged, err := json.Marshal(decode(t, buffer)[test.attr.Key])
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if string(logged) != test.expected {
+				t.Fatalf("expected %s, got %s", test.expected, logged)
+			}
+		})
+	}
+
+	t.Run("Logger Attributes", func(t *testing.T) {
+		logger, buffer := newLogger(t)
+		logger.With(slog.String("token", "sk_1.secret")).Info("Authenticated " + string(privatePEM))
+		record := decode(t, buffer)
+		if record["token"] != logging.Redacted || record["msg"] != "Authenticated [REDACTED]\n" {
+			t.Fatalf("expected the attributes and message to be redacted, got %v", record)
+		}
+	})
+}
@@ -0,0 +1,122 @@
+package logging
+
+import (
+	"context"
+	"crypto"
+	"log/slog"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces the values that must not be logged.
+const Redacted = "[REDACTED]"
+
+// sensitiveKeys are the normalized keys of attributes and struct fields whose values are never logged:
+// private keys, the data being signed, which ends up in the signed data, and credentials.
+var sensitiveKeys = map[string]bool{
+	"privatekey":     true,
+	"pkpem":          true,
+	"datatobesigned": true,
+	"data":           true,
+	"signeddata":     true,
+	"document":       true,
+	"token":          true,
+	"password":       true,
+	"secret":         true,
+	"authorization":  true,
+	"xapikey":        true,
+}
+
+// privateKeyPEM matches PEM encoded private keys, e.g. in error messages.
+var privateKeyPEM = regexp.MustCompile(`-----BEGIN [A-Z0-9 ]*PRIVATE KEY-----[\s\S]*?(-----END [A-Z0-9 ]*PRIVATE KEY-----|$)`)
+
+// sensitive reports whether the values of an attribute or struct field with the given key are never logged.
+func sensitive(key string) bool {
+	return sensitiveKeys[strings.NewReplacer("_", "", "-", "", ".", "").Replace(strings.ToLower(key))]
+}
+
+// redactHandler removes sensitive values from records before they reach the handler it wraps.
+type redactHandler struct {
+	slog.Handler
+}
+
+func (h redactHandler) Handle(ctx context.Context, record slog.Record) error {
+	redacted := slog.NewRecord(record.Time, record.Level, redactString(record.Message), record.PC)
+	record.Attrs(func(attr slog.Attr) bool {
+		redacted.AddAttrs(redact(attr))
+		return true
+	})
+	return h.Handler.Handle(ctx, redacted)
+}
+
+func (h redactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, attr := range attrs {
+		redacted[i] = redact(attr)
+	}
+	return redactHandler{h.Handler.WithAttrs(redacted)}
+}
+
+func (h redactHandler) WithGroup(name string) slog.Handler {
+	return redactHandler{h.Handler.WithGroup(name)}
+}
+
+// redact returns the attribute with its value redacted if it is sensitive, by its key or by its type.
+func redact(attr slog.Attr) slog.Attr {
+	if sensitive(attr.Key) {
+		return slog.String(attr.Key, Redacted)
+	}
+	value := attr.Value.Resolve()
+	switch value.Kind() {
+	case slog.KindString:
+		return slog.String(attr.Key, redactString(value.String()))
+	case slog.KindGroup:
+		group := value.Group()
+		redacted := make([]any, len(group))
+		for i, member := range group {
+			redacted[i] = redact(member)
+		}
+		return slog.Group(attr.Key, redacted...)
+	case slog.KindAny:
+		if redactAny(value.Any()) {
+			return slog.String(attr.Key, Redacted)
+		}
+		if err, ok := value.Any().(error); ok && privateKeyPEM.MatchString(err.Error()) {
+			return slog.String(attr.Key, redactString(err.Error()))
+		}
+	}
+	return slog.Attr{Key: attr.Key, Value: value}
+}
+
+// redactString removes PEM encoded private keys from s.
+func redactString(s string) string {
+	if !strings.Contains(s, "PRIVATE KEY") {
+		return s
+	}
+	return privateKeyPEM.ReplaceAllString(s, Redacted)
+}
+
+// redactAny reports whether a value must not be logged at all: private keys, byte slices holding a PEM
+// encoded private key, and structs with a sensitive field, which would otherwise be printed with all fields.
+func redactAny(v any) bool {
+	switch v := v.(type) {
+	case crypto.Signer, crypto.Decrypter:
+		return true
+	case []byte:
+		return privateKeyPEM.Match(v)
+	}
+	t := reflect.TypeOf(v)
+	for t != nil && (t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return false
+	}
+	for i := range t.NumField() {
+		if sensitive(t.Field(i).Name) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,25 +1,309 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/backup"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/ca"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/config"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/export"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/health"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/metrics"
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
-	"log"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/ratelimit"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/tlsconfig"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/tracing"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/tsa"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+	_ "github.com/jackc/pgx/v5/stdlib"
 
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/api"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/auth"
 )
 
-const (
-	ListenAddress = ":8080"
-	// TODO: add further configuration parameters here ...
-)
+// usage documents the commands after the flags listed by the configuration.
+const usage = `
+Commands:
+  config print [flags]  print the effective configuration, without secrets
+`
 
 func main() {
-	db := persistence.NewInMemoryDatabase()
-	deviceService := domain.NewDeviceService(db)
-	server := api.NewServer(ListenAddress, deviceService)
+	args := os.Args[1:]
+	if len(args) >= 2 && args[0] == "config" && args[1] == "print" {
+		os.Exit(printConfig(args[2:]))
+	}
+	cfg, err := loadConfig(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fatal("Invalid configuration", err)
+	}
+	logger, err := cfg.Logger(os.Stderr)
+	if err != nil {
+		fatal("Invalid configuration", err)
+	}
+	// also routes the output of the log package through the redacting logger
+	slog.SetDefault(logger)
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.TracingOptions())
+	if err != nil {
+		fatal("Could not set up tracing", err)
+	}
+
+	db, err := newDatabase(cfg.Storage.DatabaseURL, cfg.Storage.DataDirectory)
+	if err != nil {
+		fatal("Could not open the database", err)
+	}
+	keyParams, err := cfg.KeyParameters()
+	if err != nil {
+		fatal("Invalid configuration", err)
+	}
+	opts := []domain.Option{domain.WithKeyParameters(keyParams)}
+	// devices is the database of the device services, which encrypts the private keys of devices
+	// and reports its errors to the metrics and traces
+	devices := db
+	if cfg.Storage.KeyEncryptionKeyFile != "" {
+		keys, err := persistence.LoadKeyEncryptionKeyFile(cfg.Storage.KeyEncryptionKeyFile)
+		if err != nil {
+			fatal("Could not load the key-encryption key", err)
+		}
+		encrypted, err := persistence.EncryptStoredKeys(db, keys)
+		if err != nil {
+			fatal("Could not encrypt the keys of devices", err)
+		}
+		if encrypted > 0 {
+			slog.Info("Encrypted device keys stored before encryption was enabled", "devices", encrypted)
+		}
+		devices = persistence.EncryptKeys(db, keys)
+	} else {
+		slog.Warn("No key-encryption key configured, the private keys of devices are stored unencrypted")
+	}
+	var observer *metrics.Metrics
+	if cfg.Metrics.Enabled {
+		metricsOpts := []metrics.Option{metrics.WithDevices(db.GetAllSignatureDevices)}
+		if cfg.Metrics.DeviceCounters {
+			metricsOpts = append(metricsOpts, metrics.WithDeviceCounters())
+		}
+		observer = metrics.New(metricsOpts...)
+		devices = persistence.Instrument(devices, observer)
+		opts = append(opts, domain.WithObserver(observer))
+	}
+	devices = persistence.Trace(devices)
+	if cfg.Signing.TimestampInSignedData {
+		opts = append(opts, domain.WithTimestampInSignedData())
+	}
+	timestamper, err := newTimestamper(cfg.Signing)
+	if err != nil {
+		fatal("Could not set up the time stamping authority", err)
+	}
+	if timestamper != nil {
+		opts = append(opts, domain.WithTimestamper(timestamper), domain.WithTimestampTimeout(cfg.Signing.TimestampTimeout))
+	}
+	authority, err := newCertificateAuthority(cfg.CA.KeyFile, cfg.CA.CertificateFile)
+	if err != nil {
+		fatal("Could not set up the certificate authority", err)
+	}
+	opts = append(opts, domain.WithCertificateIssuer(authority))
+	deviceService := domain.NewDeviceService(devices, opts...)
+	serverOpts := []api.Option{
+		api.WithExportService(export.NewService(devices)),
+		api.WithMaxDocumentSize(int64(cfg.Server.MaxDocumentSize)),
+		api.WithMaxBackupSize(int64(cfg.Server.MaxBackupSize)),
+		api.WithShutdownTimeouts(cfg.Server.DrainTimeout, cfg.Server.ShutdownTimeout),
+	}
+	if observer != nil {
+		serverOpts = append(serverOpts, api.WithMetrics(observer))
+	}
+	healthChecks, err := newHealthChecks(db, keyParams)
+	if err != nil {
+		fatal("Could not set up the readiness checks", err)
+	}
+	serverOpts = append(serverOpts, api.WithHealthChecks(healthChecks...))
+	if cfg.RateLimiting() {
+		serverOpts = append(serverOpts, api.WithRateLimiter(ratelimit.New(ratelimit.NewMemoryBackend(), cfg.RateLimitOptions()...)))
+	}
+	if cfg.Auth.Enabled {
+		authService, err := newAuthService(db, cfg.AdminKeyHash())
+		if err != nil {
+			fatal("Could not set up API key authentication", err)
+		}
+		organizations, ok := db.(domain.OrganizationStore)
+		if !ok {
+			fatal("Could not set up organizations", errors.New("the database does not support them"))
+		}
+		serverOpts = append(serverOpts, api.WithAuthService(authService),
+			api.WithOrganizations(domain.NewOrganizationService(organizations), func(organization *types.Organization) (api.DeviceService, api.ExportService) {
+				return deviceService.ForOrganization(organization), export.NewService(domain.OrganizationDatabase(devices, organization.ID))
+			}))
+	} else {
+		slog.Warn("API key authentication is disabled, every caller may use every endpoint")
+	}
+	if cfg.Backup.KeyFile != "" {
+		keys, err := backup.LoadKeyFile(cfg.Backup.KeyFile)
+		if err != nil {
+			fatal("Could not load the backup key", err)
+		}
+		serverOpts = append(serverOpts, api.WithBackupService(backup.NewService(devices, keys)))
+	}
+	if cfg.TLS.CertificateFile != "" {
+		tlsConfig, err := tlsconfig.New(cfg.TLSOptions())
+		if err != nil {
+			fatal("Could not set up TLS", err)
+		}
+		serverOpts = append(serverOpts, api.WithTLS(tlsConfig))
+	}
+	server := api.NewServer(cfg.Server.ListenAddress, deviceService, serverOpts...)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	slog.Info("Listening", "address", cfg.Server.ListenAddress)
+	err = server.Run(ctx)
+	closeDatabase(db)
+	flushTraces(shutdownTracing)
+	if err != nil {
+		fatal("Server failed", err)
+	}
+	slog.Info("Shut down")
+}
+
+// flushTraces exports the spans that are not exported yet, giving up after a few seconds.
+func flushTraces(shutdown func(context.Context) error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := shutdown(ctx); err != nil {
+		slog.Warn("Could not flush traces", "error", err)
+	}
+}
+
+// fatal logs an error that prevents the service from running and exits.
+func fatal(message string, err error) {
+	slog.Error(message, "error", err)
+	os.Exit(1)
+}
+
+// closeDatabase flushes a durable database to disk and releases it. A file database is compacted
+// into a snapshot, so that the next start does not need to replay its log.
+func closeDatabase(db domain.Database) {
+	if snapshotter, ok := db.(interface{ Snapshot() error }); ok {
+		if err := snapshotter.Snapshot(); err != nil {
+			slog.Error("Could not take a snapshot of the database", "error", err)
+		}
+	}
+	if closer, ok := db.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			slog.Error("Could not close the database", "error", err)
+		}
+	}
+}
+
+// loadConfig loads the configuration from the command line arguments, the environment and the configuration file.
+func loadConfig(args []string) (*config.Config, error) {
+	cfg, err := config.Load("signing-service", args, os.LookupEnv, os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		fmt.Fprint(os.Stderr, usage)
+	}
+	return cfg, err
+}
+
+// printConfig prints the effective configuration of the given arguments and returns the exit code.
+func printConfig(args []string) int {
+	cfg, err := loadConfig(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid configuration:", err)
+		return 2
+	}
+	if err = cfg.Redacted().WriteYAML(os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// newDatabase opens the configured PostgreSQL or file database, or an in-memory database if none is configured.
+func newDatabase(url string, dir string) (domain.Database, error) {
+	switch {
+	case url != "":
+		db, err := sql.Open("pgx", url)
+		if err != nil {
+			return nil, err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		return persistence.NewSQLDatabase(ctx, db, persistence.PostgreSQL)
+	case dir != "":
+		return persistence.OpenFileDatabase(dir)
+	default:
+		slog.Warn("No database configured, devices are kept in memory only")
+		return persistence.NewInMemoryDatabase(), nil
+	}
+}
+
+// newHealthChecks creates the checks of the readiness probe: the database if it can be pinged, signing with
+// canary keys of the configured sizes, entropy and the clock, which must not be before the build.
+func newHealthChecks(db domain.Database, keyParams crypto.KeyParameters) ([]health.Checker, error) {
+	keyProvider, err := health.KeyProvider(keyParams)
+	if err != nil {
+		return nil, err
+	}
+	checks := []health.Checker{keyProvider, health.Entropy(), health.Clock(health.ReadBuild().Time)}
+	if pinger, ok := db.(health.Pinger); ok {
+		checks = append(checks, health.Storage(pinger))
+	}
+	return checks, nil
+}
+
+// newAuthService creates the service authenticating API keys, which are stored in the device database.
+func newAuthService(db domain.Database, adminKeyHash []byte) (*auth.Service, error) {
+	store, ok := db.(auth.KeyStore)
+	if !ok {
+		return nil, errors.New("the database does not support API keys")
+	}
+	if adminKeyHash == nil {
+		return auth.NewService(store), nil
+	}
+	return auth.NewService(store, auth.WithAdminKeyHash(adminKeyHash)), nil
+}
+
+// newTimestamper creates the Timestamper for the configured authority, nil if timestamping is disabled.
+func newTimestamper(signing config.Signing) (domain.Timestamper, error) {
+	switch signing.TimestampAuthority {
+	case "":
+		return nil, nil
+	case "local":
+		if signing.TimestampKeyFile != "" {
+			return tsa.LoadFiles(signing.TimestampKeyFile, signing.TimestampCertificateFile)
+		}
+		slog.Warn("No TSA key configured, timestamp tokens are issued by an ephemeral TSA that is only meant for tests")
+		return tsa.GenerateAuthority("Signing Service Local TSA")
+	default:
+		roots, err := tsa.LoadRoots(signing.TimestampRootsFile)
+		if err != nil {
+			return nil, err
+		}
+		return tsa.NewClient(signing.TimestampAuthority, roots), nil
+	}
+}
 
-	log.Printf("Listening on %s\n", ListenAddress)
-	if err := server.Run(); err != nil {
-		log.Fatal("Could not start server on ", ListenAddress)
+// newCertificateAuthority loads the configured CA or generates an ephemeral one if none is configured.
+func newCertificateAuthority(keyFile string, certificateFile string) (*ca.Authority, error) {
+	if keyFile == "" && certificateFile == "" {
+		slog.Warn("No CA configured, device certificates are issued by an ephemeral CA")
+		return ca.Generate("Signing Service Local CA")
 	}
+	return ca.LoadFiles(keyFile, certificateFile)
 }
@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+)
+
+const (
+	// stateUnused is the state of devices that have not signed yet.
+	stateUnused = "unused"
+	// stateActive is the state of devices that have signed.
+	stateActive = "active"
+)
+
+// algorithms are the signing algorithms of devices, which are reported even without devices.
+var algorithms = []types.SigningAlgorithm{types.ECC, types.RSA, types.RSAPSS, types.Ed25519}
+
+var (
+	devicesDesc = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "devices"),
+		"Number of signature devices by algorithm and state, unused or active once they have signed.",
+		[]string{"algorithm", "state"}, nil)
+	deviceCounterDesc = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "device_signature_counter"),
+		"Signature counter of a device, the number of signatures it has made.",
+		[]string{"device_id", "algorithm", "organization_id"}, nil)
+)
+
+// deviceCollector reads the devices on every scrape, so that the gauges reflect all instances sharing the database.
+type deviceCollector struct {
+	devices  func() ([]*types.SignatureDevice, error)
+	counters bool
+}
+
+func (c *deviceCollector) Describe(descs chan<- *prometheus.Desc) {
+	descs <- devicesDesc
+	if c.counters {
+		descs <- deviceCounterDesc
+	}
+}
+
+func (c *deviceCollector) Collect(metrics chan<- prometheus.Metric) {
+	type key struct {
+		algorithm types.SigningAlgorithm
+		state     string
+	}
+	devices, err := c.devices()
+	if err != nil {
+		// fails the scrape rather than reporting no devices
+		metrics <- prometheus.NewInvalidMetric(devicesDesc, err)
+		return
+	}
+	counts := make(map[key]int)
+	// every algorithm and state is reported, also without devices, so that the series do not disappear
+	for _, algorithm := range algorithms {
+		counts[key{algorithm, stateUnused}] = 0
+		counts[key{algorithm, stateActive}] = 0
+	}
+	for _, device := range devices {
+		state := stateUnused
+		if device.Counter > 0 {
+			state = stateActive
+		}
+		counts[key{device.Algorithm, state}]++
+		if c.counters {
+			metrics <- prometheus.MustNewConstMetric(deviceCounterDesc, prometheus.GaugeValue, float64(device.Counter),
+				device.ID, string(device.Algorithm), device.Organization())
+		}
+	}
+	for k, count := range counts {
+		metrics <- prometheus.MustNewConstMetric(devicesDesc, prometheus.GaugeValue, float64(count), string(k.algorithm), k.state)
+	}
+}
@@ -0,0 +1,131 @@
+// Package metrics exports the metrics of the signing service in the Prometheus format.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+)
+
+// namespace prefixes the names of all metrics.
+const namespace = "signing"
+
+// latencyBuckets are the histogram buckets of request and signing latencies in seconds, from 1ms, which
+// ECDSA signatures take, to 10s, which RSA key generations and timestamps by a remote authority may take.
+var latencyBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Option configures optional metrics.
+type Option func(*Metrics)
+
+// WithDevices exports the number of devices by algorithm and state, read from devices on every scrape.
+func WithDevices(devices func() ([]*types.SignatureDevice, error)) Option {
+	return func(m *Metrics) {
+		m.devices = devices
+	}
+}
+
+// WithDeviceCounters additionally exports the signature counter of every device. It adds a time series per
+// device, so it is only suitable for a moderate number of devices. It requires WithDevices.
+func WithDeviceCounters() Option {
+	return func(m *Metrics) {
+		m.deviceCounters = true
+	}
+}
+
+// Metrics collects the metrics of the API, the domain and the persistence of the service. It implements
+// domain.Observer and persistence.ErrorObserver.
+type Metrics struct {
+	registry        *prometheus.Registry
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	signing         *prometheus.HistogramVec
+	keyGeneration   *prometheus.HistogramVec
+	storageErrors   *prometheus.CounterVec
+	devices         func() ([]*types.SignatureDevice, error)
+	deviceCounters  bool
+}
+
+// New creates the metrics, registered together with the Go runtime and process metrics.
+func New(opts ...Option) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "Number of HTTP requests by route, method and status code.",
+		}, []string{"route", "method", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Latency of HTTP requests by route, method and status code.",
+			Buckets:   latencyBuckets,
+		}, []string{"route", "method", "status"}),
+		signing: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "signature_duration_seconds",
+			Help:      "Latency of signatures by algorithm, format and result, including waiting for the device and storing the signature.",
+			Buckets:   latencyBuckets,
+		}, []string{"algorithm", "format", "result"}),
+		keyGeneration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "key_generation_duration_seconds",
+			Help:      "Latency of device key generations by algorithm and result.",
+			Buckets:   latencyBuckets,
+		}, []string{"algorithm", "result"}),
+		storageErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "storage_errors_total",
+			Help:      "Number of failed storage operations by operation.",
+		}, []string{"operation"}),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests, m.requestDuration, m.signing, m.keyGeneration, m.storageErrors,
+	)
+	if m.devices != nil {
+		m.registry.MustRegister(&deviceCollector{devices: m.devices, counters: m.deviceCounters})
+	}
+	return m
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// ObserveRequest records an HTTP request to the route with the given pattern.
+func (m *Metrics) ObserveRequest(route string, method string, status int, duration time.Duration) {
+	code := strconv.Itoa(status)
+	m.requests.WithLabelValues(route, method, code).Inc()
+	m.requestDuration.WithLabelValues(route, method, code).Observe(duration.Seconds())
+}
+
+func (m *Metrics) ObserveSigning(algorithm types.SigningAlgorithm, format types.SignatureFormat, duration time.Duration, err error) {
+	m.signing.WithLabelValues(string(algorithm), string(format), result(err)).Observe(duration.Seconds())
+}
+
+func (m *Metrics) ObserveKeyGeneration(algorithm types.SigningAlgorithm, duration time.Duration, err error) {
+	m.keyGeneration.WithLabelValues(string(algorithm), result(err)).Observe(duration.Seconds())
+}
+
+func (m *Metrics) ObserveStorageError(operation string, _ error) {
+	m.storageErrors.WithLabelValues(operation).Inc()
+}
+
+// result is the result label of an operation that failed with err.
+func result(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
@@ -0,0 +1,94 @@
+package metrics_test
+
+import (
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/metrics"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+)
+
+// scrape returns the metrics served by the handler of m.
+func scrape(t *testing.T, m *metrics.Metrics) string {
+	t.Helper()
+	response := httptest.NewRecorder()
+	m.Handler().ServeHTTP(response, httptest.NewRequest("GET", "/metrics", nil))
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	return string(body)
+}
+
+func TestMetrics(t *testing.T) {
+	devices := []*types.SignatureDevice{
+		{ID: "a", Algorithm: types.ECC, Counter: 3, OrganizationID: "store"},
+		{ID: "b", Algorithm: types.ECC},
+		{ID: "c", Algorithm: types.RSA, Counter: 1},
+	}
+	tests := []struct {
+		name     string
+		opts     []metrics.Option
+		expected []string
+		absent   []string
+	}{
+		{
+			name: "Default",
+			expected: []string{
+				`signing_http_requests_total{method="POST",route="/api/v0/sign-transaction",status="201"} 1`,
+				`signing_http_request_duration_seconds_count{method="POST",route="/api/v0/sign-transaction",status="201"} 1`,
+				`signing_signature_duration_seconds_count{algorithm="ECC",format="raw",result="success"} 1`,
+				`signing_signature_duration_seconds_count{algorithm="RSA",format="cms",result="error"} 1`,
+				`signing_key_generation_duration_seconds_bucket{algorithm="RSA",result="success",le="0.5"} 1`,
+				`signing_storage_errors_total{operation="commit"} 1`,
+				`go_goroutines`,
+			},
+			absent: []string{"signing_devices", "signing_device_signature_counter"},
+		},
+		{
+			name: "Devices",
+			opts: []metrics.Option{metrics.WithDevices(func() ([]*types.SignatureDevice, error) { return devices, nil })},
+			expected: []string{
+				`signing_devices{algorithm="ECC",state="active"} 1`,
+				`signing_devices{algorithm="ECC",state="unused"} 1`,
+				`signing_devices{algorithm="RSA",state="active"} 1`,
+				`signing_devices{algorithm="ED25519",state="unused"} 0`,
+			},
+			absent: []string{"signing_device_signature_counter"},
+		},
+		{
+			name: "Device Counters",
+			opts: []metrics.Option{metrics.WithDevices(func() ([]*types.SignatureDevice, error) { return devices, nil }), metrics.WithDeviceCounters()},
+			expected: []string{
+				`signing_device_signature_counter{algorithm="ECC",device_id="a",organization_id="store"} 3`,
+				`signing_device_signature_counter{algorithm="ECC",device_id="b",organization_id="default"} 0`,
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := metrics.New(test.opts...)
+			m.ObserveRequest("/api/v0/sign-transaction", "POST", 201, 5*time.Millisecond)
+			m.ObserveSigning(types.ECC, types.FormatRaw, time.Millisecond, nil)
+			m.ObserveSigning(types.RSA, types.FormatCMS, time.Millisecond, errors.New("failed"))
+			m.ObserveKeyGeneration(types.RSA, 300*time.Millisecond, nil)
+			m.ObserveStorageError("commit", errors.New("disk full"))
+
+			scraped := scrape(t, m)
+			for _, line := range test.expected {
+				if !strings.Contains(scraped, line) {
+					t.Errorf("expected %s in the metrics", line)
+				}
+			}
+			for _, name := range test.absent {
+				if strings.Contains(scraped, name) {
+					t.Errorf("expected no %s in the metrics", name)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package persistence
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+)
+
+// chains holds the signature chains of devices by device ID. Counters start at zero and have no gaps,
+// so the signature with counter n is at index n of its chain.
+type chains map[string][]types.Signature
+
+func (c chains) get(deviceID string, counter uint32) (*types.Signature, error) {
+	chain := c[deviceID]
+	if int64(counter) >= int64(len(chain)) {
+		return nil, types.ErrSignatureNotFound
+	}
+	signature := chain[counter]
+	return &signature, nil
+}
+
+// between returns a copy of the signatures with a counter from from to to, both inclusive.
+func (c chains) between(deviceID string, from, to uint32) []types.Signature {
+	chain := c[deviceID]
+	if from > to || int64(from) >= int64(len(chain)) {
+		return []types.Signature{}
+	}
+	end := min(int64(to)+1, int64(len(chain)))
+	return slices.Clone(chain[from:end])
+}
+
+func (c chains) last(deviceID string) (*types.Signature, error) {
+	chain := c[deviceID]
+	if len(chain) == 0 {
+		return nil, types.ErrSignatureNotFound
+	}
+	signature := chain[len(chain)-1]
+	return &signature, nil
+}
+
+// advance moves the chain of the device on to the signature.
+func advance(device *types.SignatureDevice, signature types.Signature) {
+	device.Counter = signature.Counter + 1
+	device.LastSignature = signature.Value
+	device.LastSignedAt = signature.Timestamp
+}
+
+// appendSignatures returns a copy of the current device with its chain advanced by the signatures.
+// The chain of the current device must not have advanced since the first signature was made.
+func appendSignatures(current *types.SignatureDevice, appended []types.Signature) (*types.SignatureDevice, error) {
+	if appended[0].Counter != current.Counter {
+		return nil, fmt.Errorf("%w: counter is at %d, unit of work started at %d",
+			types.ErrSignatureCounterConflict, current.Counter, appended[0].Counter)
+	}
+	device := cloneDevice(current)
+	for _, signature := range appended {
+		advance(device, signature)
+	}
+	return device, nil
+}
+
+// withChainOf returns a copy of the updated device that keeps the signature chain of the current one.
+func withChainOf(updated, current *types.SignatureDevice) *types.SignatureDevice {
+	device := cloneDevice(updated)
+	device.Counter = current.Counter
+	device.LastSignature = current.LastSignature
+	device.LastSignedAt = current.LastSignedAt
+	return device
+}
+
+// cloneDevice returns a copy of the device that shares no mutable state with it.
+// Byte slices are never modified in place and are shared.
+func cloneDevice(device *types.SignatureDevice) *types.SignatureDevice {
+	clone := *device
+	return &clone
+}
+
+// organizationDevices returns copies of the devices of the organization with the given ID.
+func organizationDevices(devices map[string]*types.SignatureDevice, organizationID string) []*types.SignatureDevice {
+	result := []*types.SignatureDevice{}
+	for _, device := range devices {
+		if device.Organization() == organizationID {
+			result = append(result, cloneDevice(device))
+		}
+	}
+	return result
+}
+
+// countDevices returns the number of devices of the organization with the given ID.
+func countDevices(devices map[string]*types.SignatureDevice, organizationID string) int {
+	count := 0
+	for _, device := range devices {
+		if device.Organization() == organizationID {
+			count++
+		}
+	}
+	return count
+}
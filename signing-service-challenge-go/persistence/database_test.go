@@ -0,0 +1,79 @@
+package persistence
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/auth"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence/dbtest"
+)
+
+func TestInMemoryDatabase(t *testing.T) {
+	dbtest.Run(t, func(*testing.T) domain.Database {
+		return NewInMemoryDatabase()
+	})
+}
+
+func TestFileDatabase(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T) domain.Database {
+		db, err := OpenFileDatabase(t.TempDir())
+		if err != nil {
+			t.Fatalf("failed to open database: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return db
+	})
+}
+
+func TestSQLDatabase(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T) domain.Database {
+		return openSQLite(t, filepath.Join(t.TempDir(), "devices.db"))
+	})
+}
+
+func TestInMemoryDatabase_APIKeys(t *testing.T) {
+	dbtest.RunKeyStore(t, func(*testing.T) auth.KeyStore {
+		return NewInMemoryDatabase()
+	})
+}
+
+func TestFileDatabase_APIKeys(t *testing.T) {
+	dbtest.RunKeyStore(t, func(t *testing.T) auth.KeyStore {
+		db, err := OpenFileDatabase(t.TempDir())
+		if err != nil {
+			t.Fatalf("failed to open database: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return db
+	})
+}
+
+func TestSQLDatabase_APIKeys(t *testing.T) {
+	dbtest.RunKeyStore(t, func(t *testing.T) auth.KeyStore {
+		return openSQLite(t, filepath.Join(t.TempDir(), "devices.db"))
+	})
+}
+
+func TestInMemoryDatabase_Organizations(t *testing.T) {
+	dbtest.RunOrganizationStore(t, func(*testing.T) domain.OrganizationStore {
+		return NewInMemoryDatabase()
+	})
+}
+
+func TestFileDatabase_Organizations(t *testing.T) {
+	dbtest.RunOrganizationStore(t, func(t *testing.T) domain.OrganizationStore {
+		db, err := OpenFileDatabase(t.TempDir())
+		if err != nil {
+			t.Fatalf("failed to open database: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return db
+	})
+}
+
+func TestSQLDatabase_Organizations(t *testing.T) {
+	dbtest.RunOrganizationStore(t, func(t *testing.T) domain.OrganizationStore {
+		return openSQLite(t, filepath.Join(t.TempDir(), "devices.db"))
+	})
+}
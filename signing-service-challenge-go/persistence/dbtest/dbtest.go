@@ -0,0 +1,663 @@
+// Package dbtest provides a conformance test suite for implementations of domain.Database.
+//
+// Every backend runs the same suite from its own tests:
+//
+//	func TestMyDatabase(t *testing.T) {
+//		dbtest.Run(t, func(t *testing.T) domain.Database {
+//			return openEmptyDatabase(t)
+//		})
+//	}
+package dbtest
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+)
+
+// Open returns a new, empty database. It is called once per test, cleanup should be registered with t.Cleanup.
+type Open func(t *testing.T) domain.Database
+
+// Run runs the conformance suite against the databases returned by open.
+func Run(t *testing.T, open Open) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, db domain.Database)
+	}{
+		{name: "Create And Get", test: testCreateAndGet},
+		{name: "Create Existing", test: testCreateExisting},
+		{name: "Unknown Device", test: testUnknownDevice},
+		{name: "Update", test: testUpdate},
+		{name: "Round Trip", test: testRoundTrip},
+		{name: "Signatures", test: testSignatures},
+		{name: "Get All", test: testGetAll},
+		{name: "Organization Devices", test: testOrganizationDevices},
+		{name: "Device Quota", test: testDeviceQuota},
+		{name: "Isolation", test: testIsolation},
+		{name: "Concurrent Updates", test: testConcurrentUpdates},
+		{name: "Transaction Commit", test: testTxCommit},
+		{name: "Transaction Rollback", test: testTxRollback},
+		{name: "Transaction Counter Conflict", test: testTxCounterConflict},
+		{name: "Concurrent Transactions", test: testConcurrentTx},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.test(t, open(t))
+		})
+	}
+}
+
+// NewDevice returns a device without signatures with the given ID.
+func NewDevice(id string) *types.SignatureDevice {
+	return &types.SignatureDevice{
+		ID:             id,
+		Algorithm:      types.ECC,
+		Label:          "label " + id,
+		PkPem:          []byte("key " + id),
+		OrganizationID: "organization",
+	}
+}
+
+// NewSignature returns the signature with the given counter the way domain.DeviceService would make it.
+func NewSignature(counter uint32) types.Signature {
+	return types.Signature{
+		Counter:    counter,
+		Value:      []byte(fmt.Sprintf("signature %d", counter)),
+		SignedData: []byte(fmt.Sprintf("%d_data", counter)),
+		Timestamp:  time.Date(2025, 6, 1, 12, 0, int(counter), 123456789, time.UTC),
+		Format:     types.FormatRaw,
+	}
+}
+
+// sign appends the next signature to the chain of the device in its own unit of work.
+func sign(db domain.Database, id string) error {
+	tx, err := db.BeginDeviceTx(id)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err = tx.AppendSignature(NewSignature(tx.Device().Counter)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func signN(t *testing.T, db domain.Database, id string, n int) {
+	t.Helper()
+	for range n {
+		if err := sign(db, id); err != nil {
+			t.Fatalf("failed to sign with device %s: %v", id, err)
+		}
+	}
+}
+
+func create(t *testing.T, db domain.Database, device *types.SignatureDevice) {
+	t.Helper()
+	if err := db.CreateSignatureDevice(device); err != nil {
+		t.Fatalf("failed to create device %s: %v", device.ID, err)
+	}
+}
+
+func get(t *testing.T, db domain.Database, id string) *types.SignatureDevice {
+	t.Helper()
+	device, err := db.GetSignatureDevice(id)
+	if err != nil {
+		t.Fatalf("failed to get device %s: %v", id, err)
+	}
+	return device
+}
+
+func all(t *testing.T, db domain.Database) []*types.SignatureDevice {
+	t.Helper()
+	devices, err := db.GetAllSignatureDevices()
+	if err != nil {
+		t.Fatalf("failed to get devices: %v", err)
+	}
+	return devices
+}
+
+func organizationDevices(t *testing.T, db domain.Database, organizationID string) []*types.SignatureDevice {
+	t.Helper()
+	devices, err := db.GetOrganizationSignatureDevices(organizationID)
+	if err != nil {
+		t.Fatalf("failed to get devices of organization %s: %v", organizationID, err)
+	}
+	return devices
+}
+
+func begin(t *testing.T, db domain.Database, id string) domain.DeviceTx {
+	t.Helper()
+	tx, err := db.BeginDeviceTx(id)
+	if err != nil {
+		t.Fatalf("failed to begin unit of work on device %s: %v", id, err)
+	}
+	t.Cleanup(func() { tx.Rollback() })
+	return tx
+}
+
+func signatures(t *testing.T, db domain.Database, id string) []types.Signature {
+	t.Helper()
+	signatures, err := db.GetSignatures(id, 0, math.MaxUint32)
+	if err != nil {
+		t.Fatalf("failed to get signatures of device %s: %v", id, err)
+	}
+	return signatures
+}
+
+// expectChain checks that the device refers to the last of n signatures.
+func expectChain(t *testing.T, device *types.SignatureDevice, n uint32) {
+	t.Helper()
+	if device.Counter != n {
+		t.Fatalf("expected counter %d, got %d", n, device.Counter)
+	}
+	if n == 0 {
+		if device.LastSignature != nil || !device.LastSignedAt.IsZero() {
+			t.Fatalf("expected no last signature, got %q at %s", device.LastSignature, device.LastSignedAt)
+		}
+		return
+	}
+	last := NewSignature(n - 1)
+	if string(device.LastSignature) != string(last.Value) || !device.LastSignedAt.Equal(last.Timestamp) {
+		t.Fatalf("expected last signature %q at %s, got %q at %s", last.Value, last.Timestamp, device.LastSignature, device.LastSignedAt)
+	}
+}
+
+func testCreateAndGet(t *testing.T, db domain.Database) {
+	create(t, db, NewDevice("a"))
+	device := get(t, db, "a")
+	if device.ID != "a" || device.Label != "label a" || string(device.PkPem) != "key a" {
+		t.Fatalf("unexpected device %+v", device)
+	}
+	expectChain(t, device, 0)
+}
+
+func testCreateExisting(t *testing.T, db domain.Database) {
+	create(t, db, NewDevice("a"))
+	duplicate := NewDevice("a")
+	duplicate.Label = "duplicate"
+	if err := db.CreateSignatureDevice(duplicate); !errors.Is(err, types.ErrDeviceAlreadyExists) {
+		t.Fatalf("expected %q, got %v", types.ErrDeviceAlreadyExists, err)
+	}
+	if device := get(t, db, "a"); device.Label != "label a" {
+		t.Fatalf("expected the existing device to be kept, got label %q", device.Label)
+	}
+}
+
+func testUnknownDevice(t *testing.T, db domain.Database) {
+	if _, err := db.GetSignatureDevice("missing"); !errors.Is(err, types.ErrDeviceNotFound) {
+		t.Fatalf("expected %q, got %v", types.ErrDeviceNotFound, err)
+	}
+	if err := db.UpdateSignatureDevice(NewDevice("missing")); !errors.Is(err, types.ErrDeviceNotFound) {
+		t.Fatalf("expected %q, got %v", types.ErrDeviceNotFound, err)
+	}
+	if _, err := db.BeginDeviceTx("missing"); !errors.Is(err, types.ErrDeviceNotFound) {
+		t.Fatalf("expected %q, got %v", types.ErrDeviceNotFound, err)
+	}
+	if _, err := db.GetSignature("missing", 0); !errors.Is(err, types.ErrDeviceNotFound) {
+		t.Fatalf("expected %q, got %v", types.ErrDeviceNotFound, err)
+	}
+	if _, err := db.GetSignatures("missing", 0, math.MaxUint32); !errors.Is(err, types.ErrDeviceNotFound) {
+		t.Fatalf("expected %q, got %v", types.ErrDeviceNotFound, err)
+	}
+	if _, err := db.GetLastSignature("missing"); !errors.Is(err, types.ErrDeviceNotFound) {
+		t.Fatalf("expected %q, got %v", types.ErrDeviceNotFound, err)
+	}
+}
+
+func testUpdate(t *testing.T, db domain.Database) {
+	create(t, db, NewDevice("a"))
+	stale := get(t, db, "a")
+	signN(t, db, "a", 3)
+
+	// a copy of the device read before the signatures must not roll back the chain
+	stale.Label = "updated"
+	stale.Certificate = []byte("certificate")
+	if err := db.UpdateSignatureDevice(stale); err != nil {
+		t.Fatalf("failed to update device: %v", err)
+	}
+	device := get(t, db, "a")
+	if device.Label != "updated" || string(device.Certificate) != "certificate" {
+		t.Fatalf("expected the attributes to be updated, got %+v", device)
+	}
+	expectChain(t, device, 3)
+	if len(signatures(t, db, "a")) != 3 {
+		t.Fatal("expected the signatures to be kept")
+	}
+
+	// neither can an update advance the chain
+	device.Counter = 42
+	device.LastSignature = []byte("forged")
+	if err := db.UpdateSignatureDevice(device); err != nil {
+		t.Fatalf("failed to update device: %v", err)
+	}
+	expectChain(t, get(t, db, "a"), 3)
+}
+
+func testRoundTrip(t *testing.T, db domain.Database) {
+	device := NewDevice("a")
+	device.Certificate = []byte("certificate")
+	create(t, db, device)
+	want := types.Signature{
+		Counter:        0,
+		Value:          []byte("value"),
+		SignedData:     []byte("0_data_YQ=="),
+		Timestamp:      time.Date(2025, 6, 1, 12, 0, 0, 123456789, time.UTC),
+		Format:         types.FormatJWS,
+		Envelope:       []byte("envelope"),
+		TimestampToken: []byte("token"),
+	}
+	tx := begin(t, db, "a")
+	if err := tx.AppendSignature(want); err != nil {
+		t.Fatalf("failed to append signature: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+
+	got := get(t, db, "a")
+	if got.Algorithm != device.Algorithm || got.Label != device.Label || string(got.PkPem) != string(device.PkPem) ||
+		got.OrganizationID != device.OrganizationID ||
+		string(got.Certificate) != string(device.Certificate) || got.Counter != 1 ||
+		string(got.LastSignature) != "value" || !got.LastSignedAt.Equal(want.Timestamp) {
+		t.Fatalf("expected device %+v, got %+v", device, got)
+	}
+	signature, err := db.GetSignature("a", 0)
+	if err != nil {
+		t.Fatalf("failed to get signature: %v", err)
+	}
+	if !signature.Timestamp.Equal(want.Timestamp) {
+		t.Fatalf("expected timestamp %s, got %s", want.Timestamp, signature.Timestamp)
+	}
+	signature.Timestamp = want.Timestamp
+	if !reflect.DeepEqual(*signature, want) {
+		t.Fatalf("expected signature %+v, got %+v", want, *signature)
+	}
+}
+
+func testSignatures(t *testing.T, db domain.Database) {
+	create(t, db, NewDevice("a"))
+	create(t, db, NewDevice("b"))
+	if _, err := db.GetLastSignature("a"); !errors.Is(err, types.ErrSignatureNotFound) {
+		t.Fatalf("expected %q before the first signature, got %v", types.ErrSignatureNotFound, err)
+	}
+	signN(t, db, "a", 20)
+	signN(t, db, "b", 1)
+
+	all := signatures(t, db, "a")
+	if len(all) != 20 {
+		t.Fatalf("expected 20 signatures, got %d", len(all))
+	}
+	for i, signature := range all {
+		if signature.Counter != uint32(i) || string(signature.Value) != string(NewSignature(uint32(i)).Value) {
+			t.Fatalf("expected signatures ordered by counter, got %+v at index %d", signature, i)
+		}
+	}
+
+	ranges := []struct {
+		from, to uint32
+		want     []uint32
+	}{
+		{from: 5, to: 7, want: []uint32{5, 6, 7}},
+		{from: 19, to: math.MaxUint32, want: []uint32{19}},
+		{from: 3, to: 3, want: []uint32{3}},
+		{from: 7, to: 5, want: []uint32{}},
+		{from: 20, to: 30, want: []uint32{}},
+	}
+	for _, r := range ranges {
+		signatures, err := db.GetSignatures("a", r.from, r.to)
+		if err != nil {
+			t.Fatalf("failed to get signatures %d to %d: %v", r.from, r.to, err)
+		}
+		counters := []uint32{}
+		for _, signature := range signatures {
+			counters = append(counters, signature.Counter)
+		}
+		if signatures == nil || !slices.Equal(counters, r.want) {
+			t.Fatalf("expected signatures %v from %d to %d, got %v", r.want, r.from, r.to, counters)
+		}
+	}
+
+	signature, err := db.GetSignature("a", 12)
+	if err != nil || signature.Counter != 12 || string(signature.Value) != "signature 12" {
+		t.Fatalf("expected signature 12, got %+v (%v)", signature, err)
+	}
+	if _, err = db.GetSignature("a", 20); !errors.Is(err, types.ErrSignatureNotFound) {
+		t.Fatalf("expected %q, got %v", types.ErrSignatureNotFound, err)
+	}
+	if signature, err = db.GetLastSignature("a"); err != nil || signature.Counter != 19 {
+		t.Fatalf("expected signature 19 as the last one, got %+v (%v)", signature, err)
+	}
+	if signature, err = db.GetLastSignature("b"); err != nil || signature.Counter != 0 {
+		t.Fatalf("expected the chains of devices to be separate, got %+v (%v)", signature, err)
+	}
+
+	create(t, db, NewDevice("c"))
+	if signatures := signatures(t, db, "c"); signatures == nil || len(signatures) != 0 {
+		t.Fatalf("expected an empty, non-nil list of signatures, got %v", signatures)
+	}
+}
+
+func testGetAll(t *testing.T, db domain.Database) {
+	if devices := all(t, db); devices == nil || len(devices) != 0 {
+		t.Fatalf("expected an empty, non-nil list of devices, got %v", devices)
+	}
+	for _, id := range []string{"a", "b", "c"} {
+		create(t, db, NewDevice(id))
+	}
+	signN(t, db, "b", 1)
+	var ids []string
+	for _, device := range all(t, db) {
+		ids = append(ids, device.ID)
+		if device.ID == "b" {
+			expectChain(t, device, 1)
+		}
+	}
+	slices.Sort(ids)
+	if !slices.Equal(ids, []string{"a", "b", "c"}) {
+		t.Fatalf("expected all devices, got %v", ids)
+	}
+}
+
+func testOrganizationDevices(t *testing.T, db domain.Database) {
+	for _, device := range []*types.SignatureDevice{NewDevice("a"), NewDevice("b"), NewDevice("c")} {
+		device.OrganizationID = "store-" + device.ID
+		if device.ID == "c" {
+			// devices without an organization belong to the default one
+			device.OrganizationID = ""
+		}
+		create(t, db, device)
+	}
+	for organizationID, expected := range map[string]string{"store-a": "a", "store-b": "b", types.DefaultOrganizationID: "c"} {
+		devices := organizationDevices(t, db, organizationID)
+		if len(devices) != 1 || devices[0].ID != expected {
+			t.Fatalf("expected only device %s in organization %s, got %v", expected, organizationID, devices)
+		}
+	}
+	if devices := organizationDevices(t, db, "unknown"); devices == nil || len(devices) != 0 {
+		t.Fatalf("expected an empty, non-nil list of devices, got %v", devices)
+	}
+}
+
+// testDeviceQuota creates devices of one organization in parallel, no more than its quota may succeed.
+func testDeviceQuota(t *testing.T, db domain.Database) {
+	const quota = 3
+	other := NewDevice("other")
+	other.OrganizationID = "store-b"
+	create(t, db, other)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*quota)
+	for i := range 2 * quota {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			device := NewDevice(fmt.Sprint(i))
+			device.OrganizationID = "store-a"
+			errs <- db.CreateOrganizationSignatureDevice(device, quota)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	created := 0
+	for err := range errs {
+		if err == nil {
+			created++
+		} else if !errors.Is(err, types.ErrDeviceQuotaExceeded) {
+			t.Fatalf("expected no error or %v, got %v", types.ErrDeviceQuotaExceeded, err)
+		}
+	}
+	if created != quota || len(organizationDevices(t, db, "store-a")) != quota {
+		t.Fatalf("expected %d devices, created %d", quota, created)
+	}
+
+	// the quota only counts the devices of the organization, 0 means unlimited
+	device := NewDevice("first")
+	device.OrganizationID = "store-b"
+	if err := db.CreateOrganizationSignatureDevice(device, 2); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	device = NewDevice("unlimited")
+	device.OrganizationID = "store-a"
+	if err := db.CreateOrganizationSignatureDevice(device, 0); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := db.CreateOrganizationSignatureDevice(NewDevice("first"), 0); !errors.Is(err, types.ErrDeviceAlreadyExists) {
+		t.Fatalf("expected %v, got %v", types.ErrDeviceAlreadyExists, err)
+	}
+}
+
+// testIsolation checks that callers never share state with the database, only its methods change it.
+func testIsolation(t *testing.T, db domain.Database) {
+	created := NewDevice("a")
+	create(t, db, created)
+	created.Label = "changed after create"
+	created.Counter = 1
+
+	returned := get(t, db, "a")
+	if returned.Label != "label a" || returned.Counter != 0 {
+		t.Fatalf("expected the stored device to be unaffected by changes to the created one, got %+v", returned)
+	}
+	returned.Label = "changed after get"
+	returned.Counter = 1
+	if device := get(t, db, "a"); device.Label != "label a" || device.Counter != 0 {
+		t.Fatalf("expected the stored device to be unaffected by changes to a returned one, got %+v", device)
+	}
+	for _, device := range all(t, db) {
+		device.Label = "changed after get all"
+		device.Counter = 1
+	}
+	if device := get(t, db, "a"); device.Label != "label a" || device.Counter != 0 {
+		t.Fatalf("expected the stored device to be unaffected by changes to listed ones, got %+v", device)
+	}
+
+	updated := get(t, db, "a")
+	if err := db.UpdateSignatureDevice(updated); err != nil {
+		t.Fatalf("failed to update device: %v", err)
+	}
+	updated.Label = "changed after update"
+	if device := get(t, db, "a"); device.Label != "label a" {
+		t.Fatalf("expected the stored device to be unaffected by changes to an updated one, got %+v", device)
+	}
+
+	tx := begin(t, db, "a")
+	locked := tx.Device()
+	locked.Counter = 42
+	locked.Label = "changed in unit of work"
+	if device := tx.Device(); device.Counter != 0 || device.Label != "label a" {
+		t.Fatalf("expected the locked device to be unaffected by changes to a returned one, got %+v", device)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("failed to roll back: %v", err)
+	}
+
+	signN(t, db, "a", 2)
+	all := signatures(t, db, "a")
+	all[0].Counter = 42
+	all = append(all[:1], NewSignature(7))
+	signature, err := db.GetLastSignature("a")
+	if err != nil {
+		t.Fatalf("failed to get signature: %v", err)
+	}
+	signature.Counter = 42
+	if all = signatures(t, db, "a"); len(all) != 2 || all[0].Counter != 0 || all[1].Counter != 1 {
+		t.Fatalf("expected the stored signatures to be unaffected by changes to returned ones, got %+v", all)
+	}
+	if signature, _ = db.GetSignature("a", 1); signature.Counter != 1 {
+		t.Fatalf("expected the stored signatures to be unaffected by changes to returned ones, got %+v", signature)
+	}
+}
+
+// testConcurrentUpdates signs with several devices in parallel while others read, no signature may get lost.
+func testConcurrentUpdates(t *testing.T, db domain.Database) {
+	const devices = 4
+	const perDevice = 10
+	for i := range devices {
+		create(t, db, NewDevice(fmt.Sprint(i)))
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*devices)
+	for i := range devices {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for range perDevice {
+				if err := sign(db, fmt.Sprint(i)); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for range perDevice {
+				_, err := db.GetAllSignatureDevices()
+				if err != nil {
+					errs <- err
+					return
+				}
+				device, err := db.GetSignatureDevice(fmt.Sprint(i))
+				if err == nil {
+					// the chain of a device is committed at once with its counter
+					_, err = db.GetSignature(device.ID, device.Counter-1)
+					if device.Counter == 0 {
+						err = nil
+					}
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	for i := range devices {
+		id := fmt.Sprint(i)
+		expectChain(t, get(t, db, id), perDevice)
+		if n := len(signatures(t, db, id)); n != perDevice {
+			t.Fatalf("expected %d signatures for device %s, got %d", perDevice, id, n)
+		}
+	}
+}
+
+func testTxCommit(t *testing.T, db domain.Database) {
+	create(t, db, NewDevice("a"))
+	signN(t, db, "a", 1)
+
+	tx := begin(t, db, "a")
+	expectChain(t, tx.Device(), 1)
+	for _, counter := range []uint32{1, 2} {
+		if err := tx.AppendSignature(NewSignature(counter)); err != nil {
+			t.Fatalf("failed to append signature: %v", err)
+		}
+	}
+	expectChain(t, tx.Device(), 3)
+	expectChain(t, get(t, db, "a"), 1)
+	if n := len(signatures(t, db, "a")); n != 1 {
+		t.Fatalf("expected nothing to be visible before commit, got %d signatures", n)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("expected rollback after commit to do nothing, got %v", err)
+	}
+
+	if n := len(signatures(t, db, "a")); n != 3 {
+		t.Fatalf("expected three signatures, got %d", n)
+	}
+	device := get(t, db, "a")
+	expectChain(t, device, 3)
+	if device.Label != "label a" {
+		t.Fatalf("expected the attributes to be kept, got %+v", device)
+	}
+}
+
+func testTxRollback(t *testing.T, db domain.Database) {
+	create(t, db, NewDevice("a"))
+	tx := begin(t, db, "a")
+	if err := tx.AppendSignature(NewSignature(0)); err != nil {
+		t.Fatalf("failed to append signature: %v", err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("failed to roll back: %v", err)
+	}
+	if err := tx.Commit(); err == nil {
+		t.Fatal("expected commit after rollback to fail")
+	}
+	expectChain(t, get(t, db, "a"), 0)
+	if n := len(signatures(t, db, "a")); n != 0 {
+		t.Fatalf("expected the rolled back signature to be discarded, got %d signatures", n)
+	}
+
+	// the device must be unlocked again
+	signN(t, db, "a", 1)
+	expectChain(t, get(t, db, "a"), 1)
+}
+
+func testTxCounterConflict(t *testing.T, db domain.Database) {
+	create(t, db, NewDevice("a"))
+	tx := begin(t, db, "a")
+	for _, counter := range []uint32{1, 42} {
+		err := tx.AppendSignature(NewSignature(counter))
+		if !errors.Is(err, types.ErrSignatureCounterConflict) {
+			t.Fatalf("expected %q for counter %d, got %v", types.ErrSignatureCounterConflict, counter, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("expected an empty commit to succeed, got %v", err)
+	}
+	expectChain(t, get(t, db, "a"), 0)
+}
+
+// testConcurrentTx signs with the same device in parallel, the units of work must wait for each other instead of conflicting.
+func testConcurrentTx(t *testing.T, db domain.Database) {
+	const workers = 4
+	const perWorker = 5
+	create(t, db, NewDevice("a"))
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range perWorker {
+				if err := sign(db, "a"); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	stored := signatures(t, db, "a")
+	if len(stored) != workers*perWorker {
+		t.Fatalf("expected %d signatures, got %d", workers*perWorker, len(stored))
+	}
+	for i, signature := range stored {
+		if signature.Counter != uint32(i) {
+			t.Fatalf("expected gap-free counters, got counter %d at index %d", signature.Counter, i)
+		}
+	}
+	expectChain(t, get(t, db, "a"), workers*perWorker)
+}
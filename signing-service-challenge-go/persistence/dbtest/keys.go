@@ -0,0 +1,126 @@
+package dbtest
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/auth"
+)
+
+// created is the creation time of the keys of the suite.
+var created = time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// OpenKeyStore returns a new, empty key store. It is called once per test, cleanup should be registered with t.Cleanup.
+type OpenKeyStore func(t *testing.T) auth.KeyStore
+
+// RunKeyStore runs the conformance suite for API key stores against the stores returned by open.
+func RunKeyStore(t *testing.T, open OpenKeyStore) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, store auth.KeyStore)
+	}{
+		{name: "Create And Get", test: testKeyCreateAndGet},
+		{name: "Create Existing", test: testKeyCreateExisting},
+		{name: "Get All", test: testKeyGetAll},
+		{name: "Revoke", test: testKeyRevoke},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.test(t, open(t))
+		})
+	}
+}
+
+// NewKey returns an active key with the given ID, created at the given time.
+func NewKey(id string, createdAt time.Time) *auth.Key {
+	return &auth.Key{
+		ID:             id,
+		OrganizationID: "organization",
+		Name:           "key " + id,
+		Hash:           auth.Hash("token " + id),
+		Scopes:         []auth.Scope{auth.ScopeDevicesRead, auth.ScopeSign},
+		DeviceIDs:      []string{"device-a", "device-b"},
+		CreatedAt:      createdAt,
+	}
+}
+
+func testKeyCreateAndGet(t *testing.T, store auth.KeyStore) {
+	key := NewKey("a", created)
+	if err := store.CreateAPIKey(key); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	stored, err := store.GetAPIKey("a")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(stored, key) {
+		t.Fatalf("expected %+v, got %+v", key, stored)
+	}
+	// the store must not share state with its callers
+	stored.DeviceIDs[0] = "other"
+	if again, _ := store.GetAPIKey("a"); again.DeviceIDs[0] != "device-a" {
+		t.Fatalf("expected the stored key to be unchanged, got %v", again.DeviceIDs)
+	}
+	if _, err = store.GetAPIKey("unknown"); !errors.Is(err, auth.ErrKeyNotFound) {
+		t.Fatalf("expected error %v, got %v", auth.ErrKeyNotFound, err)
+	}
+}
+
+func testKeyCreateExisting(t *testing.T, store auth.KeyStore) {
+	if err := store.CreateAPIKey(NewKey("a", created)); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := store.CreateAPIKey(NewKey("a", created)); !errors.Is(err, auth.ErrKeyAlreadyExists) {
+		t.Fatalf("expected error %v, got %v", auth.ErrKeyAlreadyExists, err)
+	}
+}
+
+func testKeyGetAll(t *testing.T, store auth.KeyStore) {
+	keys, err := store.GetAllAPIKeys()
+	if err != nil || len(keys) != 0 {
+		t.Fatalf("expected no keys, got %v, %v", keys, err)
+	}
+	// created out of order, with timestamps whose text does not sort by time
+	for _, key := range []*auth.Key{NewKey("c", created.Add(time.Second)), NewKey("a", created.Add(500*time.Millisecond)), NewKey("b", created)} {
+		if err = store.CreateAPIKey(key); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	keys, err = store.GetAllAPIKeys()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	var ids []string
+	for _, key := range keys {
+		ids = append(ids, key.ID)
+	}
+	if !reflect.DeepEqual(ids, []string{"b", "a", "c"}) {
+		t.Fatalf("expected keys in order of creation, got %v", ids)
+	}
+}
+
+func testKeyRevoke(t *testing.T, store auth.KeyStore) {
+	if err := store.CreateAPIKey(NewKey("a", created)); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	revokedAt := created.Add(time.Hour)
+	if err := store.RevokeAPIKey("a", revokedAt); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	// revoking again keeps the first revocation
+	if err := store.RevokeAPIKey("a", revokedAt.Add(time.Hour)); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	key, err := store.GetAPIKey("a")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if key.RevokedAt == nil || !key.RevokedAt.Equal(revokedAt) {
+		t.Fatalf("expected key revoked at %v, got %v", revokedAt, key.RevokedAt)
+	}
+	if err = store.RevokeAPIKey("unknown", revokedAt); !errors.Is(err, auth.ErrKeyNotFound) {
+		t.Fatalf("expected error %v, got %v", auth.ErrKeyNotFound, err)
+	}
+}
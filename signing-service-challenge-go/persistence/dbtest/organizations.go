@@ -0,0 +1,116 @@
+package dbtest
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+)
+
+// OpenOrganizationStore returns a new, empty organization store. It is called once per test, cleanup
+// should be registered with t.Cleanup.
+type OpenOrganizationStore func(t *testing.T) domain.OrganizationStore
+
+// RunOrganizationStore runs the conformance suite for organization stores against the stores returned by open.
+func RunOrganizationStore(t *testing.T, open OpenOrganizationStore) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, store domain.OrganizationStore)
+	}{
+		{name: "Create And Get", test: testOrganizationCreateAndGet},
+		{name: "Create Existing", test: testOrganizationCreateExisting},
+		{name: "Get All", test: testOrganizationGetAll},
+		{name: "Update", test: testOrganizationUpdate},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.test(t, open(t))
+		})
+	}
+}
+
+// NewOrganization returns an organization with the given ID and device quota.
+func NewOrganization(id string, maxDevices int) *types.Organization {
+	return &types.Organization{
+		ID:         id,
+		Name:       "organization " + id,
+		MaxDevices: maxDevices,
+		CreatedAt:  created,
+	}
+}
+
+func testOrganizationCreateAndGet(t *testing.T, store domain.OrganizationStore) {
+	organization := NewOrganization("a", 10)
+	if err := store.CreateOrganization(organization); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	stored, err := store.GetOrganization("a")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(stored, organization) {
+		t.Fatalf("expected %+v, got %+v", organization, stored)
+	}
+	if _, err = store.GetOrganization("unknown"); !errors.Is(err, types.ErrOrganizationNotFound) {
+		t.Fatalf("expected error %v, got %v", types.ErrOrganizationNotFound, err)
+	}
+}
+
+func testOrganizationCreateExisting(t *testing.T, store domain.OrganizationStore) {
+	if err := store.CreateOrganization(NewOrganization("a", 10)); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := store.CreateOrganization(NewOrganization("a", 20)); !errors.Is(err, types.ErrOrganizationExists) {
+		t.Fatalf("expected error %v, got %v", types.ErrOrganizationExists, err)
+	}
+	if stored, _ := store.GetOrganization("a"); stored.MaxDevices != 10 {
+		t.Fatalf("expected the existing organization to be kept, got %+v", stored)
+	}
+}
+
+func testOrganizationGetAll(t *testing.T, store domain.OrganizationStore) {
+	all, err := store.GetAllOrganizations()
+	if err != nil || len(all) != 0 {
+		t.Fatalf("expected no organizations, got %v, %v", all, err)
+	}
+	for _, id := range []string{"c", "a", "b"} {
+		if err = store.CreateOrganization(NewOrganization(id, 0)); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	all, err = store.GetAllOrganizations()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	var ids []string
+	for _, organization := range all {
+		ids = append(ids, organization.ID)
+	}
+	if !reflect.DeepEqual(ids, []string{"a", "b", "c"}) {
+		t.Fatalf("expected organizations ordered by ID, got %v", ids)
+	}
+}
+
+func testOrganizationUpdate(t *testing.T, store domain.OrganizationStore) {
+	if err := store.CreateOrganization(NewOrganization("a", 10)); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	updated := NewOrganization("a", 20)
+	updated.Name = "renamed"
+	updated.CreatedAt = created.AddDate(1, 0, 0)
+	if err := store.UpdateOrganization(updated); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	stored, err := store.GetOrganization("a")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if stored.Name != "renamed" || stored.MaxDevices != 20 || !stored.CreatedAt.Equal(created) {
+		t.Fatalf("expected the name and quota to be updated, got %+v", stored)
+	}
+	if err = store.UpdateOrganization(NewOrganization("unknown", 0)); !errors.Is(err, types.ErrOrganizationNotFound) {
+		t.Fatalf("expected error %v, got %v", types.ErrOrganizationNotFound, err)
+	}
+}
@@ -0,0 +1,254 @@
+package persistence
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+)
+
+// encryptedKeyType is the PEM type of device private keys encrypted with the key-encryption key of their organization.
+const encryptedKeyType = "ENCRYPTED DEVICE KEY"
+
+// KeyEncryptionKeys derives a key-encryption key (KEK) for every organization from a master key.
+type KeyEncryptionKeys struct {
+	master []byte
+}
+
+// NewKeyEncryptionKeys creates the KeyEncryptionKeys of a master key of 32 random bytes.
+func NewKeyEncryptionKeys(master []byte) (*KeyEncryptionKeys, error) {
+	if len(master) != 32 {
+		return nil, fmt.Errorf("master key must have 32 bytes, got %d", len(master))
+	}
+	return &KeyEncryptionKeys{master: bytes.Clone(master)}, nil
+}
+
+// LoadKeyEncryptionKeyFile reads the hex encoded master key of the KeyEncryptionKeys from a file,
+// e.g. one created with "openssl rand -hex 32".
+func LoadKeyEncryptionKeyFile(file string) (*KeyEncryptionKeys, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key-encryption key: %w", err)
+	}
+	master, err := hex.DecodeString(string(bytes.TrimSpace(content)))
+	if err != nil {
+		return nil, fmt.Errorf("key-encryption key must be hex encoded: %w", err)
+	}
+	return NewKeyEncryptionKeys(master)
+}
+
+// aead returns the AES-256-GCM cipher keyed with the KEK of the organization.
+func (k *KeyEncryptionKeys) aead(organizationID string) (cipher.AEAD, error) {
+	mac := hmac.New(sha256.New, k.master)
+	mac.Write([]byte("device key encryption\x00" + organizationID))
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// additionalData binds an encrypted key to its device and organization, so it cannot be moved to another one.
+func additionalData(device *types.SignatureDevice) []byte {
+	return []byte(device.Organization() + "\x00" + device.ID)
+}
+
+// wrap encrypts the private key of the device with the KEK of its organization.
+func (k *KeyEncryptionKeys) wrap(device *types.SignatureDevice) ([]byte, error) {
+	aead, err := k.aead(device.Organization())
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  encryptedKeyType,
+		Bytes: aead.Seal(nonce, nonce, device.PkPem, additionalData(device)),
+	}), nil
+}
+
+// encrypted reports whether the private key of the device is encrypted.
+func encrypted(device *types.SignatureDevice) bool {
+	block, _ := pem.Decode(device.PkPem)
+	return block != nil && block.Type == encryptedKeyType
+}
+
+// unwrap decrypts the private key of the device. Keys stored before encryption was enabled are returned as they
+// are, with a warning, until EncryptStoredKeys encrypts them.
+func (k *KeyEncryptionKeys) unwrap(device *types.SignatureDevice) ([]byte, error) {
+	if !encrypted(device) {
+		slog.Warn("Device key is stored unencrypted", "device_id", device.ID)
+		return device.PkPem, nil
+	}
+	block, _ := pem.Decode(device.PkPem)
+	aead, err := k.aead(device.Organization())
+	if err != nil {
+		return nil, err
+	}
+	if len(block.Bytes) < aead.NonceSize() {
+		return nil, errors.New("encrypted device key is too short")
+	}
+	nonce, ciphertext := block.Bytes[:aead.NonceSize()], block.Bytes[aead.NonceSize():]
+	key, err := aead.Open(nil, nonce, ciphertext, additionalData(device))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt the key of device %s: %w", device.ID, err)
+	}
+	return key, nil
+}
+
+// encryptedDatabase encrypts the private keys of devices on their way into a Database and decrypts them on
+// their way out, each with the KEK of the organization of the device.
+type encryptedDatabase struct {
+	db   domain.Database
+	keys *KeyEncryptionKeys
+}
+
+// encryptedTx returns the decrypted device of a DeviceTx.
+type encryptedTx struct {
+	domain.DeviceTx
+	key []byte
+}
+
+// EncryptKeys returns db storing the private keys of devices encrypted with the KEK of their organization.
+// Like Instrument, the returned Database only implements domain.Database.
+func EncryptKeys(db domain.Database, keys *KeyEncryptionKeys) domain.Database {
+	return &encryptedDatabase{db: db, keys: keys}
+}
+
+// EncryptStoredKeys encrypts the private keys of devices in db that were stored before encryption was enabled,
+// and returns how many it encrypted. Keys that are already encrypted are left as they are.
+func EncryptStoredKeys(db domain.Database, keys *KeyEncryptionKeys) (int, error) {
+	devices, err := db.GetAllSignatureDevices()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read devices: %w", err)
+	}
+	encryptedDB := &encryptedDatabase{db: db, keys: keys}
+	count := 0
+	for _, device := range devices {
+		if encrypted(device) {
+			continue
+		}
+		if err = encryptedDB.UpdateSignatureDevice(device); err != nil {
+			return count, fmt.Errorf("failed to encrypt the key of device %s: %w", device.ID, err)
+		}
+		count++
+	}
+	return count, nil
+}
+
+// encrypt returns a copy of the device with its private key encrypted, the caller keeps the plain key.
+func (e *encryptedDatabase) encrypt(device *types.SignatureDevice) (*types.SignatureDevice, error) {
+	encrypted := cloneDevice(device)
+	var err error
+	if encrypted.PkPem, err = e.keys.wrap(device); err != nil {
+		return nil, fmt.Errorf("failed to encrypt device key: %w", err)
+	}
+	return encrypted, nil
+}
+
+func (e *encryptedDatabase) decrypt(device *types.SignatureDevice) (*types.SignatureDevice, error) {
+	key, err := e.keys.unwrap(device)
+	if err != nil {
+		return nil, err
+	}
+	device.PkPem = key
+	return device, nil
+}
+
+// decryptAll decrypts the keys of listed devices, failing if any key cannot be decrypted.
+func (e *encryptedDatabase) decryptAll(devices []*types.SignatureDevice, err error) ([]*types.SignatureDevice, error) {
+	if err != nil {
+		return nil, err
+	}
+	for _, device := range devices {
+		if _, err = e.decrypt(device); err != nil {
+			return nil, err
+		}
+	}
+	return devices, nil
+}
+
+func (e *encryptedDatabase) GetSignatureDevice(id string) (*types.SignatureDevice, error) {
+	device, err := e.db.GetSignatureDevice(id)
+	if err != nil {
+		return nil, err
+	}
+	return e.decrypt(device)
+}
+
+func (e *encryptedDatabase) GetAllSignatureDevices() ([]*types.SignatureDevice, error) {
+	return e.decryptAll(e.db.GetAllSignatureDevices())
+}
+
+func (e *encryptedDatabase) GetOrganizationSignatureDevices(organizationID string) ([]*types.SignatureDevice, error) {
+	return e.decryptAll(e.db.GetOrganizationSignatureDevices(organizationID))
+}
+
+func (e *encryptedDatabase) CreateSignatureDevice(device *types.SignatureDevice) error {
+	encrypted, err := e.encrypt(device)
+	if err != nil {
+		return err
+	}
+	return e.db.CreateSignatureDevice(encrypted)
+}
+
+func (e *encryptedDatabase) CreateOrganizationSignatureDevice(device *types.SignatureDevice, maxDevices int) error {
+	encrypted, err := e.encrypt(device)
+	if err != nil {
+		return err
+	}
+	return e.db.CreateOrganizationSignatureDevice(encrypted, maxDevices)
+}
+
+// UpdateSignatureDevice encrypts the key of the device, which also encrypts keys stored before encryption was enabled.
+func (e *encryptedDatabase) UpdateSignatureDevice(updatedDevice *types.SignatureDevice) error {
+	encrypted, err := e.encrypt(updatedDevice)
+	if err != nil {
+		return err
+	}
+	return e.db.UpdateSignatureDevice(encrypted)
+}
+
+func (e *encryptedDatabase) BeginDeviceTx(id string) (domain.DeviceTx, error) {
+	tx, err := e.db.BeginDeviceTx(id)
+	if err != nil {
+		return nil, err
+	}
+	key, err := e.keys.unwrap(tx.Device())
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return &encryptedTx{DeviceTx: tx, key: key}, nil
+}
+
+func (e *encryptedDatabase) GetSignature(deviceID string, counter uint32) (*types.Signature, error) {
+	return e.db.GetSignature(deviceID, counter)
+}
+
+func (e *encryptedDatabase) GetSignatures(deviceID string, from, to uint32) ([]types.Signature, error) {
+	return e.db.GetSignatures(deviceID, from, to)
+}
+
+func (e *encryptedDatabase) GetLastSignature(deviceID string) (*types.Signature, error) {
+	return e.db.GetLastSignature(deviceID)
+}
+
+func (t *encryptedTx) Device() *types.SignatureDevice {
+	device := t.DeviceTx.Device()
+	device.PkPem = bytes.Clone(t.key)
+	return device
+}
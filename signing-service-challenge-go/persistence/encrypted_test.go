@@ -0,0 +1,151 @@
+package persistence
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence/dbtest"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+)
+
+func newKeyEncryptionKeys(t *testing.T, fill byte) *KeyEncryptionKeys {
+	t.Helper()
+	keys, err := NewKeyEncryptionKeys(bytes.Repeat([]byte{fill}, 32))
+	if err != nil {
+		t.Fatalf("failed to create key-encryption keys: %v", err)
+	}
+	return keys
+}
+
+func TestEncryptKeys(t *testing.T) {
+	dbtest.Run(t, func(*testing.T) domain.Database {
+		return EncryptKeys(NewInMemoryDatabase(), newKeyEncryptionKeys(t, 1))
+	})
+}
+
+func TestEncryptKeys_Storage(t *testing.T) {
+	stored := NewInMemoryDatabase()
+	db := EncryptKeys(stored, newKeyEncryptionKeys(t, 1))
+	for _, device := range []*types.SignatureDevice{
+		{ID: "a", Algorithm: types.ECC, PkPem: []byte("key a"), OrganizationID: "store-a"},
+		{ID: "b", Algorithm: types.ECC, PkPem: []byte("key b"), OrganizationID: "store-b"},
+	} {
+		if err := db.CreateSignatureDevice(device); err != nil {
+			t.Fatalf("failed to create device: %v", err)
+		}
+		if string(device.PkPem) != "key "+device.ID {
+			t.Fatalf("expected the key of the caller to stay unencrypted, got %q", device.PkPem)
+		}
+	}
+
+	a, err := stored.GetSignatureDevice("a")
+	if err != nil {
+		t.Fatalf("failed to get device: %v", err)
+	}
+	if bytes.Contains(a.PkPem, []byte("key a")) || !strings.Contains(string(a.PkPem), encryptedKeyType) {
+		t.Fatalf("expected an encrypted key in storage, got %q", a.PkPem)
+	}
+	tx, err := db.BeginDeviceTx("a")
+	if err != nil {
+		t.Fatalf("failed to begin unit of work: %v", err)
+	}
+	if device := tx.Device(); string(device.PkPem) != "key a" {
+		t.Fatalf("expected the decrypted key, got %q", device.PkPem)
+	}
+	tx.Rollback()
+
+	// the key of one organization cannot be moved to a device of another organization
+	b, err := stored.GetSignatureDevice("b")
+	if err != nil {
+		t.Fatalf("failed to get device: %v", err)
+	}
+	b.PkPem = a.PkPem
+	if err = stored.UpdateSignatureDevice(b); err != nil {
+		t.Fatalf("failed to update device: %v", err)
+	}
+	if _, err = db.GetSignatureDevice("b"); err == nil {
+		t.Fatal("expected an error for a key of another organization")
+	}
+	if _, err = db.GetOrganizationSignatureDevices("store-b"); err == nil {
+		t.Fatal("expected an error listing a device whose key cannot be decrypted")
+	}
+
+	// a different master key derives different key-encryption keys
+	if _, err = EncryptKeys(stored, newKeyEncryptionKeys(t, 2)).GetSignatureDevice("a"); err == nil {
+		t.Fatal("expected an error for another master key")
+	}
+}
+
+func TestEncryptKeys_Unencrypted(t *testing.T) {
+	stored := NewInMemoryDatabase()
+	if err := stored.CreateSignatureDevice(&types.SignatureDevice{ID: "a", Algorithm: types.ECC, PkPem: []byte("key a")}); err != nil {
+		t.Fatalf("failed to create device: %v", err)
+	}
+	db := EncryptKeys(stored, newKeyEncryptionKeys(t, 1))
+	device, err := db.GetSignatureDevice("a")
+	if err != nil || string(device.PkPem) != "key a" {
+		t.Fatalf("expected the key stored before encryption, got %q, %v", device.PkPem, err)
+	}
+
+	// keys stored before encryption was enabled are encrypted on their next update
+	if err = db.UpdateSignatureDevice(device); err != nil {
+		t.Fatalf("failed to update device: %v", err)
+	}
+	if device, _ = stored.GetSignatureDevice("a"); bytes.Contains(device.PkPem, []byte("key a")) {
+		t.Fatalf("expected an encrypted key in storage, got %q", device.PkPem)
+	}
+}
+
+func TestEncryptStoredKeys(t *testing.T) {
+	stored := NewInMemoryDatabase()
+	for _, id := range []string{"a", "b"} {
+		if err := stored.CreateSignatureDevice(&types.SignatureDevice{ID: id, Algorithm: types.ECC, PkPem: []byte("key " + id)}); err != nil {
+			t.Fatalf("failed to create device: %v", err)
+		}
+	}
+	keys := newKeyEncryptionKeys(t, 1)
+	db := EncryptKeys(stored, keys)
+	if err := db.CreateSignatureDevice(&types.SignatureDevice{ID: "c", Algorithm: types.ECC, PkPem: []byte("key c")}); err != nil {
+		t.Fatalf("failed to create device: %v", err)
+	}
+	c, _ := stored.GetSignatureDevice("c")
+
+	if encrypted, err := EncryptStoredKeys(stored, keys); err != nil || encrypted != 2 {
+		t.Fatalf("expected 2 encrypted keys, got %d, %v", encrypted, err)
+	}
+	for _, id := range []string{"a", "b"} {
+		if device, _ := stored.GetSignatureDevice(id); !strings.Contains(string(device.PkPem), encryptedKeyType) {
+			t.Fatalf("expected an encrypted key in storage, got %q", device.PkPem)
+		}
+		if device, err := db.GetSignatureDevice(id); err != nil || string(device.PkPem) != "key "+id {
+			t.Fatalf("expected the decrypted key, got %q, %v", device.PkPem, err)
+		}
+	}
+	// keys that are already encrypted are not encrypted again
+	if device, _ := stored.GetSignatureDevice("c"); !bytes.Equal(device.PkPem, c.PkPem) {
+		t.Fatalf("expected the encrypted key to be unchanged, got %q", device.PkPem)
+	}
+	if encrypted, err := EncryptStoredKeys(stored, keys); err != nil || encrypted != 0 {
+		t.Fatalf("expected no encrypted keys, got %d, %v", encrypted, err)
+	}
+}
+
+func TestLoadKeyEncryptionKeyFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "kek")
+	if err := os.WriteFile(file, []byte(strings.Repeat("ab", 32)+"\n"), 0o600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+	if _, err := LoadKeyEncryptionKeyFile(file); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := os.WriteFile(file, []byte(strings.Repeat("ab", 16)), 0o600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+	if _, err := LoadKeyEncryptionKeyFile(file); err == nil {
+		t.Fatal("expected an error for a short key")
+	}
+}
@@ -0,0 +1,584 @@
+package persistence
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+)
+
+const (
+	walFileName      = "wal.log"
+	snapshotFileName = "snapshot"
+	keysFileName     = "api_keys"
+	snapshotVersion  = 1
+
+	// DefaultSnapshotInterval is the number of log records after which a snapshot is taken.
+	DefaultSnapshotInterval = 1000
+
+	// recordHeaderSize is the size of the length, the payload checksum and the header checksum preceding every record.
+	recordHeaderSize = 12
+)
+
+var (
+	// ErrCorruptLog is returned on startup if the write-ahead log is damaged other than by a record cut short at its tail.
+	ErrCorruptLog = errors.New("write-ahead log is corrupt")
+	// ErrCorruptSnapshot is returned on startup if the snapshot fails its checksum or cannot be decoded.
+	ErrCorruptSnapshot = errors.New("snapshot is corrupt")
+	// ErrCorruptKeys is returned on startup if the API keys file fails its checksum or cannot be decoded.
+	ErrCorruptKeys = errors.New("API keys file is corrupt")
+	// ErrCorruptOrganizations is returned on startup if the organizations file fails its checksum or cannot be decoded.
+	ErrCorruptOrganizations = errors.New("organizations file is corrupt")
+	// ErrDatabaseFailed is returned by every write after the log could not be written consistently.
+	ErrDatabaseFailed = errors.New("database failed, restart to recover from the log")
+)
+
+// crcTable is the Castagnoli polynomial, which is hardware accelerated on most platforms.
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+const (
+	// opPut stores a new device, opUpdate the device and the signatures appended to its chain.
+	opPut    = "put"
+	opUpdate = "update"
+)
+
+// record is an entry of the write-ahead log. Updates only carry the signatures appended since the
+// previous record of the device, as signatures of the chain never change once written.
+type record struct {
+	Sequence   uint64                 `json:"seq"`
+	Operation  string                 `json:"op"`
+	Device     *types.SignatureDevice `json:"device"`
+	Signatures []types.Signature      `json:"signatures,omitempty"`
+}
+
+// snapshot is the state of all devices up to and including the record with the given sequence number.
+type snapshot struct {
+	Version    int                          `json:"version"`
+	Sequence   uint64                       `json:"seq"`
+	Devices    []*types.SignatureDevice     `json:"devices"`
+	Signatures map[string][]types.Signature `json:"signatures"`
+}
+
+// FileOption configures optional behaviour of a FileDatabase.
+type FileOption func(*FileDatabase)
+
+// WithSnapshotInterval takes a snapshot and truncates the log after the given number of records.
+func WithSnapshotInterval(records int) FileOption {
+	return func(d *FileDatabase) {
+		d.snapshotInterval = records
+	}
+}
+
+// FileDatabase is a durable, thread-safe implementation of the Database interface. Every change is
+// appended to a write-ahead log and synced to disk before it becomes visible. The log is periodically
+// compacted into a snapshot, and replayed on top of the latest snapshot on startup. API keys and
+// organizations, which change rarely, are kept apart from the log in files that are replaced on every change.
+//
+// Devices are copied on the way in and out, callers never share state with the database.
+type FileDatabase struct {
+	lock             sync.Mutex
+	locks            deviceLocks
+	dir              string
+	wal              *os.File
+	walSize          int64
+	sequence         uint64
+	records          int
+	snapshotInterval int
+	failed           bool
+	db               map[string]*types.SignatureDevice
+	signatures       chains
+	keys             apiKeys
+	organizations    organizations
+}
+
+// OpenFileDatabase opens the database in the given directory, creating it if necessary, and recovers
+// its state from the snapshot and the log. A record cut short at the tail of the log, as left behind by
+// a crash during a write, is discarded. A complete record failing its checksum fails with ErrCorruptLog.
+func OpenFileDatabase(dir string, opts ...FileOption) (*FileDatabase, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %w", err)
+	}
+	d := &FileDatabase{
+		dir:              dir,
+		snapshotInterval: DefaultSnapshotInterval,
+		db:               make(map[string]*types.SignatureDevice),
+		signatures:       make(chains),
+		keys:             make(apiKeys),
+		organizations:    make(organizations),
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	if err := d.loadSnapshot(); err != nil {
+		return nil, err
+	}
+	if err := d.loadKeys(); err != nil {
+		return nil, err
+	}
+	if err := d.loadOrganizations(); err != nil {
+		return nil, err
+	}
+	wal, err := os.OpenFile(filepath.Join(dir, walFileName), os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open write-ahead log: %w", err)
+	}
+	if err = syncDir(dir); err != nil {
+		wal.Close()
+		return nil, err
+	}
+	d.wal = wal
+	if err = d.replay(); err != nil {
+		wal.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+// Close releases the log file. The database must not be used afterwards.
+func (d *FileDatabase) Close() error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.wal.Close()
+}
+
+// Ping checks that the database accepts writes and that its log is still in the data directory.
+func (d *FileDatabase) Ping(context.Context) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.failed {
+		return ErrDatabaseFailed
+	}
+	if _, err := os.Stat(filepath.Join(d.dir, walFileName)); err != nil {
+		return fmt.Errorf("failed to access write-ahead log: %w", err)
+	}
+	return nil
+}
+
+func (d *FileDatabase) GetSignatureDevice(id string) (*types.SignatureDevice, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	device, exists := d.db[id]
+	if !exists {
+		return nil, types.ErrDeviceNotFound
+	}
+	return cloneDevice(device), nil
+}
+
+func (d *FileDatabase) CreateSignatureDevice(device *types.SignatureDevice) error {
+	return d.CreateOrganizationSignatureDevice(device, 0)
+}
+
+func (d *FileDatabase) CreateOrganizationSignatureDevice(device *types.SignatureDevice, maxDevices int) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	// We must not overwrite an existing device.
+	if _, exists := d.db[device.ID]; exists {
+		return types.ErrDeviceAlreadyExists
+	}
+	if maxDevices > 0 && countDevices(d.db, device.Organization()) >= maxDevices {
+		return types.ErrDeviceQuotaExceeded
+	}
+	stored := cloneDevice(device)
+	if err := d.append(record{Operation: opPut, Device: stored}); err != nil {
+		return err
+	}
+	d.db[stored.ID] = stored
+	d.compact()
+	return nil
+}
+
+func (d *FileDatabase) UpdateSignatureDevice(updatedDevice *types.SignatureDevice) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	current, exists := d.db[updatedDevice.ID]
+	if !exists {
+		return types.ErrDeviceNotFound
+	}
+	stored := withChainOf(updatedDevice, current)
+	if err := d.append(record{Operation: opUpdate, Device: stored}); err != nil {
+		return err
+	}
+	d.db[stored.ID] = stored
+	d.compact()
+	return nil
+}
+
+// BeginDeviceTx locks the device until the unit of work ends. Committing it appends a single
+// record with all signatures of the unit of work to the log.
+func (d *FileDatabase) BeginDeviceTx(id string) (domain.DeviceTx, error) {
+	release := d.locks.acquire(id)
+	device, err := d.GetSignatureDevice(id)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	return &deviceTx{device: device, commit: d.commit, release: release}, nil
+}
+
+func (d *FileDatabase) commit(device *types.SignatureDevice, appended []types.Signature) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	current, exists := d.db[device.ID]
+	if !exists {
+		return types.ErrDeviceNotFound
+	}
+	stored, err := appendSignatures(current, appended)
+	if err != nil {
+		return err
+	}
+	if err = d.append(record{Operation: opUpdate, Device: stored, Signatures: appended}); err != nil {
+		return err
+	}
+	d.db[stored.ID] = stored
+	d.signatures[stored.ID] = append(d.signatures[stored.ID], appended...)
+	d.compact()
+	return nil
+}
+
+func (d *FileDatabase) GetAllSignatureDevices() ([]*types.SignatureDevice, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	devices := make([]*types.SignatureDevice, 0, len(d.db))
+	for _, device := range d.db {
+		devices = append(devices, cloneDevice(device))
+	}
+	return devices, nil
+}
+
+func (d *FileDatabase) GetOrganizationSignatureDevices(organizationID string) ([]*types.SignatureDevice, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return organizationDevices(d.db, organizationID), nil
+}
+
+func (d *FileDatabase) GetSignature(deviceID string, counter uint32) (*types.Signature, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if _, exists := d.db[deviceID]; !exists {
+		return nil, types.ErrDeviceNotFound
+	}
+	return d.signatures.get(deviceID, counter)
+}
+
+func (d *FileDatabase) GetSignatures(deviceID string, from, to uint32) ([]types.Signature, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if _, exists := d.db[deviceID]; !exists {
+		return nil, types.ErrDeviceNotFound
+	}
+	return d.signatures.between(deviceID, from, to), nil
+}
+
+func (d *FileDatabase) GetLastSignature(deviceID string) (*types.Signature, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if _, exists := d.db[deviceID]; !exists {
+		return nil, types.ErrDeviceNotFound
+	}
+	return d.signatures.last(deviceID)
+}
+
+// Snapshot writes the current state to the snapshot file and truncates the log.
+func (d *FileDatabase) Snapshot() error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.failed {
+		return ErrDatabaseFailed
+	}
+	return d.snapshot()
+}
+
+// append writes the record to the log and syncs it to disk. The caller must hold the lock.
+func (d *FileDatabase) append(r record) error {
+	if d.failed {
+		return ErrDatabaseFailed
+	}
+	r.Sequence = d.sequence + 1
+	payload, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("failed to encode log record: %w", err)
+	}
+	if _, err = d.wal.WriteAt(frame(payload), d.walSize); err != nil {
+		// Drop whatever part of the record made it to the file, the next write would otherwise follow garbage.
+		if truncateErr := d.wal.Truncate(d.walSize); truncateErr != nil {
+			d.failed = true
+			slog.Error("Write-ahead log is inconsistent, refusing further writes", "error", truncateErr)
+		}
+		return fmt.Errorf("failed to write log record: %w", err)
+	}
+	if err = d.wal.Sync(); err != nil {
+		// After a failed sync it is unknown what reached the disk, only a replay of the log can tell.
+		d.failed = true
+		return fmt.Errorf("%w: failed to sync log record: %v", ErrDatabaseFailed, err)
+	}
+	d.walSize += int64(recordHeaderSize + len(payload))
+	d.sequence = r.Sequence
+	d.records++
+	return nil
+}
+
+// compact takes a snapshot once enough records have been written. It must be called after
+// the last record has been applied to the state. The caller must hold the lock.
+func (d *FileDatabase) compact() {
+	if d.snapshotInterval <= 0 || d.records < d.snapshotInterval {
+		return
+	}
+	// The records are durable, a failed snapshot only means a longer replay on the next start.
+	if err := d.snapshot(); err != nil {
+		slog.Warn("Failed to take snapshot", "error", err)
+	}
+}
+
+// snapshot atomically replaces the snapshot file, then truncates the log. A crash in between leaves
+// records in the log that are already part of the snapshot, which replay skips by their sequence number.
+func (d *FileDatabase) snapshot() error {
+	state := snapshot{
+		Version:    snapshotVersion,
+		Sequence:   d.sequence,
+		Devices:    make([]*types.SignatureDevice, 0, len(d.db)),
+		Signatures: d.signatures,
+	}
+	for _, device := range d.db {
+		state.Devices = append(state.Devices, device)
+	}
+	payload, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+	if err = writeFileAtomic(filepath.Join(d.dir, snapshotFileName), frame(payload)); err != nil {
+		return err
+	}
+	// Like in append, a log whose size is no longer known must not be written to.
+	if err = d.wal.Truncate(0); err != nil {
+		d.failed = true
+		return fmt.Errorf("%w: failed to truncate write-ahead log: %v", ErrDatabaseFailed, err)
+	}
+	d.walSize = 0
+	d.records = 0
+	if err = d.wal.Sync(); err != nil {
+		d.failed = true
+		return fmt.Errorf("%w: failed to sync write-ahead log: %v", ErrDatabaseFailed, err)
+	}
+	return nil
+}
+
+// loadSnapshot restores the state of the snapshot file, if there is one.
+func (d *FileDatabase) loadSnapshot() error {
+	data, err := os.ReadFile(filepath.Join(d.dir, snapshotFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	payload, rest, err := unframe(data)
+	if err != nil || len(rest) > 0 {
+		return fmt.Errorf("%w: checksum mismatch", ErrCorruptSnapshot)
+	}
+	var state snapshot
+	if err = json.Unmarshal(payload, &state); err != nil {
+		return fmt.Errorf("%w: %v", ErrCorruptSnapshot, err)
+	}
+	if state.Version != snapshotVersion {
+		return fmt.Errorf("%w: unsupported version %d", ErrCorruptSnapshot, state.Version)
+	}
+	for _, device := range state.Devices {
+		if device == nil {
+			return fmt.Errorf("%w: device without attributes", ErrCorruptSnapshot)
+		}
+		if err = d.restore(device, nil, state.Signatures[device.ID]); err != nil {
+			return fmt.Errorf("%w: %v", ErrCorruptSnapshot, err)
+		}
+	}
+	d.sequence = state.Sequence
+	return nil
+}
+
+// replay applies all records of the log that are newer than the snapshot.
+func (d *FileDatabase) replay() error {
+	data, err := io.ReadAll(d.wal)
+	if err != nil {
+		return fmt.Errorf("failed to read write-ahead log: %w", err)
+	}
+	var offset int64
+	for len(data) > 0 {
+		payload, rest, err := unframe(data)
+		if err != nil {
+			if isTornTail(data, err) {
+				return d.discardTail(offset, int64(len(data)))
+			}
+			return fmt.Errorf("%w: %v at offset %d", ErrCorruptLog, err, offset)
+		}
+		var r record
+		if err = json.Unmarshal(payload, &r); err != nil {
+			return fmt.Errorf("%w: record at offset %d: %v", ErrCorruptLog, offset, err)
+		}
+		if err = d.apply(r); err != nil {
+			return fmt.Errorf("%w: record at offset %d: %v", ErrCorruptLog, offset, err)
+		}
+		offset += int64(len(data) - len(rest))
+		data = rest
+	}
+	d.walSize = offset
+	return nil
+}
+
+// isTornTail reports whether a record that failed to decode is the remainder of an interrupted write,
+// rather than damage to a record that was written completely. A complete record may have been synced
+// and acknowledged, so a checksum mismatch in it is never discarded but left to an operator.
+func isTornTail(data []byte, err error) bool {
+	switch {
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		// the header or the payload was not written completely
+		return true
+	case errors.Is(err, errHeaderChecksum):
+		// the file was extended but the header never made it to disk
+		return !slices.ContainsFunc(data, func(b byte) bool { return b != 0 })
+	default:
+		return false
+	}
+}
+
+// discardTail truncates a torn record of the given length at the end of the log.
+func (d *FileDatabase) discardTail(offset int64, length int64) error {
+	slog.Warn("Discarding torn record at the end of the write-ahead log", "bytes", length)
+	if err := d.wal.Truncate(offset); err != nil {
+		return fmt.Errorf("failed to truncate write-ahead log: %w", err)
+	}
+	if err := d.wal.Sync(); err != nil {
+		return fmt.Errorf("failed to sync write-ahead log: %w", err)
+	}
+	d.walSize = offset
+	return nil
+}
+
+// apply replays a single record on top of the current state.
+func (d *FileDatabase) apply(r record) error {
+	if r.Sequence <= d.sequence {
+		// already part of the snapshot
+		return nil
+	}
+	if r.Sequence != d.sequence+1 {
+		return fmt.Errorf("expected sequence number %d, got %d", d.sequence+1, r.Sequence)
+	}
+	if r.Device == nil {
+		return errors.New("record without device")
+	}
+	var err error
+	switch r.Operation {
+	case opPut:
+		err = d.restore(r.Device, nil, nil)
+	case opUpdate:
+		if _, exists := d.db[r.Device.ID]; !exists {
+			return fmt.Errorf("update of unknown device %s", r.Device.ID)
+		}
+		err = d.restore(r.Device, d.signatures[r.Device.ID], r.Signatures)
+	default:
+		return fmt.Errorf("unknown operation %q", r.Operation)
+	}
+	if err != nil {
+		return err
+	}
+	d.sequence = r.Sequence
+	d.records++
+	return nil
+}
+
+var (
+	errHeaderChecksum  = errors.New("record header checksum mismatch")
+	errPayloadChecksum = errors.New("record checksum mismatch")
+)
+
+// frame prefixes the payload with its length, its CRC-32C checksum and the checksum of these two fields,
+// which allows telling a corrupt length apart from a record that was cut short.
+func frame(payload []byte) []byte {
+	framed := make([]byte, recordHeaderSize, recordHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(framed, uint32(len(payload)))
+	binary.BigEndian.PutUint32(framed[4:], crc32.Checksum(payload, crcTable))
+	binary.BigEndian.PutUint32(framed[8:], crc32.Checksum(framed[:8], crcTable))
+	return append(framed, payload...)
+}
+
+// unframe is the inverse of frame and returns the data following the payload.
+func unframe(data []byte) ([]byte, []byte, error) {
+	if len(data) < recordHeaderSize {
+		return nil, nil, io.ErrUnexpectedEOF
+	}
+	if crc32.Checksum(data[:8], crcTable) != binary.BigEndian.Uint32(data[8:]) {
+		return nil, nil, errHeaderChecksum
+	}
+	size := binary.BigEndian.Uint32(data)
+	if uint64(size) > uint64(len(data)-recordHeaderSize) {
+		return nil, nil, io.ErrUnexpectedEOF
+	}
+	payload := data[recordHeaderSize : recordHeaderSize+size]
+	if crc32.Checksum(payload, crcTable) != binary.BigEndian.Uint32(data[4:]) {
+		return nil, nil, errPayloadChecksum
+	}
+	return payload, data[recordHeaderSize+size:], nil
+}
+
+// writeFileAtomic replaces the file with data such that either the old or the new content survives a crash.
+func writeFileAtomic(name string, data []byte) error {
+	dir := filepath.Dir(name)
+	tmp, err := os.CreateTemp(dir, filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", name, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = io.Copy(tmp, bytes.NewReader(data)); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	if err = os.Rename(tmp.Name(), name); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", name, err)
+	}
+	return syncDir(dir)
+}
+
+// syncDir makes changes to the entries of a directory durable.
+func syncDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", dir, err)
+	}
+	defer f.Close()
+	if err = f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync %s: %w", dir, err)
+	}
+	return nil
+}
+
+// restore sets the device while recovering and appends the signatures to its chain.
+// The counter and the last signature of the device are derived from the chain.
+func (d *FileDatabase) restore(device *types.SignatureDevice, chain, appended []types.Signature) error {
+	for _, signature := range appended {
+		if int64(signature.Counter) != int64(len(chain)) {
+			return fmt.Errorf("signature %d of device %s found at counter %d", signature.Counter, device.ID, len(chain))
+		}
+		chain = append(chain, signature)
+	}
+	if len(chain) > 0 {
+		advance(device, chain[len(chain)-1])
+	}
+	d.db[device.ID] = device
+	d.signatures[device.ID] = chain
+	return nil
+}
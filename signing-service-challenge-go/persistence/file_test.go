@@ -0,0 +1,402 @@
+package persistence
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence/dbtest"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+)
+
+// fill creates a device and signs n times with it, returning the size of the log after every write.
+func fill(t *testing.T, db *FileDatabase, id string, n int) []int64 {
+	t.Helper()
+	sizes := make([]int64, 0, n+1)
+	if err := db.CreateSignatureDevice(&types.SignatureDevice{ID: id, Algorithm: types.ECC, PkPem: []byte("key")}); err != nil {
+		t.Fatalf("failed to create device: %v", err)
+	}
+	sizes = append(sizes, db.walSize)
+	for range n {
+		tx, err := db.BeginDeviceTx(id)
+		if err != nil {
+			t.Fatalf("failed to begin unit of work: %v", err)
+		}
+		counter := tx.Device().Counter
+		err = tx.AppendSignature(types.Signature{
+			Counter:   counter,
+			Value:     []byte{byte(counter)},
+			Timestamp: time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC),
+		})
+		if err != nil {
+			t.Fatalf("failed to append signature: %v", err)
+		}
+		if err = tx.Commit(); err != nil {
+			t.Fatalf("failed to commit: %v", err)
+		}
+		sizes = append(sizes, db.walSize)
+	}
+	return sizes
+}
+
+// reopen simulates a restart, the database is not closed as a crash would not close it either.
+func reopen(t *testing.T, dir string, opts ...FileOption) *FileDatabase {
+	t.Helper()
+	db, err := OpenFileDatabase(dir, opts...)
+	if err != nil {
+		t.Fatalf("failed to reopen database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func expectCounter(t *testing.T, db *FileDatabase, id string, counter uint32) {
+	t.Helper()
+	device, err := db.GetSignatureDevice(id)
+	if err != nil {
+		t.Fatalf("failed to get device: %v", err)
+	}
+	signatures, err := db.GetSignatures(id, 0, math.MaxUint32)
+	if err != nil {
+		t.Fatalf("failed to get signatures: %v", err)
+	}
+	if device.Counter != counter || len(signatures) != int(counter) {
+		t.Fatalf("expected counter %d, got %d with %d signatures", counter, device.Counter, len(signatures))
+	}
+}
+
+func TestFileDatabase_Recovery(t *testing.T) {
+	tests := []struct {
+		name string
+		// damage modifies the log given the log sizes after every write and returns the expected counter.
+		damage func(t *testing.T, wal string, sizes []int64) uint32
+	}{
+		{
+			name: "Clean Restart",
+			damage: func(*testing.T, string, []int64) uint32 {
+				return 5
+			},
+		},
+		{
+			name: "Torn Header",
+			damage: func(t *testing.T, wal string, sizes []int64) uint32 {
+				truncate(t, wal, sizes[4]+recordHeaderSize/2)
+				return 4
+			},
+		},
+		{
+			name: "Torn Payload",
+			damage: func(t *testing.T, wal string, sizes []int64) uint32 {
+				truncate(t, wal, sizes[5]-1)
+				return 4
+			},
+		},
+		{
+			name: "Zeroed Tail",
+			damage: func(t *testing.T, wal string, sizes []int64) uint32 {
+				appendBytes(t, wal, make([]byte, 64))
+				return 5
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			db, err := OpenFileDatabase(dir)
+			if err != nil {
+				t.Fatalf("failed to open database: %v", err)
+			}
+			sizes := fill(t, db, "a", 5)
+			db.Close()
+
+			want := test.damage(t, filepath.Join(dir, walFileName), sizes)
+			db = reopen(t, dir)
+			expectCounter(t, db, "a", want)
+
+			// the recovered log must accept further writes that survive the next restart
+			fill(t, db, "b", 1)
+			expectCounter(t, reopen(t, dir), "a", want)
+		})
+	}
+}
+
+func TestFileDatabase_CorruptLog(t *testing.T) {
+	tests := []struct {
+		name   string
+		damage func(t *testing.T, wal string, sizes []int64)
+	}{
+		{
+			name: "Corrupt Payload",
+			damage: func(t *testing.T, wal string, sizes []int64) {
+				flip(t, wal, sizes[2]-2)
+			},
+		},
+		{
+			name: "Corrupt Length",
+			damage: func(t *testing.T, wal string, sizes []int64) {
+				flip(t, wal, sizes[2])
+			},
+		},
+		{
+			// the last record was written completely and may have been acknowledged
+			name: "Corrupt Tail",
+			damage: func(t *testing.T, wal string, sizes []int64) {
+				flip(t, wal, sizes[5]-2)
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			db, err := OpenFileDatabase(dir)
+			if err != nil {
+				t.Fatalf("failed to open database: %v", err)
+			}
+			sizes := fill(t, db, "a", 5)
+			db.Close()
+
+			test.damage(t, filepath.Join(dir, walFileName), sizes)
+			if _, err = OpenFileDatabase(dir); !errors.Is(err, ErrCorruptLog) {
+				t.Fatalf("expected %q, got %v", ErrCorruptLog, err)
+			}
+		})
+	}
+}
+
+func TestFileDatabase_Ping(t *testing.T) {
+	dir := t.TempDir()
+	db, err := OpenFileDatabase(dir)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	if err = db.Ping(context.Background()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err = os.Remove(filepath.Join(dir, walFileName)); err != nil {
+		t.Fatalf("failed to remove log: %v", err)
+	}
+	if err = db.Ping(context.Background()); err == nil {
+		t.Fatalf("expected an error for a missing log")
+	}
+	db.failed = true
+	if err = db.Ping(context.Background()); !errors.Is(err, ErrDatabaseFailed) {
+		t.Fatalf("expected %q, got %v", ErrDatabaseFailed, err)
+	}
+}
+
+func TestFileDatabase_Snapshot(t *testing.T) {
+	dir := t.TempDir()
+	db, err := OpenFileDatabase(dir, WithSnapshotInterval(4))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	sizes := fill(t, db, "a", 6)
+	if sizes[3] != 0 {
+		t.Fatalf("expected the log to be truncated after the fourth record, got %d bytes", sizes[3])
+	}
+	db.Close()
+
+	db = reopen(t, dir, WithSnapshotInterval(4))
+	expectCounter(t, db, "a", 6)
+	db.Close()
+
+	// a corrupt snapshot must not be mistaken for an empty database
+	flip(t, filepath.Join(dir, snapshotFileName), 20)
+	if _, err = OpenFileDatabase(dir); !errors.Is(err, ErrCorruptSnapshot) {
+		t.Fatalf("expected %q, got %v", ErrCorruptSnapshot, err)
+	}
+}
+
+func TestFileDatabase_SnapshotTruncateFails(t *testing.T) {
+	dir := t.TempDir()
+	db, err := OpenFileDatabase(dir, WithSnapshotInterval(0))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	fill(t, db, "a", 3)
+	// a read-only handle cannot be truncated
+	wal := db.wal
+	if db.wal, err = os.Open(filepath.Join(dir, walFileName)); err != nil {
+		t.Fatalf("failed to open log: %v", err)
+	}
+	wal.Close()
+	if err = db.Snapshot(); !errors.Is(err, ErrDatabaseFailed) {
+		t.Fatalf("expected %q, got %v", ErrDatabaseFailed, err)
+	}
+	err = db.CreateSignatureDevice(&types.SignatureDevice{ID: "b", Algorithm: types.ECC, PkPem: []byte("key")})
+	if !errors.Is(err, ErrDatabaseFailed) {
+		t.Fatalf("expected %q, got %v", ErrDatabaseFailed, err)
+	}
+	db.Close()
+
+	expectCounter(t, reopen(t, dir), "a", 3)
+}
+
+func TestFileDatabase_CrashAfterSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	wal := filepath.Join(dir, walFileName)
+	db, err := OpenFileDatabase(dir, WithSnapshotInterval(0))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	fill(t, db, "a", 3)
+	beforeSnapshot, err := os.ReadFile(wal)
+	if err != nil {
+		t.Fatalf("failed to read log: %v", err)
+	}
+	if err = db.Snapshot(); err != nil {
+		t.Fatalf("failed to take snapshot: %v", err)
+	}
+	db.Close()
+
+	// crash between writing the snapshot and truncating the log
+	if err = os.WriteFile(wal, beforeSnapshot, 0o600); err != nil {
+		t.Fatalf("failed to restore log: %v", err)
+	}
+	db = reopen(t, dir)
+	expectCounter(t, db, "a", 3)
+	fill(t, db, "b", 1)
+	expectCounter(t, reopen(t, dir), "a", 3)
+}
+
+func TestFileDatabase_DeviceTx(t *testing.T) {
+	dir := t.TempDir()
+	db, err := OpenFileDatabase(dir)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	fill(t, db, "a", 2)
+	tx, err := db.BeginDeviceTx("a")
+	if err != nil {
+		t.Fatalf("failed to begin unit of work: %v", err)
+	}
+	for counter := range uint32(2) {
+		err = tx.AppendSignature(types.Signature{Counter: 2 + counter, Value: []byte{byte(counter)}, Timestamp: time.Now()})
+		if err != nil {
+			t.Fatalf("failed to append signature: %v", err)
+		}
+	}
+	before := db.walSize
+	if err = tx.Commit(); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+	if db.walSize == before {
+		t.Fatal("expected the commit to be written to the log")
+	}
+	// a commit is durable without closing the database
+	expectCounter(t, reopen(t, dir), "a", 4)
+}
+
+func TestFileDatabase_SnapshotVersion(t *testing.T) {
+	payload, err := json.Marshal(snapshot{Version: snapshotVersion + 1})
+	if err != nil {
+		t.Fatalf("failed to encode snapshot: %v", err)
+	}
+	dir := t.TempDir()
+	if err = os.WriteFile(filepath.Join(dir, snapshotFileName), frame(payload), 0o600); err != nil {
+		t.Fatalf("failed to write snapshot: %v", err)
+	}
+	if _, err = OpenFileDatabase(dir); !errors.Is(err, ErrCorruptSnapshot) {
+		t.Fatalf("expected %q, got %v", ErrCorruptSnapshot, err)
+	}
+}
+
+func truncate(t *testing.T, name string, size int64) {
+	t.Helper()
+	if err := os.Truncate(name, size); err != nil {
+		t.Fatalf("failed to truncate %s: %v", name, err)
+	}
+}
+
+func flip(t *testing.T, name string, offset int64) {
+	t.Helper()
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", name, err)
+	}
+	data[offset] ^= 0xff
+	if err = os.WriteFile(name, data, 0o600); err != nil {
+		t.Fatalf("failed to write %s: %v", name, err)
+	}
+}
+
+func appendBytes(t *testing.T, name string, data []byte) {
+	t.Helper()
+	f, err := os.OpenFile(name, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("failed to open %s: %v", name, err)
+	}
+	defer f.Close()
+	if _, err = f.Write(data); err != nil {
+		t.Fatalf("failed to write %s: %v", name, err)
+	}
+}
+
+func TestFileDatabase_APIKeysReopen(t *testing.T) {
+	dir := t.TempDir()
+	db, err := OpenFileDatabase(dir)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	created := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	for _, id := range []string{"a", "b"} {
+		if err = db.CreateAPIKey(dbtest.NewKey(id, created)); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	if err = db.RevokeAPIKey("b", created.Add(time.Hour)); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	db.Close()
+
+	db = reopen(t, dir)
+	keys, err := db.GetAllAPIKeys()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(keys) != 2 || keys[0].Revoked() || !keys[1].Revoked() {
+		t.Fatalf("expected key a active and key b revoked, got %+v", keys)
+	}
+	db.Close()
+
+	flip(t, filepath.Join(dir, keysFileName), 20)
+	if _, err = OpenFileDatabase(dir); !errors.Is(err, ErrCorruptKeys) {
+		t.Fatalf("expected %q, got %v", ErrCorruptKeys, err)
+	}
+}
+
+func TestFileDatabase_OrganizationsReopen(t *testing.T) {
+	dir := t.TempDir()
+	db, err := OpenFileDatabase(dir)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if err = db.CreateOrganization(dbtest.NewOrganization("a", 10)); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err = db.UpdateOrganization(dbtest.NewOrganization("a", 20)); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	db.Close()
+
+	db = reopen(t, dir)
+	organization, err := db.GetOrganization("a")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if organization.MaxDevices != 20 {
+		t.Fatalf("expected the updated quota, got %+v", organization)
+	}
+	db.Close()
+
+	flip(t, filepath.Join(dir, organizationsFileName), 20)
+	if _, err = OpenFileDatabase(dir); !errors.Is(err, ErrCorruptOrganizations) {
+		t.Fatalf("expected %q, got %v", ErrCorruptOrganizations, err)
+	}
+}
@@ -1,21 +1,36 @@
 package persistence
 
 import (
+	"context"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
 	"sync"
 )
 
 func NewInMemoryDatabase() *InMemoryDatabase {
 	return &InMemoryDatabase{
-		lock: sync.Mutex{},
-		db:   make(map[string]*types.SignatureDevice),
+		lock:          sync.Mutex{},
+		db:            make(map[string]*types.SignatureDevice),
+		signatures:    make(chains),
+		keys:          make(apiKeys),
+		organizations: make(organizations),
 	}
 }
 
 // InMemoryDatabase is a simple in-memory thread-safe implementation of the Database interface.
+// Devices are copied on the way in and out, so callers never share state with the database.
 type InMemoryDatabase struct {
-	lock sync.Mutex
-	db   map[string]*types.SignatureDevice
+	lock          sync.Mutex
+	locks         deviceLocks
+	db            map[string]*types.SignatureDevice
+	signatures    chains
+	keys          apiKeys
+	organizations organizations
+}
+
+// Ping always succeeds, the database is in the memory of the process.
+func (d *InMemoryDatabase) Ping(context.Context) error {
+	return nil
 }
 
 func (d *InMemoryDatabase) GetSignatureDevice(id string) (*types.SignatureDevice, error) {
@@ -23,12 +38,16 @@ func (d *InMemoryDatabase) GetSignatureDevice(id string) (*types.SignatureDevice
 	device, exists := d.db[id]
 	d.lock.Unlock()
 	if exists {
-		return device, nil
+		return cloneDevice(device), nil
 	}
 	return nil, types.ErrDeviceNotFound
 }
 
 func (d *InMemoryDatabase) CreateSignatureDevice(device *types.SignatureDevice) error {
+	return d.CreateOrganizationSignatureDevice(device, 0)
+}
+
+func (d *InMemoryDatabase) CreateOrganizationSignatureDevice(device *types.SignatureDevice, maxDevices int) error {
 	d.lock.Lock()
 	defer d.lock.Unlock()
 	// We must not overwrite an existing device.
@@ -36,51 +55,97 @@ func (d *InMemoryDatabase) CreateSignatureDevice(device *types.SignatureDevice)
 	if exists {
 		return types.ErrDeviceAlreadyExists
 	}
-	d.db[device.ID] = device
+	if maxDevices > 0 && countDevices(d.db, device.Organization()) >= maxDevices {
+		return types.ErrDeviceQuotaExceeded
+	}
+	d.db[device.ID] = cloneDevice(device)
 	return nil
 }
 
 func (d *InMemoryDatabase) UpdateSignatureDevice(updatedDevice *types.SignatureDevice) error {
 	d.lock.Lock()
 	defer d.lock.Unlock()
-	if _, exist := d.db[updatedDevice.ID]; !exist {
+	current, exist := d.db[updatedDevice.ID]
+	if !exist {
 		return types.ErrDeviceNotFound
 	}
-	d.db[updatedDevice.ID] = updatedDevice
+	d.db[updatedDevice.ID] = withChainOf(updatedDevice, current)
 	return nil
 }
 
-func (d *InMemoryDatabase) GetAllSignatureDevices() []*types.SignatureDevice {
+// BeginDeviceTx locks the device until the unit of work ends. Other units of work on
+// the device wait, while reads return the last committed state.
+func (d *InMemoryDatabase) BeginDeviceTx(id string) (domain.DeviceTx, error) {
+	release := d.locks.acquire(id)
+	device, err := d.GetSignatureDevice(id)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	return &deviceTx{device: device, commit: d.commit, release: release}, nil
+}
+
+func (d *InMemoryDatabase) commit(device *types.SignatureDevice, appended []types.Signature) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	current, exists := d.db[device.ID]
+	if !exists {
+		return types.ErrDeviceNotFound
+	}
+	stored, err := appendSignatures(current, appended)
+	if err != nil {
+		return err
+	}
+	d.db[device.ID] = stored
+	d.signatures[device.ID] = append(d.signatures[device.ID], appended...)
+	return nil
+}
+
+func (d *InMemoryDatabase) GetAllSignatureDevices() ([]*types.SignatureDevice, error) {
 	d.lock.Lock()
 	defer d.lock.Unlock()
 	if len(d.db) == 0 {
-		return []*types.SignatureDevice{}
+		return []*types.SignatureDevice{}, nil
 	}
 	devices := make([]*types.SignatureDevice, len(d.db))
 	idx := 0
 	for _, device := range d.db {
-		devices[idx] = device
+		devices[idx] = cloneDevice(device)
 		idx++
 	}
 
-	return devices
+	return devices, nil
+}
+
+func (d *InMemoryDatabase) GetOrganizationSignatureDevices(organizationID string) ([]*types.SignatureDevice, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return organizationDevices(d.db, organizationID), nil
 }
-func (d *InMemoryDatabase) GetDeviceSignatures(id string) ([][]byte, error) {
+
+func (d *InMemoryDatabase) GetSignature(deviceID string, counter uint32) (*types.Signature, error) {
 	d.lock.Lock()
-	device, exists := d.db[id]
-	d.lock.Unlock()
-	if !exists {
+	defer d.lock.Unlock()
+	if _, exists := d.db[deviceID]; !exists {
 		return nil, types.ErrDeviceNotFound
 	}
-	if len(device.PreviousSignatures) == 0 {
-		return [][]byte{}, nil
+	return d.signatures.get(deviceID, counter)
+}
+
+func (d *InMemoryDatabase) GetSignatures(deviceID string, from, to uint32) ([]types.Signature, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if _, exists := d.db[deviceID]; !exists {
+		return nil, types.ErrDeviceNotFound
 	}
+	return d.signatures.between(deviceID, from, to), nil
+}
 
-	signatures := make([][]byte, len(device.PreviousSignatures))
-	idx := 0
-	for _, signature := range device.PreviousSignatures {
-		signatures[idx] = signature
-		idx++
+func (d *InMemoryDatabase) GetLastSignature(deviceID string) (*types.Signature, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if _, exists := d.db[deviceID]; !exists {
+		return nil, types.ErrDeviceNotFound
 	}
-	return signatures, nil
+	return d.signatures.last(deviceID)
 }
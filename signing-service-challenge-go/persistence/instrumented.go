@@ -0,0 +1,114 @@
+package persistence
+
+import (
+	"errors"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+)
+
+// ErrorObserver is notified of failed storage operations, e.g. to export metrics.
+type ErrorObserver interface {
+	// ObserveStorageError is called after the storage operation with the given name failed.
+	ObserveStorageError(operation string, err error)
+}
+
+// instrumentedDatabase reports the failed operations of a Database, except for the errors of missing and
+// duplicate devices and signatures, which are part of normal operation.
+type instrumentedDatabase struct {
+	db       domain.Database
+	observer ErrorObserver
+}
+
+// instrumentedTx reports the failed operations of a DeviceTx.
+type instrumentedTx struct {
+	tx       domain.DeviceTx
+	observer ErrorObserver
+}
+
+// Instrument returns db reporting its failed operations to observer. The returned Database only
+// implements domain.Database, optional interfaces such as auth.KeyStore must be used on db.
+func Instrument(db domain.Database, observer ErrorObserver) domain.Database {
+	return &instrumentedDatabase{db: db, observer: observer}
+}
+
+// unexpected reports whether err is a failure of a storage operation, rather than a missing or duplicate
+// device or signature, or an exceeded device quota.
+func unexpected(err error) bool {
+	return err != nil && !errors.Is(err, types.ErrDeviceNotFound) && !errors.Is(err, types.ErrDeviceAlreadyExists) &&
+		!errors.Is(err, types.ErrSignatureNotFound) && !errors.Is(err, types.ErrDeviceQuotaExceeded)
+}
+
+// observe reports err if the operation failed unexpectedly, and returns it.
+func observe(observer ErrorObserver, operation string, err error) error {
+	if unexpected(err) {
+		observer.ObserveStorageError(operation, err)
+	}
+	return err
+}
+
+func (i *instrumentedDatabase) GetSignatureDevice(id string) (*types.SignatureDevice, error) {
+	device, err := i.db.GetSignatureDevice(id)
+	return device, observe(i.observer, "get_device", err)
+}
+
+func (i *instrumentedDatabase) GetAllSignatureDevices() ([]*types.SignatureDevice, error) {
+	devices, err := i.db.GetAllSignatureDevices()
+	return devices, observe(i.observer, "get_all_devices", err)
+}
+
+func (i *instrumentedDatabase) GetOrganizationSignatureDevices(organizationID string) ([]*types.SignatureDevice, error) {
+	devices, err := i.db.GetOrganizationSignatureDevices(organizationID)
+	return devices, observe(i.observer, "get_organization_devices", err)
+}
+
+func (i *instrumentedDatabase) CreateSignatureDevice(device *types.SignatureDevice) error {
+	return observe(i.observer, "create_device", i.db.CreateSignatureDevice(device))
+}
+
+func (i *instrumentedDatabase) CreateOrganizationSignatureDevice(device *types.SignatureDevice, maxDevices int) error {
+	return observe(i.observer, "create_device", i.db.CreateOrganizationSignatureDevice(device, maxDevices))
+}
+
+func (i *instrumentedDatabase) UpdateSignatureDevice(updatedDevice *types.SignatureDevice) error {
+	return observe(i.observer, "update_device", i.db.UpdateSignatureDevice(updatedDevice))
+}
+
+func (i *instrumentedDatabase) BeginDeviceTx(id string) (domain.DeviceTx, error) {
+	tx, err := i.db.BeginDeviceTx(id)
+	if err != nil {
+		return nil, observe(i.observer, "begin_device_tx", err)
+	}
+	return &instrumentedTx{tx: tx, observer: i.observer}, nil
+}
+
+func (i *instrumentedDatabase) GetSignature(deviceID string, counter uint32) (*types.Signature, error) {
+	signature, err := i.db.GetSignature(deviceID, counter)
+	return signature, observe(i.observer, "get_signature", err)
+}
+
+func (i *instrumentedDatabase) GetSignatures(deviceID string, from, to uint32) ([]types.Signature, error) {
+	signatures, err := i.db.GetSignatures(deviceID, from, to)
+	return signatures, observe(i.observer, "get_signatures", err)
+}
+
+func (i *instrumentedDatabase) GetLastSignature(deviceID string) (*types.Signature, error) {
+	signature, err := i.db.GetLastSignature(deviceID)
+	return signature, observe(i.observer, "get_last_signature", err)
+}
+
+func (i *instrumentedTx) Device() *types.SignatureDevice {
+	return i.tx.Device()
+}
+
+func (i *instrumentedTx) AppendSignature(signature types.Signature) error {
+	return observe(i.observer, "append_signature", i.tx.AppendSignature(signature))
+}
+
+func (i *instrumentedTx) Commit() error {
+	return observe(i.observer, "commit", i.tx.Commit())
+}
+
+func (i *instrumentedTx) Rollback() error {
+	return observe(i.observer, "rollback", i.tx.Rollback())
+}
@@ -0,0 +1,64 @@
+package persistence
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence/dbtest"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+)
+
+// recordingObserver records the operations of the observed storage errors.
+type recordingObserver struct {
+	operations []string
+}
+
+func (o *recordingObserver) ObserveStorageError(operation string, _ error) {
+	o.operations = append(o.operations, operation)
+}
+
+func TestInstrument(t *testing.T) {
+	dbtest.Run(t, func(*testing.T) domain.Database {
+		return Instrument(NewInMemoryDatabase(), &recordingObserver{})
+	})
+}
+
+func TestInstrument_Errors(t *testing.T) {
+	observer := &recordingObserver{}
+	db := Instrument(NewInMemoryDatabase(), observer)
+	if err := db.CreateSignatureDevice(&types.SignatureDevice{ID: "a", Algorithm: types.ECC, PkPem: []byte("key")}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// missing and duplicate devices are part of normal operation
+	if _, err := db.GetSignatureDevice("unknown"); !errors.Is(err, types.ErrDeviceNotFound) {
+		t.Fatalf("expected error %v, got %v", types.ErrDeviceNotFound, err)
+	}
+	if err := db.CreateSignatureDevice(&types.SignatureDevice{ID: "a", Algorithm: types.ECC}); !errors.Is(err, types.ErrDeviceAlreadyExists) {
+		t.Fatalf("expected error %v, got %v", types.ErrDeviceAlreadyExists, err)
+	}
+	if _, err := db.GetSignature("a", 0); !errors.Is(err, types.ErrSignatureNotFound) {
+		t.Fatalf("expected error %v, got %v", types.ErrSignatureNotFound, err)
+	}
+
+	tx, err := db.BeginDeviceTx("a")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err = tx.AppendSignature(types.Signature{Counter: 1, Timestamp: time.Now()}); !errors.Is(err, types.ErrSignatureCounterConflict) {
+		t.Fatalf("expected error %v, got %v", types.ErrSignatureCounterConflict, err)
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err = tx.Commit(); !errors.Is(err, ErrTxDone) {
+		t.Fatalf("expected error %v, got %v", ErrTxDone, err)
+	}
+
+	if expected := []string{"append_signature", "commit"}; !reflect.DeepEqual(observer.operations, expected) {
+		t.Fatalf("expected errors of %v, got %v", expected, observer.operations)
+	}
+}
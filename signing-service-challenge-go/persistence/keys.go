@@ -0,0 +1,295 @@
+package persistence
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/auth"
+)
+
+// apiKeys holds API keys by their ID. It is not thread-safe, callers hold the lock of their database.
+type apiKeys map[string]*auth.Key
+
+func (k apiKeys) create(key *auth.Key) error {
+	if _, exists := k[key.ID]; exists {
+		return auth.ErrKeyAlreadyExists
+	}
+	k[key.ID] = cloneKey(key)
+	return nil
+}
+
+func (k apiKeys) get(id string) (*auth.Key, error) {
+	key, exists := k[id]
+	if !exists {
+		return nil, auth.ErrKeyNotFound
+	}
+	return cloneKey(key), nil
+}
+
+// all returns copies of all keys, ordered by creation.
+func (k apiKeys) all() []*auth.Key {
+	keys := make([]*auth.Key, 0, len(k))
+	for _, key := range k {
+		keys = append(keys, cloneKey(key))
+	}
+	slices.SortFunc(keys, compareKeys)
+	return keys
+}
+
+// revoke marks the key as revoked and reports whether it changed.
+func (k apiKeys) revoke(id string, revokedAt time.Time) (bool, error) {
+	key, exists := k[id]
+	if !exists {
+		return false, auth.ErrKeyNotFound
+	}
+	if key.Revoked() {
+		return false, nil
+	}
+	key.RevokedAt = &revokedAt
+	return true, nil
+}
+
+// compareKeys orders keys by creation, and by ID if created at the same time.
+func compareKeys(a, b *auth.Key) int {
+	return cmp.Or(a.CreatedAt.Compare(b.CreatedAt), cmp.Compare(a.ID, b.ID))
+}
+
+// cloneKey copies a key, so that callers never share state with the database.
+func cloneKey(key *auth.Key) *auth.Key {
+	clone := *key
+	clone.Hash = slices.Clone(key.Hash)
+	clone.Scopes = slices.Clone(key.Scopes)
+	clone.DeviceIDs = slices.Clone(key.DeviceIDs)
+	if key.RevokedAt != nil {
+		revokedAt := *key.RevokedAt
+		clone.RevokedAt = &revokedAt
+	}
+	return &clone
+}
+
+func (d *InMemoryDatabase) CreateAPIKey(key *auth.Key) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.keys.create(key)
+}
+
+func (d *InMemoryDatabase) GetAPIKey(id string) (*auth.Key, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.keys.get(id)
+}
+
+func (d *InMemoryDatabase) GetAllAPIKeys() ([]*auth.Key, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.keys.all(), nil
+}
+
+func (d *InMemoryDatabase) RevokeAPIKey(id string, revokedAt time.Time) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	_, err := d.keys.revoke(id, revokedAt)
+	return err
+}
+
+// storedKeys is the content of the API keys file of a FileDatabase.
+type storedKeys struct {
+	Version int         `json:"version"`
+	Keys    []*auth.Key `json:"keys"`
+}
+
+// loadKeys restores the API keys from their file, if there is one.
+func (d *FileDatabase) loadKeys() error {
+	var stored storedKeys
+	if exists, err := d.readFile(keysFileName, ErrCorruptKeys, &stored); err != nil || !exists {
+		return err
+	}
+	if stored.Version != 1 {
+		return fmt.Errorf("%w: unsupported version %d", ErrCorruptKeys, stored.Version)
+	}
+	for _, key := range stored.Keys {
+		if err := d.keys.create(key); err != nil {
+			return fmt.Errorf("%w: %v", ErrCorruptKeys, err)
+		}
+	}
+	return nil
+}
+
+// writeKeys atomically replaces the API keys file. The caller must hold the lock.
+func (d *FileDatabase) writeKeys() error {
+	return d.writeFile(keysFileName, storedKeys{Version: 1, Keys: d.keys.all()})
+}
+
+// readFile decodes the JSON content of a file that is replaced as a whole on every change, and reports
+// whether it exists. A file that fails its checksum or cannot be decoded is reported as corrupt.
+func (d *FileDatabase) readFile(name string, corrupt error, v any) (bool, error) {
+	data, err := os.ReadFile(filepath.Join(d.dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	payload, rest, err := unframe(data)
+	if err != nil || len(rest) > 0 {
+		return false, fmt.Errorf("%w: checksum mismatch", corrupt)
+	}
+	if err = json.Unmarshal(payload, v); err != nil {
+		return false, fmt.Errorf("%w: %v", corrupt, err)
+	}
+	return true, nil
+}
+
+// writeFile atomically replaces a file with the JSON encoding of v.
+func (d *FileDatabase) writeFile(name string, v any) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", name, err)
+	}
+	return writeFileAtomic(filepath.Join(d.dir, name), frame(payload))
+}
+
+func (d *FileDatabase) CreateAPIKey(key *auth.Key) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if err := d.keys.create(key); err != nil {
+		return err
+	}
+	if err := d.writeKeys(); err != nil {
+		delete(d.keys, key.ID)
+		return err
+	}
+	return nil
+}
+
+func (d *FileDatabase) GetAPIKey(id string) (*auth.Key, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.keys.get(id)
+}
+
+func (d *FileDatabase) GetAllAPIKeys() ([]*auth.Key, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.keys.all(), nil
+}
+
+func (d *FileDatabase) RevokeAPIKey(id string, revokedAt time.Time) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	changed, err := d.keys.revoke(id, revokedAt)
+	if err != nil || !changed {
+		return err
+	}
+	if err = d.writeKeys(); err != nil {
+		d.keys[id].RevokedAt = nil
+		return err
+	}
+	return nil
+}
+
+const selectKey = `SELECT id, organization_id, name, hash, scopes, device_ids, created_at, revoked_at FROM api_keys`
+
+func (d *SQLDatabase) CreateAPIKey(key *auth.Key) error {
+	scopes, err := json.Marshal(key.Scopes)
+	if err != nil {
+		return err
+	}
+	deviceIDs, err := json.Marshal(key.DeviceIDs)
+	if err != nil {
+		return err
+	}
+	result, err := d.db.ExecContext(context.Background(), `INSERT INTO api_keys (id, organization_id, name, hash, scopes, device_ids, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) ON CONFLICT (id) DO NOTHING`,
+		key.ID, key.OrganizationID, key.Name, key.Hash, string(scopes), string(deviceIDs), formatTime(key.CreatedAt))
+	if err != nil {
+		return fmt.Errorf("failed to insert API key: %w", err)
+	}
+	if inserted, err := result.RowsAffected(); err != nil {
+		return err
+	} else if inserted == 0 {
+		return auth.ErrKeyAlreadyExists
+	}
+	return nil
+}
+
+func (d *SQLDatabase) GetAPIKey(id string) (*auth.Key, error) {
+	return scanKey(d.db.QueryRowContext(context.Background(), selectKey+` WHERE id = $1`, id))
+}
+
+func (d *SQLDatabase) GetAllAPIKeys() ([]*auth.Key, error) {
+	rows, err := d.db.QueryContext(context.Background(), selectKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query API keys: %w", err)
+	}
+	defer rows.Close()
+	var keys []*auth.Key
+	for rows.Next() {
+		key, err := scanKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	// RFC 3339 text does not sort by time, as trailing zeros of the fraction are omitted.
+	slices.SortFunc(keys, compareKeys)
+	return keys, nil
+}
+
+func (d *SQLDatabase) RevokeAPIKey(id string, revokedAt time.Time) error {
+	result, err := d.db.ExecContext(context.Background(), `UPDATE api_keys SET revoked_at = COALESCE(revoked_at, $1) WHERE id = $2`,
+		formatTime(revokedAt), id)
+	if err != nil {
+		return fmt.Errorf("failed to revoke API key: %w", err)
+	}
+	if updated, err := result.RowsAffected(); err != nil {
+		return err
+	} else if updated == 0 {
+		return auth.ErrKeyNotFound
+	}
+	return nil
+}
+
+func scanKey(row scanner) (*auth.Key, error) {
+	var (
+		key               auth.Key
+		scopes, deviceIDs string
+		createdAt         string
+		revokedAt         sql.NullString
+	)
+	err := row.Scan(&key.ID, &key.OrganizationID, &key.Name, &key.Hash, &scopes, &deviceIDs, &createdAt, &revokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, auth.ErrKeyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API key: %w", err)
+	}
+	if err = json.Unmarshal([]byte(scopes), &key.Scopes); err != nil {
+		return nil, fmt.Errorf("failed to decode scopes of API key %s: %w", key.ID, err)
+	}
+	if err = json.Unmarshal([]byte(deviceIDs), &key.DeviceIDs); err != nil {
+		return nil, fmt.Errorf("failed to decode devices of API key %s: %w", key.ID, err)
+	}
+	if key.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt); err != nil {
+		return nil, fmt.Errorf("invalid creation time of API key %s: %w", key.ID, err)
+	}
+	if revokedAt.Valid {
+		revoked, err := time.Parse(time.RFC3339Nano, revokedAt.String)
+		if err != nil {
+			return nil, fmt.Errorf("invalid revocation time of API key %s: %w", key.ID, err)
+		}
+		key.RevokedAt = &revoked
+	}
+	return &key, nil
+}
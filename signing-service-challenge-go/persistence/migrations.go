@@ -0,0 +1,153 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// migration is a versioned change of the SQL schema. Migrations are applied in order,
+// each in its own transaction, and must never change once released.
+type migration struct {
+	version     int
+	description string
+	statements  func(d Dialect) []string
+}
+
+var migrations = []migration{
+	{
+		version:     1,
+		description: "create devices and signatures",
+		statements: func(d Dialect) []string {
+			return []string{
+				`CREATE TABLE devices (
+					id          TEXT PRIMARY KEY,
+					algorithm   TEXT NOT NULL,
+					label       TEXT NOT NULL,
+					counter     BIGINT NOT NULL CHECK (counter >= 0),
+					private_key ` + d.blob + ` NOT NULL,
+					certificate ` + d.blob + `
+				)`,
+				// Timestamps are stored as RFC 3339 text with nanoseconds, which every dialect keeps exactly.
+				`CREATE TABLE signatures (
+					device_id       TEXT NOT NULL REFERENCES devices (id),
+					counter         BIGINT NOT NULL CHECK (counter >= 0),
+					value           ` + d.blob + ` NOT NULL,
+					signed_data     ` + d.blob + ` NOT NULL,
+					signed_at       TEXT NOT NULL,
+					format          TEXT NOT NULL,
+					envelope        ` + d.blob + `,
+					timestamp_token ` + d.blob + `,
+					CONSTRAINT signatures_device_counter_unique UNIQUE (device_id, counter)
+				)`,
+			}
+		},
+	},
+	{
+		version:     2,
+		description: "reference the last signature from devices",
+		statements: func(d Dialect) []string {
+			return []string{
+				`ALTER TABLE devices ADD COLUMN last_signature ` + d.blob,
+				`ALTER TABLE devices ADD COLUMN last_signed_at TEXT`,
+				`UPDATE devices SET
+					last_signature = (SELECT value FROM signatures WHERE device_id = devices.id AND counter = devices.counter - 1),
+					last_signed_at = (SELECT signed_at FROM signatures WHERE device_id = devices.id AND counter = devices.counter - 1)`,
+			}
+		},
+	},
+	{
+		version:     3,
+		description: "create API keys",
+		statements: func(d Dialect) []string {
+			return []string{
+				// Scopes and device IDs are JSON arrays, they are only ever read together with their key.
+				`CREATE TABLE api_keys (
+					id         TEXT PRIMARY KEY,
+					name       TEXT NOT NULL,
+					hash       ` + d.blob + ` NOT NULL,
+					scopes     TEXT NOT NULL,
+					device_ids TEXT NOT NULL,
+					created_at TEXT NOT NULL,
+					revoked_at TEXT
+				)`,
+			}
+		},
+	},
+	{
+		version:     4,
+		description: "create organizations",
+		statements: func(d Dialect) []string {
+			return []string{
+				`CREATE TABLE organizations (
+					id          TEXT PRIMARY KEY,
+					name        TEXT NOT NULL,
+					max_devices INTEGER NOT NULL CHECK (max_devices >= 0),
+					created_at  TEXT NOT NULL
+				)`,
+				// Devices and API keys existing before belong to the default organization.
+				`ALTER TABLE devices ADD COLUMN organization_id TEXT NOT NULL DEFAULT 'default'`,
+				`ALTER TABLE api_keys ADD COLUMN organization_id TEXT NOT NULL DEFAULT 'default'`,
+			}
+		},
+	},
+	{
+		version:     5,
+		description: "index devices by organization",
+		statements: func(d Dialect) []string {
+			return []string{
+				`CREATE INDEX devices_organization_id ON devices (organization_id)`,
+			}
+		},
+	},
+}
+
+// migrate brings the schema up to the latest version.
+func migrate(ctx context.Context, db *sql.DB, dialect Dialect) error {
+	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at TEXT NOT NULL
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create migrations table: %w", err)
+	}
+	for _, m := range migrations {
+		if err = applyMigration(ctx, db, dialect, m); err != nil {
+			return fmt.Errorf("failed to apply migration %d (%s): %w", m.version, m.description, err)
+		}
+	}
+	return nil
+}
+
+func applyMigration(ctx context.Context, db *sql.DB, dialect Dialect, m migration) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	// Serialize concurrent migrations of several instances starting at once.
+	if dialect.lockMigrations != "" {
+		if _, err = tx.ExecContext(ctx, dialect.lockMigrations); err != nil {
+			return err
+		}
+	}
+	var applied int
+	if err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM schema_migrations WHERE version = $1`, m.version).Scan(&applied); err != nil {
+		return err
+	}
+	if applied > 0 {
+		return nil
+	}
+	for _, statement := range m.statements(dialect) {
+		if _, err = tx.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, applied_at) VALUES ($1, $2)`,
+		m.version, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
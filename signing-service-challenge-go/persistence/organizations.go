@@ -0,0 +1,224 @@
+package persistence
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+)
+
+// organizationsFileName is the file of a FileDatabase holding the organizations.
+const organizationsFileName = "organizations"
+
+// organizations holds organizations by their ID. It is not thread-safe, callers hold the lock of their database.
+type organizations map[string]*types.Organization
+
+func (o organizations) create(organization *types.Organization) error {
+	if _, exists := o[organization.ID]; exists {
+		return types.ErrOrganizationExists
+	}
+	clone := *organization
+	o[organization.ID] = &clone
+	return nil
+}
+
+func (o organizations) get(id string) (*types.Organization, error) {
+	organization, exists := o[id]
+	if !exists {
+		return nil, types.ErrOrganizationNotFound
+	}
+	clone := *organization
+	return &clone, nil
+}
+
+// all returns copies of all organizations, ordered by their ID.
+func (o organizations) all() []*types.Organization {
+	all := make([]*types.Organization, 0, len(o))
+	for _, organization := range o {
+		clone := *organization
+		all = append(all, &clone)
+	}
+	slices.SortFunc(all, func(a, b *types.Organization) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return all
+}
+
+// update replaces the name and quota of an organization and returns its previous state.
+func (o organizations) update(organization *types.Organization) (types.Organization, error) {
+	current, exists := o[organization.ID]
+	if !exists {
+		return types.Organization{}, types.ErrOrganizationNotFound
+	}
+	previous := *current
+	current.Name = organization.Name
+	current.MaxDevices = organization.MaxDevices
+	return previous, nil
+}
+
+func (d *InMemoryDatabase) CreateOrganization(organization *types.Organization) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.organizations.create(organization)
+}
+
+func (d *InMemoryDatabase) GetOrganization(id string) (*types.Organization, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.organizations.get(id)
+}
+
+func (d *InMemoryDatabase) GetAllOrganizations() ([]*types.Organization, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.organizations.all(), nil
+}
+
+func (d *InMemoryDatabase) UpdateOrganization(organization *types.Organization) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	_, err := d.organizations.update(organization)
+	return err
+}
+
+// storedOrganizations is the content of the organizations file of a FileDatabase.
+type storedOrganizations struct {
+	Version       int                   `json:"version"`
+	Organizations []*types.Organization `json:"organizations"`
+}
+
+// loadOrganizations restores the organizations from their file, if there is one.
+func (d *FileDatabase) loadOrganizations() error {
+	var stored storedOrganizations
+	if exists, err := d.readFile(organizationsFileName, ErrCorruptOrganizations, &stored); err != nil || !exists {
+		return err
+	}
+	if stored.Version != 1 {
+		return fmt.Errorf("%w: unsupported version %d", ErrCorruptOrganizations, stored.Version)
+	}
+	for _, organization := range stored.Organizations {
+		if err := d.organizations.create(organization); err != nil {
+			return fmt.Errorf("%w: %v", ErrCorruptOrganizations, err)
+		}
+	}
+	return nil
+}
+
+// writeOrganizations atomically replaces the organizations file. The caller must hold the lock.
+func (d *FileDatabase) writeOrganizations() error {
+	return d.writeFile(organizationsFileName, storedOrganizations{Version: 1, Organizations: d.organizations.all()})
+}
+
+func (d *FileDatabase) CreateOrganization(organization *types.Organization) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if err := d.organizations.create(organization); err != nil {
+		return err
+	}
+	if err := d.writeOrganizations(); err != nil {
+		delete(d.organizations, organization.ID)
+		return err
+	}
+	return nil
+}
+
+func (d *FileDatabase) GetOrganization(id string) (*types.Organization, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.organizations.get(id)
+}
+
+func (d *FileDatabase) GetAllOrganizations() ([]*types.Organization, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.organizations.all(), nil
+}
+
+func (d *FileDatabase) UpdateOrganization(organization *types.Organization) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	previous, err := d.organizations.update(organization)
+	if err != nil {
+		return err
+	}
+	if err = d.writeOrganizations(); err != nil {
+		d.organizations[organization.ID] = &previous
+		return err
+	}
+	return nil
+}
+
+const selectOrganization = `SELECT id, name, max_devices, created_at FROM organizations`
+
+func (d *SQLDatabase) CreateOrganization(organization *types.Organization) error {
+	result, err := d.db.ExecContext(context.Background(), `INSERT INTO organizations (id, name, max_devices, created_at)
+		VALUES ($1, $2, $3, $4) ON CONFLICT (id) DO NOTHING`,
+		organization.ID, organization.Name, organization.MaxDevices, formatTime(organization.CreatedAt))
+	if err != nil {
+		return fmt.Errorf("failed to insert organization: %w", err)
+	}
+	if inserted, err := result.RowsAffected(); err != nil {
+		return err
+	} else if inserted == 0 {
+		return types.ErrOrganizationExists
+	}
+	return nil
+}
+
+func (d *SQLDatabase) GetOrganization(id string) (*types.Organization, error) {
+	return scanOrganization(d.db.QueryRowContext(context.Background(), selectOrganization+` WHERE id = $1`, id))
+}
+
+func (d *SQLDatabase) GetAllOrganizations() ([]*types.Organization, error) {
+	rows, err := d.db.QueryContext(context.Background(), selectOrganization+` ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query organizations: %w", err)
+	}
+	defer rows.Close()
+	all := []*types.Organization{}
+	for rows.Next() {
+		organization, err := scanOrganization(rows)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, organization)
+	}
+	return all, rows.Err()
+}
+
+func (d *SQLDatabase) UpdateOrganization(organization *types.Organization) error {
+	result, err := d.db.ExecContext(context.Background(), `UPDATE organizations SET name = $1, max_devices = $2 WHERE id = $3`,
+		organization.Name, organization.MaxDevices, organization.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update organization: %w", err)
+	}
+	if updated, err := result.RowsAffected(); err != nil {
+		return err
+	} else if updated == 0 {
+		return types.ErrOrganizationNotFound
+	}
+	return nil
+}
+
+func scanOrganization(row scanner) (*types.Organization, error) {
+	var (
+		organization types.Organization
+		createdAt    string
+	)
+	err := row.Scan(&organization.ID, &organization.Name, &organization.MaxDevices, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, types.ErrOrganizationNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read organization: %w", err)
+	}
+	if organization.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt); err != nil {
+		return nil, fmt.Errorf("invalid creation time of organization %s: %w", organization.ID, err)
+	}
+	return &organization, nil
+}
@@ -0,0 +1,367 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+)
+
+// Dialect captures the differences between the SQL databases supported by SQLDatabase.
+type Dialect struct {
+	name string
+	// blob is the column type of binary data.
+	blob string
+	// forUpdate is appended to queries that lock the selected rows until the end of the transaction.
+	forUpdate string
+	// lockMigrations is executed at the start of every migration transaction, if set.
+	lockMigrations string
+	// lockOrganization is executed with the organization ID as $1 before its devices are counted
+	// against its quota, if set. It locks until the end of the transaction.
+	lockOrganization string
+}
+
+var (
+	// PostgreSQL locks device rows with SELECT ... FOR UPDATE.
+	PostgreSQL = Dialect{
+		name:           "postgres",
+		blob:           "BYTEA",
+		forUpdate:      " FOR UPDATE",
+		lockMigrations: "LOCK TABLE schema_migrations IN EXCLUSIVE MODE",
+		// The organization may not have a row to lock, the default organization exists without one.
+		lockOrganization: "SELECT pg_advisory_xact_lock(hashtext('organization:' || $1::text))",
+	}
+	// SQLite has no row-level locks, writing transactions lock the whole database instead.
+	// The connection must start transactions with BEGIN IMMEDIATE (e.g. "_txlock=immediate" for modernc.org/sqlite),
+	// otherwise concurrent updates fail with SQLITE_BUSY instead of waiting for each other.
+	SQLite = Dialect{
+		name: "sqlite",
+		blob: "BLOB",
+	}
+)
+
+func (d Dialect) String() string {
+	return d.name
+}
+
+// SQLDatabase is a database/sql implementation of the Database interface. Devices and their signatures
+// are kept in separate tables, a unique constraint on device and counter guarantees that no counter
+// is ever used twice. Signatures are appended in a transaction that locks the device row.
+type SQLDatabase struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+// NewSQLDatabase migrates the schema of db to the latest version and returns a database using it.
+func NewSQLDatabase(ctx context.Context, db *sql.DB, dialect Dialect) (*SQLDatabase, error) {
+	if err := migrate(ctx, db, dialect); err != nil {
+		return nil, err
+	}
+	return &SQLDatabase{
+		db:      db,
+		dialect: dialect,
+	}, nil
+}
+
+// Close closes the underlying database.
+func (d *SQLDatabase) Close() error {
+	return d.db.Close()
+}
+
+// Ping checks that the underlying database is reachable.
+func (d *SQLDatabase) Ping(ctx context.Context) error {
+	return d.db.PingContext(ctx)
+}
+
+const selectDevice = `SELECT id, algorithm, label, counter, private_key, certificate, last_signature, last_signed_at, organization_id FROM devices`
+
+const selectSignature = `SELECT counter, value, signed_data, signed_at, format, envelope, timestamp_token FROM signatures`
+
+func (d *SQLDatabase) GetSignatureDevice(id string) (*types.SignatureDevice, error) {
+	return scanDevice(d.db.QueryRowContext(context.Background(), selectDevice+` WHERE id = $1`, id))
+}
+
+func (d *SQLDatabase) CreateSignatureDevice(device *types.SignatureDevice) error {
+	return insertDevice(context.Background(), d.db, device)
+}
+
+// CreateOrganizationSignatureDevice counts the devices of the organization and inserts the device in one
+// transaction, which holds a lock on the organization so that concurrent creations are counted one by one.
+func (d *SQLDatabase) CreateOrganizationSignatureDevice(device *types.SignatureDevice, maxDevices int) error {
+	if maxDevices <= 0 {
+		return d.CreateSignatureDevice(device)
+	}
+	ctx := context.Background()
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	if d.dialect.lockOrganization != "" {
+		if _, err = tx.ExecContext(ctx, d.dialect.lockOrganization, device.Organization()); err != nil {
+			return fmt.Errorf("failed to lock organization: %w", err)
+		}
+	}
+	var count int
+	err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM devices WHERE organization_id = $1`, device.Organization()).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("failed to count devices: %w", err)
+	}
+	if count >= maxDevices {
+		return types.ErrDeviceQuotaExceeded
+	}
+	if err = insertDevice(ctx, tx, device); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit device: %w", err)
+	}
+	return nil
+}
+
+// execer is implemented by *sql.DB and *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// insertDevice inserts a new device, it must not overwrite an existing one.
+func insertDevice(ctx context.Context, db execer, device *types.SignatureDevice) error {
+	result, err := db.ExecContext(ctx, `INSERT INTO devices (id, algorithm, label, counter, private_key, certificate, organization_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) ON CONFLICT (id) DO NOTHING`,
+		device.ID, string(device.Algorithm), device.Label, int64(device.Counter), device.PkPem, nullBytes(device.Certificate), device.Organization())
+	if err != nil {
+		return fmt.Errorf("failed to insert device: %w", err)
+	}
+	if inserted, err := result.RowsAffected(); err != nil {
+		return err
+	} else if inserted == 0 {
+		return types.ErrDeviceAlreadyExists
+	}
+	return nil
+}
+
+// UpdateSignatureDevice stores the attributes of the device. The counter and the last signature are only
+// written by a DeviceTx, so a stale copy of the device can never roll back its chain.
+func (d *SQLDatabase) UpdateSignatureDevice(updatedDevice *types.SignatureDevice) error {
+	result, err := d.db.ExecContext(context.Background(), `UPDATE devices SET algorithm = $1, label = $2, private_key = $3, certificate = $4 WHERE id = $5`,
+		string(updatedDevice.Algorithm), updatedDevice.Label, updatedDevice.PkPem, nullBytes(updatedDevice.Certificate), updatedDevice.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update device: %w", err)
+	}
+	if updated, err := result.RowsAffected(); err != nil {
+		return err
+	} else if updated == 0 {
+		return types.ErrDeviceNotFound
+	}
+	return nil
+}
+
+// BeginDeviceTx starts a transaction that locks the device row until the unit of work ends.
+// The appended signatures are inserted on commit, together with the new counter.
+func (d *SQLDatabase) BeginDeviceTx(id string) (domain.DeviceTx, error) {
+	ctx := context.Background()
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	device, err := scanDevice(tx.QueryRowContext(ctx, selectDevice+` WHERE id = $1`+d.dialect.forUpdate, id))
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	commit := func(device *types.SignatureDevice, appended []types.Signature) error {
+		for _, signature := range appended {
+			if err := insertSignature(ctx, tx, device.ID, signature); err != nil {
+				return err
+			}
+		}
+		_, err := tx.ExecContext(ctx, `UPDATE devices SET counter = $1, last_signature = $2, last_signed_at = $3 WHERE id = $4`,
+			int64(device.Counter), device.LastSignature, formatTime(device.LastSignedAt), device.ID)
+		if err != nil {
+			return fmt.Errorf("failed to update device: %w", err)
+		}
+		if err = tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit signatures: %w", err)
+		}
+		return nil
+	}
+	// Rolling back after a commit is a harmless no-op.
+	return &deviceTx{device: device, commit: commit, release: func() { tx.Rollback() }}, nil
+}
+
+func (d *SQLDatabase) GetAllSignatureDevices() ([]*types.SignatureDevice, error) {
+	return d.queryDevices(context.Background(), selectDevice+` ORDER BY id`)
+}
+
+func (d *SQLDatabase) GetOrganizationSignatureDevices(organizationID string) ([]*types.SignatureDevice, error) {
+	return d.queryDevices(context.Background(), selectDevice+` WHERE organization_id = $1 ORDER BY id`, organizationID)
+}
+
+func (d *SQLDatabase) queryDevices(ctx context.Context, query string, args ...any) ([]*types.SignatureDevice, error) {
+	rows, err := d.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	devices := []*types.SignatureDevice{}
+	for rows.Next() {
+		device, err := scanDevice(rows)
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, device)
+	}
+	return devices, rows.Err()
+}
+
+func (d *SQLDatabase) GetSignature(deviceID string, counter uint32) (*types.Signature, error) {
+	ctx := context.Background()
+	signature, err := scanSignature(d.db.QueryRowContext(ctx, selectSignature+` WHERE device_id = $1 AND counter = $2`,
+		deviceID, int64(counter)))
+	if errors.Is(err, sql.ErrNoRows) {
+		if err = d.deviceExists(ctx, deviceID); err != nil {
+			return nil, err
+		}
+		return nil, types.ErrSignatureNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &signature, nil
+}
+
+func (d *SQLDatabase) GetSignatures(deviceID string, from, to uint32) ([]types.Signature, error) {
+	ctx := context.Background()
+	if err := d.deviceExists(ctx, deviceID); err != nil {
+		return nil, err
+	}
+	rows, err := d.db.QueryContext(ctx, selectSignature+` WHERE device_id = $1 AND counter BETWEEN $2 AND $3 ORDER BY counter`,
+		deviceID, int64(from), int64(to))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signatures: %w", err)
+	}
+	defer rows.Close()
+	signatures := []types.Signature{}
+	for rows.Next() {
+		signature, err := scanSignature(rows)
+		if err != nil {
+			return nil, err
+		}
+		signatures = append(signatures, signature)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read signatures: %w", err)
+	}
+	return signatures, nil
+}
+
+func (d *SQLDatabase) GetLastSignature(deviceID string) (*types.Signature, error) {
+	ctx := context.Background()
+	signature, err := scanSignature(d.db.QueryRowContext(ctx, selectSignature+` WHERE device_id = $1 ORDER BY counter DESC LIMIT 1`, deviceID))
+	if errors.Is(err, sql.ErrNoRows) {
+		if err = d.deviceExists(ctx, deviceID); err != nil {
+			return nil, err
+		}
+		return nil, types.ErrSignatureNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &signature, nil
+}
+
+func (d *SQLDatabase) deviceExists(ctx context.Context, id string) error {
+	var exists int
+	err := d.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM devices WHERE id = $1`, id).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to read device: %w", err)
+	}
+	if exists == 0 {
+		return types.ErrDeviceNotFound
+	}
+	return nil
+}
+
+// insertSignature appends a signature to the chain of the device. An existing signature
+// with the same counter violates the unique constraint and results in a conflict.
+func insertSignature(ctx context.Context, tx *sql.Tx, deviceID string, signature types.Signature) error {
+	result, err := tx.ExecContext(ctx, `INSERT INTO signatures (device_id, counter, value, signed_data, signed_at, format, envelope, timestamp_token)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) ON CONFLICT (device_id, counter) DO NOTHING`,
+		deviceID, int64(signature.Counter), signature.Value, signature.SignedData,
+		formatTime(signature.Timestamp), string(signature.Format),
+		nullBytes(signature.Envelope), nullBytes(signature.TimestampToken))
+	if err != nil {
+		return fmt.Errorf("failed to insert signature: %w", err)
+	}
+	if inserted, err := result.RowsAffected(); err != nil {
+		return err
+	} else if inserted == 0 {
+		return fmt.Errorf("%w: signature %d of device %s already exists", types.ErrSignatureCounterConflict, signature.Counter, deviceID)
+	}
+	return nil
+}
+
+// scanner is implemented by *sql.Row and *sql.Rows.
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanDevice(row scanner) (*types.SignatureDevice, error) {
+	var device types.SignatureDevice
+	var algorithm string
+	var counter int64
+	var lastSignedAt sql.NullString
+	err := row.Scan(&device.ID, &algorithm, &device.Label, &counter, &device.PkPem, &device.Certificate,
+		&device.LastSignature, &lastSignedAt, &device.OrganizationID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, types.ErrDeviceNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read device: %w", err)
+	}
+	device.Algorithm = types.SigningAlgorithm(algorithm)
+	device.Counter = uint32(counter)
+	if lastSignedAt.Valid {
+		if device.LastSignedAt, err = time.Parse(time.RFC3339Nano, lastSignedAt.String); err != nil {
+			return nil, fmt.Errorf("failed to read last signature timestamp: %w", err)
+		}
+	}
+	return &device, nil
+}
+
+func scanSignature(row scanner) (types.Signature, error) {
+	var signedAt, format string
+	var counter int64
+	var signature types.Signature
+	err := row.Scan(&counter, &signature.Value, &signature.SignedData, &signedAt, &format,
+		&signature.Envelope, &signature.TimestampToken)
+	if err != nil {
+		return types.Signature{}, fmt.Errorf("failed to read signature: %w", err)
+	}
+	signature.Counter = uint32(counter)
+	signature.Format = types.SignatureFormat(format)
+	if signature.Timestamp, err = time.Parse(time.RFC3339Nano, signedAt); err != nil {
+		return types.Signature{}, fmt.Errorf("failed to read signature timestamp: %w", err)
+	}
+	return signature, nil
+}
+
+// formatTime stores timestamps as RFC 3339 text with nanoseconds, and the zero time as NULL.
+func formatTime(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// nullBytes stores empty byte slices as NULL.
+func nullBytes(b []byte) any {
+	if len(b) == 0 {
+		return nil
+	}
+	return b
+}
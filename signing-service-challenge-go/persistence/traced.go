@@ -0,0 +1,166 @@
+package persistence
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/tracing"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+)
+
+// tracedDatabase traces the operations of a Database as part of the span of its context. Operations outside
+// of a trace, e.g. of backups, exports and metric scrapes, are not traced.
+type tracedDatabase struct {
+	db  domain.Database
+	ctx context.Context
+}
+
+// tracedTx traces the operations of a DeviceTx as part of the span of its context.
+type tracedTx struct {
+	tx  domain.DeviceTx
+	ctx context.Context
+	// committed skips the span of the Rollback deferred by the caller, which does nothing after Commit.
+	committed bool
+}
+
+// Trace returns db tracing its operations as part of the span of the context it is bound to with WithContext.
+// Like Instrument, the returned Database only implements domain.Database and domain.ContextDatabase.
+func Trace(db domain.Database) domain.ContextDatabase {
+	return &tracedDatabase{db: db, ctx: context.Background()}
+}
+
+func (t *tracedDatabase) WithContext(ctx context.Context) domain.Database {
+	return &tracedDatabase{db: t.db, ctx: ctx}
+}
+
+// start starts the span of a storage operation, nil if ctx is not part of a trace.
+func start(ctx context.Context, operation string, attrs ...attribute.KeyValue) trace.Span {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return nil
+	}
+	attrs = append(attrs, attribute.String("db.operation.name", operation))
+	_, span := otel.Tracer("github.com/fiskaly/coding-challenges/signing-service-challenge/persistence").
+		Start(ctx, "storage "+operation, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	return span
+}
+
+// end ends the span of a storage operation, marking it as failed if the operation failed unexpectedly.
+func end(span trace.Span, err error) {
+	if span == nil {
+		return
+	}
+	if !unexpected(err) {
+		err = nil
+	}
+	tracing.End(span, err)
+}
+
+func deviceID(id string) attribute.KeyValue {
+	return attribute.String("device.id", id)
+}
+
+func (t *tracedDatabase) GetSignatureDevice(id string) (*types.SignatureDevice, error) {
+	span := start(t.ctx, "get_device", deviceID(id))
+	device, err := t.db.GetSignatureDevice(id)
+	end(span, err)
+	return device, err
+}
+
+func (t *tracedDatabase) GetAllSignatureDevices() ([]*types.SignatureDevice, error) {
+	span := start(t.ctx, "get_all_devices")
+	devices, err := t.db.GetAllSignatureDevices()
+	end(span, err)
+	return devices, err
+}
+
+func (t *tracedDatabase) GetOrganizationSignatureDevices(organizationID string) ([]*types.SignatureDevice, error) {
+	span := start(t.ctx, "get_organization_devices", attribute.String("organization.id", organizationID))
+	devices, err := t.db.GetOrganizationSignatureDevices(organizationID)
+	end(span, err)
+	return devices, err
+}
+
+func (t *tracedDatabase) CreateSignatureDevice(device *types.SignatureDevice) error {
+	span := start(t.ctx, "create_device", deviceID(device.ID))
+	err := t.db.CreateSignatureDevice(device)
+	end(span, err)
+	return err
+}
+
+func (t *tracedDatabase) CreateOrganizationSignatureDevice(device *types.SignatureDevice, maxDevices int) error {
+	span := start(t.ctx, "create_device", deviceID(device.ID), attribute.String("organization.id", device.Organization()))
+	err := t.db.CreateOrganizationSignatureDevice(device, maxDevices)
+	end(span, err)
+	return err
+}
+
+func (t *tracedDatabase) UpdateSignatureDevice(updatedDevice *types.SignatureDevice) error {
+	span := start(t.ctx, "update_device", deviceID(updatedDevice.ID))
+	err := t.db.UpdateSignatureDevice(updatedDevice)
+	end(span, err)
+	return err
+}
+
+func (t *tracedDatabase) BeginDeviceTx(id string) (domain.DeviceTx, error) {
+	span := start(t.ctx, "begin_device_tx", deviceID(id))
+	tx, err := t.db.BeginDeviceTx(id)
+	end(span, err)
+	if err != nil {
+		return nil, err
+	}
+	return &tracedTx{tx: tx, ctx: t.ctx}, nil
+}
+
+func (t *tracedDatabase) GetSignature(id string, counter uint32) (*types.Signature, error) {
+	span := start(t.ctx, "get_signature", deviceID(id), attribute.Int64("signature.counter", int64(counter)))
+	signature, err := t.db.GetSignature(id, counter)
+	end(span, err)
+	return signature, err
+}
+
+func (t *tracedDatabase) GetSignatures(id string, from, to uint32) ([]types.Signature, error) {
+	span := start(t.ctx, "get_signatures", deviceID(id))
+	signatures, err := t.db.GetSignatures(id, from, to)
+	end(span, err)
+	return signatures, err
+}
+
+func (t *tracedDatabase) GetLastSignature(id string) (*types.Signature, error) {
+	span := start(t.ctx, "get_last_signature", deviceID(id))
+	signature, err := t.db.GetLastSignature(id)
+	end(span, err)
+	return signature, err
+}
+
+func (t *tracedTx) Device() *types.SignatureDevice {
+	return t.tx.Device()
+}
+
+func (t *tracedTx) AppendSignature(signature types.Signature) error {
+	span := start(t.ctx, "append_signature", attribute.Int64("signature.counter", int64(signature.Counter)))
+	err := t.tx.AppendSignature(signature)
+	end(span, err)
+	return err
+}
+
+func (t *tracedTx) Commit() error {
+	span := start(t.ctx, "commit")
+	err := t.tx.Commit()
+	end(span, err)
+	t.committed = err == nil
+	return err
+}
+
+func (t *tracedTx) Rollback() error {
+	if t.committed {
+		return t.tx.Rollback()
+	}
+	span := start(t.ctx, "rollback")
+	err := t.tx.Rollback()
+	end(span, err)
+	return err
+}
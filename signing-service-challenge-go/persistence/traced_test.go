@@ -0,0 +1,82 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence/dbtest"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+)
+
+// traced records the spans of the global tracer provider until the test ends, and returns the context of a
+// span to trace operations as part of.
+func traced(t *testing.T) (context.Context, *tracetest.SpanRecorder) {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	ctx, _ := provider.Tracer("test").Start(context.Background(), "request")
+	return ctx, recorder
+}
+
+func TestTrace(t *testing.T) {
+	ctx, _ := traced(t)
+	dbtest.Run(t, func(*testing.T) domain.Database {
+		return Trace(NewInMemoryDatabase()).WithContext(ctx)
+	})
+}
+
+func TestTrace_Spans(t *testing.T) {
+	ctx, recorder := traced(t)
+	db := Trace(NewInMemoryDatabase())
+
+	// operations outside of a trace are not traced
+	if err := db.CreateSignatureDevice(&types.SignatureDevice{ID: "a", Algorithm: types.ECC, PkPem: []byte("key")}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	bound := db.WithContext(ctx)
+	if _, err := bound.GetSignatureDevice("unknown"); !errors.Is(err, types.ErrDeviceNotFound) {
+		t.Fatalf("expected error %v, got %v", types.ErrDeviceNotFound, err)
+	}
+	tx, err := bound.BeginDeviceTx("a")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	tx.Rollback()
+	if err = tx.Commit(); !errors.Is(err, ErrTxDone) {
+		t.Fatalf("expected error %v, got %v", ErrTxDone, err)
+	}
+
+	var names []string
+	var failed []string
+	for _, span := range recorder.Ended() {
+		names = append(names, span.Name())
+		if span.Parent().SpanID() != trace.SpanContextFromContext(ctx).SpanID() {
+			t.Fatalf("expected span %s to be part of the trace", span.Name())
+		}
+		if span.Status().Code == codes.Error {
+			failed = append(failed, span.Name())
+		}
+	}
+	if expected := []string{"storage get_device", "storage begin_device_tx", "storage commit", "storage commit"}; !reflect.DeepEqual(names, expected) {
+		t.Fatalf("expected spans %v, got %v", expected, names)
+	}
+	// missing devices are part of normal operation
+	if expected := []string{"storage commit"}; !reflect.DeepEqual(failed, expected) {
+		t.Fatalf("expected failed spans %v, got %v", expected, failed)
+	}
+}
@@ -0,0 +1,96 @@
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/types"
+)
+
+// ErrTxDone is returned when a unit of work is used after it was committed or rolled back.
+var ErrTxDone = errors.New("unit of work has already been committed or rolled back")
+
+// deviceLocks serializes units of work per device. A device has an entry only while a unit of
+// work holds or waits for its lock, so the map does not grow with the number of devices.
+type deviceLocks struct {
+	lock  sync.Mutex
+	locks map[string]*deviceLock
+}
+
+// deviceLock is the lock of a single device and the number of units of work holding or waiting for it.
+type deviceLock struct {
+	sync.Mutex
+	refs int
+}
+
+// acquire locks the device and returns the function releasing it.
+func (l *deviceLocks) acquire(id string) func() {
+	l.lock.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*deviceLock)
+	}
+	lock, exists := l.locks[id]
+	if !exists {
+		lock = &deviceLock{}
+		l.locks[id] = lock
+	}
+	lock.refs++
+	l.lock.Unlock()
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		l.lock.Lock()
+		if lock.refs--; lock.refs == 0 {
+			delete(l.locks, id)
+		}
+		l.lock.Unlock()
+	}
+}
+
+// deviceTx implements domain.DeviceTx on a private copy of the locked device. The signatures
+// appended to it are handed to commit at the end, release is called once the unit of work ends.
+type deviceTx struct {
+	device   *types.SignatureDevice
+	appended []types.Signature
+	commit   func(device *types.SignatureDevice, appended []types.Signature) error
+	release  func()
+	done     bool
+}
+
+func (tx *deviceTx) Device() *types.SignatureDevice {
+	return cloneDevice(tx.device)
+}
+
+func (tx *deviceTx) AppendSignature(signature types.Signature) error {
+	if tx.done {
+		return ErrTxDone
+	}
+	if signature.Counter != tx.device.Counter {
+		return fmt.Errorf("%w: counter is at %d, signature has %d", types.ErrSignatureCounterConflict, tx.device.Counter, signature.Counter)
+	}
+	advance(tx.device, signature)
+	tx.appended = append(tx.appended, signature)
+	return nil
+}
+
+func (tx *deviceTx) Commit() error {
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.done = true
+	defer tx.release()
+	if len(tx.appended) == 0 {
+		return nil
+	}
+	return tx.commit(tx.device, tx.appended)
+}
+
+func (tx *deviceTx) Rollback() error {
+	if tx.done {
+		return nil
+	}
+	tx.done = true
+	tx.release()
+	return nil
+}
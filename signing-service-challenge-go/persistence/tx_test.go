@@ -0,0 +1,32 @@
+package persistence
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestDeviceLocks(t *testing.T) {
+	var locks deviceLocks
+	var wg sync.WaitGroup
+	ids := []string{"a", "b", "c"}
+	counters := make([]int, len(ids))
+	for i := range 100 {
+		device := i % len(ids)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release := locks.acquire(ids[device])
+			defer release()
+			// the race detector reports concurrent units of work on the same device
+			counters[device]++
+		}()
+	}
+	wg.Wait()
+	if counters[0]+counters[1]+counters[2] != 100 {
+		t.Fatalf("expected 100 units of work, got %v", counters)
+	}
+	// released devices must not keep their locks
+	if len(locks.locks) != 0 {
+		t.Fatalf("expected no locks, got %d", len(locks.locks))
+	}
+}
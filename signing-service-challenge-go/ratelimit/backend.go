@@ -0,0 +1,167 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// sweepInterval is the minimum time between two removals of full buckets and expired counters.
+const sweepInterval = time.Minute
+
+// Backend keeps the token buckets and counters of a Limiter. MemoryBackend keeps them in the process; a
+// backend shared by all instances of the service, e.g. on Redis, enforces the limits across instances.
+type Backend interface {
+	// Take takes a token from the bucket with the given key at time now, a new bucket is full. If the bucket
+	// is empty, it returns false and the time until the next token.
+	Take(key string, limit Limit, now time.Time) (bool, time.Duration, error)
+	// Give gives a token back to the bucket with the given key at time now, which never fills it above its burst.
+	Give(key string, limit Limit, now time.Time) error
+	// Add adds n to all given counters, unless that would take one of them above its Max, and returns the
+	// index of the first such counter, or -1 if all were added to. n may be negative to give back a reservation.
+	Add(counters []Counter, n int64, now time.Time) (int, error)
+	// Counts returns the values of the counters with the given keys at time now, 0 for unknown ones.
+	Counts(keys []string, now time.Time) ([]int64, error)
+}
+
+// Counter counts up to Max, 0 for no maximum, until it expires.
+type Counter struct {
+	Key     string
+	Max     int64
+	Expires time.Time
+}
+
+// MemoryBackend is a Backend keeping its state in memory, which is lost on restart and not shared between processes.
+type MemoryBackend struct {
+	lock     sync.Mutex
+	buckets  map[string]*bucket
+	counters map[string]*counter
+	sweptAt  time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	// full is the time the bucket is full again, after which it can be forgotten.
+	full time.Time
+}
+
+type counter struct {
+	value   int64
+	expires time.Time
+}
+
+// NewMemoryBackend creates an empty MemoryBackend.
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{
+		buckets:  make(map[string]*bucket),
+		counters: make(map[string]*counter),
+	}
+}
+
+func (m *MemoryBackend) Take(key string, limit Limit, now time.Time) (bool, time.Duration, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.sweep(now)
+
+	burst := float64(limit.Burst)
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, updated: now}
+		m.buckets[key] = b
+	} else if elapsed := now.Sub(b.updated); elapsed > 0 {
+		b.tokens = min(burst, b.tokens+elapsed.Seconds()*limit.Rate)
+		b.updated = now
+	}
+	if b.tokens < 1 {
+		return false, seconds((1 - b.tokens) / limit.Rate), nil
+	}
+	b.tokens--
+	b.full = b.updated.Add(seconds((burst - b.tokens) / limit.Rate))
+	return true, 0, nil
+}
+
+func (m *MemoryBackend) Give(key string, limit Limit, now time.Time) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	b, ok := m.buckets[key]
+	if !ok {
+		// a forgotten bucket is full
+		return nil
+	}
+	burst := float64(limit.Burst)
+	if elapsed := now.Sub(b.updated); elapsed > 0 {
+		b.tokens = min(burst, b.tokens+elapsed.Seconds()*limit.Rate)
+		b.updated = now
+	}
+	b.tokens = min(burst, b.tokens+1)
+	b.full = b.updated.Add(seconds((burst - b.tokens) / limit.Rate))
+	return nil
+}
+
+func (m *MemoryBackend) Add(counters []Counter, n int64, now time.Time) (int, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.sweep(now)
+
+	if n > 0 {
+		for i, c := range counters {
+			if c.Max > 0 && m.value(c.Key, now)+n > c.Max {
+				return i, nil
+			}
+		}
+	}
+	for _, c := range counters {
+		current, ok := m.counters[c.Key]
+		if !ok || !now.Before(current.expires) {
+			current = &counter{expires: c.Expires}
+			m.counters[c.Key] = current
+		}
+		current.value = max(0, current.value+n)
+		if current.value == 0 {
+			delete(m.counters, c.Key)
+		}
+	}
+	return -1, nil
+}
+
+func (m *MemoryBackend) Counts(keys []string, now time.Time) ([]int64, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	counts := make([]int64, len(keys))
+	for i, key := range keys {
+		counts[i] = m.value(key, now)
+	}
+	return counts, nil
+}
+
+// value returns the value of a counter that has not expired yet.
+func (m *MemoryBackend) value(key string, now time.Time) int64 {
+	if c, ok := m.counters[key]; ok && now.Before(c.expires) {
+		return c.value
+	}
+	return 0
+}
+
+// sweep forgets full buckets and expired counters, which behave like unknown ones, at most once per sweepInterval.
+func (m *MemoryBackend) sweep(now time.Time) {
+	if now.Sub(m.sweptAt) < sweepInterval {
+		return
+	}
+	m.sweptAt = now
+	for key, b := range m.buckets {
+		if !now.Before(b.full) {
+			delete(m.buckets, key)
+		}
+	}
+	for key, c := range m.counters {
+		if !now.Before(c.expires) {
+			delete(m.counters, key)
+		}
+	}
+}
+
+// seconds converts a number of seconds to a Duration.
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,226 @@
+// Package ratelimit limits the request rate of API clients and the signing rate of devices with token buckets,
+// and enforces daily and monthly signature quotas of devices.
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// ErrLimitExceeded indicates a request that exceeds a rate limit or quota, see ExceededError.
+var ErrLimitExceeded = errors.New("limit exceeded")
+
+// ExceededError is the error of a request that exceeds a rate limit or quota. It matches ErrLimitExceeded.
+type ExceededError struct {
+	// Limit describes the exceeded limit, e.g. "daily signature quota of device 1234".
+	Limit string
+	// RetryAfter is the time until the request would be allowed again.
+	RetryAfter time.Duration
+}
+
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("%s exceeded, retry after %s", e.Limit, time.Duration(e.RetryAfterSeconds())*time.Second)
+}
+
+// RetryAfterSeconds returns RetryAfter in whole seconds, rounded up to at least one second, as in a Retry-After header.
+func (e *ExceededError) RetryAfterSeconds() int64 {
+	return max(1, int64(math.Ceil(e.RetryAfter.Seconds())))
+}
+
+func (e *ExceededError) Unwrap() error {
+	return ErrLimitExceeded
+}
+
+// Limit is a token bucket: Burst requests may be made at once, and Rate requests per second are sustained.
+// A Rate of 0 disables the limit.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// burst returns the size of the bucket, which holds at least one token and defaults to one second of requests.
+func (l Limit) burst() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+	return max(1, int(math.Ceil(l.Rate)))
+}
+
+// Quota limits the number of signatures of a device per calendar day and month in UTC. 0 is unlimited.
+type Quota struct {
+	Daily   int64
+	Monthly int64
+}
+
+// Usage is the number of signatures of a device in the current quota periods.
+type Usage struct {
+	Daily   PeriodUsage
+	Monthly PeriodUsage
+}
+
+// PeriodUsage is the number of signatures of a device in a quota period.
+type PeriodUsage struct {
+	Used int64
+	// Limit is the quota of the period, 0 if it is unlimited.
+	Limit int64
+	// ResetsAt is the end of the period, when the usage starts from 0 again.
+	ResetsAt time.Time
+}
+
+// Option configures the limits of a Limiter.
+type Option func(*Limiter)
+
+// WithClientLimit limits the requests of every API client.
+func WithClientLimit(limit Limit) Option {
+	return func(l *Limiter) {
+		l.client = limit
+	}
+}
+
+// WithClientLimits overrides the limit of WithClientLimit for single clients, by the identity passed to AllowClient.
+func WithClientLimits(limits map[string]Limit) Option {
+	return func(l *Limiter) {
+		l.clients = limits
+	}
+}
+
+// WithDeviceLimit limits the signatures of every device.
+func WithDeviceLimit(limit Limit) Option {
+	return func(l *Limiter) {
+		l.device = limit
+	}
+}
+
+// WithDeviceLimits overrides the limit of WithDeviceLimit for single devices, by their ID.
+func WithDeviceLimits(limits map[string]Limit) Option {
+	return func(l *Limiter) {
+		l.devices = limits
+	}
+}
+
+// WithSigningQuota limits the signatures of every device per day and month.
+func WithSigningQuota(quota Quota) Option {
+	return func(l *Limiter) {
+		l.quota = quota
+	}
+}
+
+// WithClock sets the source of the current time, for tests.
+func WithClock(now func() time.Time) Option {
+	return func(l *Limiter) {
+		l.now = now
+	}
+}
+
+// Limiter enforces the rate limits and quotas, keeping their state in a Backend. Limits that are not configured
+// are not enforced.
+type Limiter struct {
+	backend Backend
+	client  Limit
+	clients map[string]Limit
+	device  Limit
+	devices map[string]Limit
+	quota   Quota
+	now     func() time.Time
+}
+
+// New creates a Limiter keeping its state in backend, e.g. a MemoryBackend.
+func New(backend Backend, opts ...Option) *Limiter {
+	l := &Limiter{backend: backend, now: time.Now}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// AllowClient takes a request of the client with the given identity from its rate limit.
+func (l *Limiter) AllowClient(client string) error {
+	limit, ok := l.clients[client]
+	if !ok {
+		limit = l.client
+	}
+	return l.take("client:"+client, limit, "rate limit of client "+client)
+}
+
+// ReserveSignature takes a signature of a device from its rate limit and quotas. If no signature is made
+// after all, the returned cancel function gives the signature back to the rate limit and the quotas.
+func (l *Limiter) ReserveSignature(deviceID string) (cancel func(), err error) {
+	key := "device:" + deviceID
+	limit, ok := l.devices[deviceID]
+	if !ok {
+		limit = l.device
+	}
+	if err = l.take(key, limit, "rate limit of device "+deviceID); err != nil {
+		return nil, err
+	}
+	now := l.now()
+	counters := l.counters(deviceID, now)
+	exceeded, err := l.backend.Add(counters, 1, now)
+	if err == nil && exceeded < 0 {
+		return func() {
+			// giving back never exceeds a limit, and a failure only costs the device a signature
+			l.backend.Add(counters, -1, l.now())
+			l.give(key, limit)
+		}, nil
+	}
+	l.give(key, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count the signature of device %s: %w", deviceID, err)
+	}
+	names := []string{"daily", "monthly"}
+	return nil, &ExceededError{
+		Limit:      fmt.Sprintf("%s signature quota of device %s", names[exceeded], deviceID),
+		RetryAfter: counters[exceeded].Expires.Sub(now),
+	}
+}
+
+// Usage returns the number of signatures of a device in the current day and month.
+func (l *Limiter) Usage(deviceID string) (*Usage, error) {
+	now := l.now()
+	counters := l.counters(deviceID, now)
+	counts, err := l.backend.Counts([]string{counters[0].Key, counters[1].Key}, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count the signatures of device %s: %w", deviceID, err)
+	}
+	return &Usage{
+		Daily:   PeriodUsage{Used: counts[0], Limit: l.quota.Daily, ResetsAt: counters[0].Expires},
+		Monthly: PeriodUsage{Used: counts[1], Limit: l.quota.Monthly, ResetsAt: counters[1].Expires},
+	}, nil
+}
+
+// take takes a token from the bucket with the given key, unless the limit is disabled.
+func (l *Limiter) take(key string, limit Limit, name string) error {
+	if limit.Rate <= 0 {
+		return nil
+	}
+	ok, retryAfter, err := l.backend.Take(key, Limit{Rate: limit.Rate, Burst: limit.burst()}, l.now())
+	if err != nil {
+		return fmt.Errorf("failed to check the %s: %w", name, err)
+	}
+	if !ok {
+		return &ExceededError{Limit: name, RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// give gives a token back to the bucket with the given key, unless the limit is disabled. A failure is ignored,
+// as it only costs a token.
+func (l *Limiter) give(key string, limit Limit) {
+	if limit.Rate <= 0 {
+		return
+	}
+	l.backend.Give(key, Limit{Rate: limit.Rate, Burst: limit.burst()}, l.now())
+}
+
+// counters returns the daily and monthly signature counters of a device at the given time.
+func (l *Limiter) counters(deviceID string, now time.Time) []Counter {
+	now = now.UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return []Counter{
+		{Key: "signatures:" + deviceID + ":" + day.Format("2006-01-02"), Max: l.quota.Daily, Expires: day.AddDate(0, 0, 1)},
+		{Key: "signatures:" + deviceID + ":" + month.Format("2006-01"), Max: l.quota.Monthly, Expires: month.AddDate(0, 1, 0)},
+	}
+}
@@ -0,0 +1,235 @@
+package ratelimit_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/ratelimit"
+)
+
+// clock is a manually advanced time source.
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func newClock() *clock {
+	return &clock{now: time.Date(2025, 6, 30, 23, 59, 0, 0, time.UTC)}
+}
+
+func TestLimiter_AllowClient(t *testing.T) {
+	c := newClock()
+	limiter := ratelimit.New(ratelimit.NewMemoryBackend(), ratelimit.WithClock(c.Now),
+		ratelimit.WithClientLimit(ratelimit.Limit{Rate: 2, Burst: 3}))
+
+	for i := range 3 {
+		if err := limiter.AllowClient("a"); err != nil {
+			t.Fatalf("expected request %d within the burst to be allowed, got %v", i, err)
+		}
+	}
+	err := limiter.AllowClient("a")
+	var exceeded *ratelimit.ExceededError
+	if !errors.As(err, &exceeded) || !errors.Is(err, ratelimit.ErrLimitExceeded) {
+		t.Fatalf("expected error %v, got %v", ratelimit.ErrLimitExceeded, err)
+	}
+	if exceeded.RetryAfter != 500*time.Millisecond {
+		t.Fatalf("expected to retry after 500ms, got %s", exceeded.RetryAfter)
+	}
+	if err = limiter.AllowClient("b"); err != nil {
+		t.Fatalf("expected other clients to have their own limit, got %v", err)
+	}
+
+	c.now = c.now.Add(exceeded.RetryAfter)
+	if err = limiter.AllowClient("a"); err != nil {
+		t.Fatalf("expected a refilled token to be allowed, got %v", err)
+	}
+	if err = limiter.AllowClient("a"); !errors.Is(err, ratelimit.ErrLimitExceeded) {
+		t.Fatalf("expected error %v, got %v", ratelimit.ErrLimitExceeded, err)
+	}
+}
+
+func TestLimiter_Overrides(t *testing.T) {
+	limiter := ratelimit.New(ratelimit.NewMemoryBackend(), ratelimit.WithClock(newClock().Now),
+		ratelimit.WithClientLimit(ratelimit.Limit{Rate: 1}),
+		ratelimit.WithClientLimits(map[string]ratelimit.Limit{"bulk": {Rate: 1, Burst: 3}, "trusted": {}}),
+		ratelimit.WithDeviceLimit(ratelimit.Limit{Rate: 1}),
+		ratelimit.WithDeviceLimits(map[string]ratelimit.Limit{"busy": {Rate: 1, Burst: 2}}))
+
+	tests := []struct {
+		name      string
+		allow     func() error
+		allowed   int
+		unlimited bool
+	}{
+		{"Client", func() error { return limiter.AllowClient("a") }, 1, false},
+		{"Client Override", func() error { return limiter.AllowClient("bulk") }, 3, false},
+		{"Exempt Client", func() error { return limiter.AllowClient("trusted") }, 100, true},
+		{"Device", func() error { _, err := limiter.ReserveSignature("a"); return err }, 1, false},
+		{"Device Override", func() error { _, err := limiter.ReserveSignature("busy"); return err }, 2, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for i := range test.allowed {
+				if err := test.allow(); err != nil {
+					t.Fatalf("expected request %d to be allowed, got %v", i, err)
+				}
+			}
+			if !test.unlimited {
+				if err := test.allow(); !errors.Is(err, ratelimit.ErrLimitExceeded) {
+					t.Fatalf("expected error %v, got %v", ratelimit.ErrLimitExceeded, err)
+				}
+			}
+		})
+	}
+}
+
+func TestLimiter_Unlimited(t *testing.T) {
+	limiter := ratelimit.New(ratelimit.NewMemoryBackend())
+	for range 100 {
+		if err := limiter.AllowClient("a"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		cancel, err := limiter.ReserveSignature("device")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		cancel()
+	}
+}
+
+func TestLimiter_ReserveSignature(t *testing.T) {
+	tests := []struct {
+		name       string
+		quota      ratelimit.Quota
+		device     ratelimit.Limit
+		allowed    int
+		limit      string
+		retryAfter time.Duration
+	}{
+		{
+			name:       "Daily Quota",
+			quota:      ratelimit.Quota{Daily: 2, Monthly: 10},
+			allowed:    2,
+			limit:      "daily signature quota of device a",
+			retryAfter: time.Minute,
+		},
+		{
+			name:       "Monthly Quota",
+			quota:      ratelimit.Quota{Daily: 10, Monthly: 3},
+			allowed:    3,
+			limit:      "monthly signature quota of device a",
+			retryAfter: time.Minute,
+		},
+		{
+			name:       "Device Rate",
+			device:     ratelimit.Limit{Rate: 0.1},
+			allowed:    1,
+			limit:      "rate limit of device a",
+			retryAfter: 10 * time.Second,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := ratelimit.New(ratelimit.NewMemoryBackend(), ratelimit.WithClock(newClock().Now),
+				ratelimit.WithSigningQuota(test.quota), ratelimit.WithDeviceLimit(test.device))
+			for i := range test.allowed {
+				if _, err := limiter.ReserveSignature("a"); err != nil {
+					t.Fatalf("expected signature %d to be allowed, got %v", i, err)
+				}
+			}
+			_, err := limiter.ReserveSignature("a")
+			var exceeded *ratelimit.ExceededError
+			if !errors.As(err, &exceeded) {
+				t.Fatalf("expected error %v, got %v", ratelimit.ErrLimitExceeded, err)
+			}
+			if exceeded.Limit != test.limit || exceeded.RetryAfter != test.retryAfter {
+				t.Fatalf("expected %s with retry after %s, got %+v", test.limit, test.retryAfter, exceeded)
+			}
+			if _, err = limiter.ReserveSignature("b"); err != nil {
+				t.Fatalf("expected other devices to have their own limits, got %v", err)
+			}
+		})
+	}
+}
+
+func TestLimiter_CancelSignature(t *testing.T) {
+	limiter := ratelimit.New(ratelimit.NewMemoryBackend(), ratelimit.WithClock(newClock().Now),
+		ratelimit.WithDeviceLimit(ratelimit.Limit{Rate: 0.1}), ratelimit.WithSigningQuota(ratelimit.Quota{Daily: 1}))
+
+	// a cancelled signature gives back its token and its place in the quotas
+	for i := range 3 {
+		cancel, err := limiter.ReserveSignature("a")
+		if err != nil {
+			t.Fatalf("expected signature %d to be allowed after cancelling, got %v", i, err)
+		}
+		cancel()
+	}
+	if usage, err := limiter.Usage("a"); err != nil || usage.Daily.Used != 0 {
+		t.Fatalf("expected no signatures in the quota, got %+v, %v", usage, err)
+	}
+	if _, err := limiter.ReserveSignature("a"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := limiter.ReserveSignature("a"); !errors.Is(err, ratelimit.ErrLimitExceeded) {
+		t.Fatalf("expected error %v, got %v", ratelimit.ErrLimitExceeded, err)
+	}
+}
+
+func TestLimiter_QuotaKeepsToken(t *testing.T) {
+	c := newClock()
+	limiter := ratelimit.New(ratelimit.NewMemoryBackend(), ratelimit.WithClock(c.Now),
+		ratelimit.WithDeviceLimit(ratelimit.Limit{Rate: 0.1}), ratelimit.WithSigningQuota(ratelimit.Quota{Daily: 1}))
+	if _, err := limiter.ReserveSignature("a"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	c.now = c.now.Add(10 * time.Second)
+	// signatures rejected by the quota do not take from the rate limit
+	for range 2 {
+		var exceeded *ratelimit.ExceededError
+		if _, err := limiter.ReserveSignature("a"); !errors.As(err, &exceeded) || exceeded.Limit != "daily signature quota of device a" {
+			t.Fatalf("expected the daily quota to be exceeded, got %v", err)
+		}
+	}
+}
+
+func TestLimiter_Usage(t *testing.T) {
+	c := newClock()
+	limiter := ratelimit.New(ratelimit.NewMemoryBackend(), ratelimit.WithClock(c.Now),
+		ratelimit.WithSigningQuota(ratelimit.Quota{Daily: 5}))
+
+	for range 3 {
+		if _, err := limiter.ReserveSignature("a"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	cancel, err := limiter.ReserveSignature("a")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	cancel()
+
+	usage, err := limiter.Usage("a")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	expected := ratelimit.Usage{
+		Daily:   ratelimit.PeriodUsage{Used: 3, Limit: 5, ResetsAt: time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC)},
+		Monthly: ratelimit.PeriodUsage{Used: 3, Limit: 0, ResetsAt: time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	if *usage != expected {
+		t.Fatalf("expected %+v, got %+v", expected, *usage)
+	}
+
+	// the next day starts a new month, both periods start from 0
+	c.now = c.now.Add(time.Minute)
+	if usage, err = limiter.Usage("a"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if usage.Daily.Used != 0 || usage.Monthly.Used != 0 || !usage.Monthly.ResetsAt.Equal(time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected the usage to be reset, got %+v", *usage)
+	}
+}
@@ -0,0 +1,220 @@
+// Package tlsconfig builds the TLS configuration of the server from certificate files, which are
+// reloaded when they change, so that certificates can be rotated without a restart.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DefaultReloadInterval is the minimum time between two checks of the files for changes.
+const DefaultReloadInterval = 10 * time.Second
+
+// Client authentication modes.
+const (
+	// ClientAuthNone does not ask for client certificates.
+	ClientAuthNone = "none"
+	// ClientAuthOptional verifies client certificates, but accepts clients without one.
+	ClientAuthOptional = "optional"
+	// ClientAuthRequire rejects clients without a valid certificate.
+	ClientAuthRequire = "require"
+)
+
+// ErrNoClientCAs indicates client authentication without CAs to verify the client certificates.
+var ErrNoClientCAs = errors.New("client authentication requires a client CA file")
+
+// Options configure the TLS server.
+type Options struct {
+	// CertificateFile and KeyFile hold the PEM encoded certificate chain and private key of the server.
+	CertificateFile string
+	KeyFile         string
+	// ClientCAFile holds the PEM encoded CA certificates that issue client certificates.
+	ClientCAFile string
+	// ClientAuth is ClientAuthNone, ClientAuthOptional or ClientAuthRequire. Defaults to ClientAuthNone.
+	ClientAuth string
+	// MinVersion is the minimum TLS version, 1.2 or 1.3. Defaults to 1.2.
+	MinVersion string
+	// CipherSuites are the names of the TLS 1.2 cipher suites, e.g. TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256.
+	// Defaults to the secure suites of crypto/tls. TLS 1.3 suites are not configurable.
+	CipherSuites []string
+	// ReloadInterval is the minimum time between two checks of the files for changes. Defaults to DefaultReloadInterval.
+	ReloadInterval time.Duration
+}
+
+// ParseVersion returns the TLS version with the given number, 1.2 or 1.3.
+func ParseVersion(version string) (uint16, error) {
+	switch version {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unsupported TLS version: %s", version)
+	}
+}
+
+// ParseCipherSuites returns the IDs of the named cipher suites, which must not be insecure.
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	var ids []uint16
+	for _, name := range names {
+		index := slices.IndexFunc(tls.CipherSuites(), func(suite *tls.CipherSuite) bool { return suite.Name == name })
+		if index < 0 {
+			return nil, fmt.Errorf("unsupported cipher suite: %s", name)
+		}
+		ids = append(ids, tls.CipherSuites()[index].ID)
+	}
+	return ids, nil
+}
+
+// ParseClientAuth returns the client authentication type of the given mode.
+func ParseClientAuth(mode string) (tls.ClientAuthType, error) {
+	switch mode {
+	case "", ClientAuthNone:
+		return tls.NoClientCert, nil
+	case ClientAuthOptional:
+		return tls.VerifyClientCertIfGiven, nil
+	case ClientAuthRequire:
+		return tls.RequireAndVerifyClientCert, nil
+	default:
+		return 0, fmt.Errorf("unsupported client authentication: %s", mode)
+	}
+}
+
+// New loads the files of the options and returns a server configuration that reloads them on change.
+func New(opts Options) (*tls.Config, error) {
+	minVersion, err := ParseVersion(opts.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+	cipherSuites, err := ParseCipherSuites(opts.CipherSuites)
+	if err != nil {
+		return nil, err
+	}
+	clientAuth, err := ParseClientAuth(opts.ClientAuth)
+	if err != nil {
+		return nil, err
+	}
+	if clientAuth != tls.NoClientCert && opts.ClientCAFile == "" {
+		return nil, ErrNoClientCAs
+	}
+	r := &reloader{
+		base: &tls.Config{
+			MinVersion:   minVersion,
+			CipherSuites: cipherSuites,
+			ClientAuth:   clientAuth,
+		},
+		opts:     opts,
+		interval: opts.ReloadInterval,
+	}
+	if r.interval == 0 {
+		r.interval = DefaultReloadInterval
+	}
+	if r.current, err = r.load(); err != nil {
+		return nil, err
+	}
+	r.checked = time.Now()
+	config := r.base.Clone()
+	config.GetConfigForClient = r.configForClient
+	return config, nil
+}
+
+// reloader holds the configuration of the current files and replaces it when a file changes.
+type reloader struct {
+	base     *tls.Config
+	opts     Options
+	interval time.Duration
+
+	lock    sync.Mutex
+	current *loaded
+	checked time.Time
+}
+
+// loaded is the configuration loaded from the files, with the state of the files it was loaded from.
+type loaded struct {
+	config *tls.Config
+	files  []fileState
+}
+
+// fileState identifies a version of a file.
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// configForClient returns the configuration of the current files for every handshake.
+func (r *reloader) configForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if now := time.Now(); now.Sub(r.checked) >= r.interval {
+		r.checked = now
+		if r.changed() {
+			// A failed reload keeps the previous files in use, e.g. while only the certificate was replaced yet.
+			if reloaded, err := r.load(); err != nil {
+				slog.Warn("Could not reload the TLS files, keeping the previous ones", "error", err)
+			} else {
+				r.current = reloaded
+				slog.Info("Reloaded the TLS files")
+			}
+		}
+	}
+	return r.current.config, nil
+}
+
+// changed reports whether any file differs from the files of the current configuration.
+func (r *reloader) changed() bool {
+	files, err := r.stat()
+	return err != nil || !slices.Equal(files, r.current.files)
+}
+
+func (r *reloader) names() []string {
+	names := []string{r.opts.CertificateFile, r.opts.KeyFile}
+	if r.opts.ClientCAFile != "" {
+		names = append(names, r.opts.ClientCAFile)
+	}
+	return names
+}
+
+func (r *reloader) stat() ([]fileState, error) {
+	var files []fileState
+	for _, name := range r.names() {
+		info, err := os.Stat(name)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, fileState{modTime: info.ModTime(), size: info.Size()})
+	}
+	return files, nil
+}
+
+// load reads the files. Their state is taken before reading, so that a change while reading is seen by the next check.
+func (r *reloader) load() (*loaded, error) {
+	files, err := r.stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read TLS files: %w", err)
+	}
+	certificate, err := tls.LoadX509KeyPair(r.opts.CertificateFile, r.opts.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the server certificate: %w", err)
+	}
+	config := r.base.Clone()
+	config.Certificates = []tls.Certificate{certificate}
+	if r.opts.ClientCAFile != "" {
+		pem, err := os.ReadFile(r.opts.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in client CA file %s", r.opts.ClientCAFile)
+		}
+		config.ClientCAs = pool
+	}
+	return &loaded{config: config, files: files}, nil
+}
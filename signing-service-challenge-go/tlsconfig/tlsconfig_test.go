@@ -0,0 +1,306 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// issuer is a CA issuing test certificates.
+type issuer struct {
+	key         *ecdsa.PrivateKey
+	certificate *x509.Certificate
+	pem         []byte
+}
+
+func newIssuer(t *testing.T) *issuer {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	return &issuer{key: key, certificate: certificate, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+func (i *issuer) pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(i.certificate)
+	return pool
+}
+
+// issue returns the PEM encoded certificate and key of a server or client with the given common name.
+func (i *issuer) issue(t *testing.T, commonName string, usage x509.ExtKeyUsage) ([]byte, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName, Organization: []string{"Test"}},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, i.certificate, &key.PublicKey, i.key)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	keyDer, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer})
+}
+
+func (i *issuer) clientCertificate(t *testing.T, commonName string) tls.Certificate {
+	t.Helper()
+	certificatePem, keyPem := i.issue(t, commonName, x509.ExtKeyUsageClientAuth)
+	certificate, err := tls.X509KeyPair(certificatePem, keyPem)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	return certificate
+}
+
+// writeFile writes the file and moves its modification time forward, so that every write is seen as a change.
+func writeFile(t *testing.T, file string, content []byte, generation int) {
+	t.Helper()
+	if err := os.WriteFile(file, content, 0o600); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	modTime := time.Now().Add(time.Duration(generation) * time.Minute)
+	if err := os.Chtimes(file, modTime, modTime); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
+
+// handshake connects a client with the given configuration and returns the server side state of the connection.
+func handshake(t *testing.T, server *tls.Config, client *tls.Config) (tls.ConnectionState, error) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer listener.Close()
+	clientConn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	serverConn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	clientConn.SetDeadline(deadline)
+	serverConn.SetDeadline(deadline)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer clientConn.Close()
+		conn := tls.Client(clientConn, client)
+		if conn.Handshake() == nil {
+			// TLS 1.3 clients learn of a rejected certificate only when reading
+			conn.Read(make([]byte, 1))
+		}
+	}()
+	conn := tls.Server(serverConn, server)
+	err = conn.Handshake()
+	serverConn.Close()
+	<-done
+	return conn.ConnectionState(), err
+}
+
+func TestNew_Reload(t *testing.T) {
+	ca := newIssuer(t)
+	dir := t.TempDir()
+	certificateFile, keyFile := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+	certificatePem, keyPem := ca.issue(t, "one", x509.ExtKeyUsageServerAuth)
+	writeFile(t, certificateFile, certificatePem, 0)
+	writeFile(t, keyFile, keyPem, 0)
+
+	config, err := New(Options{CertificateFile: certificateFile, KeyFile: keyFile, ReloadInterval: time.Nanosecond})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	client := &tls.Config{RootCAs: ca.pool(), ServerName: "localhost"}
+	serverName := func() string {
+		t.Helper()
+		var name string
+		client.VerifyPeerCertificate = func(_ [][]byte, chains [][]*x509.Certificate) error {
+			name = chains[0][0].Subject.CommonName
+			return nil
+		}
+		if _, err := handshake(t, config, client); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		return name
+	}
+	if name := serverName(); name != "one" {
+		t.Fatalf("expected certificate one, got %s", name)
+	}
+
+	certificatePem, keyPem = ca.issue(t, "two", x509.ExtKeyUsageServerAuth)
+	writeFile(t, certificateFile, certificatePem, 1)
+	writeFile(t, keyFile, keyPem, 1)
+	if name := serverName(); name != "two" {
+		t.Fatalf("expected the reloaded certificate two, got %s", name)
+	}
+
+	// a key that does not match the certificate keeps the previous files in use
+	_, keyPem = ca.issue(t, "three", x509.ExtKeyUsageServerAuth)
+	writeFile(t, keyFile, keyPem, 2)
+	if name := serverName(); name != "two" {
+		t.Fatalf("expected the previous certificate two, got %s", name)
+	}
+}
+
+func TestNew_ClientAuth(t *testing.T) {
+	ca, other := newIssuer(t), newIssuer(t)
+	dir := t.TempDir()
+	certificateFile, keyFile, clientCAFile := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key"), filepath.Join(dir, "clients.crt")
+	certificatePem, keyPem := ca.issue(t, "server", x509.ExtKeyUsageServerAuth)
+	writeFile(t, certificateFile, certificatePem, 0)
+	writeFile(t, keyFile, keyPem, 0)
+	writeFile(t, clientCAFile, ca.pem, 0)
+
+	tests := []struct {
+		name       string
+		clientAuth string
+		version    string
+		client     []tls.Certificate
+		expected   string
+		err        bool
+	}{
+		{
+			name:       "Required",
+			clientAuth: ClientAuthRequire,
+			client:     []tls.Certificate{ca.clientCertificate(t, "store-0042")},
+			expected:   "store-0042",
+		},
+		{
+			name:       "Required TLS 1.3",
+			clientAuth: ClientAuthRequire,
+			version:    "1.3",
+			client:     []tls.Certificate{ca.clientCertificate(t, "store-0042")},
+			expected:   "store-0042",
+		},
+		{
+			name:       "Required Missing",
+			clientAuth: ClientAuthRequire,
+			err:        true,
+		},
+		{
+			name:       "Unknown Issuer",
+			clientAuth: ClientAuthOptional,
+			client:     []tls.Certificate{other.clientCertificate(t, "store-0042")},
+			err:        true,
+		},
+		{
+			name:       "Optional Missing",
+			clientAuth: ClientAuthOptional,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config, err := New(Options{
+				CertificateFile: certificateFile,
+				KeyFile:         keyFile,
+				ClientCAFile:    clientCAFile,
+				ClientAuth:      test.clientAuth,
+				MinVersion:      test.version,
+			})
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			state, err := handshake(t, config, &tls.Config{RootCAs: ca.pool(), ServerName: "localhost", Certificates: test.client})
+			if test.err {
+				if err == nil {
+					t.Fatal("expected the handshake to fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			var name string
+			if len(state.VerifiedChains) > 0 {
+				name = state.VerifiedChains[0][0].Subject.CommonName
+			}
+			if name != test.expected {
+				t.Fatalf("expected client %q, got %q", test.expected, name)
+			}
+			if test.version == "1.3" && state.Version != tls.VersionTLS13 {
+				t.Fatalf("expected TLS 1.3, got %x", state.Version)
+			}
+		})
+	}
+}
+
+func TestNew_Invalid(t *testing.T) {
+	ca := newIssuer(t)
+	dir := t.TempDir()
+	certificateFile, keyFile := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+	certificatePem, keyPem := ca.issue(t, "server", x509.ExtKeyUsageServerAuth)
+	writeFile(t, certificateFile, certificatePem, 0)
+	writeFile(t, keyFile, keyPem, 0)
+
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{"Missing Files", Options{CertificateFile: filepath.Join(dir, "missing.crt"), KeyFile: keyFile}},
+		{"No Client CAs", Options{CertificateFile: certificateFile, KeyFile: keyFile, ClientAuth: ClientAuthRequire}},
+		{"Empty Client CAs", Options{CertificateFile: certificateFile, KeyFile: keyFile, ClientAuth: ClientAuthRequire, ClientCAFile: keyFile}},
+		{"Client Auth", Options{CertificateFile: certificateFile, KeyFile: keyFile, ClientAuth: "sometimes"}},
+		{"Version", Options{CertificateFile: certificateFile, KeyFile: keyFile, MinVersion: "1.1"}},
+		{"Cipher Suite", Options{CertificateFile: certificateFile, KeyFile: keyFile, CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := New(test.opts); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+	if _, err := New(tests[1].opts); !errors.Is(err, ErrNoClientCAs) {
+		t.Fatalf("expected error %v, got %v", ErrNoClientCAs, err)
+	}
+}
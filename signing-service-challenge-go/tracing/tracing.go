@@ -0,0 +1,120 @@
+// Package tracing sets up the OpenTelemetry traces of the signing service. The packages of the service
+// create their spans with the global tracer provider, which records nothing until Setup installs an exporter.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// ExporterNone records no spans, trace context is still propagated.
+	ExporterNone = "none"
+	// ExporterOTLP sends spans to an OpenTelemetry collector with OTLP over HTTP.
+	ExporterOTLP = "otlp"
+	// ExporterStdout writes spans as JSON, one per line, for local testing.
+	ExporterStdout = "stdout"
+)
+
+// ServiceName identifies the spans of the signing service.
+const ServiceName = "signing-service"
+
+// ErrUnknownExporter indicates an exporter that is neither none, otlp nor stdout.
+var ErrUnknownExporter = errors.New("unknown trace exporter")
+
+// Options configure the export of spans.
+type Options struct {
+	// Exporter is ExporterNone, ExporterOTLP or ExporterStdout.
+	Exporter string
+	// Endpoint is the URL of the collector the OTLP exporter sends spans to, e.g. http://localhost:4318.
+	// If empty, the OTEL_EXPORTER_OTLP_ENDPOINT environment variable or the default of the exporter is used.
+	Endpoint string
+	// File is the file the stdout exporter appends spans to, standard output if empty.
+	File string
+	// SampleRatio is the fraction of traces recorded, unless the caller of a request decided for its trace.
+	SampleRatio float64
+}
+
+// Setup installs the global tracer provider exporting spans as configured and the propagator of W3C trace
+// context. The returned function flushes the remaining spans and releases the exporter, it must be called
+// before the service exits.
+func Setup(ctx context.Context, options Options) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	exporter, err := newExporter(ctx, options)
+	if err != nil || exporter == nil {
+		return func(context.Context) error { return nil }, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(options.SampleRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(ServiceName))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// newExporter creates the configured exporter, nil for ExporterNone.
+func newExporter(ctx context.Context, options Options) (sdktrace.SpanExporter, error) {
+	switch strings.ToLower(options.Exporter) {
+	case ExporterNone, "":
+		return nil, nil
+	case ExporterOTLP:
+		var opts []otlptracehttp.Option
+		if options.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpointURL(options.Endpoint))
+		}
+		exporter, err := otlptracehttp.New(ctx, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+		}
+		return exporter, nil
+	case ExporterStdout:
+		if options.File == "" {
+			return stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		}
+		file, err := os.OpenFile(options.File, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open trace file: %w", err)
+		}
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		return &fileExporter{SpanExporter: exporter, file: file}, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownExporter, options.Exporter)
+	}
+}
+
+// fileExporter closes the file it writes to on shutdown.
+type fileExporter struct {
+	sdktrace.SpanExporter
+	file *os.File
+}
+
+func (e *fileExporter) Shutdown(ctx context.Context) error {
+	return errors.Join(e.SpanExporter.Shutdown(ctx), e.file.Close())
+}
+
+// End ends a span, marking it as failed if err is not nil.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
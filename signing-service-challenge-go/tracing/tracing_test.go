@@ -0,0 +1,89 @@
+package tracing_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/tracing"
+)
+
+func TestSetup(t *testing.T) {
+	tests := []struct {
+		exporter string
+		err      error
+	}{
+		{exporter: "none"},
+		{exporter: ""},
+		{exporter: "OTLP"},
+		{exporter: "jaeger", err: tracing.ErrUnknownExporter},
+	}
+	for _, test := range tests {
+		t.Run(test.exporter, func(t *testing.T) {
+			shutdown, err := tracing.Setup(context.Background(), tracing.Options{Exporter: test.exporter, SampleRatio: 1})
+			if !errors.Is(err, test.err) {
+				t.Fatalf("expected error %v, got %v", test.err, err)
+			}
+			if err = shutdown(context.Background()); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestSetup_File(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "spans.json")
+	shutdown, err := tracing.Setup(context.Background(), tracing.Options{Exporter: tracing.ExporterStdout, File: file, SampleRatio: 0})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// the caller sampled the trace, which overrides the sample ratio
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	header := http.Header{}
+	header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), propagation.HeaderCarrier(header))
+	_, span := otel.Tracer("test").Start(ctx, "request")
+	tracing.End(span, errors.New("failed"))
+	// a new trace is not sampled
+	_, span = otel.Tracer("test").Start(context.Background(), "unsampled")
+	if span.SpanContext().IsSampled() {
+		t.Fatalf("expected the trace not to be sampled")
+	}
+	tracing.End(span, nil)
+	if err = shutdown(context.Background()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected one span, got %s", data)
+	}
+	var exported struct {
+		Name        string
+		SpanContext struct{ TraceID string }
+		Status      struct{ Code string }
+	}
+	if err = json.Unmarshal([]byte(lines[0]), &exported); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if exported.Name != "request" || exported.SpanContext.TraceID != traceID || exported.Status.Code != "Error" {
+		t.Fatalf("expected the failed span of trace %s, got %s", traceID, lines[0])
+	}
+	if trace.SpanContextFromContext(ctx).TraceID().String() != traceID {
+		t.Fatalf("expected the trace context to be propagated")
+	}
+}
@@ -0,0 +1,312 @@
+package tsa
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/cms"
+)
+
+const (
+	// ContentTypeQuery is the media type of time-stamp requests (RFC 3161, section 3.4).
+	ContentTypeQuery = "application/timestamp-query"
+	// ContentTypeReply is the media type of time-stamp responses (RFC 3161, section 3.4).
+	ContentTypeReply = "application/timestamp-reply"
+
+	maxRequestSize = 64 * 1024
+)
+
+var (
+	oidExtKeyUsage = asn1.ObjectIdentifier{2, 5, 29, 37}
+	// extKeyUsageTimeStamping is the DER encoded extended key usage extension value for id-kp-timeStamping.
+	extKeyUsageTimeStamping = []byte{0x30, 0x0a, 0x06, 0x08, 0x2b, 0x06, 0x01, 0x05, 0x05, 0x07, 0x03, 0x08}
+)
+
+// DefaultPolicy is the TSA policy used by the built-in Authority unless another one is configured.
+// It is the example policy of the OpenSSL TSA and only meant for local setups.
+var DefaultPolicy = asn1.ObjectIdentifier{1, 2, 3, 4, 1}
+
+// Authority is a minimal RFC 3161 Time Stamping Authority with its own key and certificate.
+// It can be used in-process or served over HTTP as a stand-in for an external TSA.
+type Authority struct {
+	key                crypto.Signer
+	certificate        *x509.Certificate
+	hash               crypto.Hash
+	signatureAlgorithm x509.SignatureAlgorithm
+	policy             asn1.ObjectIdentifier
+	now                func() time.Time
+}
+
+// NewAuthority creates an Authority signing tokens with the given key under the given policy.
+// The certificate must belong to the key and be restricted to the time stamping extended key usage.
+func NewAuthority(key crypto.Signer, certificate *x509.Certificate, policy asn1.ObjectIdentifier) (*Authority, error) {
+	publicKey, ok := key.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !publicKey.Equal(certificate.PublicKey) {
+		return nil, errors.New("certificate does not match the TSA key")
+	}
+	if !slices.Equal(certificate.ExtKeyUsage, []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping}) {
+		return nil, errors.New("TSA certificate must only have the time stamping extended key usage")
+	}
+	hash, signatureAlgorithm, err := algorithmsForKey(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	if policy == nil {
+		policy = DefaultPolicy
+	}
+	return &Authority{
+		key:                key,
+		certificate:        certificate,
+		hash:               hash,
+		signatureAlgorithm: signatureAlgorithm,
+		policy:             policy,
+		now:                time.Now,
+	}, nil
+}
+
+// LoadFiles creates an Authority from a PEM encoded private key and a PEM encoded certificate.
+// The first certificate in the file must be the TSA certificate, further certificates are ignored.
+func LoadFiles(keyFile string, certificateFile string) (*Authority, error) {
+	keyPem, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read TSA key: %w", err)
+	}
+	certificatePem, err := os.ReadFile(certificateFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read TSA certificate: %w", err)
+	}
+	key, err := parsePrivateKey(keyPem)
+	if err != nil {
+		return nil, err
+	}
+	for block, rest := pem.Decode(certificatePem); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse TSA certificate: %w", err)
+		}
+		return NewAuthority(key, certificate, DefaultPolicy)
+	}
+	return nil, errors.New("TSA certificate file contains no certificate")
+}
+
+// GenerateAuthority creates an Authority with a fresh ECDSA key and a self-signed certificate.
+// Nothing persists the key, tokens of a generated Authority cannot be verified against the
+// certificate of the next one, so it is only meant for tests and local setups.
+func GenerateAuthority(commonName string) (*Authority, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate TSA key: %w", err)
+	}
+	serialNumber, err := randomSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		// RFC 3161 requires the extended key usage to be critical, which crypto/x509 does not do on its own.
+		ExtraExtensions: []pkix.Extension{{Id: oidExtKeyUsage, Critical: true, Value: extKeyUsageTimeStamping}},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create TSA certificate: %w", err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return NewAuthority(key, certificate, DefaultPolicy)
+}
+
+// parsePrivateKey parses a PEM encoded EC, PKCS #1 or PKCS #8 private key.
+func parsePrivateKey(keyPem []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(keyPem)
+	if block == nil {
+		return nil, errors.New("TSA key is not PEM encoded")
+	}
+	var key any
+	var err error
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse TSA key: %w", err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported TSA key type %T", key)
+	}
+	return signer, nil
+}
+
+// Certificate returns the certificate of the Authority.
+func (a *Authority) Certificate() *x509.Certificate {
+	return a.certificate
+}
+
+// Timestamp issues a timestamp token over the SHA-256 digest of data.
+func (a *Authority) Timestamp(_ context.Context, data []byte) ([]byte, error) {
+	digest := sha256.Sum256(data)
+	return a.issue(messageImprint{
+		HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA256},
+		HashedMessage: digest[:],
+	}, nil, true)
+}
+
+// Respond answers a DER encoded time-stamp request with a DER encoded time-stamp response.
+// Invalid requests are answered with a rejection rather than an error.
+func (a *Authority) Respond(request []byte) ([]byte, error) {
+	var req timeStampReq
+	if rest, err := asn1.Unmarshal(request, &req); err != nil || len(rest) > 0 || req.Version != 1 {
+		return rejection(failureBadDataFormat, "malformed time-stamp request")
+	}
+	hash, ok := hashFromOID(req.MessageImprint.HashAlgorithm.Algorithm)
+	if !ok {
+		return rejection(failureBadAlg, "unsupported hash algorithm")
+	}
+	if len(req.MessageImprint.HashedMessage) != hash.Size() {
+		return rejection(failureBadRequest, "message imprint does not match the hash algorithm")
+	}
+	if req.ReqPolicy != nil && !req.ReqPolicy.Equal(a.policy) {
+		return rejection(failureUnacceptedPolicy, "requested policy is not supported")
+	}
+	token, err := a.issue(req.MessageImprint, req.Nonce, req.CertReq)
+	if err != nil {
+		return rejection(failureSystemFailure, "failed to issue time-stamp token")
+	}
+	return asn1.Marshal(timeStampResp{
+		Status:         pkiStatusInfo{Status: statusGranted},
+		TimeStampToken: asn1.RawValue{FullBytes: token},
+	})
+}
+
+// ServeHTTP implements the HTTP transport of RFC 3161, section 3.4.
+func (a *Authority) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		http.Error(response, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if request.Header.Get("Content-Type") != ContentTypeQuery {
+		http.Error(response, http.StatusText(http.StatusUnsupportedMediaType), http.StatusUnsupportedMediaType)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(request.Body, maxRequestSize))
+	if err != nil {
+		http.Error(response, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	reply, err := a.Respond(body)
+	if err != nil {
+		http.Error(response, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	response.Header().Set("Content-Type", ContentTypeReply)
+	response.WriteHeader(http.StatusOK)
+	response.Write(reply)
+}
+
+// issue creates a signed timestamp token for the given message imprint.
+func (a *Authority) issue(imprint messageImprint, nonce *big.Int, includeCertificate bool) ([]byte, error) {
+	serialNumber, err := randomSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+	info, err := asn1.Marshal(tstInfo{
+		Version:        1,
+		Policy:         a.policy,
+		MessageImprint: imprint,
+		SerialNumber:   serialNumber,
+		GenTime:        a.now().UTC(),
+		Accuracy:       accuracy{Seconds: 1},
+		Nonce:          nonce,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode TSTInfo: %w", err)
+	}
+	certificateHash := sha256.Sum256(a.certificate.Raw)
+	return cms.Sign(info, cms.NewSigner(a.key, a.hash), cms.Options{
+		ContentType:         oidTSTInfo,
+		Hash:                a.hash,
+		SignatureAlgorithm:  a.signatureAlgorithm,
+		Certificate:         a.certificate,
+		ExcludeCertificates: !includeCertificate,
+		Attributes: []cms.Attribute{{
+			Type:  oidSigningCertificateV2,
+			Value: signingCertificateV2{Certs: []essCertIDv2{{CertHash: certificateHash[:]}}},
+		}},
+	})
+}
+
+// rejection encodes a time-stamp response rejecting the request.
+func rejection(failure int, reason string) ([]byte, error) {
+	// DER requires the bit string to end with the highest set bit.
+	failInfo := asn1.BitString{Bytes: make([]byte, failure/8+1), BitLength: failure + 1}
+	failInfo.Bytes[failure/8] = 0x80 >> (failure % 8)
+	return asn1.Marshal(timeStampResp{
+		Status: pkiStatusInfo{
+			Status:       statusRejection,
+			StatusString: []string{reason},
+			FailInfo:     failInfo,
+		},
+	})
+}
+
+// algorithmsForKey selects the digest and signature algorithm for a TSA key.
+func algorithmsForKey(publicKey crypto.PublicKey) (crypto.Hash, x509.SignatureAlgorithm, error) {
+	switch key := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		switch key.Curve {
+		case elliptic.P256():
+			return crypto.SHA256, x509.ECDSAWithSHA256, nil
+		case elliptic.P384():
+			return crypto.SHA384, x509.ECDSAWithSHA384, nil
+		case elliptic.P521():
+			return crypto.SHA512, x509.ECDSAWithSHA512, nil
+		}
+	case *rsa.PublicKey:
+		return crypto.SHA256, x509.SHA256WithRSA, nil
+	case ed25519.PublicKey:
+		return crypto.SHA512, x509.PureEd25519, nil
+	}
+	return 0, x509.UnknownSignatureAlgorithm, fmt.Errorf("unsupported TSA key type %T", publicKey)
+}
+
+// randomSerialNumber returns a random positive 128 bit serial number.
+func randomSerialNumber() (*big.Int, error) {
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+	return serialNumber, nil
+}
@@ -0,0 +1,225 @@
+package tsa
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAuthority_Timestamp(t *testing.T) {
+	authority, err := GenerateAuthority("Test TSA")
+	if err != nil {
+		t.Fatalf("failed to create authority: %v", err)
+	}
+	genTime := time.Now().UTC().Truncate(time.Second)
+	authority.now = func() time.Time { return genTime }
+	roots := x509.NewCertPool()
+	roots.AddCert(authority.Certificate())
+
+	token, err := authority.Timestamp(context.Background(), []byte("signature"))
+	if err != nil {
+		t.Fatalf("failed to issue token: %v", err)
+	}
+	info, err := Verify(token, []byte("signature"), roots)
+	if err != nil {
+		t.Fatalf("expected token to verify, got %v", err)
+	}
+	if !info.Time.Equal(genTime) {
+		t.Fatalf("expected time %s, got %s", genTime, info.Time)
+	}
+	if !info.Policy.Equal(DefaultPolicy) {
+		t.Fatalf("expected policy %s, got %s", DefaultPolicy, info.Policy)
+	}
+	if _, err = Verify(token, []byte("another signature"), roots); !errors.Is(err, ErrImprintMismatch) {
+		t.Fatalf("expected %q, got %v", ErrImprintMismatch, err)
+	}
+
+	other, err := GenerateAuthority("Other TSA")
+	if err != nil {
+		t.Fatalf("failed to create authority: %v", err)
+	}
+	untrusted := x509.NewCertPool()
+	untrusted.AddCert(other.Certificate())
+	if _, err = Verify(token, []byte("signature"), untrusted); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("expected %q for untrusted TSA, got %v", ErrInvalidToken, err)
+	}
+}
+
+func TestLoadFiles(t *testing.T) {
+	generated, err := GenerateAuthority("Test TSA")
+	if err != nil {
+		t.Fatalf("failed to create authority: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(generated.key)
+	if err != nil {
+		t.Fatalf("failed to encode key: %v", err)
+	}
+	dir := t.TempDir()
+	keyFile, certificateFile := filepath.Join(dir, "tsa.key"), filepath.Join(dir, "tsa.crt")
+	if err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+	if err = os.WriteFile(certificateFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: generated.Certificate().Raw}), 0o600); err != nil {
+		t.Fatalf("failed to write certificate: %v", err)
+	}
+
+	// a restarted service keeps issuing tokens that verify against the same certificate
+	loaded, err := LoadFiles(keyFile, certificateFile)
+	if err != nil {
+		t.Fatalf("failed to load authority: %v", err)
+	}
+	token, err := loaded.Timestamp(context.Background(), []byte("signature"))
+	if err != nil {
+		t.Fatalf("failed to issue token: %v", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(generated.Certificate())
+	if _, err = Verify(token, []byte("signature"), roots); err != nil {
+		t.Fatalf("expected token to verify, got %v", err)
+	}
+
+	if _, err = LoadFiles(certificateFile, certificateFile); err == nil {
+		t.Fatal("expected an error for a certificate in place of the key")
+	}
+}
+
+func TestClient_Timestamp(t *testing.T) {
+	authority, err := GenerateAuthority("Test TSA")
+	if err != nil {
+		t.Fatalf("failed to create authority: %v", err)
+	}
+	server := httptest.NewServer(authority)
+	defer server.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(authority.Certificate())
+
+	token, err := NewClient(server.URL, roots).Timestamp(context.Background(), []byte("signature"))
+	if err != nil {
+		t.Fatalf("failed to obtain token: %v", err)
+	}
+	info, err := Verify(token, []byte("signature"), roots)
+	if err != nil {
+		t.Fatalf("expected token to verify, got %v", err)
+	}
+	if info.Nonce == nil {
+		t.Fatal("expected the token to carry the request nonce")
+	}
+}
+
+func TestClient_UntrustedAuthority(t *testing.T) {
+	authority, err := GenerateAuthority("Test TSA")
+	if err != nil {
+		t.Fatalf("failed to create authority: %v", err)
+	}
+	other, err := GenerateAuthority("Other TSA")
+	if err != nil {
+		t.Fatalf("failed to create authority: %v", err)
+	}
+	server := httptest.NewServer(authority)
+	defer server.Close()
+	file := filepath.Join(t.TempDir(), "roots.pem")
+	if err = os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: other.Certificate().Raw}), 0o600); err != nil {
+		t.Fatalf("failed to write roots: %v", err)
+	}
+	roots, err := LoadRoots(file)
+	if err != nil {
+		t.Fatalf("failed to load roots: %v", err)
+	}
+
+	// a token of a TSA that does not chain up to the roots is rejected, despite its time stamping usage
+	if _, err = NewClient(server.URL, roots).Timestamp(context.Background(), []byte("signature")); err == nil {
+		t.Fatal("expected an error for a TSA outside the roots")
+	}
+	if _, err = LoadRoots(filepath.Join(t.TempDir(), "missing.pem")); err == nil {
+		t.Fatal("expected an error for a missing roots file")
+	}
+}
+
+func TestAuthority_Respond(t *testing.T) {
+	authority, err := GenerateAuthority("Test TSA")
+	if err != nil {
+		t.Fatalf("failed to create authority: %v", err)
+	}
+	digest := sha256.Sum256([]byte("signature"))
+
+	tests := []struct {
+		name       string
+		request    timeStampReq
+		wantStatus int
+		wantCert   bool
+	}{
+		{
+			name: "Granted Without Certificate",
+			request: timeStampReq{
+				Version:        1,
+				MessageImprint: messageImprint{HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA256}, HashedMessage: digest[:]},
+				Nonce:          big.NewInt(7),
+			},
+			wantStatus: statusGranted,
+		},
+		{
+			name: "Granted With Certificate",
+			request: timeStampReq{
+				Version:        1,
+				MessageImprint: messageImprint{HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA256}, HashedMessage: digest[:]},
+				CertReq:        true,
+			},
+			wantStatus: statusGranted,
+			wantCert:   true,
+		},
+		{
+			name: "Unknown Hash Algorithm",
+			request: timeStampReq{
+				Version:        1,
+				MessageImprint: messageImprint{HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 3}}, HashedMessage: digest[:]},
+			},
+			wantStatus: statusRejection,
+		},
+		{
+			name: "Unaccepted Policy",
+			request: timeStampReq{
+				Version:        1,
+				MessageImprint: messageImprint{HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA256}, HashedMessage: digest[:]},
+				ReqPolicy:      asn1.ObjectIdentifier{1, 2, 3},
+			},
+			wantStatus: statusRejection,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request, err := asn1.Marshal(test.request)
+			if err != nil {
+				t.Fatalf("failed to encode request: %v", err)
+			}
+			reply, err := authority.Respond(request)
+			if err != nil {
+				t.Fatalf("failed to respond: %v", err)
+			}
+			var response timeStampResp
+			if _, err = asn1.Unmarshal(reply, &response); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if response.Status.Status != test.wantStatus {
+				t.Fatalf("expected status %d, got %d", test.wantStatus, response.Status.Status)
+			}
+			if test.wantStatus != statusGranted {
+				return
+			}
+			embedsCertificate := bytes.Contains(response.TimeStampToken.FullBytes, authority.Certificate().Raw)
+			if embedsCertificate != test.wantCert {
+				t.Fatalf("expected certificate embedded to be %t, got %t", test.wantCert, embedsCertificate)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package tsa
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+var ErrRequestRejected = errors.New("timestamp request rejected")
+
+var statusTexts = map[int]string{
+	statusRejection:              "rejection",
+	statusWaiting:                "waiting",
+	statusRevocationWarning:      "revocation warning",
+	statusRevocationNotification: "revocation notification",
+}
+
+// Client obtains timestamp tokens from a remote Time Stamping Authority over HTTP (RFC 3161, section 3.4).
+type Client struct {
+	url        string
+	httpClient *http.Client
+	hash       crypto.Hash
+	roots      *x509.CertPool
+}
+
+// NewClient creates a Client for the TSA at the given URL. If roots is not nil, the TSA
+// certificate of every token has to chain up to one of them.
+func NewClient(url string, roots *x509.CertPool) *Client {
+	return &Client{
+		url:        url,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		hash:       crypto.SHA256,
+		roots:      roots,
+	}
+}
+
+// LoadRoots reads the PEM encoded root certificates the TSA certificate of a Client must chain up to.
+func LoadRoots(file string) (*x509.CertPool, error) {
+	roots, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read TSA roots: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(roots) {
+		return nil, fmt.Errorf("no certificate found in TSA roots file %s", file)
+	}
+	return pool, nil
+}
+
+// Timestamp requests a timestamp token over data and verifies it before returning it.
+func (c *Client) Timestamp(ctx context.Context, data []byte) ([]byte, error) {
+	hashOID, _ := hashAlgorithmOID(c.hash)
+	hasher := c.hash.New()
+	hasher.Write(data)
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	request, err := asn1.Marshal(timeStampReq{
+		Version: 1,
+		MessageImprint: messageImprint{
+			HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: hashOID},
+			HashedMessage: hasher.Sum(nil),
+		},
+		Nonce:   nonce,
+		CertReq: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode timestamp request: %w", err)
+	}
+
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(request))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create timestamp request: %w", err)
+	}
+	httpRequest.Header.Set("Content-Type", ContentTypeQuery)
+	httpResponse, err := c.httpClient.Do(httpRequest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to contact TSA: %w", err)
+	}
+	defer httpResponse.Body.Close()
+	if httpResponse.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("TSA responded with HTTP status %d", httpResponse.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(httpResponse.Body, maxRequestSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read TSA response: %w", err)
+	}
+
+	var response timeStampResp
+	if rest, err := asn1.Unmarshal(body, &response); err != nil || len(rest) > 0 {
+		return nil, fmt.Errorf("%w: malformed timestamp response", ErrInvalidToken)
+	}
+	if response.Status.Status != statusGranted && response.Status.Status != statusGrantedWithMods {
+		status, ok := statusTexts[response.Status.Status]
+		if !ok {
+			status = fmt.Sprintf("status %d", response.Status.Status)
+		}
+		return nil, fmt.Errorf("%w: %s %s", ErrRequestRejected, status, strings.Join(response.Status.StatusString, ", "))
+	}
+
+	token := response.TimeStampToken.FullBytes
+	info, err := Verify(token, data, c.roots)
+	if err != nil {
+		return nil, err
+	}
+	if info.Nonce == nil || info.Nonce.Cmp(nonce) != 0 {
+		return nil, fmt.Errorf("%w: nonce does not match the request", ErrInvalidToken)
+	}
+	return token, nil
+}
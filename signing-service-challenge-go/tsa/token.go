@@ -0,0 +1,128 @@
+package tsa
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/cms"
+)
+
+var (
+	ErrInvalidToken    = errors.New("invalid timestamp token")
+	ErrImprintMismatch = errors.New("timestamp token does not cover the given data")
+)
+
+// Info holds the verified content of a timestamp token.
+type Info struct {
+	// Time at which the TSA produced the token.
+	Time time.Time
+	// Accuracy of Time as claimed by the TSA.
+	Accuracy time.Duration
+	// SerialNumber is unique per token issued by the TSA.
+	SerialNumber *big.Int
+	// Policy under which the token was issued.
+	Policy asn1.ObjectIdentifier
+	// Nonce of the request, nil if the request had none.
+	Nonce *big.Int
+	// Certificate of the TSA that signed the token.
+	Certificate *x509.Certificate
+}
+
+// Verify checks that the token is a valid timestamp token over data. The token must embed
+// the TSA certificate. If roots is not nil, the certificate must chain up to one of them.
+func Verify(token []byte, data []byte, roots *x509.CertPool) (*Info, error) {
+	signedData, err := cms.Parse(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	if !signedData.ContentType.Equal(oidTSTInfo) {
+		return nil, fmt.Errorf("%w: unexpected content type %s", ErrInvalidToken, signedData.ContentType)
+	}
+	var info tstInfo
+	if rest, err := asn1.Unmarshal(signedData.Content, &info); err != nil || len(rest) > 0 {
+		return nil, fmt.Errorf("%w: malformed TSTInfo", ErrInvalidToken)
+	}
+
+	hash, ok := hashFromOID(info.MessageImprint.HashAlgorithm.Algorithm)
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported imprint algorithm %s", ErrInvalidToken, info.MessageImprint.HashAlgorithm.Algorithm)
+	}
+	hasher := hash.New()
+	hasher.Write(data)
+	if !bytes.Equal(hasher.Sum(nil), info.MessageImprint.HashedMessage) {
+		return nil, ErrImprintMismatch
+	}
+
+	certificate, err := signedData.Verify(nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	if err = checkSigningCertificate(signedData, certificate); err != nil {
+		return nil, err
+	}
+	if !slices.Contains(certificate.ExtKeyUsage, x509.ExtKeyUsageTimeStamping) {
+		return nil, fmt.Errorf("%w: certificate is not allowed to issue timestamps", ErrInvalidToken)
+	}
+	if roots != nil {
+		intermediates := x509.NewCertPool()
+		for _, embedded := range signedData.Certificates {
+			intermediates.AddCert(embedded)
+		}
+		_, err = certificate.Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			CurrentTime:   info.GenTime,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+		}
+	}
+
+	return &Info{
+		Time: info.GenTime,
+		Accuracy: time.Duration(info.Accuracy.Seconds)*time.Second +
+			time.Duration(info.Accuracy.Millis)*time.Millisecond +
+			time.Duration(info.Accuracy.Micros)*time.Microsecond,
+		SerialNumber: info.SerialNumber,
+		Policy:       info.Policy,
+		Nonce:        info.Nonce,
+		Certificate:  certificate,
+	}, nil
+}
+
+// checkSigningCertificate ensures the ESS signing certificate attribute references the signer certificate,
+// which prevents substituting the certificate in the token.
+func checkSigningCertificate(signedData *cms.SignedData, certificate *x509.Certificate) error {
+	var attribute signingCertificateV2
+	found, err := signedData.Attribute(oidSigningCertificateV2, &attribute)
+	if err != nil {
+		return fmt.Errorf("%w: malformed signing certificate attribute", ErrInvalidToken)
+	}
+	if !found {
+		// RFC 3161 tokens may use the older signingCertificate attribute instead, which is not checked.
+		return nil
+	}
+	for _, id := range attribute.Certs {
+		hash := crypto.SHA256
+		if id.HashAlgorithm.Algorithm != nil {
+			var ok bool
+			if hash, ok = hashFromOID(id.HashAlgorithm.Algorithm); !ok {
+				continue
+			}
+		}
+		hasher := hash.New()
+		hasher.Write(certificate.Raw)
+		if bytes.Equal(hasher.Sum(nil), id.CertHash) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: signing certificate attribute does not match the signer", ErrInvalidToken)
+}
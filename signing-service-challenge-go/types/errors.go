@@ -8,4 +8,21 @@ var (
 	ErrUnknownSigningAlgorithm = errors.New("unknown signing algorithm")
 	ErrDeviceNotFound          = errors.New("device with given ID does not exist")
 	ErrDeviceAlreadyExists     = errors.New("device with given ID already exist")
+	ErrClockMovedBackwards     = errors.New("clock moved backwards since the last signature")
+	ErrCertificateNotFound     = errors.New("device has no certificate")
+	ErrNoCertificateAuthority  = errors.New("no certificate authority configured")
+	ErrInvalidCertificate      = errors.New("invalid certificate")
+	ErrUnknownSignatureFormat  = errors.New("unknown signature format")
+	ErrSignatureNotFound       = errors.New("signature with given counter does not exist")
+	// ErrSignatureCounterConflict indicates that a signature counter was already used by another signature.
+	ErrSignatureCounterConflict = errors.New("signature counter conflict")
+	ErrOrganizationNotFound     = errors.New("organization with given ID does not exist")
+	ErrOrganizationExists       = errors.New("organization with given ID already exists")
+	ErrInvalidOrganization      = errors.New("invalid organization")
+	// ErrDeviceQuotaExceeded indicates that an organization already has as many devices as it may have.
+	ErrDeviceQuotaExceeded = errors.New("device quota of the organization exceeded")
+	// ErrTimestampUnavailable indicates that the Time Stamping Authority did not issue a token in time.
+	ErrTimestampUnavailable = errors.New("timestamp authority did not respond in time")
+	// ErrSignatureFormatUnsupportedByKey indicates that the key of a device cannot produce signatures in a known format.
+	ErrSignatureFormatUnsupportedByKey = errors.New("signature format not supported by the device key")
 )
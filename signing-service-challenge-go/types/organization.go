@@ -0,0 +1,16 @@
+package types
+
+import "time"
+
+// DefaultOrganizationID is the organization operating the service. It owns the devices created before
+// organizations existed, and its administrators manage all other organizations.
+const DefaultOrganizationID = "default"
+
+// Organization is a tenant of the service. Its devices and API keys are isolated from other organizations.
+type Organization struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// MaxDevices limits the number of devices of the organization, 0 means unlimited.
+	MaxDevices int       `json:"max_devices"`
+	CreatedAt  time.Time `json:"created_at"`
+}
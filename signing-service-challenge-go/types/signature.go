@@ -1 +1,16 @@
 package types
+
+import "time"
+
+// Signature is a single entry of a device's signature chain.
+type Signature struct {
+	Counter    uint32    `json:"counter"`
+	Value      []byte    `json:"signature"`
+	SignedData []byte    `json:"signed_data"`
+	Timestamp  time.Time `json:"timestamp"`
+	// Format of the signature. Except for FormatCMS, the Value is computed over the signing input of the Envelope.
+	Format   SignatureFormat `json:"format,omitempty"`
+	Envelope []byte          `json:"envelope,omitempty"`
+	// TimestampToken is an RFC 3161 timestamp token over Value, if a Time Stamping Authority is configured.
+	TimestampToken []byte `json:"timestamp_token,omitempty"`
+}
@@ -1,11 +1,42 @@
 package types
 
+import (
+	"log/slog"
+	"time"
+)
+
 // SignatureDevice represents a device that can sign data using a specific signing algorithm.
+// Its signatures are stored separately, the device only refers to the latest one.
 type SignatureDevice struct {
-	ID                 string
-	Algorithm          SigningAlgorithm
-	Label              string
-	Counter            uint32
-	PkPem              []byte
-	PreviousSignatures map[uint32][]byte // counter -> signature mapping
+	ID          string
+	Algorithm   SigningAlgorithm
+	Label       string
+	Counter     uint32
+	PkPem       []byte
+	Certificate []byte // DER encoded X.509 certificate of the public key, if one was issued
+	// LastSignature is the value of the signature with counter Counter-1, nil before the first signature.
+	LastSignature []byte
+	// LastSignedAt is the timestamp of the last signature.
+	LastSignedAt time.Time
+	// OrganizationID is the organization owning the device, empty for devices created before organizations existed,
+	// which belong to the default organization.
+	OrganizationID string
+}
+
+// Organization returns the ID of the organization owning the device.
+func (d *SignatureDevice) Organization() string {
+	if d.OrganizationID == "" {
+		return DefaultOrganizationID
+	}
+	return d.OrganizationID
+}
+
+// LogValue logs a device by its attributes, never by its private key.
+func (d *SignatureDevice) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("id", d.ID),
+		slog.String("algorithm", string(d.Algorithm)),
+		slog.Uint64("counter", uint64(d.Counter)),
+		slog.String("organization_id", d.Organization()),
+	)
 }
@@ -0,0 +1,18 @@
+package types
+
+// SignatureFormat is the representation in which a signature is returned to the client.
+type SignatureFormat string
+
+const (
+	// FormatRaw is the plain signature over the secured data.
+	FormatRaw SignatureFormat = "raw"
+	// FormatJWS is a compact serialized JWS with the secured data as payload.
+	FormatJWS SignatureFormat = "jws"
+	// FormatJWSDetached is a compact serialized JWS with the unencoded secured data as detached payload.
+	FormatJWSDetached SignatureFormat = "jws-detached"
+	// FormatCOSE is a tagged COSE_Sign1 structure with the secured data as payload.
+	FormatCOSE SignatureFormat = "cose"
+	// FormatCMS is a detached CMS SignedData over a document. Unlike the other formats, the signature
+	// value is a plain signature over the secured data, which covers the document by its digest.
+	FormatCMS SignatureFormat = "cms"
+)
@@ -3,13 +3,20 @@ package types
 type SigningAlgorithm string
 
 const (
-	ECC SigningAlgorithm = "ECC"
-	RSA SigningAlgorithm = "RSA"
+	ECC     SigningAlgorithm = "ECC"
+	RSA     SigningAlgorithm = "RSA"
+	RSAPSS  SigningAlgorithm = "RSA-PSS"
+	Ed25519 SigningAlgorithm = "ED25519"
 )
 
+// SigningAlgorithms returns all allowed signing algorithms.
+func SigningAlgorithms() []SigningAlgorithm {
+	return []SigningAlgorithm{ECC, RSA, RSAPSS, Ed25519}
+}
+
 func IsAllowedSigningAlgorithm(algorithm SigningAlgorithm) bool {
 	switch algorithm {
-	case ECC, RSA:
+	case ECC, RSA, RSAPSS, Ed25519:
 		return true
 	default:
 		return false